@@ -0,0 +1,675 @@
+package ble
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// the ATT opcodes, Bluetooth Core Specification Vol 3 Part F
+const (
+	attErrorResponse          = 0x01
+	attMTURequest             = 0x02
+	attMTUResponse            = 0x03
+	attFindInformationRequest = 0x04
+	attFindInformation        = 0x05
+	attFindByTypeValueRequest = 0x06
+	attFindByTypeValue        = 0x07
+	attReadByTypeRequest      = 0x08
+	attReadByType             = 0x09
+	attReadRequest            = 0x0A
+	attRead                   = 0x0B
+	attReadBlobRequest        = 0x0C
+	attReadBlob               = 0x0D
+	attReadByGroupTypeRequest = 0x10
+	attReadByGroupType        = 0x11
+	attWriteRequest           = 0x12
+	attWrite                  = 0x13
+	attNotification           = 0x1B
+	attIndication             = 0x1D
+	attConfirmation           = 0x1E
+	attWriteCommand           = 0x52
+
+	attCommand = 0x40 // set on the opcodes not answered
+)
+
+// the ATT error codes
+const (
+	errInvalidHandle            = 0x01
+	errReadNotPermitted         = 0x02
+	errWriteNotPermitted        = 0x03
+	errInvalidPDU               = 0x04
+	errRequestNotSupported      = 0x06
+	errInvalidOffset            = 0x07
+	errAttributeNotFound        = 0x0A
+	errInvalidLength            = 0x0D
+	errUnsupportedGroupType     = 0x10
+	errCCCDImproperlyConfigured = 0xFD
+)
+
+// the GATT attribute types
+const (
+	typePrimaryService = 0x2800
+	typeCharacteristic = 0x2803
+	typeClientConfig   = 0x2902
+)
+
+// the characteristic properties
+const (
+	propertyRead     = 0x02
+	propertyWrite    = 0x08
+	propertyNotify   = 0x10
+	propertyIndicate = 0x20
+)
+
+// the client characteristic configuration bits
+const (
+	configNotify   = 0x0001
+	configIndicate = 0x0002
+)
+
+// the MTU of the ATT bearer as received, and the default of LE
+const (
+	serverMTU  = 185
+	defaultMTU = 23
+)
+
+// the time an indication is waiting for its confirmation, the ATT
+// transaction timeout
+const attTimeout = 30 * time.Second
+
+// the 16-bit UUIDs of the Bluetooth SIG are in the Bluetooth base UUID
+// 0000xxxx-0000-1000-8000-00805F9B34FB, here in little-endian without them
+var baseUUID = []byte{0xFB, 0x34, 0x9B, 0x5F, 0x80, 0x00, 0x00, 0x80, 0x00, 0x10, 0x00, 0x00}
+
+// characteristic is a characteristic of a GATT service, with a 16-bit UUID
+// of the Bluetooth SIG
+type characteristic struct {
+	uuid uint16
+	// read returns the value, nil if the characteristic cannot be read
+	read func() []byte
+	// write handles a value written, nil if the characteristic cannot be
+	// written. It returns an ATT error code, 0 if written, and the value
+	// sent back after the write response, if any, e.g. the response of a
+	// control point.
+	write func(value []byte) (byte, []byte)
+	// replied is called once the value sent back is queued, if set, e.g.
+	// to notify the changes made by the write
+	replied  func()
+	notify   bool
+	indicate bool
+
+	handle uint16 // of the value
+}
+
+func (c *characteristic) properties() byte {
+	var properties byte
+	if c.read != nil {
+		properties |= propertyRead
+	}
+	if c.write != nil {
+		properties |= propertyWrite
+	}
+	if c.notify {
+		properties |= propertyNotify
+	}
+	if c.indicate {
+		properties |= propertyIndicate
+	}
+	return properties
+}
+
+// service is a primary service of the GATT server
+type service struct {
+	uuid            uint16
+	characteristics []*characteristic
+}
+
+// attribute is an attribute of the GATT server, its handle being its index
+// from 1
+type attribute struct {
+	handle uint16
+	typ    uint16
+	value  []byte          // of the declarations
+	char   *characteristic // of the values and their client configuration
+	end    uint16          // the last handle of the group of a service
+}
+
+// attributes lays the services out as the attributes of the GATT server:
+// the declaration of each service, followed by the declaration and the value
+// of each of its characteristics, and their client configuration if
+// notified or indicated
+func attributes(services []*service) []attribute {
+	var all []attribute
+	add := func(a attribute) {
+		a.handle = uint16(len(all) + 1)
+		all = append(all, a)
+	}
+	for _, s := range services {
+		start := len(all)
+		add(attribute{typ: typePrimaryService, value: binary.LittleEndian.AppendUint16(nil, s.uuid)})
+		for _, c := range s.characteristics {
+			c.handle = uint16(len(all) + 2)
+			declaration := []byte{c.properties()}
+			declaration = binary.LittleEndian.AppendUint16(declaration, c.handle)
+			declaration = binary.LittleEndian.AppendUint16(declaration, c.uuid)
+			add(attribute{typ: typeCharacteristic, value: declaration})
+			add(attribute{typ: c.uuid, char: c})
+			if c.notify || c.indicate {
+				add(attribute{typ: typeClientConfig, char: c})
+			}
+		}
+		all[start].end = uint16(len(all))
+	}
+	return all
+}
+
+// peripheral serves the attributes of its services to the central
+// connected, one at a time
+type peripheral struct {
+	name       string
+	services   []*service
+	attributes []attribute
+
+	disconnected func() // called when the central disconnects, if set
+
+	mutex  sync.Mutex
+	conn   *conn    // of the central connected, nil if none
+	stops  []func() // stopping the sockets served on, once closed
+	closed bool
+}
+
+func newPeripheral(name string, services ...*service) *peripheral {
+	return &peripheral{name: name, services: services, attributes: attributes(services)}
+}
+
+// track keeps the function stopping a socket served on, calling it at once
+// if the peripheral is closed already
+func (p *peripheral) track(stop func()) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		stop()
+		return false
+	}
+	p.stops = append(p.stops, stop)
+	return true
+}
+
+// untrack forgets the socket tracked last, about to be closed
+func (p *peripheral) untrack() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(p.stops) > 0 {
+		p.stops = p.stops[:len(p.stops)-1]
+	}
+}
+
+func (p *peripheral) isClosed() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.closed
+}
+
+// close stops serving, disconnecting the central
+func (p *peripheral) close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return errors.New("closed already")
+	}
+	p.closed = true
+	for _, stop := range p.stops {
+		stop()
+	}
+	return nil
+}
+
+// notify sends the value of the characteristic to the central connected,
+// notified or indicated as it subscribed, if at all
+func (p *peripheral) notify(c *characteristic, value []byte) {
+	p.mutex.Lock()
+	conn := p.conn
+	p.mutex.Unlock()
+	if conn != nil {
+		conn.notify(c, value)
+	}
+}
+
+// serveConn serves the central on its ATT bearer until it disconnects, each
+// read and write being a PDU
+func (p *peripheral) serveConn(rw io.ReadWriter) error {
+	c := &conn{
+		peripheral: p,
+		rw:         rw,
+		mtu:        defaultMTU,
+		subscribed: map[uint16]uint16{},
+		out:        make(chan outgoing, 64),
+		confirmed:  make(chan struct{}, 1),
+		done:       make(chan struct{})}
+	p.mutex.Lock()
+	p.conn = c
+	p.mutex.Unlock()
+	defer func() {
+		p.mutex.Lock()
+		p.conn = nil
+		p.mutex.Unlock()
+		close(c.done)
+		if p.disconnected != nil {
+			p.disconnected()
+		}
+	}()
+	go c.send()
+
+	pdu := make([]byte, 512)
+	for {
+		n, err := rw.Read(pdu)
+		if err != nil {
+			return err
+		}
+		c.handle(pdu[:n])
+	}
+}
+
+// outgoing is a PDU sent to the central, indications waiting for their
+// confirmation before the next PDU
+type outgoing struct {
+	pdu        []byte
+	indication bool
+}
+
+// conn is the ATT bearer of a central connected
+type conn struct {
+	peripheral *peripheral
+	rw         io.ReadWriter
+
+	mutex      sync.Mutex
+	mtu        int
+	subscribed map[uint16]uint16 // the client configuration by value handle
+
+	out       chan outgoing
+	confirmed chan struct{}
+	done      chan struct{}
+}
+
+// send writes the PDUs in order until the central disconnects
+func (c *conn) send() {
+	for {
+		select {
+		case o := <-c.out:
+			if _, err := c.rw.Write(o.pdu); err != nil || !o.indication {
+				continue
+			}
+			select {
+			case <-c.confirmed:
+			case <-time.After(attTimeout):
+			case <-c.done:
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// queue queues the PDU to send, unless the central disconnected
+func (c *conn) queue(o outgoing) {
+	select {
+	case c.out <- o:
+	case <-c.done:
+	}
+}
+
+func (c *conn) notify(char *characteristic, value []byte) {
+	c.mutex.Lock()
+	config := c.subscribed[char.handle]
+	if len(value) > c.mtu-3 {
+		value = value[:c.mtu-3]
+	}
+	c.mutex.Unlock()
+
+	opcode := byte(attNotification)
+	if config&configIndicate != 0 && char.indicate {
+		opcode = attIndication
+	} else if config&configNotify == 0 || !char.notify {
+		return
+	}
+	pdu := append([]byte{opcode}, binary.LittleEndian.AppendUint16(nil, char.handle)...)
+	pdu = append(pdu, value...)
+	if opcode == attIndication {
+		c.queue(outgoing{pdu: pdu, indication: true})
+		return
+	}
+	// the notifications of a central falling behind are dropped
+	select {
+	case c.out <- outgoing{pdu: pdu}:
+	default:
+	}
+}
+
+func errorResponse(opcode byte, handle uint16, code byte) []byte {
+	response := []byte{attErrorResponse, opcode}
+	response = binary.LittleEndian.AppendUint16(response, handle)
+	return append(response, code)
+}
+
+// handle answers the PDU received, the commands but the write command being
+// ignored
+func (c *conn) handle(pdu []byte) {
+	if len(pdu) == 0 {
+		return
+	}
+	opcode := pdu[0]
+	var response []byte
+	switch opcode {
+	case attMTURequest:
+		response = c.exchangeMTU(pdu)
+	case attFindInformationRequest:
+		response = c.findInformation(pdu)
+	case attFindByTypeValueRequest:
+		response = c.findByTypeValue(pdu)
+	case attReadByTypeRequest:
+		response = c.readByType(pdu)
+	case attReadRequest, attReadBlobRequest:
+		response = c.read(pdu)
+	case attReadByGroupTypeRequest:
+		response = c.readByGroupType(pdu)
+	case attWriteRequest, attWriteCommand:
+		c.write(pdu)
+		return
+	case attConfirmation:
+		select {
+		case c.confirmed <- struct{}{}:
+		default:
+		}
+		return
+	default:
+		if opcode&attCommand != 0 {
+			return
+		}
+		response = errorResponse(opcode, 0, errRequestNotSupported)
+	}
+	c.queue(outgoing{pdu: response})
+}
+
+// handleRange returns the range of handles of a request, or the error
+// response of an invalid one
+func handleRange(pdu []byte, length int) (uint16, uint16, []byte) {
+	if len(pdu) < length {
+		return 0, 0, errorResponse(pdu[0], 0, errInvalidPDU)
+	}
+	start := binary.LittleEndian.Uint16(pdu[1:])
+	end := binary.LittleEndian.Uint16(pdu[3:])
+	if start == 0 || start > end {
+		return 0, 0, errorResponse(pdu[0], start, errInvalidHandle)
+	}
+	return start, end, nil
+}
+
+// inRange returns the attributes in the range of handles
+func (c *conn) inRange(start, end uint16) []attribute {
+	all := c.peripheral.attributes
+	if int(start) > len(all) {
+		return nil
+	}
+	if int(end) > len(all) {
+		end = uint16(len(all))
+	}
+	return all[start-1 : end]
+}
+
+// uuid16 returns the 16-bit UUID of a UUID in a request, of 2 or 16 bytes
+func uuid16(b []byte) (uint16, bool) {
+	switch {
+	case len(b) == 2:
+		return binary.LittleEndian.Uint16(b), true
+	case len(b) == 16 && bytes.Equal(b[:12], baseUUID) && b[14] == 0 && b[15] == 0:
+		return binary.LittleEndian.Uint16(b[12:]), true
+	}
+	return 0, false
+}
+
+func (c *conn) mtuLocked() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.mtu
+}
+
+func (c *conn) exchangeMTU(pdu []byte) []byte {
+	if len(pdu) != 3 {
+		return errorResponse(pdu[0], 0, errInvalidPDU)
+	}
+	mtu := int(binary.LittleEndian.Uint16(pdu[1:]))
+	if mtu > serverMTU {
+		mtu = serverMTU
+	}
+	if mtu >= defaultMTU {
+		c.mutex.Lock()
+		c.mtu = mtu
+		c.mutex.Unlock()
+	}
+	return binary.LittleEndian.AppendUint16([]byte{attMTUResponse}, serverMTU)
+}
+
+func (c *conn) findInformation(pdu []byte) []byte {
+	start, end, failed := handleRange(pdu, 5)
+	if failed != nil {
+		return failed
+	}
+	mtu := c.mtuLocked()
+	response := []byte{attFindInformation, 0x01} // 16-bit UUIDs
+	for _, a := range c.inRange(start, end) {
+		if len(response)+4 > mtu {
+			break
+		}
+		response = binary.LittleEndian.AppendUint16(response, a.handle)
+		response = binary.LittleEndian.AppendUint16(response, a.typ)
+	}
+	if len(response) == 2 {
+		return errorResponse(pdu[0], start, errAttributeNotFound)
+	}
+	return response
+}
+
+// findByTypeValue finds the declarations with the value, e.g. the primary
+// service of a UUID
+func (c *conn) findByTypeValue(pdu []byte) []byte {
+	start, end, failed := handleRange(pdu, 7)
+	if failed != nil {
+		return failed
+	}
+	typ := binary.LittleEndian.Uint16(pdu[5:])
+	value := pdu[7:]
+	mtu := c.mtuLocked()
+	response := []byte{attFindByTypeValue}
+	for _, a := range c.inRange(start, end) {
+		if a.typ != typ || a.char != nil || !bytes.Equal(a.value, value) {
+			continue
+		}
+		if len(response)+4 > mtu {
+			break
+		}
+		groupEnd := a.end
+		if groupEnd == 0 {
+			groupEnd = a.handle
+		}
+		response = binary.LittleEndian.AppendUint16(response, a.handle)
+		response = binary.LittleEndian.AppendUint16(response, groupEnd)
+	}
+	if len(response) == 1 {
+		return errorResponse(pdu[0], start, errAttributeNotFound)
+	}
+	return response
+}
+
+// value returns the value of the attribute read, or the ATT error code
+func (c *conn) value(a attribute) ([]byte, byte) {
+	switch {
+	case a.char == nil:
+		return a.value, 0
+	case a.typ == typeClientConfig:
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		return binary.LittleEndian.AppendUint16(nil, c.subscribed[a.char.handle]), 0
+	case a.char.read == nil:
+		return nil, errReadNotPermitted
+	}
+	return a.char.read(), 0
+}
+
+func (c *conn) readByType(pdu []byte) []byte {
+	start, end, failed := handleRange(pdu, 7)
+	if failed != nil {
+		return failed
+	}
+	typ, ok := uuid16(pdu[5:])
+	if !ok {
+		return errorResponse(pdu[0], start, errAttributeNotFound)
+	}
+	mtu := c.mtuLocked()
+	var response []byte
+	for _, a := range c.inRange(start, end) {
+		if a.typ != typ {
+			continue
+		}
+		value, code := c.value(a)
+		if code != 0 {
+			if response == nil {
+				return errorResponse(pdu[0], a.handle, code)
+			}
+			break
+		}
+		if len(value) > mtu-4 {
+			value = value[:mtu-4]
+		}
+		// the values listed are all of the length of the first
+		if response == nil {
+			response = []byte{attReadByType, byte(2 + len(value))}
+		} else if int(response[1]) != 2+len(value) || len(response)+2+len(value) > mtu {
+			break
+		}
+		response = binary.LittleEndian.AppendUint16(response, a.handle)
+		response = append(response, value...)
+	}
+	if response == nil {
+		return errorResponse(pdu[0], start, errAttributeNotFound)
+	}
+	return response
+}
+
+// read answers the read and the read blob requests
+func (c *conn) read(pdu []byte) []byte {
+	length, responseOpcode := 3, byte(attRead)
+	if pdu[0] == attReadBlobRequest {
+		length, responseOpcode = 5, attReadBlob
+	}
+	if len(pdu) != length {
+		return errorResponse(pdu[0], 0, errInvalidPDU)
+	}
+	handle := binary.LittleEndian.Uint16(pdu[1:])
+	if handle == 0 || int(handle) > len(c.peripheral.attributes) {
+		return errorResponse(pdu[0], handle, errInvalidHandle)
+	}
+	value, code := c.value(c.peripheral.attributes[handle-1])
+	if code != 0 {
+		return errorResponse(pdu[0], handle, code)
+	}
+	if responseOpcode == attReadBlob {
+		offset := int(binary.LittleEndian.Uint16(pdu[3:]))
+		if offset > len(value) {
+			return errorResponse(pdu[0], handle, errInvalidOffset)
+		}
+		value = value[offset:]
+	}
+	if mtu := c.mtuLocked(); len(value) > mtu-1 {
+		value = value[:mtu-1]
+	}
+	return append([]byte{responseOpcode}, value...)
+}
+
+func (c *conn) readByGroupType(pdu []byte) []byte {
+	start, end, failed := handleRange(pdu, 7)
+	if failed != nil {
+		return failed
+	}
+	if typ, ok := uuid16(pdu[5:]); !ok || typ != typePrimaryService {
+		return errorResponse(pdu[0], start, errUnsupportedGroupType)
+	}
+	mtu := c.mtuLocked()
+	response := []byte{attReadByGroupType, 6}
+	for _, a := range c.inRange(start, end) {
+		if a.typ != typePrimaryService {
+			continue
+		}
+		if len(response)+6 > mtu {
+			break
+		}
+		response = binary.LittleEndian.AppendUint16(response, a.handle)
+		response = binary.LittleEndian.AppendUint16(response, a.end)
+		response = append(response, a.value...)
+	}
+	if len(response) == 2 {
+		return errorResponse(pdu[0], start, errAttributeNotFound)
+	}
+	return response
+}
+
+// write answers the write requests, and handles the write commands without
+// answering them. The value sent back by the characteristic is indicated
+// after the write response.
+func (c *conn) write(pdu []byte) {
+	answer := func(response []byte) {
+		if pdu[0] == attWriteRequest {
+			c.queue(outgoing{pdu: response})
+		}
+	}
+	if len(pdu) < 3 {
+		answer(errorResponse(pdu[0], 0, errInvalidPDU))
+		return
+	}
+	handle := binary.LittleEndian.Uint16(pdu[1:])
+	value := pdu[3:]
+	if handle == 0 || int(handle) > len(c.peripheral.attributes) {
+		answer(errorResponse(pdu[0], handle, errInvalidHandle))
+		return
+	}
+	a := c.peripheral.attributes[handle-1]
+	switch {
+	case a.typ == typeClientConfig:
+		if len(value) != 2 {
+			answer(errorResponse(pdu[0], handle, errInvalidLength))
+			return
+		}
+		c.mutex.Lock()
+		c.subscribed[a.char.handle] = binary.LittleEndian.Uint16(value)
+		c.mutex.Unlock()
+		answer([]byte{attWrite})
+	case a.char == nil || a.char.write == nil:
+		answer(errorResponse(pdu[0], handle, errWriteNotPermitted))
+	default:
+		// a characteristic written and indicated, e.g. a control point,
+		// answers by indications, to be subscribed to first
+		c.mutex.Lock()
+		config := c.subscribed[a.char.handle]
+		c.mutex.Unlock()
+		if a.char.indicate && config&configIndicate == 0 {
+			answer(errorResponse(pdu[0], handle, errCCCDImproperlyConfigured))
+			return
+		}
+		code, reply := a.char.write(value)
+		if code != 0 {
+			answer(errorResponse(pdu[0], handle, code))
+			return
+		}
+		answer([]byte{attWrite})
+		if reply != nil {
+			c.notify(a.char, reply)
+			if a.char.replied != nil {
+				a.char.replied()
+			}
+		}
+	}
+}
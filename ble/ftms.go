@@ -0,0 +1,308 @@
+package ble
+
+import (
+	"encoding/binary"
+	"github.com/olympum/oarsman/s4"
+	"github.com/olympum/oarsman/server"
+	"sync"
+)
+
+// the Fitness Machine service and its characteristics
+const (
+	uuidFitnessMachine = 0x1826
+	uuidFeature        = 0x2ACC
+	uuidRowerData      = 0x2AD1
+	uuidControlPoint   = 0x2AD9
+	uuidStatus         = 0x2ADA
+)
+
+// the control point opcodes handled, and the response code
+const (
+	opRequestControl  = 0x00
+	opReset           = 0x01
+	opStartOrResume   = 0x07
+	opStopOrPause     = 0x08
+	opTargetDistance  = 0x0C
+	opTargetTime      = 0x0D
+	opResponse        = 0x80
+	stopParameter     = 0x01
+	pauseParameter    = 0x02
+	resultSuccess     = 0x01
+	resultUnsupported = 0x02
+	resultInvalid     = 0x03
+	resultFailed      = 0x04
+	resultNotAllowed  = 0x05
+)
+
+// the status opcodes notified
+const (
+	statusReset           = 0x01
+	statusStopped         = 0x02
+	statusStarted         = 0x04
+	statusDistanceChanged = 0x0D
+	statusTimeChanged     = 0x0E
+)
+
+// the features of the rower: cadence, total distance, pace, expended
+// energy, heart rate, elapsed time and power; and the targets settable:
+// the distance and the training time
+const (
+	features       = 1<<1 | 1<<2 | 1<<5 | 1<<9 | 1<<10 | 1<<12 | 1<<14
+	targetFeatures = 1<<8 | 1<<9
+)
+
+// the fields of the rower data: the stroke rate and count (bit 0 clear),
+// the total distance, the pace, the power, the expended energy, the heart
+// rate and the elapsed time
+const rowerDataFlags = 1<<2 | 1<<3 | 1<<5 | 1<<8 | 1<<9 | 1<<11
+
+// the time between two rower data notifications
+const rowerDataMillis = 1000
+
+// FTMSMetrics are the metrics broadcast as the rower data
+var FTMSMetrics = []s4.Metric{
+	s4.MetricTotalDistance,
+	s4.MetricStrokeRate,
+	s4.MetricWatts,
+	s4.MetricCalories,
+	s4.MetricSpeed,
+	s4.MetricHeartRate,
+	s4.MetricStrokeStart,
+	s4.MetricWorkoutState,
+}
+
+// FTMS is a BLE Fitness Machine rower broadcasting the live metrics of the
+// sessions, e.g. to a training app like Kinomap or EXR, which starts and
+// stops the workouts of the recorder on its control point
+type FTMS struct {
+	recorder     server.Recorder
+	peripheral   *peripheral
+	rowerData    *characteristic
+	controlPoint *characteristic
+	status       *characteristic
+
+	mutex      sync.Mutex
+	controlled bool // by the central connected, once requested
+	target     server.WorkoutRequest
+	changed    []byte // the status notified once the control point answered
+	rower      rowerData
+}
+
+// rowerData are the metrics of the session in progress
+type rowerData struct {
+	started    int64 // time of the start of the workout, 0 until rowing
+	sent       int64 // time of the last notification
+	strokes    uint64
+	strokeRate uint64
+	distance   uint64
+	speed      uint64 // cm/s
+	watts      uint64
+	calories   uint64
+	heartRate  uint64
+	elapsed    uint64 // seconds
+}
+
+// NewFTMS returns the fitness machine named, starting and stopping the
+// workouts of the recorder
+func NewFTMS(name string, recorder server.Recorder) *FTMS {
+	f := &FTMS{recorder: recorder}
+	f.rowerData = &characteristic{uuid: uuidRowerData, notify: true}
+	f.controlPoint = &characteristic{uuid: uuidControlPoint, write: f.control, indicate: true}
+	f.controlPoint.replied = f.notifyChanged
+	f.status = &characteristic{uuid: uuidStatus, notify: true}
+	feature := &characteristic{uuid: uuidFeature, read: func() []byte {
+		value := binary.LittleEndian.AppendUint32(nil, features)
+		return binary.LittleEndian.AppendUint32(value, targetFeatures)
+	}}
+	fitnessMachine := &service{uuid: uuidFitnessMachine, characteristics: []*characteristic{
+		feature, f.rowerData, f.controlPoint, f.status}}
+	f.peripheral = newPeripheral(name, genericAccess(name), fitnessMachine)
+	f.peripheral.disconnected = f.lostControl
+	return f
+}
+
+// serviceData returns the FTMS service data advertised: the machine
+// available, a rower
+func (f *FTMS) serviceData() []byte {
+	return []byte{uuidFitnessMachine & 0xFF, uuidFitnessMachine >> 8, 0x01, 1 << 4, 0x00}
+}
+
+// Serve advertises the fitness machine on the Bluetooth adapter, e.g. 0 for
+// hci0, and serves the training app connecting, one at a time, until closed
+func (f *FTMS) Serve(device int) error {
+	data, response := advertisement(f.peripheral.name, f.peripheral.services, f.serviceData())
+	return f.peripheral.serve(device, data, response)
+}
+
+// Close stops advertising and disconnects the training app
+func (f *FTMS) Close() error {
+	return f.peripheral.close()
+}
+
+// lostControl takes the control back from the central disconnected
+func (f *FTMS) lostControl() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.controlled = false
+	f.changed = nil
+}
+
+// control handles the requests written on the control point, answering
+// each with the response code, the request opcode and the result. The
+// training app has to request the control first.
+func (f *FTMS) control(request []byte) (byte, []byte) {
+	if len(request) == 0 {
+		return errInvalidLength, nil
+	}
+	opcode, parameter := request[0], request[1:]
+	result := f.handleRequest(opcode, parameter)
+	return 0, []byte{opResponse, opcode, result}
+}
+
+func (f *FTMS) handleRequest(opcode byte, parameter []byte) byte {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if opcode == opRequestControl {
+		f.controlled = true
+		return resultSuccess
+	}
+	if !f.controlled {
+		return resultNotAllowed
+	}
+
+	switch opcode {
+	case opReset:
+		f.target = server.WorkoutRequest{}
+		f.recorder.Stop("current")
+		f.changed = []byte{statusReset}
+		// the control is lost on reset
+		f.controlled = false
+	case opStartOrResume:
+		if _, err := f.recorder.Start(f.target); err != nil {
+			return resultFailed
+		}
+		f.changed = []byte{statusStarted}
+	case opStopOrPause:
+		if len(parameter) != 1 || (parameter[0] != stopParameter && parameter[0] != pauseParameter) {
+			return resultInvalid
+		}
+		// the S4 cannot be paused remotely
+		if parameter[0] == pauseParameter {
+			return resultFailed
+		}
+		if _, err := f.recorder.Stop("current"); err != nil {
+			return resultFailed
+		}
+		f.changed = []byte{statusStopped, stopParameter}
+	case opTargetDistance:
+		if len(parameter) != 3 {
+			return resultInvalid
+		}
+		meters := uint64(parameter[0]) | uint64(parameter[1])<<8 | uint64(parameter[2])<<16
+		target := server.WorkoutRequest{DistanceMeters: meters}
+		if _, err := target.Build(); err != nil {
+			return resultInvalid
+		}
+		f.target = target
+		f.changed = append([]byte{statusDistanceChanged}, parameter...)
+	case opTargetTime:
+		if len(parameter) != 2 {
+			return resultInvalid
+		}
+		target := server.WorkoutRequest{DurationSeconds: uint64(binary.LittleEndian.Uint16(parameter))}
+		if _, err := target.Build(); err != nil {
+			return resultInvalid
+		}
+		f.target = target
+		f.changed = append([]byte{statusTimeChanged}, parameter...)
+	default:
+		return resultUnsupported
+	}
+	return resultSuccess
+}
+
+// notifyChanged notifies the status changed by the request answered on the
+// control point, if any
+func (f *FTMS) notifyChanged() {
+	f.mutex.Lock()
+	changed := f.changed
+	f.changed = nil
+	f.mutex.Unlock()
+	if changed != nil {
+		f.peripheral.notify(f.status, changed)
+	}
+}
+
+// Run notifies the rower data of the session every second until the events
+// end, as subscribed with s4.Subscribe for the FTMSMetrics
+func (f *FTMS) Run(events <-chan s4.Event) {
+	f.mutex.Lock()
+	f.rower = rowerData{}
+	f.mutex.Unlock()
+	for event := range events {
+		f.mutex.Lock()
+		r := &f.rower
+		switch event.Metric {
+		case s4.MetricTotalDistance:
+			r.distance = event.Value
+		case s4.MetricStrokeRate:
+			r.strokeRate = event.Value
+		case s4.MetricWatts:
+			r.watts = event.Value
+		case s4.MetricCalories:
+			r.calories = event.Value
+		case s4.MetricSpeed:
+			r.speed = event.Value
+		case s4.MetricHeartRate:
+			r.heartRate = event.Value
+		case s4.MetricStrokeStart:
+			r.strokes++
+		case s4.MetricWorkoutState:
+			if s4.WorkoutState(event.Value) == s4.WorkoutStarted && r.started == 0 {
+				r.started = event.Time
+			}
+		}
+		if r.started > 0 {
+			r.elapsed = uint64(event.Time-r.started) / 1000
+		}
+		due := event.Time-r.sent >= rowerDataMillis
+		if due {
+			r.sent = event.Time
+		}
+		value := r.encode()
+		f.mutex.Unlock()
+		if due {
+			f.peripheral.notify(f.rowerData, value)
+		}
+	}
+}
+
+// encode returns the rower data characteristic of the metrics
+func (r rowerData) encode() []byte {
+	b := binary.LittleEndian.AppendUint16(nil, rowerDataFlags)
+	// the stroke rate by half strokes per minute
+	b = append(b, byte(clamp(r.strokeRate*2, 0xFF)))
+	b = binary.LittleEndian.AppendUint16(b, uint16(clamp(r.strokes, 0xFFFF)))
+	distance := clamp(r.distance, 0xFFFFFF)
+	b = append(b, byte(distance), byte(distance>>8), byte(distance>>16))
+	// the pace in seconds per 500 m, the speed being in cm/s
+	var pace uint64
+	if r.speed > 0 {
+		pace = 50000 / r.speed
+	}
+	b = binary.LittleEndian.AppendUint16(b, uint16(clamp(pace, 0xFFFF)))
+	b = binary.LittleEndian.AppendUint16(b, uint16(clamp(r.watts, 0x7FFF)))
+	// the total energy, the energy per hour and per minute not available
+	b = binary.LittleEndian.AppendUint16(b, uint16(clamp(r.calories, 0xFFFE)))
+	b = binary.LittleEndian.AppendUint16(b, 0xFFFF)
+	b = append(b, 0xFF)
+	b = append(b, byte(clamp(r.heartRate, 0xFF)))
+	return binary.LittleEndian.AppendUint16(b, uint16(clamp(r.elapsed, 0xFFFF)))
+}
+
+func clamp(v uint64, max uint64) uint64 {
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,268 @@
+package ble
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/olympum/oarsman/s4"
+	"github.com/olympum/oarsman/server"
+	"net"
+	"testing"
+	"time"
+)
+
+type testRecorder struct {
+	started  []server.WorkoutRequest
+	stopped  int
+	inFlight bool
+}
+
+func (r *testRecorder) Start(request server.WorkoutRequest) (server.Session, error) {
+	if r.inFlight {
+		return server.Session{}, server.ErrSessionInProgress
+	}
+	r.started = append(r.started, request)
+	return server.Session{ID: "1"}, nil
+}
+
+func (r *testRecorder) Stop(id string) (server.Session, error) {
+	if id != "current" {
+		return server.Session{}, errors.New("unknown session " + id)
+	}
+	r.stopped++
+	return server.Session{ID: "1"}, nil
+}
+
+func (r *testRecorder) Session(id string) (server.Session, bool) {
+	return server.Session{}, false
+}
+
+func (r *testRecorder) Subscribe(id string) (<-chan s4.Event, func(), bool) {
+	return nil, nil, false
+}
+
+// central is the end of a training app connected to the peripheral
+type central struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func connect(t *testing.T, p *peripheral) (*central, chan error) {
+	ours, theirs := net.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- p.serveConn(theirs)
+	}()
+	return &central{t: t, conn: ours}, served
+}
+
+func (c *central) send(pdu ...byte) {
+	c.t.Helper()
+	c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	if _, err := c.conn.Write(pdu); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *central) receive() []byte {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	pdu := make([]byte, 512)
+	n, err := c.conn.Read(pdu)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return pdu[:n]
+}
+
+// request sends the request and returns its response
+func (c *central) request(pdu ...byte) []byte {
+	c.t.Helper()
+	c.send(pdu...)
+	return c.receive()
+}
+
+func (c *central) expect(want ...byte) {
+	c.t.Helper()
+	if got := c.receive(); !bytes.Equal(got, want) {
+		c.t.Fatalf("received % X, want % X", got, want)
+	}
+}
+
+func le16(v uint16) []byte {
+	return binary.LittleEndian.AppendUint16(nil, v)
+}
+
+func TestDiscovery(t *testing.T) {
+	f := NewFTMS("Oarsman", &testRecorder{})
+	c, served := connect(t, f.peripheral)
+
+	// GAP: declaration, name, appearance; FTMS from handle 6: feature,
+	// rower data and its configuration, control point and its
+	// configuration, status and its configuration
+	c.send(attMTURequest, 0x00, 0x02)
+	c.expect(append([]byte{attMTUResponse}, le16(serverMTU)...)...)
+	c.send(attReadByGroupTypeRequest, 0x01, 0x00, 0xFF, 0xFF, 0x00, 0x28)
+	c.expect(attReadByGroupType, 6, 0x01, 0x00, 0x05, 0x00, 0x00, 0x18, 0x06, 0x00, 0x11, 0x00, 0x26, 0x18)
+	c.send(attReadByGroupTypeRequest, 0x12, 0x00, 0xFF, 0xFF, 0x00, 0x28)
+	c.expect(attErrorResponse, attReadByGroupTypeRequest, 0x12, 0x00, errAttributeNotFound)
+
+	c.send(attFindByTypeValueRequest, 0x01, 0x00, 0xFF, 0xFF, 0x00, 0x28, 0x26, 0x18)
+	c.expect(attFindByTypeValue, 0x06, 0x00, 0x11, 0x00)
+
+	declarations := c.request(attReadByTypeRequest, 0x06, 0x00, 0x11, 0x00, 0x03, 0x28)
+	want := []byte{attReadByType, 7,
+		0x07, 0x00, propertyRead, 0x08, 0x00, 0xCC, 0x2A,
+		0x09, 0x00, propertyNotify, 0x0A, 0x00, 0xD1, 0x2A,
+		0x0C, 0x00, propertyWrite | propertyIndicate, 0x0D, 0x00, 0xD9, 0x2A,
+		0x0F, 0x00, propertyNotify, 0x10, 0x00, 0xDA, 0x2A}
+	if !bytes.Equal(declarations, want) {
+		t.Fatalf("declarations % X, want % X", declarations, want)
+	}
+	c.send(attFindInformationRequest, 0x0A, 0x00, 0x0B, 0x00)
+	c.expect(attFindInformation, 0x01, 0x0A, 0x00, 0xD1, 0x2A, 0x0B, 0x00, 0x02, 0x29)
+
+	// the name by its 128-bit UUID, and read
+	uuid := append(append([]byte{}, baseUUID...), 0x00, 0x2A, 0x00, 0x00)
+	c.send(append([]byte{attReadByTypeRequest, 0x01, 0x00, 0xFF, 0xFF}, uuid...)...)
+	c.expect(append([]byte{attReadByType, 9, 0x03, 0x00}, "Oarsman"...)...)
+	c.send(attReadBlobRequest, 0x03, 0x00, 0x04, 0x00)
+	c.expect(append([]byte{attReadBlob}, "man"...)...)
+	c.send(attReadRequest, 0x08, 0x00)
+	c.expect(attRead, 0x26, 0x56, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00)
+
+	c.send(attReadRequest, 0x0A, 0x00)
+	c.expect(attErrorResponse, attReadRequest, 0x0A, 0x00, errReadNotPermitted)
+	c.send(attReadRequest, 0x40, 0x00)
+	c.expect(attErrorResponse, attReadRequest, 0x40, 0x00, errInvalidHandle)
+	c.send(attWriteRequest, 0x08, 0x00, 0x01)
+	c.expect(attErrorResponse, attWriteRequest, 0x08, 0x00, errWriteNotPermitted)
+	c.send(0x20, 0x01, 0x00, 0xFF, 0xFF)
+	c.expect(attErrorResponse, 0x20, 0x00, 0x00, errRequestNotSupported)
+	c.send(attReadByTypeRequest, 0x01)
+	c.expect(attErrorResponse, attReadByTypeRequest, 0x00, 0x00, errInvalidPDU)
+
+	c.conn.Close()
+	if err := <-served; err == nil {
+		t.Error("served on after the central disconnected")
+	}
+}
+
+func TestControlPoint(t *testing.T) {
+	recorder := &testRecorder{}
+	f := NewFTMS("Oarsman", recorder)
+	c, _ := connect(t, f.peripheral)
+	defer c.conn.Close()
+	cp := f.controlPoint.handle
+
+	// the responses are indicated, to be subscribed to first
+	c.send(attWriteRequest, byte(cp), 0x00, opRequestControl)
+	c.expect(attErrorResponse, attWriteRequest, byte(cp), 0x00, errCCCDImproperlyConfigured)
+	c.send(attWriteRequest, byte(cp+1), 0x00, configIndicate, 0x00)
+	c.expect(attWrite)
+	c.send(attWriteRequest, byte(f.status.handle+1), 0x00, configNotify, 0x00)
+	c.expect(attWrite)
+
+	respond := func(request []byte, result byte, status ...byte) {
+		t.Helper()
+		c.send(append([]byte{attWriteRequest, byte(cp), 0x00}, request...)...)
+		c.expect(attWrite)
+		c.expect(attIndication, byte(cp), 0x00, opResponse, request[0], result)
+		c.send(attConfirmation)
+		if status != nil {
+			c.expect(append([]byte{attNotification, byte(f.status.handle), 0x00}, status...)...)
+		}
+	}
+	respond([]byte{opStartOrResume}, resultNotAllowed)
+	respond([]byte{opRequestControl}, resultSuccess)
+	respond([]byte{opTargetDistance, 0x88, 0x13, 0x00}, resultSuccess, statusDistanceChanged, 0x88, 0x13, 0x00)
+	respond([]byte{opTargetDistance, 0x88, 0x13}, resultInvalid)
+	respond([]byte{opTargetDistance, 0xFF, 0xFF, 0xFF}, resultInvalid)
+	respond([]byte{opStartOrResume}, resultSuccess, statusStarted)
+	respond([]byte{opTargetTime, 0x08, 0x07}, resultSuccess, statusTimeChanged, 0x08, 0x07)
+	recorder.inFlight = true
+	respond([]byte{opStartOrResume}, resultFailed)
+	respond([]byte{opStopOrPause, pauseParameter}, resultFailed)
+	respond([]byte{opStopOrPause, stopParameter}, resultSuccess, statusStopped, stopParameter)
+	respond([]byte{opStopOrPause}, resultInvalid)
+	respond([]byte{0x05, 0x64, 0x00}, resultUnsupported)
+	respond([]byte{opReset}, resultSuccess, statusReset)
+	respond([]byte{opTargetTime, 0x08, 0x07}, resultNotAllowed)
+
+	if len(recorder.started) != 1 || recorder.started[0] != (server.WorkoutRequest{DistanceMeters: 5000}) {
+		t.Errorf("started %+v, want a 5000 m workout", recorder.started)
+	}
+	if recorder.stopped != 2 {
+		t.Errorf("stopped %d times, want 2", recorder.stopped)
+	}
+}
+
+func TestControlLostOnDisconnect(t *testing.T) {
+	f := NewFTMS("Oarsman", &testRecorder{})
+	c, served := connect(t, f.peripheral)
+	cp := f.controlPoint.handle
+	c.send(attWriteRequest, byte(cp+1), 0x00, configIndicate, 0x00)
+	c.expect(attWrite)
+	c.send(attWriteRequest, byte(cp), 0x00, opRequestControl)
+	c.expect(attWrite)
+	c.expect(attIndication, byte(cp), 0x00, opResponse, opRequestControl, resultSuccess)
+	c.conn.Close()
+	<-served
+
+	if result := f.handleRequest(opStartOrResume, nil); result != resultNotAllowed {
+		t.Errorf("result 0x%02X after the central disconnected, want 0x%02X", result, resultNotAllowed)
+	}
+}
+
+func TestRowerData(t *testing.T) {
+	f := NewFTMS("Oarsman", &testRecorder{})
+	c, _ := connect(t, f.peripheral)
+	defer c.conn.Close()
+	c.send(attWriteRequest, byte(f.rowerData.handle+1), 0x00, configNotify, 0x00)
+	c.expect(attWrite)
+
+	events := make(chan s4.Event)
+	go f.Run(events)
+	for _, event := range []s4.Event{
+		{Time: 1000, Metric: s4.MetricWorkoutState, Value: uint64(s4.WorkoutStarted)},
+		{Time: 1100, Metric: s4.MetricStrokeStart},
+		{Time: 1200, Metric: s4.MetricStrokeRate, Value: 22},
+		{Time: 1300, Metric: s4.MetricSpeed, Value: 400},
+		{Time: 1400, Metric: s4.MetricTotalDistance, Value: 70000},
+		{Time: 1500, Metric: s4.MetricWatts, Value: 180},
+		{Time: 1600, Metric: s4.MetricCalories, Value: 12},
+		{Time: 1700, Metric: s4.MetricHeartRate, Value: 150},
+		{Time: 6000, Metric: s4.MetricStrokeStart},
+	} {
+		events <- event
+	}
+	close(events)
+
+	handle := byte(f.rowerData.handle)
+	// the first event is notified at once, before any metric
+	c.expect(attNotification, handle, 0x00, 0x2C, 0x0B, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xFF, 0xFF, 0xFF, 0, 0, 0)
+	c.expect(attNotification, handle, 0x00, 0x2C, 0x0B,
+		44,         // strokes per minute by halves
+		0x02, 0x00, // strokes
+		0x70, 0x11, 0x01, // meters
+		0x7D, 0x00, // 125 s per 500 m
+		0xB4, 0x00, // watts
+		0x0C, 0x00, 0xFF, 0xFF, 0xFF, // kcal
+		150,        // bpm
+		0x05, 0x00) // seconds
+}
+
+func TestAdvertisement(t *testing.T) {
+	f := NewFTMS("Oarsman", &testRecorder{})
+	data, response := advertisement(f.peripheral.name, f.peripheral.services, f.serviceData())
+	want := []byte{0x02, adFlags, 0x06, 0x03, adServiceUUIDs, 0x26, 0x18, 0x06, adServiceData, 0x26, 0x18, 0x01, 0x10, 0x00}
+	if !bytes.Equal(data, want) {
+		t.Errorf("advertising % X, want % X", data, want)
+	}
+	if !bytes.Equal(response, append([]byte{8, adCompleteName}, "Oarsman"...)) {
+		t.Errorf("scan response % X", response)
+	}
+	if _, response := advertisement("The rower in the garage of the house", nil, nil); len(response) != adMaxLength || response[1] != adShortName {
+		t.Errorf("scan response of a long name % X", response)
+	}
+}
@@ -0,0 +1,64 @@
+package ble
+
+import (
+	"encoding/binary"
+)
+
+// the GAP service and its characteristics
+const (
+	uuidGenericAccess = 0x1800
+	uuidDeviceName    = 0x2A00
+	uuidAppearance    = 0x2A01
+)
+
+// the advertising data types
+const (
+	adFlags            = 0x01
+	adServiceUUIDs     = 0x03 // the complete list of the 16-bit UUIDs
+	adCompleteName     = 0x09
+	adShortName        = 0x08
+	adServiceData      = 0x16
+	adMaxLength        = 31
+	flagsGeneral       = 0x02 // LE general discoverable mode
+	flagsBREDRDisabled = 0x04
+)
+
+// genericAccess returns the GAP service of the peripheral named, with an
+// unknown appearance
+func genericAccess(name string) *service {
+	return &service{uuid: uuidGenericAccess, characteristics: []*characteristic{
+		{uuid: uuidDeviceName, read: func() []byte { return []byte(name) }},
+		{uuid: uuidAppearance, read: func() []byte { return []byte{0, 0} }},
+	}}
+}
+
+// appendAD appends an advertising data structure, its length first
+func appendAD(b []byte, typ byte, data []byte) []byte {
+	b = append(b, byte(1+len(data)), typ)
+	return append(b, data...)
+}
+
+// advertisement returns the advertising data, listing the services other
+// than GAP followed by the service data, and the scan response, naming the
+// peripheral, shortened to fit
+func advertisement(name string, services []*service, serviceData []byte) ([]byte, []byte) {
+	data := appendAD(nil, adFlags, []byte{flagsGeneral | flagsBREDRDisabled})
+	var uuids []byte
+	for _, s := range services {
+		if s.uuid != uuidGenericAccess {
+			uuids = binary.LittleEndian.AppendUint16(uuids, s.uuid)
+		}
+	}
+	if len(uuids) > 0 {
+		data = appendAD(data, adServiceUUIDs, uuids)
+	}
+	if len(serviceData) > 0 && len(data)+2+len(serviceData) <= adMaxLength {
+		data = appendAD(data, adServiceData, serviceData)
+	}
+
+	typ := byte(adCompleteName)
+	if len(name) > adMaxLength-2 {
+		typ, name = adShortName, name[:adMaxLength-2]
+	}
+	return data, appendAD(nil, typ, []byte(name))
+}
@@ -0,0 +1,240 @@
+// +build !386
+
+package ble
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/olympum/oarsman/s4"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// the Bluetooth sockets of Linux
+const (
+	afBluetooth    = 31
+	btprotoL2CAP   = 0
+	btprotoHCI     = 1
+	hciChannelRaw  = 0
+	solHCI         = 0
+	hciFilter      = 2
+	attCID         = 4 // the fixed L2CAP channel of ATT
+	bdaddrLEPublic = 1
+)
+
+// the HCI packets and events
+const (
+	hciCommandPacket   = 0x01
+	hciEventPacket     = 0x04
+	evtCommandComplete = 0x0E
+	evtCommandStatus   = 0x0F
+)
+
+// the HCI commands of the LE controller advertising
+const (
+	leSetAdvertisingParameters = 0x2006
+	leSetAdvertisingData       = 0x2008
+	leSetScanResponseData      = 0x2009
+	leSetAdvertiseEnable       = 0x200A
+)
+
+// the time the controller has to complete a command
+const hciTimeout = 2 * time.Second
+
+type sockaddrHCI struct {
+	family  uint16
+	dev     uint16
+	channel uint16
+}
+
+type sockaddrL2 struct {
+	family     uint16
+	psm        uint16
+	bdaddr     [6]byte // any
+	cid        uint16
+	bdaddrType uint8
+	_          uint8
+}
+
+// socket is a Bluetooth socket
+type socket int
+
+func (s socket) Close() error {
+	return syscall.Close(int(s))
+}
+
+// shutdown shuts the socket down, returning the accept or the read blocked
+// on it
+func (s socket) shutdown() {
+	syscall.Shutdown(int(s), syscall.SHUT_RDWR)
+}
+
+func bind(fd int, address unsafe.Pointer, length uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_BIND, uintptr(fd), uintptr(address), length); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// openHCI opens the raw HCI socket of the adapter, receiving the events
+// completing the commands
+func openHCI(device int) (socket, error) {
+	fd, err := syscall.Socket(afBluetooth, syscall.SOCK_RAW, btprotoHCI)
+	if err != nil {
+		return -1, err
+	}
+	address := sockaddrHCI{family: afBluetooth, dev: uint16(device), channel: hciChannelRaw}
+	if err := bind(fd, unsafe.Pointer(&address), unsafe.Sizeof(address)); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	// struct hci_filter: the packet types, the events and the opcode
+	filter := make([]byte, 16)
+	binary.LittleEndian.PutUint32(filter, 1<<hciEventPacket)
+	binary.LittleEndian.PutUint32(filter[4:], 1<<evtCommandComplete|1<<evtCommandStatus)
+	if err := syscall.SetsockoptString(fd, solHCI, hciFilter, string(filter)); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	timeout := syscall.NsecToTimeval(hciTimeout.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	return socket(fd), nil
+}
+
+// command sends the HCI command and waits for its completion
+func (s socket) command(opcode uint16, parameters []byte) error {
+	packet := []byte{hciCommandPacket}
+	packet = binary.LittleEndian.AppendUint16(packet, opcode)
+	packet = append(packet, byte(len(parameters)))
+	if _, err := syscall.Write(int(s), append(packet, parameters...)); err != nil {
+		return err
+	}
+	event := make([]byte, 260)
+	for {
+		n, err := syscall.Read(int(s), event)
+		if err != nil {
+			return fmt.Errorf("HCI command 0x%04X not completed: %v", opcode, err)
+		}
+		var status byte
+		switch {
+		case n >= 7 && event[1] == evtCommandComplete && binary.LittleEndian.Uint16(event[4:]) == opcode:
+			status = event[6]
+		case n >= 7 && event[1] == evtCommandStatus && binary.LittleEndian.Uint16(event[5:]) == opcode:
+			status = event[3]
+		default:
+			continue
+		}
+		if status != 0 {
+			return fmt.Errorf("HCI command 0x%04X failed with status 0x%02X", opcode, status)
+		}
+		return nil
+	}
+}
+
+// advertise advertises connectable every 100 ms until a central connects
+func (s socket) advertise(data []byte, response []byte) error {
+	// the advertising cannot be set up while enabled
+	s.command(leSetAdvertiseEnable, []byte{0x00})
+	parameters := []byte{
+		0xA0, 0x00, 0xA0, 0x00, // the interval, by 0.625 ms
+		0x00,                   // connectable undirected
+		0x00,                   // the public address
+		0x00, 0, 0, 0, 0, 0, 0, // no peer
+		0x07, // the three channels
+		0x00, // any central
+	}
+	if err := s.command(leSetAdvertisingParameters, parameters); err != nil {
+		return err
+	}
+	for _, c := range []struct {
+		opcode uint16
+		data   []byte
+	}{{leSetAdvertisingData, data}, {leSetScanResponseData, response}} {
+		parameters := make([]byte, 1+adMaxLength)
+		parameters[0] = byte(copy(parameters[1:], c.data))
+		if err := s.command(c.opcode, parameters); err != nil {
+			return err
+		}
+	}
+	return s.command(leSetAdvertiseEnable, []byte{0x01})
+}
+
+// listenATT listens for the ATT bearers of the LE centrals connecting
+func listenATT() (socket, error) {
+	fd, err := syscall.Socket(afBluetooth, syscall.SOCK_SEQPACKET, btprotoL2CAP)
+	if err != nil {
+		return -1, err
+	}
+	// the channel is little-endian, as are the hosts supported
+	address := sockaddrL2{family: afBluetooth, cid: attCID, bdaddrType: bdaddrLEPublic}
+	if err := bind(fd, unsafe.Pointer(&address), unsafe.Sizeof(address)); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	if err := syscall.Listen(fd, 1); err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	return socket(fd), nil
+}
+
+// accept returns the ATT bearer of the next central connecting. The
+// address of the central is not asked for, as syscall.Accept fails on the
+// Bluetooth addresses.
+func (s socket) accept() (*os.File, error) {
+	fd, _, errno := syscall.Syscall6(syscall.SYS_ACCEPT4, uintptr(s), 0, 0, syscall.SOCK_CLOEXEC, 0, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	return os.NewFile(fd, "att"), nil
+}
+
+// serve advertises on the adapter and serves the centrals connecting, one at
+// a time, until closed
+func (p *peripheral) serve(device int, data []byte, response []byte) error {
+	hci, err := openHCI(device)
+	if err != nil {
+		return fmt.Errorf("could not open hci%d: %v", device, err)
+	}
+	defer hci.Close()
+	listener, err := listenATT()
+	if err != nil {
+		return fmt.Errorf("could not listen for ATT, is bluetoothd running? %v", err)
+	}
+	defer listener.Close()
+	if !p.track(listener.shutdown) {
+		return nil
+	}
+	defer hci.command(leSetAdvertiseEnable, []byte{0x00})
+
+	for {
+		if err := hci.advertise(data, response); err != nil {
+			return err
+		}
+		s4.Log().Infof("Advertising %s on hci%d", p.name, device)
+		bearer, err := listener.accept()
+		if err != nil {
+			if p.isClosed() {
+				return nil
+			}
+			return err
+		}
+		if !p.track(socket(bearer.Fd()).shutdown) {
+			bearer.Close()
+			return nil
+		}
+		s4.Log().Infof("Central connected to %s", p.name)
+		p.serveConn(bearer)
+		p.untrack()
+		bearer.Close()
+		if p.isClosed() {
+			return nil
+		}
+		s4.Log().Infof("Central disconnected from %s", p.name)
+	}
+}
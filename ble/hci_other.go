@@ -0,0 +1,11 @@
+// +build !linux 386
+
+package ble
+
+import (
+	"errors"
+)
+
+func (p *peripheral) serve(device int, data []byte, response []byte) error {
+	return errors.New("BLE is only supported on Linux")
+}
@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"bufio"
+	"github.com/olympum/oarsman/export"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"os"
+)
+
+var calendarFile string
+
+var calendarCmd = &cobra.Command{
+	Use:   "calendar",
+	Short: "Export workouts as an iCalendar file",
+	Long: `
+Exports all the activities in the database as an iCalendar (.ics)
+file, one event per workout with the distance and duration in the
+event description, so they can be imported or subscribed to from a
+calendar application.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		exportCalendar(calendarFile)
+	},
+}
+
+func exportCalendar(filename string) {
+	database := openDatabase()
+	defer database.Close()
+
+	activities := database.ListActivities()
+	if len(activities) == 0 {
+		jww.INFO.Println("No activities found")
+		return
+	}
+
+	if filename == "" {
+		filename = viper.GetString("TempFolder") + string(os.PathSeparator) + "oarsman.ics"
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		jww.ERROR.Printf("Could not create %s\n", filename)
+		return
+	}
+	defer f.Close()
+
+	jww.INFO.Printf("Writing %d activities to %s\n", len(activities), f.Name())
+	export.ICSWriter(activities, bufio.NewWriter(f))
+}
+
+func init() {
+	calendarCmd.Flags().StringVar(&calendarFile, "output", "", "output file (defaults to oarsman.ics in the temp folder)")
+}
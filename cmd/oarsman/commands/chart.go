@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"github.com/olympum/oarsman/export"
+	"github.com/olympum/oarsman/util"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"os"
+	"strconv"
+)
+
+var chartFormat string
+
+var chartCmd = &cobra.Command{
+	Use:   "chart <id>",
+	Short: "Render workout charts",
+	Long: `
+Renders pace, heart rate, power and stroke rate traces of an
+activity, with its laps shaded, as SVG or PNG files in the temp
+folder.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		if len(args) != 1 {
+			cmd.Usage()
+			return
+		}
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			jww.ERROR.Println("Activity id must be numeric")
+			return
+		}
+		chartActivity(id)
+	},
+}
+
+func chartActivity(activityId int64) {
+	database := openDatabase()
+	defer database.Close()
+
+	activity := database.FindActivityById(activityId)
+	if activity == nil {
+		jww.ERROR.Printf("Activity %d not found\n", activityId)
+		return
+	}
+
+	activity = replayActivity(activity)
+	if activity == nil {
+		jww.ERROR.Printf("Could not read workout log for activity %d\n", activityId)
+		return
+	}
+
+	prefix := viper.GetString("TempFolder") + string(os.PathSeparator) + util.MillisToZulu(activity.StartTimeMilliseconds)
+	if chartFormat == "SVG" {
+		export.ExportCollectorEvents(activity, prefix+".svg", export.SVGWriter)
+	} else if chartFormat == "PNG" {
+		export.ExportCollectorEvents(activity, prefix+".png", export.PNGWriter)
+	} else {
+		jww.ERROR.Printf("Unknow chart file format %s\n", chartFormat)
+	}
+}
+
+func init() {
+	chartCmd.Flags().StringVar(&chartFormat, "format", "SVG", "format to render charts as, SVG or PNG")
+}
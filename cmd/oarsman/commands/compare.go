@@ -0,0 +1,136 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/util"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"strconv"
+)
+
+var compareBy string
+var splitSize int64
+
+var compareCmd = &cobra.Command{
+	Use:   "compare <id1> <id2>",
+	Short: "Compare two workout activities split by split",
+	Long: `
+Aligns two activities by distance or elapsed time and prints, for
+each split, the pace, heart rate and stroke rate of both activities
+and the delta of the second activity against the first. The splits
+are matched on their offset; those rowed in only one of the
+activities, e.g. past the end of the shorter one, are printed without
+deltas.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		if len(args) != 2 {
+			cmd.Usage()
+			return
+		}
+		id1, err1 := strconv.ParseInt(args[0], 10, 64)
+		id2, err2 := strconv.ParseInt(args[1], 10, 64)
+		if err1 != nil || err2 != nil {
+			jww.ERROR.Println("Activity ids must be numeric")
+			return
+		}
+		compareActivities(id1, id2)
+	},
+}
+
+func compareActivities(id1 int64, id2 int64) {
+	if compareBy != collector.SplitByDistance && compareBy != collector.SplitByTime {
+		jww.ERROR.Printf("Unknown split alignment %s\n", compareBy)
+		return
+	}
+
+	database := openDatabase()
+	defer database.Close()
+
+	splits := [2][]collector.Split{}
+	tanks := [2]string{}
+	for n, id := range []int64{id1, id2} {
+		activity := database.FindActivityById(id)
+		if activity == nil {
+			jww.ERROR.Printf("Activity %d not found\n", id)
+			return
+		}
+		activity = replayActivity(activity)
+		if activity == nil {
+			jww.ERROR.Printf("Could not read workout log for activity %d\n", id)
+			return
+		}
+		splits[n] = activity.Splits(compareBy, splitSize)
+		tanks[n] = activity.TankNotes
+	}
+
+	// power and pace depend on the water level of the tank
+	for n, id := range []int64{id1, id2} {
+		if tanks[n] != "" {
+			jww.INFO.Printf("Activity %d tank: %s\n", id, tanks[n])
+		}
+	}
+	if tanks[0] != tanks[1] {
+		jww.WARN.Println("The tank notes differ, power and pace may not be comparable")
+	}
+
+	// the splits are joined on their offset, so that a split missing from
+	// either activity is not compared against another distance or time
+	fmt.Println("split,offset,pace_1,pace_2,delta_pace,ave_hr_1,ave_hr_2,delta_hr,ave_cadence_1,ave_cadence_2,delta_cadence")
+	i, j := 0, 0
+	for i < len(splits[0]) || j < len(splits[1]) {
+		switch {
+		case j == len(splits[1]) || (i < len(splits[0]) && splits[0][i].Offset < splits[1][j].Offset):
+			printUnmatchedSplit(splits[0][i], 0)
+			i++
+		case i == len(splits[0]) || splits[1][j].Offset < splits[0][i].Offset:
+			printUnmatchedSplit(splits[1][j], 1)
+			j++
+		default:
+			printComparedSplits(splits[0][i], splits[1][j])
+			i++
+			j++
+		}
+	}
+}
+
+// printComparedSplits prints the splits at the same offset of both
+// activities, with the delta of the second against the first
+func printComparedSplits(a collector.Split, b collector.Split) {
+	fmt.Printf("%d,%d,%s,%s,%+.1f,%d,%d,%+d,%d,%d,%+d\n",
+		a.Number,
+		a.Offset,
+		util.SecondsToPace(a.Pace()),
+		util.SecondsToPace(b.Pace()),
+		b.Pace()-a.Pace(),
+		a.AverageHeartRateBpm,
+		b.AverageHeartRateBpm,
+		int64(b.AverageHeartRateBpm)-int64(a.AverageHeartRateBpm),
+		a.AverageCadenceRpm,
+		b.AverageCadenceRpm,
+		int64(b.AverageCadenceRpm)-int64(a.AverageCadenceRpm))
+}
+
+// printUnmatchedSplit prints a split of only one of the activities, n being
+// 0 for the first and 1 for the second, without deltas
+func printUnmatchedSplit(split collector.Split, n int) {
+	columns := [2][3]string{}
+	columns[n] = [3]string{
+		util.SecondsToPace(split.Pace()),
+		strconv.FormatUint(split.AverageHeartRateBpm, 10),
+		strconv.FormatUint(split.AverageCadenceRpm, 10)}
+	fmt.Printf("%d,%d,%s,%s,,%s,%s,,%s,%s,\n",
+		split.Number,
+		split.Offset,
+		columns[0][0],
+		columns[1][0],
+		columns[0][1],
+		columns[1][1],
+		columns[0][2],
+		columns[1][2])
+}
+
+func init() {
+	compareCmd.Flags().StringVar(&compareBy, "by", collector.SplitByDistance, "align activities by distance or time")
+	compareCmd.Flags().Int64Var(&splitSize, "split", 500, "split size (in meters, or seconds when aligning by time)")
+}
@@ -0,0 +1,344 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/olympum/oarsman/ble"
+	"github.com/olympum/oarsman/display"
+	"github.com/olympum/oarsman/gpio"
+	"github.com/olympum/oarsman/s4"
+	"github.com/olympum/oarsman/server"
+	"github.com/olympum/oarsman/sink"
+	"github.com/olympum/oarsman/util"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var daemonFromMonitor bool
+var daemonServe bool
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Record every rowing session automatically",
+	Long: `
+Keeps waiting for rowing to start, records a just row activity from
+the first stroke until the rower is idle for two minutes, saves it in
+the database and goes back to waiting, so that every session is
+captured without touching a terminal. The S4 is opened again whenever
+it is switched off or unplugged.
+
+With --serve, the activities are served like with the serve command,
+and workouts can be started and stopped remotely, e.g. with the remote
+command, and their live events streamed, also over gRPC (see
+api/oarsman.proto). The /overlay page shows the
+live metrics over a transparent background, e.g. as a browser source
+of OBS for streaming the sessions.
+
+With FTMSDevice set in the configuration, e.g. 0 for hci0, the live
+metrics are broadcast over Bluetooth LE as a FTMS rower, and the
+training apps start and stop the workouts on its control point.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		if !cmd.Flags().Changed("device") {
+			serialDevice = viper.GetString("SerialDevice")
+		}
+		// sessions interrupted by a crash or a power cut
+		recoverActivities()
+
+		d := &daemon{ended: map[string]server.Session{}, publisher: newPublisher(), screen: newScreen(), feedback: newFeedback()}
+		if d.ftms = newFTMS(d); d.ftms != nil {
+			defer d.ftms.Close()
+		}
+		if daemonServe {
+			s := newAPIServer()
+			sessions := server.Sessions(d)
+			s.Handle("/sessions", sessions)
+			s.Handle("/sessions/", sessions)
+			overlay := server.Overlay(d, strings.Split(viper.GetString("OverlayFields"), ","))
+			s.Handle("/overlay", overlay)
+			s.Handle("/overlay/", overlay)
+			s.Handle(server.GRPCService, s.GRPC(d, apiLibrary()))
+			go func() {
+				if err := serveAPI(cmd, s); err != nil {
+					jww.ERROR.Printf("Could not serve: %v\n", err)
+				}
+			}()
+		}
+
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		retry := viper.GetDuration("DaemonRetryInterval")
+		for {
+			stopped, err := d.record(d.nextSession(), stop)
+			if stopped {
+				return
+			}
+			if s4.Cause(err) == s4.ErrUnsupportedFirmware {
+				os.Exit(exitCode(err))
+			}
+			if err != nil {
+				jww.INFO.Printf("Opening the S4 again in %v\n", retry)
+				select {
+				case <-stop:
+					return
+				case <-time.After(retry):
+				}
+			}
+		}
+	},
+}
+
+// daemonSession is a session recorded by the daemon
+type daemonSession struct {
+	server.Session
+	request server.WorkoutRequest
+	s4      s4.S4Interface // once connected
+	stop    chan bool      // closed to end the session
+	once    sync.Once
+}
+
+func newDaemonSession(request server.WorkoutRequest) *daemonSession {
+	id := strconv.FormatInt(time.Now().UnixNano()/1000000, 10)
+	return &daemonSession{
+		Session: server.Session{
+			ID:              id,
+			State:           s4.WorkoutUnset.String(),
+			DistanceMeters:  request.DistanceMeters,
+			DurationSeconds: request.DurationSeconds},
+		request: request,
+		stop:    make(chan bool)}
+}
+
+func (session *daemonSession) end() {
+	session.once.Do(func() { close(session.stop) })
+}
+
+// daemon records the sessions one after the other, just row workouts unless
+// a workout is started remotely
+type daemon struct {
+	mutex   sync.Mutex
+	current *daemonSession
+	next    *daemonSession // started remotely, recorded once the current one ends
+	ended   map[string]server.Session
+
+	publisher sink.Publisher // nil if not publishing
+	screen    display.Screen // nil if no display
+	feedback  *gpio.Feedback // nil if no LEDs
+	ftms      *ble.FTMS      // nil if not broadcasting
+}
+
+// nextSession returns the workout started remotely, if any, or else a just
+// row session
+func (d *daemon) nextSession() *daemonSession {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.current = d.next
+	d.next = nil
+	if d.current == nil {
+		d.current = newDaemonSession(server.WorkoutRequest{})
+	}
+	return d.current
+}
+
+// find returns the session in progress or to be recorded next with the id,
+// "current" for the one in progress
+func (d *daemon) find(id string) *daemonSession {
+	for _, session := range []*daemonSession{d.current, d.next} {
+		if session != nil && (session.ID == id || (id == "current" && session == d.current)) {
+			return session
+		}
+	}
+	return nil
+}
+
+func (d *daemon) Start(request server.WorkoutRequest) (server.Session, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.current != nil {
+		if state := d.current.State; state == s4.WorkoutStarted.String() || state == s4.WorkoutPaused.String() {
+			return server.Session{}, server.ErrSessionInProgress
+		}
+		// the S4 is waiting for rowing to start, and reset for the workout
+		d.current.end()
+	}
+	if d.next != nil {
+		d.ended[d.next.ID] = d.next.Session
+	}
+	d.next = newDaemonSession(request)
+	jww.INFO.Printf("Workout started remotely, session %s\n", d.next.ID)
+	return d.next.Session, nil
+}
+
+func (d *daemon) Stop(id string) (server.Session, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	session := d.find(id)
+	switch {
+	case session == nil:
+		if ended, ok := d.ended[id]; ok {
+			return ended, nil
+		}
+		return server.Session{}, fmt.Errorf("unknown session %s", id)
+	case session == d.next:
+		d.next = nil
+		session.State = s4.WorkoutExited.String()
+		d.ended[session.ID] = session.Session
+	default:
+		jww.INFO.Printf("Session %s stopped remotely\n", session.ID)
+		session.end()
+	}
+	return session.Session, nil
+}
+
+func (d *daemon) Session(id string) (server.Session, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if session := d.find(id); session != nil {
+		return session.Session, true
+	}
+	ended, ok := d.ended[id]
+	return ended, ok
+}
+
+func (d *daemon) Subscribe(id string) (<-chan s4.Event, func(), bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	session := d.find(id)
+	if session == nil || session != d.current || session.s4 == nil {
+		return nil, nil, false
+	}
+	events, cancel := session.s4.Subscribe()
+	return events, cancel, true
+}
+
+// locked changes the sessions under the lock of the daemon
+func (d *daemon) locked(change func()) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	change()
+}
+
+// record waits for rowing to start and records the session until it is
+// completed or stopped, saving it in the database. It returns whether the
+// daemon was stopped, and the failure of the S4, if any.
+func (d *daemon) record(session *daemonSession, stop <-chan os.Signal) (bool, error) {
+	stopped, err := d.recordSession(session, stop)
+	d.locked(func() {
+		if err != nil {
+			session.Error = err.Error()
+		}
+		d.ended[session.ID] = session.Session
+		if d.current == session {
+			d.current = nil
+		}
+	})
+	return stopped, err
+}
+
+func (d *daemon) recordSession(session *daemonSession, stop <-chan os.Signal) (bool, error) {
+	var workout s4.S4Workout
+	var err error
+	if session.request == (server.WorkoutRequest{}) && daemonFromMonitor {
+		workout, err = s4.NewWorkout().FromMonitor().Build()
+	} else {
+		workout, err = session.request.Build()
+	}
+	if err != nil {
+		return false, err
+	}
+
+	eventChannel := make(chan s4.AtomicEvent)
+	// the S4 pings every second, even idle: silence is a monitor switched
+	// off, the port then opened again
+	s, err := s4.NewS4(eventChannel, nil,
+		s4.WithDevice(serialDevice),
+		s4.WithOdometer(viper.GetString("OdometerAddress")),
+		s4.WithReadTimeout(viper.GetDuration("DaemonReadTimeout")))
+	if err != nil {
+		return false, err
+	}
+	stamp := util.MillisToZulu(time.Now().UnixNano() / 1000000)
+	tempFile := viper.GetString("TempFolder") + string(os.PathSeparator) + stamp + ".log"
+	logged := make(chan bool)
+	go s4.LogEvents(eventChannel, tempFile, viper.GetInt64("LogSegmentBytes"), logged)
+	states, _ := s.Subscribe(s4.MetricWorkoutState)
+	publishEvents(d.publisher, s)
+	showDashboard(d.screen, s)
+	driveFeedback(d.feedback, s)
+	broadcastFTMS(d.ftms, s)
+	d.locked(func() { session.s4 = s })
+
+	failed := make(chan error, 1)
+	go func() {
+		failed <- s.Run(&workout)
+	}()
+
+	jww.INFO.Println("Waiting for rowing to start")
+	started := false
+	stopped := false
+wait:
+	for {
+		select {
+		case state, ok := <-states:
+			if !ok {
+				err = <-failed
+				break wait
+			}
+			d.locked(func() { session.State = state.Text })
+			if s4.WorkoutState(state.Value) == s4.WorkoutStarted && !started {
+				started = true
+				jww.INFO.Println("Rowing started, recording")
+			}
+		case <-session.stop:
+			s.Exit()
+			err = <-failed
+			break wait
+		case sig := <-stop:
+			jww.INFO.Printf("Stopping (received %s signal)\n", sig.String())
+			stopped = true
+			s.Exit()
+			err = <-failed
+			break wait
+		}
+	}
+	s.Exit()
+	<-logged
+	d.locked(func() {
+		if session.State != s4.WorkoutCompleted.String() {
+			session.State = s4.WorkoutExited.String()
+		}
+	})
+
+	if started {
+		tank := session.request.TankNotes
+		if tank == "" {
+			tank = viper.GetString("TankNotes")
+		}
+		activity := importActivity(tempFile, false, server.ActivityDetails{
+			TankNotes: tank,
+			Workout:   workout.Name()})
+		if activity != nil {
+			os.Remove(tempFile)
+			exportActivity(activity.StartTimeMilliseconds)
+			publishActivity(d.publisher, activity)
+			d.locked(func() { session.ActivityID = activity.StartTimeMilliseconds })
+		}
+	} else {
+		os.Remove(tempFile)
+	}
+	return stopped, err
+}
+
+func init() {
+	daemonCmd.Flags().StringVar(&serialDevice, "device", "", "serial device of the S4, e.g. /dev/ttyACM0 (defaults to SerialDevice in the config, or the first USB modem found)")
+	daemonCmd.Flags().BoolVar(&daemonFromMonitor, "from-monitor", false, "record the workouts programmed on the monitor's buttons rather than just row")
+	daemonCmd.Flags().BoolVar(&daemonServe, "serve", false, "serve the activities, and the remote workouts and their live events")
+	addServeFlags(daemonCmd)
+}
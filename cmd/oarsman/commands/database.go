@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"github.com/olympum/oarsman/storage"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"os"
+)
+
+func workoutDatabase() (*storage.OarsmanDB, error) {
+	workingFolder := viper.GetString("DbFolder")
+	database, e := storage.OpenDatabase(workingFolder)
+	if e != nil {
+		return nil, e
+	}
+	if e := database.InitializeDatabase(); e != nil {
+		database.Close()
+		return nil, e
+	}
+	return database, nil
+}
+
+// openDatabase returns the workout database for the commands that cannot do
+// without it, exiting with an error when it cannot be opened
+func openDatabase() *storage.OarsmanDB {
+	database, err := workoutDatabase()
+	if err != nil {
+		jww.ERROR.Println("Could not open the database", err)
+		os.Exit(-1)
+	}
+	return database
+}
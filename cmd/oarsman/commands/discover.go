@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/olympum/oarsman/server"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"os"
+	"strings"
+	"time"
+)
+
+var discoverTimeout time.Duration
+
+// the server discovered for RemoteURL auto, once per run
+var discoveredURL string
+
+var discoverCmd = &cobra.Command{
+	Use:   "discover",
+	Short: "Find the oarsman servers on the LAN",
+	Long: `
+Finds the oarsman servers and daemons advertised on the LAN with mDNS
+(Bonjour) as _oarsman._tcp, e.g. the Raspberry Pi by the rower, and
+lists their URL, whether they serve over TLS and need a ServerToken.
+The remote and sync commands find the server themselves with --url
+auto, or RemoteURL auto in the configuration.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		services, err := server.Browse(discoverTimeout)
+		if err != nil {
+			jww.ERROR.Printf("Could not query the LAN: %v\n", err)
+			os.Exit(-1)
+		}
+		if len(services) == 0 {
+			fmt.Println("No oarsman server found")
+			return
+		}
+		fmt.Println("name,url,host,text")
+		for _, service := range services {
+			fmt.Printf("%s,%s,%s,%s\n", service.Instance, service.URL(), strings.TrimSuffix(service.Host, "."), strings.Join(service.Text, " "))
+		}
+	},
+}
+
+// discoverServer returns the URL of the first oarsman server found on the
+// LAN, exiting if there is none
+func discoverServer() string {
+	if discoveredURL != "" {
+		return discoveredURL
+	}
+	services, err := server.Browse(discoverTimeout)
+	if err != nil {
+		jww.ERROR.Printf("Could not query the LAN: %v\n", err)
+		os.Exit(-1)
+	}
+	if len(services) == 0 {
+		jww.ERROR.Println("No oarsman server found on the LAN")
+		os.Exit(-1)
+	}
+	if len(services) > 1 {
+		jww.WARN.Printf("%d oarsman servers found, using %s (see discover)\n", len(services), services[0].Instance)
+	}
+	discoveredURL = services[0].URL()
+	jww.INFO.Printf("Using the oarsman server %s at %s\n", services[0].Instance, discoveredURL)
+	return discoveredURL
+}
+
+func init() {
+	discoverCmd.Flags().DurationVar(&discoverTimeout, "timeout", 2*time.Second, "time to wait for the servers to answer")
+}
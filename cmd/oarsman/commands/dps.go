@@ -0,0 +1,104 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/s4"
+	"github.com/olympum/oarsman/util"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+var dpsDays int
+var dpsRate uint64
+
+var dpsCmd = &cobra.Command{
+	Use:   "dps",
+	Short: "Show the distance per stroke and its trend",
+	Long: `
+Shows the distance gained per stroke of the recent activities, over
+all their strokes and at the stroke rate given with --rate, and how
+it changed over time: at a given rate, a longer distance per stroke
+is one of the best simple signs of a better technique. With an
+activity id, shows the distance per stroke at every stroke rate of
+that activity instead.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		if activityId > 0 {
+			showActivityDistancePerStroke(activityId)
+		} else {
+			showDistancePerStrokeTrend()
+		}
+	},
+}
+
+// strokeDistances returns the distance per stroke of every stroke of an
+// activity, from its workout log
+func strokeDistances(id int64) []collector.StrokeDistance {
+	events, err := s4.ReadLog(workoutLogFile(id))
+	if err != nil {
+		jww.ERROR.Printf("Could not read workout log for activity %d\n", id)
+		return nil
+	}
+	return collector.NewStrokeDistances(events)
+}
+
+func showActivityDistancePerStroke(id int64) {
+	strokes := strokeDistances(id)
+	if len(strokes) == 0 {
+		jww.INFO.Printf("No strokes found for activity %d\n", id)
+		return
+	}
+	meters, n := collector.AverageDistancePerStroke(strokes, 0)
+	fmt.Printf("Distance per stroke: %.2f m over %d strokes\n", meters, n)
+	fmt.Println("stroke_rate,strokes,distance_per_stroke")
+	for _, r := range collector.DistancePerStrokeByRate(strokes) {
+		fmt.Printf("%d,%d,%.2f\n", r.StrokeRate, r.Strokes, r.Meters)
+	}
+}
+
+func showDistancePerStrokeTrend() {
+	database := openDatabase()
+	defer database.Close()
+
+	activities := recentActivities(database.ListActivities(), dpsDays)
+	if len(activities) == 0 {
+		jww.INFO.Printf("No activities found in the last %d days\n", dpsDays)
+		return
+	}
+
+	var times []int64
+	var trend []float64
+	fmt.Println("date,activity,strokes,distance_per_stroke,strokes_at_rate,distance_per_stroke_at_rate")
+	for _, activity := range activities {
+		strokes := strokeDistances(activity.StartTimeMilliseconds)
+		if len(strokes) == 0 {
+			continue
+		}
+		meters, n := collector.AverageDistancePerStroke(strokes, 0)
+		atRate, m := collector.AverageDistancePerStroke(strokes, dpsRate)
+		fmt.Printf("%s,%d,%d,%.2f,%d,%.2f\n",
+			util.MillisToLocal(activity.StartTimeMilliseconds, activity.Timezone)[:10],
+			activity.StartTimeMilliseconds,
+			n,
+			meters,
+			m,
+			atRate)
+		// the trend at the rate, as the distance per stroke falls with the rate
+		if m > 0 {
+			times = append(times, activity.StartTimeMilliseconds)
+			trend = append(trend, atRate)
+		}
+	}
+	if len(trend) < 2 {
+		fmt.Printf("Not enough activities at %d spm for a trend\n", dpsRate)
+		return
+	}
+	fmt.Printf("Distance per stroke at %d spm: %+.2f m per 30 days over %d activities\n", dpsRate, collector.DistancePerStrokeTrend(times, trend), len(trend))
+}
+
+func init() {
+	dpsCmd.Flags().Int64Var(&activityId, "id", 0, "id of the activity to show the distance per stroke of")
+	dpsCmd.Flags().IntVar(&dpsDays, "days", 90, "number of days of recent training to show")
+	dpsCmd.Flags().Uint64Var(&dpsRate, "rate", 20, "stroke rate to compare the distance per stroke at")
+}
@@ -0,0 +1,224 @@
+package commands
+
+import (
+	"bufio"
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/export"
+	"github.com/olympum/oarsman/s4"
+	"github.com/olympum/oarsman/storage"
+	"github.com/olympum/oarsman/util"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+var format string
+var sampleRate time.Duration
+var exportAll bool
+var exportWorkers int
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export workout data from database",
+	Long: `
+Exports one or multiple workouts from the database
+as RAW (40Hz JSON formatted feed), CSV, JSON or TCX (Garmin
+Training Center). CSV, JSON and TCX files are aggregated at
+10Hz before export.
+
+ERGDATA exports one row per stroke in the CSV dialect of ErgData and
+painsled, read by rowing analysis tools such as rowsandall, and ROWPRO
+in the CSV layout of RowPro, with the session totals and the strokes.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		if exportAll {
+			exportAllActivities(exportWorkers)
+		} else if !exportActivity(activityId) {
+			os.Exit(-1)
+		}
+	},
+}
+
+// exportActivity writes the activity to the temp folder, failing without
+// exiting, as the daemon exports its sessions too
+func exportActivity(activityId int64) bool {
+	if activityId == 0 {
+		jww.ERROR.Println("Activity id required")
+		return false
+	}
+
+	database, err := workoutDatabase()
+	if err != nil {
+		jww.ERROR.Println("Could not open the database", err)
+		return false
+	}
+	defer database.Close()
+
+	activity := database.FindActivityById(activityId)
+	if activity == nil {
+		jww.ERROR.Printf("Activity %d not found\n", activityId)
+		return false
+	}
+
+	return writeExport(database, activity)
+}
+
+// exportAllActivities exports the whole history with a bounded pool of
+// workers, each streaming one activity at a time
+func exportAllActivities(workers int) {
+	database := openDatabase()
+	defer database.Close()
+
+	activities := database.ListActivities()
+	if len(activities) == 0 {
+		jww.INFO.Println("No activities found")
+		return
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan *collector.Activity)
+	done := make(chan int64)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for activity := range jobs {
+				writeExport(database, activity)
+				done <- activity.StartTimeMilliseconds
+			}
+		}()
+	}
+	go func() {
+		for _, activity := range activities {
+			jobs <- activity
+		}
+		close(jobs)
+		wg.Wait()
+		close(done)
+	}()
+
+	n := 0
+	for id := range done {
+		n++
+		jww.INFO.Printf("Exported activity %d (%d/%d)\n", id, n, len(activities))
+	}
+}
+
+// writeExport writes the activity to the temp folder in the export format,
+// failing when it cannot be read
+func writeExport(database *storage.OarsmanDB, activity *collector.Activity) bool {
+	if format == "ERGDATA" {
+		return writeStrokeExport(activity, export.ErgDataCSVWriter, "_strokes.csv")
+	} else if format == "ROWPRO" {
+		return writeStrokeExport(activity, export.RowProCSVWriter, "_rowpro.csv")
+	}
+	var writerFunc export.StreamWriterFunc
+	var extension string
+	if format == "TCX" {
+		writerFunc, extension = export.TCXStreamWriter, ".tcx"
+	} else if format == "CSV" {
+		writerFunc, extension = export.CSVStreamWriter, ".csv"
+	} else if format == "JSON" {
+		writerFunc, extension = export.JSONStreamWriter, ".json"
+	} else {
+		jww.ERROR.Printf("Unknow export file format %s\n", format)
+		return false
+	}
+
+	// the samples are streamed from the workout log to the output file,
+	// with the lap summaries from the database
+	laps := database.FindLapsByParentId(activity.StartTimeMilliseconds)
+	aggregateEventChannel := make(chan s4.AggregateEvent)
+	inputFile := workoutLogFile(activity.StartTimeMilliseconds)
+	s, err := s4.NewReplayS4(nil, aggregateEventChannel, false, inputFile, false)
+	if err != nil {
+		jww.ERROR.Printf("Could not read the workout log of activity %d: %v\n", activity.StartTimeMilliseconds, err)
+		return false
+	}
+	go s.Run(nil)
+
+	var events <-chan s4.AggregateEvent = aggregateEventChannel
+	if sampleRate > 0 {
+		events = collector.ResampleStream(events, sampleRate, laps)
+	}
+
+	prefix := viper.GetString("TempFolder") + string(os.PathSeparator) + util.MillisToZulu(activity.StartTimeMilliseconds)
+	export.ExportStream(activity, laps, events, prefix+extension, writerFunc)
+	return true
+}
+
+// writeStrokeExport writes the strokes of the activity, from its workout log,
+// to the temp folder, the file name ending with suffix
+func writeStrokeExport(activity *collector.Activity, writerFunc export.StrokeWriterFunc, suffix string) bool {
+	events, err := s4.ReadLog(workoutLogFile(activity.StartTimeMilliseconds))
+	if err != nil {
+		jww.ERROR.Printf("Could not read the strokes of activity %d: %v\n", activity.StartTimeMilliseconds, err)
+		return false
+	}
+	filename := viper.GetString("TempFolder") + string(os.PathSeparator) + util.MillisToZulu(activity.StartTimeMilliseconds) + suffix
+	f, err := os.Create(filename)
+	if err != nil {
+		jww.ERROR.Printf("Could not create %s\n", filename)
+		return false
+	}
+	defer f.Close()
+	jww.INFO.Printf("Writing the strokes to %s\n", f.Name())
+	writerFunc(activity, collector.NewStrokes(events), bufio.NewWriter(f))
+	return true
+}
+
+func workoutLogFile(startTimeMilliseconds int64) string {
+	return viper.GetString("WorkoutFolder") + string(os.PathSeparator) + util.MillisToZulu(startTimeMilliseconds) + ".log"
+}
+
+// replayActivity rebuilds the activity events from its workout log file
+func replayActivity(activity *collector.Activity) *collector.Activity {
+	return replayActivityLog(activity, workoutLogFile(activity.StartTimeMilliseconds))
+}
+
+// replayActivityLog rebuilds the activity events from a workout log file,
+// e.g. of another profile
+func replayActivityLog(activity *collector.Activity, logFile string) *collector.Activity {
+	aggregateEventChannel := make(chan s4.AggregateEvent)
+	collector := collector.NewEventCollector(aggregateEventChannel)
+	go collector.Run()
+
+	s, err := s4.NewReplayS4(nil, aggregateEventChannel, false, logFile, false)
+	if err != nil {
+		return nil
+	}
+	s.Run(nil)
+
+	replayed := collector.Activity()
+	if replayed != nil {
+		replayed.Recovered = activity.Recovered
+		replayed.Timezone = activity.Timezone
+		replayed.TankNotes = activity.TankNotes
+		replayed.Workout = activity.Workout
+		replayed.Notes = activity.Notes
+		replayed.Tags = activity.Tags
+		replayed.TrainingLoad = activity.TrainingLoad
+		replayed.DifficultyScore = activity.DifficultyScore
+		if activity.AutoIntervals {
+			if detected := replayed.DetectIntervals(); detected != nil {
+				replayed = detected
+			}
+		}
+	}
+	return replayed
+}
+
+func init() {
+	exportCmd.Flags().Int64Var(&activityId, "id", 0, "id of activity to export")
+	exportCmd.Flags().StringVar(&format, "format", "TCX", "format to export activity as, TCX, CSV, JSON, ERGDATA or ROWPRO (stroke by stroke CSV)")
+	exportCmd.Flags().BoolVar(&exportAll, "all", false, "export all the activities in the database")
+	exportCmd.Flags().IntVar(&exportWorkers, "workers", runtime.NumCPU(), "number of activities exported concurrently with --all")
+	exportCmd.Flags().DurationVar(&sampleRate, "sample-rate", 0, "merge the samples over this duration (e.g. 30s) for smaller files")
+}
@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/export"
+	"github.com/olympum/oarsman/storage"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"os"
+	"time"
+)
+
+var fitnessDays int
+var fitnessCSV bool
+var fitnessFile string
+
+var fitnessCmd = &cobra.Command{
+	Use:   "fitness",
+	Short: "Show the fitness, fatigue and form over time",
+	Long: `
+Shows the fitness (chronic training load, CTL), fatigue (acute
+training load, ATL) and form (training stress balance, TSB) of the
+last days, from the training load saved with every activity: the
+minutes in each heart rate zone, relative to the MaxHeartRate
+configuration parameter, times the number of the zone. The fitness
+and fatigue average the daily load over 42 and 7 days, and the form,
+their difference, is positive when fresh, e.g. before a race, and
+negative when building up.
+
+The series is kept in the database, updated whenever an activity is
+saved. With --csv, the whole series is exported as CSV for plotting.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		showFitness()
+	},
+}
+
+// updateFitness saves the training load of the activities saved without it,
+// when their workout log is still around, and the fitness series up to today
+func updateFitness(database *storage.OarsmanDB) []collector.Fitness {
+	maxHeartRate := uint64(viper.GetInt("MaxHeartRate"))
+	activities := database.ListActivities()
+	for _, activity := range activities {
+		if activity.TrainingLoad != 0 || activity.TotalTimeSeconds == 0 {
+			continue
+		}
+		replayed := replayActivity(activity)
+		if replayed == nil {
+			continue
+		}
+		activity.TrainingLoad = replayed.Load(maxHeartRate)
+		if err := database.UpdateTrainingLoad(activity.StartTimeMilliseconds, activity.TrainingLoad); err != nil {
+			jww.ERROR.Printf("Could not save the training load of activity %d: %v\n", activity.StartTimeMilliseconds, err)
+		}
+	}
+
+	series := collector.FitnessSeries(activities, time.Now())
+	if err := database.ReplaceFitness(series); err != nil {
+		jww.ERROR.Printf("Could not save the fitness: %v\n", err)
+	}
+	return series
+}
+
+func showFitness() {
+	database := openDatabase()
+	defer database.Close()
+
+	updateFitness(database)
+	series := database.FindFitness(time.Local)
+	if len(series) == 0 {
+		jww.INFO.Println("No activities found")
+		return
+	}
+
+	today := series[len(series)-1]
+	fmt.Printf("Fitness %.1f, fatigue %.1f, form %.1f\n", today.Fitness, today.Fatigue, today.Form)
+	recent := series
+	if len(recent) > fitnessDays {
+		recent = recent[len(recent)-fitnessDays:]
+	}
+	export.FitnessCSVWriter(recent, bufio.NewWriter(os.Stdout))
+
+	if !fitnessCSV {
+		return
+	}
+	if fitnessFile == "" {
+		fitnessFile = viper.GetString("TempFolder") + string(os.PathSeparator) + "fitness.csv"
+	}
+	f, err := os.Create(fitnessFile)
+	if err != nil {
+		jww.ERROR.Printf("Could not create %s\n", fitnessFile)
+		return
+	}
+	defer f.Close()
+	jww.INFO.Printf("Writing the fitness of %d days to %s\n", len(series), f.Name())
+	export.FitnessCSVWriter(series, bufio.NewWriter(f))
+}
+
+func init() {
+	fitnessCmd.Flags().IntVar(&fitnessDays, "days", 14, "number of days shown")
+	fitnessCmd.Flags().BoolVar(&fitnessCSV, "csv", false, "export the whole series as CSV")
+	fitnessCmd.Flags().StringVar(&fitnessFile, "output", "", "CSV output file (defaults to fitness.csv in the temp folder)")
+}
@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"encoding/json"
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/server"
+	"github.com/olympum/oarsman/util"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+var flushCmd = &cobra.Command{
+	Use:   "flush",
+	Short: "Save workouts waiting in the pending queue",
+	Long: `
+Saves in the database the workouts that could not be saved when they
+were completed or imported, e.g. because the database could not be
+opened. Pending workouts are also retried every time oarsman starts.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// pending workouts are retried when initializing
+		InitializeConfig()
+		if pending := pendingLogs(); len(pending) > 0 {
+			jww.WARN.Printf("%d workout(s) could not be saved and remain in %s\n", len(pending), viper.GetString("PendingFolder"))
+		} else {
+			jww.INFO.Println("No pending workouts")
+		}
+	},
+}
+
+// pendingActivity is saved alongside a queued workout log with what is not
+// recorded in the log itself
+type pendingActivity struct {
+	StartTimeMilliseconds int64
+	server.ActivityDetails
+}
+
+// activityDetails returns the details of the activity not recorded in its
+// raw log
+func activityDetails(activity *collector.Activity) server.ActivityDetails {
+	return server.ActivityDetails{
+		Timezone:  activity.Timezone,
+		TankNotes: activity.TankNotes,
+		Recovered: activity.Recovered,
+		Workout:   activity.Workout,
+		Notes:     activity.Notes,
+		Tags:      activity.Tags}
+}
+
+func pendingName(logFile string) string {
+	return strings.TrimSuffix(logFile, ".log") + ".json"
+}
+
+// queueActivity moves the workout log to the pending folder, so the activity
+// can be saved later with flush, returning whether it was queued
+func queueActivity(logFile string, activity *collector.Activity) bool {
+	queued := viper.GetString("PendingFolder") + string(os.PathSeparator) + util.MillisToZulu(activity.StartTimeMilliseconds) + ".log"
+	b, err := json.Marshal(pendingActivity{
+		StartTimeMilliseconds: activity.StartTimeMilliseconds,
+		ActivityDetails:       activityDetails(activity)})
+	if err == nil {
+		err = ioutil.WriteFile(pendingName(queued), b, 0600)
+	}
+	if err == nil {
+		err = os.Rename(logFile, queued)
+	}
+	if err != nil {
+		jww.ERROR.Printf("Could not queue activity %d: %v\n", activity.StartTimeMilliseconds, err)
+		return false
+	}
+	jww.WARN.Printf("Activity %d could not be saved, queued in %s (run `oarsman flush` to retry)\n", activity.StartTimeMilliseconds, queued)
+	return true
+}
+
+func pendingLogs() []string {
+	pendingFolder := viper.GetString("PendingFolder")
+	contents, err := ioutil.ReadDir(pendingFolder)
+	if err != nil {
+		jww.ERROR.Println(err)
+		return nil
+	}
+
+	logs := []string{}
+	for _, f := range contents {
+		if !f.IsDir() && isTrainingLog(f.Name()) {
+			logs = append(logs, pendingFolder+string(os.PathSeparator)+f.Name())
+		}
+	}
+	return logs
+}
+
+// flushPendingActivities retries saving the queued workouts, removing them
+// from the queue once saved
+func flushPendingActivities() {
+	pending := pendingLogs()
+	if len(pending) == 0 {
+		return
+	}
+
+	database, error := workoutDatabase()
+	if error != nil {
+		jww.WARN.Printf("%d workout(s) pending, could not open the database\n", len(pending))
+		return
+	}
+	defer database.Close()
+
+	jww.INFO.Printf("Saving %d pending workout(s)\n", len(pending))
+	for _, logFile := range pending {
+		var queued pendingActivity
+		b, err := ioutil.ReadFile(pendingName(logFile))
+		if err == nil {
+			err = json.Unmarshal(b, &queued)
+		}
+		if err != nil {
+			jww.ERROR.Printf("Could not read %s: %v\n", pendingName(logFile), err)
+			continue
+		}
+
+		if database.FindActivityById(queued.StartTimeMilliseconds) != nil {
+			jww.INFO.Printf("Activity %d already saved, removing %s\n", queued.StartTimeMilliseconds, logFile)
+		} else if importActivity(logFile, false, queued.ActivityDetails) == nil {
+			continue
+		}
+		os.Remove(logFile)
+		os.Remove(pendingName(logFile))
+	}
+}
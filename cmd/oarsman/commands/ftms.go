@@ -0,0 +1,36 @@
+package commands
+
+import (
+	"github.com/olympum/oarsman/ble"
+	"github.com/olympum/oarsman/s4"
+	"github.com/olympum/oarsman/server"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+)
+
+// newFTMS broadcasts as a BLE fitness machine on the FTMSDevice adapter, the
+// training apps starting and stopping the workouts of the recorder; nil if
+// no adapter is set. The sessions are recorded even if it cannot advertise.
+func newFTMS(recorder server.Recorder) *ble.FTMS {
+	device := viper.GetInt("FTMSDevice")
+	if device < 0 {
+		return nil
+	}
+	f := ble.NewFTMS(viper.GetString("FTMSName"), recorder)
+	go func() {
+		if err := f.Serve(device); err != nil {
+			jww.ERROR.Printf("Could not broadcast as a fitness machine: %v\n", err)
+		}
+	}()
+	return f
+}
+
+// broadcastFTMS broadcasts the live metrics of the workout as the rower
+// data of the fitness machine, if any
+func broadcastFTMS(f *ble.FTMS, s s4.S4Interface) {
+	if f == nil {
+		return
+	}
+	events, _ := s.Subscribe(ble.FTMSMetrics...)
+	go f.Run(events)
+}
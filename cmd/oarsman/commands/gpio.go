@@ -0,0 +1,132 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/olympum/oarsman/coach"
+	"github.com/olympum/oarsman/gpio"
+	"github.com/olympum/oarsman/s4"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"strconv"
+	"strings"
+)
+
+// default beeps of the buzzer per cue, sounded at the interval boundaries
+var defaultBuzzerBeeps = map[string]int{
+	string(coach.CueIntervalStart): 3,
+	string(coach.CueIntervalEnd):   2,
+}
+
+// openPin opens the GPIO pin of the parameter, nil if none (negative)
+func openPin(configName string, number int) (*gpio.Pin, error) {
+	if number < 0 {
+		return nil, nil
+	}
+	pin, err := gpio.OpenPin(number)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", configName, err)
+	}
+	return pin, nil
+}
+
+// newFeedback returns the feedback of the GPIOStrokePin and GPIOZonePins
+// LEDs, nil if none or if they cannot be opened: the workout is recorded
+// without them
+func newFeedback() *gpio.Feedback {
+	zonePins := viper.GetString("GPIOZonePins")
+	strokePin := viper.GetInt("GPIOStrokePin")
+	if strokePin < 0 && zonePins == "" {
+		return nil
+	}
+	feedback := &gpio.Feedback{Pulse: viper.GetDuration("GPIOStrokePulse")}
+	var err error
+	if feedback.Stroke, err = outputOf(openPin("GPIOStrokePin", strokePin)); err != nil {
+		jww.ERROR.Printf("Invalid GPIO feedback: %v\n", err)
+		return nil
+	}
+	if zonePins == "" {
+		return feedback
+	}
+
+	// below, in and above the zone, e.g. "22,27,17"
+	tokens := strings.Split(zonePins, ",")
+	if len(tokens) != 3 {
+		jww.ERROR.Printf("Invalid GPIOZonePins %q, the pins below, in and above the zone, e.g. 22,27,17\n", zonePins)
+		return nil
+	}
+	outputs := make([]gpio.Output, 3)
+	for i, token := range tokens {
+		number, err := strconv.Atoi(strings.TrimSpace(token))
+		if err != nil {
+			jww.ERROR.Printf("Invalid GPIOZonePins %q: %v\n", zonePins, err)
+			return nil
+		}
+		if outputs[i], err = outputOf(openPin("GPIOZonePins", number)); err != nil {
+			jww.ERROR.Printf("Invalid GPIO feedback: %v\n", err)
+			return nil
+		}
+	}
+	feedback.Below, feedback.In, feedback.Above = outputs[0], outputs[1], outputs[2]
+
+	zone := viper.GetString("HeartRateZone")
+	if heartRateZone != "" {
+		zone = heartRateZone
+	}
+	feedback.ZoneMetric = s4.MetricHeartRate
+	if metric := viper.GetString("GPIOZoneMetric"); metric == "power" {
+		feedback.ZoneMetric = s4.MetricWatts
+		zone = viper.GetString("PowerZone")
+		if powerZone != "" {
+			zone = powerZone
+		}
+	} else if metric != "heart_rate" {
+		jww.ERROR.Printf("Invalid GPIOZoneMetric %s, heart_rate or power\n", metric)
+		return nil
+	}
+	if feedback.Zone, err = coach.ParseZone(zone); err != nil {
+		jww.ERROR.Printf("Invalid zone of the GPIO feedback: %v\n", err)
+		return nil
+	}
+	return feedback
+}
+
+// outputOf returns the pin as an output, nil (rather than a nil pin) if none
+func outputOf(pin *gpio.Pin, err error) (gpio.Output, error) {
+	if pin == nil {
+		return nil, err
+	}
+	return pin, err
+}
+
+// driveFeedback drives the LEDs of the feedback during the workout, if any
+func driveFeedback(feedback *gpio.Feedback, s s4.S4Interface) {
+	if feedback == nil {
+		return
+	}
+	events, _ := s.Subscribe(feedback.Metrics()...)
+	go feedback.Run(events)
+}
+
+// buzzerAlerter returns the alerter of the buzzer on the GPIOBuzzerPin,
+// beeping the GPIOBuzzerBeeps times per cue
+func buzzerAlerter() (coach.Alerter, error) {
+	number := viper.GetInt("GPIOBuzzerPin")
+	if number < 0 {
+		return nil, fmt.Errorf("no GPIOBuzzerPin for the GPIO alerts")
+	}
+	pin, err := openPin("GPIOBuzzerPin", number)
+	if err != nil {
+		return nil, err
+	}
+	beeps := viper.GetStringMapString("GPIOBuzzerBeeps")
+	buzzer := gpio.Buzzer{Output: pin, Beeps: map[coach.Cue]int{}}
+	for cue, n := range defaultBuzzerBeeps {
+		buzzer.Beeps[coach.Cue(cue)] = n
+	}
+	for cue, n := range beeps {
+		if buzzer.Beeps[coach.Cue(cue)], err = strconv.Atoi(n); err != nil {
+			return nil, fmt.Errorf("invalid GPIOBuzzerBeeps of %s: %v", cue, err)
+		}
+	}
+	return buzzer, nil
+}
@@ -0,0 +1,241 @@
+package commands
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/logbook"
+	"github.com/olympum/oarsman/s4"
+	"github.com/olympum/oarsman/server"
+	"github.com/olympum/oarsman/util"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var replay bool
+var inputFile string
+var timezone string
+var tankNotes string
+var concept2File string
+var activityNotes string
+var activityTags string
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import workout data from database",
+	Long: `
+Imports one or multiple workouts into the database
+as RAW (40Hz JSON formatted feed).
+
+With --concept2, imports instead the history exported as CSV from the
+Concept2 online logbook (log.concept2.com, History, Export Data), e.g.
+the sessions rowed before oarsman or on another erg. The logbook keeps
+summaries only, so they are saved without laps nor a raw log, and count
+towards the fitness, the leaderboard and the weekly totals, though they
+cannot be replayed nor synced. The results skied or biked are skipped,
+as are those already imported.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		if concept2File != "" {
+			importConcept2(concept2File, timezone)
+			return
+		}
+		if !cmd.Flags().Changed("tank") {
+			tankNotes = viper.GetString("TankNotes")
+		}
+		activity := importActivity(inputFile, replay, server.ActivityDetails{
+			Timezone:  timezone,
+			TankNotes: tankNotes,
+			Notes:     activityNotes,
+			Tags:      collector.ParseTags(activityTags)})
+		if activity == nil {
+			os.Exit(-1)
+		}
+	},
+}
+
+// importActivity saves the activity in the input log to the database, with
+// the details not recorded in the log, and queues it in the pending folder
+// if it cannot be saved
+func importActivity(inputFile string, replay bool, details server.ActivityDetails) *collector.Activity {
+
+	if inputFile == "" {
+		jww.ERROR.Println("Nothing to import")
+		return nil
+	}
+	jww.INFO.Printf("Importing activity from %s\n", inputFile)
+
+	zone := details.Timezone
+	if zone == "" {
+		zone = util.LocalTimezone()
+	} else if _, err := time.LoadLocation(zone); err != nil {
+		jww.ERROR.Printf("Unknown timezone %s\n", zone)
+		return nil
+	}
+
+	// Parse input file path to construct the fully qualified file name
+	// Write output file using a UUID as file name
+	eventChannel := make(chan s4.AtomicEvent)
+	aggregateEventChannel := make(chan s4.AggregateEvent)
+	collector := collector.NewEventCollector(aggregateEventChannel)
+	go collector.Run()
+
+	s, err := s4.NewReplayS4(eventChannel, aggregateEventChannel, replay, inputFile, replay)
+	if err != nil {
+		jww.ERROR.Printf("Could not read %s: %v\n", inputFile, err)
+		return nil
+	}
+
+	fqOfn := viper.GetString("TempFolder") + string(os.PathSeparator) + randomId()
+	logged := make(chan bool)
+	go s4.LogEvents(eventChannel, fqOfn, 0, logged)
+
+	s.Run(nil)
+	<-logged
+
+	activity := collector.Activity()
+	if activity == nil {
+		jww.ERROR.Printf("Empty or incorrect activity for log file %s\n", inputFile)
+		return nil
+	}
+	jww.INFO.Printf("Parsed activity with start time %d\n", activity.StartTimeMilliseconds)
+	activity.Recovered = details.Recovered
+	activity.Timezone = zone
+	activity.TankNotes = details.TankNotes
+	activity.Workout = details.Workout
+	activity.Notes = details.Notes
+	activity.Tags = details.Tags
+	maxHeartRate := uint64(viper.GetInt("MaxHeartRate"))
+	activity.TrainingLoad = activity.Load(maxHeartRate)
+	if viper.GetBool("AutoIntervals") {
+		if detected := activity.DetectIntervals(); detected != nil {
+			jww.INFO.Printf("Detected intervals, %d laps\n", len(detected.Laps()))
+			activity = detected
+		}
+	}
+	activity.DifficultyScore = activity.Difficulty(maxHeartRate)
+
+	database, error := workoutDatabase()
+	if error != nil {
+		jww.ERROR.Println("Could not open the database", error)
+		queueImport(inputFile, fqOfn, activity)
+		return nil
+	}
+	defer database.Close()
+
+	if database.FindActivityById(activity.StartTimeMilliseconds) != nil {
+		jww.ERROR.Printf("Activity %d already exists in database\n", activity.StartTimeMilliseconds)
+		return nil
+	}
+	if database.InsertActivity(activity) == nil {
+		queueImport(inputFile, fqOfn, activity)
+		return nil
+	}
+	// move file to workout folder
+	jww.INFO.Printf("Activity %d saved to database\n", activity.StartTimeMilliseconds)
+	saveStrokes(database, activity.StartTimeMilliseconds, fqOfn)
+	saveEfforts(database, activity)
+
+	workoutFile := viper.GetString("WorkoutFolder") + string(os.PathSeparator) + util.MillisToZulu(activity.StartTimeMilliseconds) + ".log"
+	os.Rename(fqOfn, workoutFile)
+	jww.INFO.Printf("Activity log saved in %s\n", workoutFile)
+	updateFitness(database)
+	checkOdometer(database, activity)
+	return activity
+}
+
+// queueImport queues the activity imported that could not be saved. Once
+// queued, the session log it was imported from is removed if in the temp
+// folder, so that it is not recovered again as an interrupted workout; the
+// logs imported from elsewhere are left as they are.
+func queueImport(inputFile string, logFile string, activity *collector.Activity) {
+	if !queueActivity(logFile, activity) {
+		return
+	}
+	if filepath.Dir(inputFile) == filepath.Clean(viper.GetString("TempFolder")) {
+		os.Remove(inputFile)
+	}
+}
+
+// importConcept2 saves the rowing results of a Concept2 logbook CSV export
+// to the database, their dates in the timezone
+func importConcept2(file string, zone string) {
+	if zone == "" {
+		zone = util.LocalTimezone()
+	}
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		jww.ERROR.Printf("Unknown timezone %s\n", zone)
+		return
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		jww.ERROR.Println(err)
+		return
+	}
+	defer f.Close()
+	results, err := logbook.ReadCSV(f, location)
+	if err != nil {
+		jww.ERROR.Println(err)
+		return
+	}
+
+	database, error := workoutDatabase()
+	if error != nil {
+		jww.ERROR.Println("Could not open the database", error)
+		return
+	}
+	defer database.Close()
+
+	maxHeartRate := uint64(viper.GetInt("MaxHeartRate"))
+	imported, skipped := 0, 0
+	for _, result := range results {
+		activity := result.Activity(zone)
+		if !result.Rowing() || database.FindActivityById(activity.StartTimeMilliseconds) != nil {
+			skipped++
+			continue
+		}
+		activity.TrainingLoad = activity.Load(maxHeartRate)
+		activity.DifficultyScore = activity.Difficulty(maxHeartRate)
+		if database.InsertActivity(activity) == nil {
+			jww.ERROR.Printf("Could not save the result of %s\n", activity.StartTimeZulu)
+			continue
+		}
+		if err := database.InsertEfforts(activity.StartTimeMilliseconds, result.Efforts(collector.EffortDistances)); err != nil {
+			jww.ERROR.Printf("Could not save the efforts of activity %d: %v\n", activity.StartTimeMilliseconds, err)
+		}
+		imported++
+	}
+	jww.INFO.Printf("Imported %d results from %s, skipped %d\n", imported, file, skipped)
+	if imported > 0 {
+		updateFitness(database)
+	}
+}
+
+func init() {
+	importCmd.Flags().BoolVar(&replay, "replay", false, "print to stdout using precise time the original recorded the raw data packets")
+	importCmd.Flags().StringVar(&inputFile, "input", "", "input file to import")
+	importCmd.Flags().StringVar(&timezone, "timezone", "", "IANA timezone where the workout took place, e.g. Europe/London (defaults to the local timezone)")
+	importCmd.Flags().StringVar(&concept2File, "concept2", "", "Concept2 logbook CSV export to import, instead of a raw log")
+	importCmd.Flags().StringVar(&tankNotes, "tank", "", "tank water level and calibration notes (defaults to TankNotes in the config)")
+	importCmd.Flags().StringVar(&activityNotes, "notes", "", "notes on the workout, e.g. how it went, to find it with search")
+	importCmd.Flags().StringVar(&activityTags, "tags", "", "comma separated tags of the workout, e.g. threshold,race")
+}
+
+func randomId() string {
+	size := 32
+	rb := make([]byte, size)
+	_, err := rand.Read(rb)
+
+	if err != nil {
+		jww.ERROR.Println(err)
+		return string(time.Now().Nanosecond())
+	}
+
+	return base64.URLEncoding.EncodeToString(rb)
+}
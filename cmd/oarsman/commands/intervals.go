@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/olympum/oarsman/collector"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+)
+
+var intervalsCmd = &cobra.Command{
+	Use:   "intervals",
+	Short: "Detect the intervals of a just row activity",
+	Long: `
+Detects the work and recovery intervals of a just row activity from
+its power, e.g. unplanned bursts or a workout not programmed on the
+monitor, and saves them as the laps of the activity, in place of the
+2000 m auto-laps, so that they are analysed and exported like the
+intervals of a programmed workout. The recovery intervals are rowed,
+so they count in the activity summary unlike programmed rests.
+
+With AutoIntervals in the configuration, the intervals are detected
+when the activities are imported.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		if activityId == 0 {
+			jww.ERROR.Println("Activity id required")
+			return
+		}
+		detectIntervals(activityId)
+	},
+}
+
+func detectIntervals(id int64) {
+	database := openDatabase()
+	defer database.Close()
+
+	activity := database.FindActivityById(id)
+	if activity == nil {
+		jww.ERROR.Printf("Activity %d not found\n", id)
+		return
+	}
+	activity = replayActivity(activity)
+	if activity == nil {
+		jww.ERROR.Printf("Could not read workout log for activity %d\n", id)
+		return
+	}
+	detected := activity.DetectIntervals()
+	if detected == nil {
+		jww.INFO.Printf("No intervals found in activity %d\n", id)
+		return
+	}
+	if err := database.ReplaceLaps(detected); err != nil {
+		jww.ERROR.Printf("Could not save the intervals of activity %d: %v\n", id, err)
+		return
+	}
+	// the intervals make the session harder
+	detected.DifficultyScore = detected.Difficulty(uint64(viper.GetInt("MaxHeartRate")))
+	if err := database.UpdateDifficulty(id, detected.DifficultyScore); err != nil {
+		jww.ERROR.Printf("Could not save the difficulty of activity %d: %v\n", id, err)
+	}
+	printIntervals(detected)
+}
+
+// printIntervals prints the laps detected, alternating work and recovery
+func printIntervals(activity *collector.Activity) {
+	fmt.Println("lap,start_time,distance,duration,ave_speed,ave_cadence,ave_power,ave_hr")
+	for i, lap := range activity.Laps() {
+		fmt.Printf("%d,%s,%d,%d,%.2f,%d,%d,%d\n",
+			i+1,
+			lap.StartTimeZulu,
+			lap.DistanceMeters,
+			lap.TotalTimeSeconds,
+			lap.AverageSpeedMs,
+			lap.AverageCadenceRpm,
+			lap.AveragePowerWatts,
+			lap.AverageHeartRateBpm)
+	}
+}
+
+func init() {
+	intervalsCmd.Flags().Int64Var(&activityId, "id", 0, "id of the activity")
+}
@@ -0,0 +1,197 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/storage"
+	"github.com/olympum/oarsman/util"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// the name of the profile of the working folder itself, used without
+// --profile
+const defaultProfile = "default"
+
+var leaderboardCmd = &cobra.Command{
+	Use:   "leaderboard",
+	Short: "Rank the athlete profiles",
+	Long: `
+Ranks the athlete profiles sharing the working folder, e.g. the
+members of a household, on the fastest 500m, 1k, 2k, 5k, 6k and 10k
+rowed within any of their activities, and on the most meters rowed in
+a week, ever and this week. The profile of the working folder itself,
+used without --profile, is ranked as "default". The databases of the
+profiles are only read, those of an older version of oarsman being
+skipped until a command is run with their profile.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		showLeaderboard()
+	},
+}
+
+// profileStanding is the best of a profile for the leaderboards
+type profileStanding struct {
+	profile   string
+	efforts   map[uint64]collector.Effort
+	bestWeek  collector.WeekSummary
+	thisWeek  uint64
+	timezones map[int64]string // of the activities of the efforts
+}
+
+// profileFolders returns the working folder of every profile by name
+func profileFolders() map[string]string {
+	workingFolder := viper.GetString("WorkingFolder")
+	folders := map[string]string{defaultProfile: workingFolder}
+	files, _ := ioutil.ReadDir(filepath.Join(workingFolder, "profiles"))
+	for _, f := range files {
+		if f.IsDir() {
+			folders[f.Name()] = filepath.Join(workingFolder, "profiles", f.Name())
+		}
+	}
+	return folders
+}
+
+// saveEfforts saves the best efforts of the activity, for the leaderboards
+func saveEfforts(database *storage.OarsmanDB, activity *collector.Activity) {
+	if err := database.InsertEfforts(activity.StartTimeMilliseconds, activity.BestEfforts(collector.EffortDistances)); err != nil {
+		jww.ERROR.Printf("Could not save the best efforts of activity %d: %v\n", activity.StartTimeMilliseconds, err)
+	}
+}
+
+// standing reads the best efforts and weeks of the profile in folder. The
+// database is only read, as it may be another profile's: the efforts of the
+// activities imported before the leaderboards are replayed from their logs
+// instead of saved.
+func standing(profile string, folder string, now time.Time) (*profileStanding, error) {
+	database, err := storage.OpenDatabaseReadOnly(filepath.Join(folder, "db"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer database.Close()
+	migrated, err := database.IsMigrated()
+	if err != nil {
+		return nil, err
+	}
+	if !migrated {
+		return nil, errors.New("not migrated to this version of oarsman, run a command with its profile first")
+	}
+
+	activities := database.ListActivities()
+	if len(activities) == 0 {
+		return nil, nil
+	}
+	s := &profileStanding{
+		profile:   profile,
+		efforts:   map[uint64]collector.Effort{},
+		bestWeek:  collector.BestWeek(activities, now.Location()),
+		timezones: map[int64]string{}}
+	for _, effort := range database.FindBestEfforts() {
+		s.efforts[effort.DistanceMeters] = effort
+	}
+	saved := database.FindEffortActivityIds()
+	for _, activity := range activities {
+		if saved[activity.StartTimeMilliseconds] || activity.DistanceMeters < collector.EffortDistances[0] {
+			continue
+		}
+		logFile := filepath.Join(folder, "workouts", util.MillisToZulu(activity.StartTimeMilliseconds)+".log")
+		if _, err := os.Stat(logFile); err != nil {
+			continue
+		}
+		jww.DEBUG.Printf("Replaying the best efforts of activity %d of %s\n", activity.StartTimeMilliseconds, profile)
+		for _, effort := range replayActivityLog(activity, logFile).BestEfforts(collector.EffortDistances) {
+			if best, ok := s.efforts[effort.DistanceMeters]; !ok || effort.Milliseconds < best.Milliseconds {
+				s.efforts[effort.DistanceMeters] = effort
+			}
+		}
+	}
+	for _, activity := range activities {
+		s.timezones[activity.StartTimeMilliseconds] = activity.Timezone
+	}
+	if weeks := collector.WeeklySummaries(activities, now, 1); len(weeks) > 0 {
+		s.thisWeek = weeks[0].DistanceMeters
+	}
+	return s, nil
+}
+
+func showLeaderboard() {
+	now := time.Now()
+	folders := profileFolders()
+	names := []string{}
+	for name := range folders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	standings := []*profileStanding{}
+	for _, name := range names {
+		s, err := standing(name, folders[name], now)
+		if err != nil {
+			jww.ERROR.Printf("Could not open the database of %s: %v\n", name, err)
+			continue
+		}
+		if s != nil {
+			standings = append(standings, s)
+		}
+	}
+	if len(standings) == 0 {
+		fmt.Println("No activities")
+		return
+	}
+
+	for _, distance := range collector.EffortDistances {
+		ranked := []*profileStanding{}
+		for _, s := range standings {
+			if _, ok := s.efforts[distance]; ok {
+				ranked = append(ranked, s)
+			}
+		}
+		if len(ranked) == 0 {
+			continue
+		}
+		sort.SliceStable(ranked, func(i, j int) bool {
+			return ranked[i].efforts[distance].Milliseconds < ranked[j].efforts[distance].Milliseconds
+		})
+		fmt.Printf("\nFastest %d m\n", distance)
+		fmt.Println("rank,profile,time,pace,activity,date")
+		for i, s := range ranked {
+			effort := s.efforts[distance]
+			fmt.Printf("%d,%s,%s,%s,%d,%s\n",
+				i+1,
+				s.profile,
+				util.SecondsToPace(float64(effort.Milliseconds)/1000),
+				util.SecondsToPace(effort.Pace()),
+				effort.StartTimeMilliseconds,
+				util.MillisToLocal(effort.StartTimeMilliseconds, s.timezones[effort.StartTimeMilliseconds]))
+		}
+	}
+
+	ranked := append([]*profileStanding{}, standings...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].bestWeek.DistanceMeters > ranked[j].bestWeek.DistanceMeters
+	})
+	fmt.Println("\nMost weekly meters")
+	fmt.Println("rank,profile,meters,week,sessions")
+	for i, s := range ranked {
+		fmt.Printf("%d,%s,%d,%s,%d\n", i+1, s.profile, s.bestWeek.DistanceMeters, s.bestWeek.Start.Format("2006-01-02"), s.bestWeek.Sessions)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].thisWeek > ranked[j].thisWeek
+	})
+	fmt.Println("\nMeters this week")
+	fmt.Println("rank,profile,meters")
+	for i, s := range ranked {
+		fmt.Printf("%d,%s,%d\n", i+1, s.profile, s.thisWeek)
+	}
+}
@@ -2,15 +2,21 @@ package commands
 
 import (
 	"fmt"
+	"github.com/olympum/oarsman/util"
 	"github.com/spf13/cobra"
 	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
 )
 
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all workout activities in the database",
 	Long: `
-Lists all the activities stored in the database`,
+Lists all the activities stored in the database, with the aerobic
+decoupling of the steady sessions, flagged with a "!" above the
+DecouplingThresholdPercent configuration parameter, and the
+difficulty of every session, from 0 for an easy spin to 10 for a long
+session of hard intervals.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		InitializeConfig()
 		if activityId > 0 {
@@ -23,23 +29,24 @@ Lists all the activities stored in the database`,
 
 func listLaps(activityId int64) {
 	jww.DEBUG.Println("Looking for laps for activity", activityId)
-	database, error := workoutDatabase()
-	if error != nil {
-		// TODO
-		return
-	}
+	database := openDatabase()
 	defer database.Close()
 
 	laps := database.FindLapsByParentId(activityId)
 	if laps == nil {
 		return
 	}
+	zone := ""
+	if activity := database.FindActivityById(activityId); activity != nil {
+		zone = activity.Timezone
+	}
 
-	fmt.Println("id,start_time,distance,duration,ave_speed,max_speed,ave_cadence,max_cadence,ave_power,max_power,calories,ave_hr,max_hr")
+	fmt.Println("id,start_time,local_time,distance,duration,ave_speed,max_speed,ave_cadence,max_cadence,ave_power,max_power,calories,ave_hr,max_hr")
 	for _, lap := range laps {
-		fmt.Printf("%d,%s,%d,%d,%.2f,%.2f,%v,%v,%v,%v,%v,%v,%v\n",
+		fmt.Printf("%d,%s,%s,%d,%d,%.2f,%.2f,%v,%v,%v,%v,%v,%v,%v\n",
 			lap.StartTimeMilliseconds,
 			lap.StartTimeZulu,
+			util.MillisToLocal(lap.StartTimeMilliseconds, zone),
 			lap.DistanceMeters,
 			lap.TotalTimeSeconds,
 			lap.AverageSpeedMs,
@@ -56,11 +63,7 @@ func listLaps(activityId int64) {
 }
 
 func listActivities() {
-	database, error := workoutDatabase()
-	if error != nil {
-		// TODO
-		return
-	}
+	database := openDatabase()
 	defer database.Close()
 
 	activities := database.ListActivities()
@@ -68,11 +71,25 @@ func listActivities() {
 		jww.INFO.Println("No activities found")
 		return
 	}
-	fmt.Println("id,start_time,distance,duration,ave_speed,max_speed,ave_cadence,max_cadence,ave_power,max_power,calories,ave_hr,max_hr")
+	// the steady sessions whose heart rate drifted, flagged with a "!"
+	threshold := viper.GetFloat64("DecouplingThresholdPercent")
+	fmt.Println("id,start_time,local_time,distance,duration,ave_speed,max_speed,ave_cadence,max_cadence,ave_power,max_power,calories,ave_hr,max_hr,decoupling,difficulty")
 	for _, activity := range activities {
-		fmt.Printf("%d,%s,%d,%d,%.2f,%.2f,%v,%v,%v,%v,%v,%v,%v\n",
+		decoupling := ""
+		if activity.DecouplingPercent != 0 {
+			decoupling = fmt.Sprintf("%.1f%%", activity.DecouplingPercent)
+			if activity.DecouplingPercent > threshold {
+				decoupling += "!"
+			}
+		}
+		difficulty := ""
+		if activity.DifficultyScore != 0 {
+			difficulty = fmt.Sprintf("%.1f", activity.DifficultyScore)
+		}
+		fmt.Printf("%d,%s,%s,%d,%d,%.2f,%.2f,%v,%v,%v,%v,%v,%v,%v,%s,%s\n",
 			activity.StartTimeMilliseconds,
 			activity.StartTimeZulu,
+			util.MillisToLocal(activity.StartTimeMilliseconds, activity.Timezone),
 			activity.DistanceMeters,
 			activity.TotalTimeSeconds,
 			activity.AverageSpeedMs,
@@ -83,7 +100,9 @@ func listActivities() {
 			activity.MaximumPowerWatts,
 			activity.KCalories,
 			activity.AverageHeartRateBpm,
-			activity.MaximumHeartRateBpm)
+			activity.MaximumHeartRateBpm,
+			decoupling,
+			difficulty)
 	}
 	return
 
@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"github.com/olympum/oarsman/collector"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+var noteCmd = &cobra.Command{
+	Use:   "note",
+	Short: "Write notes and tags on an activity",
+	Long: `
+Saves notes and tags on an activity already in the database, e.g. how
+a session went or "threshold,race", in place of those given with
+train or import, to find it later with search. Only the notes or the
+tags given are replaced; an empty value clears them.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		if activityId == 0 {
+			jww.ERROR.Println("Activity id required")
+			return
+		}
+		noteActivity(activityId, cmd.Flags().Changed("notes"), cmd.Flags().Changed("tags"))
+	},
+}
+
+// noteActivity saves the notes or the tags of the flags, whichever were
+// given, on the activity
+func noteActivity(id int64, notes bool, tags bool) {
+	database := openDatabase()
+	defer database.Close()
+
+	activity := database.FindActivityById(id)
+	if activity == nil {
+		jww.ERROR.Printf("Activity %d not found\n", id)
+		return
+	}
+	if notes {
+		activity.Notes = activityNotes
+	}
+	if tags {
+		activity.Tags = collector.ParseTags(activityTags)
+	}
+	if err := database.UpdateNotes(id, activity.Notes, activity.Tags); err != nil {
+		jww.ERROR.Printf("Could not save the notes of activity %d: %v\n", id, err)
+		return
+	}
+	jww.INFO.Printf("Notes of activity %d saved\n", id)
+}
+
+func init() {
+	noteCmd.Flags().Int64Var(&activityId, "id", 0, "id of the activity")
+	noteCmd.Flags().StringVar(&activityNotes, "notes", "", "notes on the workout, e.g. how it went")
+	noteCmd.Flags().StringVar(&activityTags, "tags", "", "comma separated tags of the workout, e.g. threshold,race")
+}
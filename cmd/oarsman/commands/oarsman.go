@@ -0,0 +1,245 @@
+package commands
+
+import (
+	"github.com/olympum/oarsman/s4"
+	"github.com/olympum/oarsman/util"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"os"
+	"os/user"
+	"path/filepath"
+)
+
+var CfgFile string
+var Verbose bool
+var Profile string
+var activityId int64
+
+var RootCmd = &cobra.Command{
+	Use:   "oarsman",
+	Short: "Oarsman is a workout management tool for the WaterRower S4",
+	Long: `
+A log capturing tool connecting to the S4 via USB, will store and
+process workout data into a database, and allows exporting as CSV
+and TCX (Garmin Training Center).`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(0)
+		}
+		InitializeConfig()
+	},
+}
+
+func InitializeConfig() {
+	if Verbose {
+		jww.SetStdoutThreshold(jww.LevelDebug)
+	} else {
+		jww.SetStdoutThreshold(jww.LevelInfo)
+	}
+	s4.SetLogger(s4Logger{})
+	s4.Debug = Verbose
+
+	// every parameter can be set with an environment variable as well, e.g.
+	// OARSMAN_SERIALDEVICE=/dev/ttyACM0 or OARSMAN_DBFOLDER=/data/db
+	viper.SetEnvPrefix("oarsman")
+	viper.AutomaticEnv()
+	if len(CfgFile) == 0 {
+		CfgFile = os.Getenv("OARSMAN_CONFIG")
+	}
+
+	if len(CfgFile) > 0 {
+		viper.SetConfigFile(CfgFile)
+		err := viper.ReadInConfig()
+		if err != nil {
+			jww.ERROR.Println("Using configuration defaults, config file not found:", CfgFile)
+		} else {
+			jww.INFO.Println("Using config file:", viper.ConfigFileUsed())
+		}
+	} else {
+		jww.INFO.Println("Using configuration defaults")
+	}
+
+	workingFolder := SetupFolder(homeFolder()+string(os.PathSeparator)+".oarsman", "WorkingFolder", "Working folder:")
+	// every profile, e.g. each athlete of a household, has its own database,
+	// workouts and plan
+	if Profile == "" {
+		Profile = viper.GetString("Profile")
+	}
+	profileFolder := workingFolder
+	if Profile != "" {
+		if filepath.Base(Profile) != Profile {
+			jww.ERROR.Printf("Invalid profile %s\n", Profile)
+			os.Exit(-1)
+		}
+		profileFolder = SetupFolder(filepath.Join(workingFolder, "profiles", Profile), "ProfileFolder", "Profile folder:")
+	}
+	SetupFolder(profileFolder+string(os.PathSeparator)+"db", "DbFolder", "Db folder:")
+	SetupFolder(profileFolder+string(os.PathSeparator)+"workouts", "WorkoutFolder", "Workout folder:")
+	SetupFolder(profileFolder+string(os.PathSeparator)+"pending", "PendingFolder", "Pending folder:")
+	SetupFolder(filepath.Join(os.TempDir(), "com.olympum.Oarsman"), "TempFolder", "Temp folder:")
+	viper.SetDefault("PlanFile", filepath.Join(profileFolder, "plan.json"))
+
+	viper.SetDefault("MaxHeartRate", 190)
+	viper.SetDefault("WeeklyTarget", 3)
+	viper.SetDefault("LogSegmentBytes", 4*1024*1024)
+	viper.SetDefault("RhythmSteadyPercent", 3.0)
+	viper.SetDefault("RhythmVariablePercent", 6.0)
+	viper.SetDefault("DecouplingThresholdPercent", 5.0)
+	viper.SetDefault("AutoIntervals", false)
+	viper.SetDefault("TankNotes", "")
+	viper.SetDefault("TankPrompt", false)
+	viper.SetDefault("MetronomeRate", "")
+	viper.SetDefault("Cues", false)
+	viper.SetDefault("CueSplitMeters", 500)
+	viper.SetDefault("HeartRateZone", "")
+	viper.SetDefault("PowerZone", "")
+	viper.SetDefault("TargetPace", "")
+	viper.SetDefault("SoundPlayer", defaultSoundPlayer())
+	viper.SetDefault("AlertBackends", []string{"sound"})
+	viper.SetDefault("AlertWebhookURL", "")
+	viper.SetDefault("AlertMQTTBroker", "")
+	viper.SetDefault("AlertMQTTTopic", "oarsman/alerts")
+	viper.SetDefault("SerialDevice", "")
+	viper.SetDefault("OdometerAddress", "")
+	viper.SetDefault("OdometerToleranceMeters", 50)
+	viper.SetDefault("DaemonRetryInterval", "10s")
+	viper.SetDefault("DaemonReadTimeout", "5s")
+	viper.SetDefault("ServerAddress", "localhost:8080")
+	viper.SetDefault("ServerToken", "")
+	viper.SetDefault("ServerTLSCert", "")
+	viper.SetDefault("ServerTLSKey", "")
+	viper.SetDefault("ServerSelfSigned", false)
+	viper.SetDefault("ServerAdvertise", true)
+	viper.SetDefault("OverlayFields", "pace,spm,hr,distance,progress")
+	viper.SetDefault("RemoteURL", "http://localhost:8080")
+	viper.SetDefault("RemoteCACert", "")
+	viper.SetDefault("NATSURL", "")
+	viper.SetDefault("NATSSubject", "oarsman")
+	viper.SetDefault("OLEDBus", "")
+	viper.SetDefault("OLEDAddress", "0x3C")
+	viper.SetDefault("GPIOStrokePin", -1)
+	viper.SetDefault("GPIOStrokePulse", "100ms")
+	viper.SetDefault("GPIOZonePins", "")
+	viper.SetDefault("GPIOZoneMetric", "heart_rate")
+	viper.SetDefault("GPIOBuzzerPin", -1)
+	viper.SetDefault("FTMSDevice", -1)
+	viper.SetDefault("FTMSName", "Oarsman")
+	viper.SetDefault("SpeakInterval", "0")
+	viper.SetDefault("SpeechCommand", defaultSpeechCommand())
+
+	// the queued workouts first, their logs not being orphaned
+	flushPendingActivities()
+	checkOrphanedLogs()
+}
+
+// s4Logger logs the messages of the s4 package like the commands
+type s4Logger struct{}
+
+func (s4Logger) Debugf(format string, v ...interface{}) {
+	jww.DEBUG.Printf(format, v...)
+}
+
+func (s4Logger) Infof(format string, v ...interface{}) {
+	jww.INFO.Printf(format, v...)
+}
+
+func (s4Logger) Errorf(format string, v ...interface{}) {
+	jww.ERROR.Printf(format, v...)
+}
+
+// exit codes of the failures of the driver, other failures exit with -1
+const (
+	exitPortNotFound         = 2
+	exitUnsupportedFirmware  = 3
+	exitWorkoutLimitExceeded = 4
+	exitConnectionLost       = 5
+	exitWorkoutRejected      = 6
+)
+
+// exitCode returns the exit code of a failure, so that scripts can tell the
+// failures of the driver apart
+func exitCode(err error) int {
+	switch s4.Cause(err) {
+	case s4.ErrPortNotFound:
+		return exitPortNotFound
+	case s4.ErrUnsupportedFirmware:
+		return exitUnsupportedFirmware
+	case s4.ErrWorkoutLimitExceeded:
+		return exitWorkoutLimitExceeded
+	case s4.ErrConnectionLost:
+		return exitConnectionLost
+	case s4.ErrWorkoutRejected:
+		return exitWorkoutRejected
+	}
+	return -1
+}
+
+// SetupFolder creates the folder of the parameter, the default folder unless
+// configured, and returns it
+func SetupFolder(folder string, configName string, logMessage string) string {
+	viper.SetDefault(configName, folder)
+	folder = viper.GetString(configName)
+	err := util.EnsureFolderExists(folder)
+	if err != nil {
+		jww.ERROR.Println("Error creating folder", err)
+	}
+	jww.INFO.Println(logMessage, folder)
+	return folder
+}
+
+// homeFolder returns the home folder of the user, or the temp folder when
+// there is none, e.g. in a container running as a user without a home
+func homeFolder() string {
+	if home := os.Getenv("HOME"); home != "" && home != "/" {
+		return home
+	}
+	if u, err := user.Current(); err == nil && u.HomeDir != "" && u.HomeDir != "/" {
+		return u.HomeDir
+	}
+	jww.INFO.Println("No home folder, using the temp folder")
+	return filepath.Clean(os.TempDir())
+}
+
+func Execute() {
+	AddCommands()
+	RootCmd.Execute()
+}
+
+func AddCommands() {
+	RootCmd.AddCommand(versionCmd)
+	RootCmd.AddCommand(trainCmd)
+	RootCmd.AddCommand(exportCmd)
+	RootCmd.AddCommand(importCmd)
+	RootCmd.AddCommand(listCmd)
+	RootCmd.AddCommand(removeCmd)
+	RootCmd.AddCommand(compareCmd)
+	RootCmd.AddCommand(chartCmd)
+	RootCmd.AddCommand(reportCmd)
+	RootCmd.AddCommand(calendarCmd)
+	RootCmd.AddCommand(summaryCmd)
+	RootCmd.AddCommand(statsCmd)
+	RootCmd.AddCommand(recoverCmd)
+	RootCmd.AddCommand(flushCmd)
+	RootCmd.AddCommand(daemonCmd)
+	RootCmd.AddCommand(serviceCmd)
+	RootCmd.AddCommand(serveCmd)
+	RootCmd.AddCommand(remoteCmd)
+	RootCmd.AddCommand(syncCmd)
+	RootCmd.AddCommand(dpsCmd)
+	RootCmd.AddCommand(intervalsCmd)
+	RootCmd.AddCommand(planCmd)
+	RootCmd.AddCommand(fitnessCmd)
+	RootCmd.AddCommand(odometerCmd)
+	RootCmd.AddCommand(leaderboardCmd)
+	RootCmd.AddCommand(discoverCmd)
+	RootCmd.AddCommand(noteCmd)
+	RootCmd.AddCommand(searchCmd)
+}
+
+func init() {
+	RootCmd.PersistentFlags().StringVar(&CfgFile, "config", "", "config file (overrides default config params, defaults to OARSMAN_CONFIG)")
+	RootCmd.PersistentFlags().BoolVar(&Verbose, "verbose", false, "verbose logging")
+	RootCmd.PersistentFlags().StringVar(&Profile, "profile", "", "athlete profile, with its own database and workouts (defaults to Profile in the config)")
+}
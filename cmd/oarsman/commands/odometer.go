@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/storage"
+	"github.com/olympum/oarsman/util"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+)
+
+var odometerCmd = &cobra.Command{
+	Use:   "odometer",
+	Short: "Show the lifetime distance rowed",
+	Long: `
+Shows the lifetime distance of all the activities in the database.
+
+With OdometerAddress in the configuration, the lifetime distance of
+the monitor itself is read when train or the daemon connect and saved
+with the activity, and the meters rowed without oarsman running
+between two activities, beyond OdometerToleranceMeters, are listed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		showOdometer()
+	},
+}
+
+func showOdometer() {
+	database := openDatabase()
+	defer database.Close()
+
+	activities := database.ListActivities()
+	total, gaps := collector.Odometer(activities, uint64(viper.GetInt64("OdometerToleranceMeters")))
+	fmt.Printf("Lifetime distance: %d m over %d activities\n", total, len(activities))
+
+	var last *collector.Activity
+	for _, activity := range activities {
+		if activity.Device.OdometerMeters > 0 {
+			last = activity
+		}
+	}
+	if last == nil {
+		return
+	}
+	fmt.Printf("Monitor odometer: %d m on %s\n", last.Device.OdometerMeters, util.MillisToLocal(last.StartTimeMilliseconds, last.Timezone))
+	if len(gaps) == 0 {
+		fmt.Println("No unrecorded meters")
+		return
+	}
+	var unrecorded uint64
+	fmt.Println("from,to,unrecorded")
+	for _, gap := range gaps {
+		unrecorded += gap.UnrecordedMeters
+		fmt.Printf("%d,%d,%d\n", gap.From.StartTimeMilliseconds, gap.To.StartTimeMilliseconds, gap.UnrecordedMeters)
+	}
+	fmt.Printf("Unrecorded: %d m\n", unrecorded)
+}
+
+// checkOdometer warns of the meters rowed on the monitor without being
+// recorded before the activity just saved
+func checkOdometer(database *storage.OarsmanDB, activity *collector.Activity) {
+	if activity.Device.OdometerMeters == 0 {
+		return
+	}
+	_, gaps := collector.Odometer(database.ListActivities(), uint64(viper.GetInt64("OdometerToleranceMeters")))
+	for _, gap := range gaps {
+		if gap.To.StartTimeMilliseconds == activity.StartTimeMilliseconds {
+			jww.WARN.Printf("%d m rowed without being recorded since activity %d\n", gap.UnrecordedMeters, gap.From.StartTimeMilliseconds)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package commands
+
+import (
+	"github.com/olympum/oarsman/display"
+	"github.com/olympum/oarsman/s4"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"strconv"
+)
+
+// newScreen opens the OLED display on the OLEDBus, nil if none or if it
+// cannot be opened: the workout is recorded without it
+func newScreen() display.Screen {
+	bus := viper.GetString("OLEDBus")
+	if bus == "" {
+		return nil
+	}
+	address, err := strconv.ParseInt(viper.GetString("OLEDAddress"), 0, 0)
+	if err != nil {
+		jww.ERROR.Printf("Invalid OLEDAddress: %v\n", err)
+		return nil
+	}
+	screen, err := display.OpenSSD1306(bus, int(address))
+	if err != nil {
+		jww.ERROR.Printf("Could not open the display at %s: %v\n", bus, err)
+		return nil
+	}
+	return screen
+}
+
+// showDashboard shows the live metrics of the workout on the screen, if any
+func showDashboard(screen display.Screen, s s4.S4Interface) {
+	if screen == nil {
+		return
+	}
+	events, _ := s.Subscribe(display.DashboardMetrics...)
+	go display.NewDashboard(screen).Run(events)
+}
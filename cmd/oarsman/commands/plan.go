@@ -0,0 +1,186 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/olympum/oarsman/plan"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"os"
+	"time"
+)
+
+var planStart string
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Follow a training plan",
+	Long: `
+Follows a training plan of several weeks, e.g. a 2k preparation
+block, defined in a JSON file: the sessions of a week, each on a day
+with a distance or duration target, repeated every week with targets
+growing by a percentage, and optionally a lighter week every few
+weeks. The plan started is kept in the PlanFile of the configuration,
+train --plan rows the session of the day, and the activities saved
+are matched to the sessions for the weekly compliance.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+var planStartCmd = &cobra.Command{
+	Use:   "start <file>",
+	Short: "Start a training plan",
+	Long: `
+Starts the plan of the file, from the week of --start, or else of the
+start of the plan, or else from next Monday (today if a Monday),
+replacing the plan followed so far.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		if len(args) != 1 {
+			jww.ERROR.Println("Plan file required")
+			os.Exit(-1)
+		}
+		p, err := plan.Read(args[0])
+		if err != nil {
+			jww.ERROR.Printf("Could not read the plan: %v\n", err)
+			os.Exit(-1)
+		}
+		if planStart != "" {
+			if _, err := time.Parse(plan.DateLayout, planStart); err != nil {
+				jww.ERROR.Printf("Invalid start %s, e.g. 2016-03-07\n", planStart)
+				os.Exit(-1)
+			}
+			p.Start = planStart
+		} else if p.Start == "" {
+			now := time.Now()
+			p.Start = now.AddDate(0, 0, (8-int(now.Weekday()))%7).Format(plan.DateLayout)
+		}
+		if err := p.Write(viper.GetString("PlanFile")); err != nil {
+			jww.ERROR.Printf("Could not save the plan: %v\n", err)
+			os.Exit(-1)
+		}
+		schedule := p.Schedule(time.Local)
+		jww.INFO.Printf("Plan %s started, %d sessions from %s to %s\n", p.Name, len(schedule),
+			schedule[0].Date.Format(plan.DateLayout), schedule[len(schedule)-1].Date.Format(plan.DateLayout))
+	},
+}
+
+var planShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the sessions of the training plan",
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		schedule, _ := trackPlan()
+		today := midnight(time.Now())
+		fmt.Println("date,week,session,target,rate,status")
+		for _, session := range schedule {
+			status := "upcoming"
+			switch {
+			case session.ActivityID != 0:
+				status = fmt.Sprintf("done %d", session.ActivityID)
+			case session.Date.Equal(today):
+				status = "today"
+			case session.Date.Before(today):
+				status = "missed"
+			}
+			name := session.Name
+			if session.Deload {
+				name += " (deload)"
+			}
+			fmt.Printf("%s,%d,%s,%s,%s,%s\n",
+				session.Date.Format(plan.DateLayout),
+				session.Week,
+				name,
+				sessionTarget(session),
+				session.Rate,
+				status)
+		}
+	},
+}
+
+var planReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Report the weekly compliance with the training plan",
+	Long: `
+Reports, for every week of the plan up to the current one, the
+sessions completed out of those scheduled, and the distance and time
+planned and rowed. A session is completed by an activity of its week
+reaching 90% of its target.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		_, weeks := trackPlan()
+		now := time.Now()
+		fmt.Println("week,start,sessions,completed,compliance,planned_distance,distance,planned_duration,duration")
+		for _, w := range weeks {
+			if w.Start.After(now) {
+				break
+			}
+			fmt.Printf("%d,%s,%d,%d,%.0f%%,%d,%d,%d,%d\n",
+				w.Number,
+				w.Start.Format(plan.DateLayout),
+				w.Sessions,
+				w.Completed,
+				w.CompliancePercent(),
+				w.PlannedMeters,
+				w.DistanceMeters,
+				w.PlannedSeconds,
+				w.TotalTimeSeconds)
+		}
+	},
+}
+
+// trackPlan reads the plan followed and matches the activities saved to its
+// sessions, exiting if there is no plan
+func trackPlan() ([]plan.Scheduled, []plan.Week) {
+	p, err := plan.Read(viper.GetString("PlanFile"))
+	if err != nil {
+		jww.ERROR.Printf("No plan started (plan start): %v\n", err)
+		os.Exit(-1)
+	}
+	schedule := p.Schedule(time.Local)
+
+	database, err := workoutDatabase()
+	if err != nil {
+		jww.ERROR.Println("Could not open the database", err)
+		os.Exit(-1)
+	}
+	defer database.Close()
+	weeks := plan.Track(schedule, database.ListActivities(), time.Local)
+	return schedule, weeks
+}
+
+// plannedSession returns the first session of the plan scheduled today and
+// not completed yet, exiting if there is none
+func plannedSession() plan.Scheduled {
+	schedule, _ := trackPlan()
+	today := midnight(time.Now())
+	for _, session := range schedule {
+		if session.Date.Equal(today) && session.ActivityID == 0 {
+			return session
+		}
+	}
+	jww.ERROR.Println("No session of the plan left today")
+	os.Exit(-1)
+	return plan.Scheduled{}
+}
+
+// sessionTarget returns the distance or duration of a session, e.g. "8000 m"
+// or "30m0s"
+func sessionTarget(session plan.Scheduled) string {
+	if session.DistanceMeters > 0 {
+		return fmt.Sprintf("%d m", session.DistanceMeters)
+	}
+	return (time.Duration(session.DurationSeconds) * time.Second).String()
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func init() {
+	planStartCmd.Flags().StringVar(&planStart, "start", "", "start date of the plan, e.g. 2016-03-07, from the Monday of its week")
+	planCmd.AddCommand(planStartCmd)
+	planCmd.AddCommand(planShowCmd)
+	planCmd.AddCommand(planReportCmd)
+}
@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/s4"
+	"github.com/olympum/oarsman/sink"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"os"
+)
+
+// newPublisher returns the publisher to the NATSURL, nil if none
+func newPublisher() sink.Publisher {
+	server := viper.GetString("NATSURL")
+	if server == "" {
+		return nil
+	}
+	publisher, err := sink.NewNATS(server)
+	if err != nil {
+		jww.ERROR.Printf("Invalid NATSURL: %v\n", err)
+		os.Exit(-1)
+	}
+	return publisher
+}
+
+// publishEvents publishes the live events of the workout, if publishing
+func publishEvents(publisher sink.Publisher, s s4.S4Interface) {
+	if publisher == nil {
+		return
+	}
+	events, _ := s.Subscribe(sink.LiveMetrics...)
+	go sink.PublishEvents(publisher, viper.GetString("NATSSubject"), events)
+}
+
+// publishActivity publishes the activity completed, if publishing
+func publishActivity(publisher sink.Publisher, activity *collector.Activity) {
+	if publisher == nil {
+		return
+	}
+	if err := sink.PublishActivity(publisher, viper.GetString("NATSSubject"), activity); err != nil {
+		jww.ERROR.Printf("Could not publish activity %d: %v\n", activity.StartTimeMilliseconds, err)
+	}
+}
@@ -0,0 +1,184 @@
+package commands
+
+import (
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/s4"
+	"github.com/olympum/oarsman/server"
+	"github.com/olympum/oarsman/storage"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// logs modified more recently may belong to a workout still in progress
+const orphanedLogMinimumAge = 2 * time.Minute
+
+var recoverCmd = &cobra.Command{
+	Use:   "recover",
+	Short: "Recover interrupted workouts",
+	Long: `
+Finds workout logs left in the temp folder by interrupted training
+sessions, rebuilds the activities from them and saves them in the
+database flagged as recovered.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		if !recoverActivities() {
+			os.Exit(-1)
+		}
+	},
+}
+
+// isTrainingLog tells whether the log file name is the RFC3339 start time
+// of a training session
+func isTrainingLog(name string) bool {
+	if !strings.HasSuffix(name, ".log") {
+		return false
+	}
+	_, err := time.Parse(time.RFC3339, strings.TrimSuffix(name, ".log"))
+	return err == nil
+}
+
+// interruptedLogs returns the training logs left partially written or in
+// segments by an interrupted workout, by the name of the complete log, and
+// whether each is in segments
+func interruptedLogs(tempFolder string) map[string]bool {
+	contents, err := ioutil.ReadDir(tempFolder)
+	if err != nil {
+		jww.ERROR.Println(err)
+		return nil
+	}
+
+	logs := map[string]bool{}
+	for _, f := range contents {
+		if f.IsDir() || time.Since(f.ModTime()) < orphanedLogMinimumAge {
+			continue
+		}
+		name := f.Name()
+		path := tempFolder + string(os.PathSeparator) + name
+		switch {
+		case strings.HasSuffix(name, s4.PartialLogSuffix) && isTrainingLog(strings.TrimSuffix(name, s4.PartialLogSuffix)):
+			logs[strings.TrimSuffix(path, s4.PartialLogSuffix)] = false
+		case strings.HasSuffix(name, s4.LogSegmentName("", 1)) && isTrainingLog(strings.TrimSuffix(name, s4.LogSegmentName("", 1))):
+			// a later segment may still be being written
+			prefix := strings.TrimSuffix(name, s4.LogSegmentName("", 1)) + "."
+			recent := false
+			for _, g := range contents {
+				if strings.HasPrefix(g.Name(), prefix) && time.Since(g.ModTime()) < orphanedLogMinimumAge {
+					recent = true
+				}
+			}
+			if !recent {
+				logs[strings.TrimSuffix(path, s4.LogSegmentName("", 1))] = true
+			}
+		}
+	}
+	return logs
+}
+
+// completeInterruptedLogs finishes the interrupted training logs, so they can
+// be matched and imported as complete logs
+func completeInterruptedLogs(tempFolder string) {
+	for out, segmented := range interruptedLogs(tempFolder) {
+		if !segmented {
+			jww.INFO.Printf("Completing interrupted workout log %s\n", out)
+			os.Rename(out+s4.PartialLogSuffix, out)
+			continue
+		}
+		jww.INFO.Printf("Merging segments of interrupted workout log %s\n", out)
+		if err := s4.MergeLogSegments(out); err != nil {
+			jww.ERROR.Printf("Could not merge segments of %s: %v\n", out, err)
+		}
+	}
+}
+
+// findOrphanedLogs returns the training logs in the temp folder for which
+// there is no activity in the database
+func findOrphanedLogs(database *storage.OarsmanDB) []string {
+	tempFolder := viper.GetString("TempFolder")
+	contents, err := ioutil.ReadDir(tempFolder)
+	if err != nil {
+		jww.ERROR.Println(err)
+		return nil
+	}
+
+	var activities []*collector.Activity
+	orphans := []string{}
+	for _, f := range contents {
+		if f.IsDir() || !isTrainingLog(f.Name()) {
+			continue
+		}
+		if time.Since(f.ModTime()) < orphanedLogMinimumAge {
+			continue
+		}
+
+		logFile := tempFolder + string(os.PathSeparator) + f.Name()
+		first, last, err := s4.LogTimeRange(logFile)
+		if err != nil || first == 0 {
+			continue
+		}
+
+		if activities == nil {
+			activities = database.ListActivities()
+		}
+		found := false
+		for _, activity := range activities {
+			if activity.StartTimeMilliseconds >= first && activity.StartTimeMilliseconds <= last {
+				found = true
+				break
+			}
+		}
+		if !found {
+			orphans = append(orphans, logFile)
+		}
+	}
+	return orphans
+}
+
+// checkOrphanedLogs warns about interrupted workouts waiting to be recovered,
+// leaving the logs as they are
+func checkOrphanedLogs() {
+	database, error := workoutDatabase()
+	if error != nil {
+		return
+	}
+	defer database.Close()
+
+	orphans := len(findOrphanedLogs(database)) + len(interruptedLogs(viper.GetString("TempFolder")))
+	if orphans > 0 {
+		jww.WARN.Printf("Found %d interrupted workout log(s), run `oarsman recover` to save them\n", orphans)
+	}
+}
+
+// recoverActivities saves the activities of the interrupted workout logs,
+// failing when the database cannot be opened, e.g. for the daemon to go on
+// queueing its sessions
+func recoverActivities() bool {
+	database, err := workoutDatabase()
+	if err != nil {
+		jww.ERROR.Println("Could not open the database", err)
+		return false
+	}
+	completeInterruptedLogs(viper.GetString("TempFolder"))
+	orphans := findOrphanedLogs(database)
+	database.Close()
+
+	if len(orphans) == 0 {
+		jww.INFO.Println("No interrupted workouts found")
+		return true
+	}
+
+	for _, logFile := range orphans {
+		activity := importActivity(logFile, false, server.ActivityDetails{
+			Recovered: true,
+			TankNotes: viper.GetString("TankNotes")})
+		if activity != nil {
+			jww.INFO.Printf("Recovered activity %d from %s\n", activity.StartTimeMilliseconds, logFile)
+			os.Remove(logFile)
+		}
+	}
+	return true
+}
@@ -0,0 +1,176 @@
+package commands
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"github.com/olympum/oarsman/server"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var remoteURL string
+var remoteCACert string
+var remoteDistance uint64
+var remoteDuration time.Duration
+var remoteTank string
+var remoteSession string
+
+var remoteCmd = &cobra.Command{
+	Use:   "remote",
+	Short: "Start and stop workouts on a daemon",
+	Long: `
+Starts and stops workouts on a daemon serving its sessions (daemon
+--serve), e.g. on a Raspberry Pi next to the rower, from another
+machine. The requests are sent with the ServerToken of the
+configuration as bearer token.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+var remoteStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start a workout on the daemon",
+	Long: `
+Programs the S4 of the daemon with a single distance or duration
+workout, or just row if neither, and prints the session, whose live
+events are streamed at /sessions/{id}/events.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		request := server.WorkoutRequest{
+			DistanceMeters:  remoteDistance,
+			DurationSeconds: uint64(remoteDuration / time.Second),
+			TankNotes:       remoteTank}
+		body, _ := json.Marshal(request)
+		session := remoteRequest(cmd, "POST", "/sessions", body)
+		fmt.Printf("Session %s started, live events at %s/sessions/%s/events\n", session.ID, remoteURL, session.ID)
+	},
+}
+
+var remoteStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the workout in progress on the daemon",
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		session := remoteRequest(cmd, "DELETE", "/sessions/"+remoteSession, nil)
+		fmt.Printf("Session %s stopped\n", session.ID)
+	},
+}
+
+var remoteStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the state of a session on the daemon",
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		session := remoteRequest(cmd, "GET", "/sessions/"+remoteSession, nil)
+		fmt.Printf("Session %s %s", session.ID, session.State)
+		if session.ActivityID != 0 {
+			fmt.Printf(", saved as activity %d", session.ActivityID)
+		}
+		if session.Error != "" {
+			fmt.Printf(", failed: %s", session.Error)
+		}
+		fmt.Println()
+	},
+}
+
+// remoteClient returns the client of the daemon, trusting the RemoteCACert
+// as well, e.g. the self-signed certificate of the daemon
+func remoteClient(cmd *cobra.Command) *http.Client {
+	if !cmd.Flags().Changed("cacert") {
+		remoteCACert = viper.GetString("RemoteCACert")
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	if remoteCACert == "" {
+		return client
+	}
+	pem, err := ioutil.ReadFile(remoteCACert)
+	if err != nil {
+		jww.ERROR.Printf("Could not read the certificate: %v\n", err)
+		os.Exit(-1)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	pool.AppendCertsFromPEM(pem)
+	client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	return client
+}
+
+// remoteDo sends the request to the oarsman server, exiting on failure
+func remoteDo(cmd *cobra.Command, method string, path string, body io.Reader) *http.Response {
+	if !cmd.Flags().Changed("url") {
+		remoteURL = viper.GetString("RemoteURL")
+	}
+	remoteURL = strings.TrimSuffix(remoteURL, "/")
+	if remoteURL == "auto" {
+		remoteURL = discoverServer()
+	}
+	request, err := http.NewRequest(method, remoteURL+path, body)
+	if err != nil {
+		jww.ERROR.Printf("Invalid request: %v\n", err)
+		os.Exit(-1)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if token := viper.GetString("ServerToken"); token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	response, err := remoteClient(cmd).Do(request)
+	if err != nil {
+		jww.ERROR.Printf("Could not reach %s: %v\n", remoteURL, err)
+		os.Exit(-1)
+	}
+	if response.StatusCode/100 != 2 {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(response.Body).Decode(&failure)
+		response.Body.Close()
+		jww.ERROR.Printf("%s %s answered %s: %s\n", method, path, response.Status, failure.Error)
+		os.Exit(-1)
+	}
+	return response
+}
+
+// remoteRequest sends the request to the daemon and returns the session
+// answered, exiting on failure
+func remoteRequest(cmd *cobra.Command, method string, path string, body []byte) server.Session {
+	response := remoteDo(cmd, method, path, bytes.NewReader(body))
+	defer response.Body.Close()
+	var session server.Session
+	if err := json.NewDecoder(response.Body).Decode(&session); err != nil {
+		jww.ERROR.Printf("Invalid answer of the daemon: %v\n", err)
+		os.Exit(-1)
+	}
+	return session
+}
+
+// addRemoteFlags adds the flags of the URL and certificate of the server
+func addRemoteFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&remoteURL, "url", "", "URL of the oarsman server, e.g. https://raspberrypi.local:8443, or auto to discover it on the LAN (defaults to RemoteURL in the config)")
+	flags.StringVar(&remoteCACert, "cacert", "", "certificate to trust, e.g. the self-signed one of the server (defaults to RemoteCACert in the config)")
+}
+
+func init() {
+	addRemoteFlags(remoteCmd.PersistentFlags())
+	remoteStartCmd.Flags().Uint64Var(&remoteDistance, "distance", 0, "distance of workout (in meters)")
+	remoteStartCmd.Flags().DurationVar(&remoteDuration, "duration", 0, "duration of workout (e.g. 1800s or 45m)")
+	remoteStartCmd.Flags().StringVar(&remoteTank, "tank", "", "tank water level and calibration notes (defaults to TankNotes in the config of the daemon)")
+	remoteStopCmd.Flags().StringVar(&remoteSession, "session", "current", "id of the session to stop")
+	remoteStatusCmd.Flags().StringVar(&remoteSession, "session", "current", "id of the session")
+	remoteCmd.AddCommand(remoteStartCmd)
+	remoteCmd.AddCommand(remoteStopCmd)
+	remoteCmd.AddCommand(remoteStatusCmd)
+}
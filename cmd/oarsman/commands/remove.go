@@ -19,17 +19,17 @@ intact in the workouts folder and temp folder.`,
 }
 
 func removeActivity(activityId int64) {
-	database, error := workoutDatabase()
-	if error != nil {
-		// TODO
-		return
-	}
+	database := openDatabase()
 	defer database.Close()
 
 	if activityId == -1 {
 		return
 	}
 
+	if database.FindActivityById(activityId) == nil {
+		jww.ERROR.Printf("Activity %d not found", activityId)
+		return
+	}
 	activity := database.RemoveActivityById(activityId)
 
 	if activity != nil {
@@ -40,7 +40,7 @@ func removeActivity(activityId int64) {
 			activity.AverageSpeedMs,
 			activity.MaximumSpeedMs)
 	} else {
-		jww.ERROR.Printf("Activity %d not found", activityId)
+		jww.ERROR.Printf("Could not remove activity %d\n", activityId)
 	}
 }
 
@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"github.com/olympum/oarsman/export"
+	"github.com/olympum/oarsman/util"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"os"
+	"strconv"
+)
+
+var reportFormat string
+
+var reportCmd = &cobra.Command{
+	Use:   "report <id>",
+	Short: "Generate a workout report",
+	Long: `
+Generates a self-contained HTML (or Markdown) report of an activity,
+with a summary table, 500m splits, heart rate zone distribution,
+embedded charts and, for the logs with the pulses of the paddle wheel,
+the average speed and acceleration through the stroke, in the temp
+folder. Heart rate zones are relative to
+the MaxHeartRate configuration parameter.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		if len(args) != 1 {
+			cmd.Usage()
+			return
+		}
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			jww.ERROR.Println("Activity id must be numeric")
+			return
+		}
+		reportActivity(id)
+	},
+}
+
+func reportActivity(activityId int64) {
+	database := openDatabase()
+	defer database.Close()
+
+	activity := database.FindActivityById(activityId)
+	if activity == nil {
+		jww.ERROR.Printf("Activity %d not found\n", activityId)
+		return
+	}
+
+	activity = replayActivity(activity)
+	if activity == nil {
+		jww.ERROR.Printf("Could not read workout log for activity %d\n", activityId)
+		return
+	}
+	activity = activity.WithStrokes(activityStrokes(database, activityId))
+
+	maxHeartRate := uint64(viper.GetInt("MaxHeartRate"))
+	prefix := viper.GetString("TempFolder") + string(os.PathSeparator) + util.MillisToZulu(activity.StartTimeMilliseconds)
+	if reportFormat == "HTML" {
+		export.ExportCollectorEvents(activity, prefix+".html", export.HTMLReportWriter(maxHeartRate))
+	} else if reportFormat == "MD" {
+		export.ExportCollectorEvents(activity, prefix+".md", export.MarkdownReportWriter(maxHeartRate))
+	} else {
+		jww.ERROR.Printf("Unknow report file format %s\n", reportFormat)
+	}
+}
+
+func init() {
+	reportCmd.Flags().StringVar(&reportFormat, "format", "HTML", "format to generate report as, HTML or MD")
+}
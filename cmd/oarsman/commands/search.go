@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/olympum/oarsman/util"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"os"
+	"strings"
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search <words>",
+	Short: "Search the activities by their notes, tags and workout",
+	Long: `
+Lists the activities whose workout name, notes, tags or tank notes
+have all the words given, or words starting with them, the latest
+first, e.g.
+
+    oarsman search threshold 8x500
+
+The workout is named after the session of the plan, or else after the
+workout programmed, e.g. "2000m", "30:00" or "8x500m/1:30r"; the notes
+and tags are given with train, import or the note command.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		searchActivities(strings.Join(args, " "))
+	},
+}
+
+func searchActivities(query string) {
+	database := openDatabase()
+	defer database.Close()
+
+	activities, err := database.SearchActivities(query)
+	if err != nil {
+		jww.ERROR.Printf("Could not search for %q: %v\n", query, err)
+		return
+	}
+	if len(activities) == 0 {
+		jww.INFO.Printf("No activities found for %q\n", query)
+		return
+	}
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"id", "local_time", "workout", "distance", "duration", "pace", "ave_hr", "tags", "notes"})
+	for _, activity := range activities {
+		pace := "-"
+		if activity.AverageSpeedMs > 0 {
+			pace = util.SecondsToPace(500 / activity.AverageSpeedMs)
+		}
+		w.Write([]string{
+			fmt.Sprintf("%d", activity.StartTimeMilliseconds),
+			util.MillisToLocal(activity.StartTimeMilliseconds, activity.Timezone),
+			activity.Workout,
+			fmt.Sprintf("%d", activity.DistanceMeters),
+			fmt.Sprintf("%d", activity.TotalTimeSeconds),
+			pace,
+			fmt.Sprintf("%d", activity.AverageHeartRateBpm),
+			strings.Join(activity.Tags, ","),
+			activity.Notes})
+	}
+	w.Flush()
+}
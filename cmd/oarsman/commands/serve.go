@@ -0,0 +1,184 @@
+package commands
+
+import (
+	"errors"
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/s4"
+	"github.com/olympum/oarsman/server"
+	"github.com/olympum/oarsman/util"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var listenAddress string
+var tlsCert string
+var tlsKey string
+var selfSigned bool
+var advertise bool
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the activities over HTTP",
+	Long: `
+Serves the activities in the database as JSON over HTTP, or HTTPS with
+a certificate given or self-signed. The requests changing anything,
+e.g. removing an activity, need the ServerToken of the configuration
+as bearer token. Unless serving on localhost only, the server is
+advertised on the LAN with mDNS (Bonjour) as _oarsman._tcp, for the
+companion apps and the discover command. The activities are also
+served over gRPC, see api/oarsman.proto.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		s := newAPIServer()
+		s.Handle(server.GRPCService, s.GRPC(nil, apiLibrary()))
+		if err := serveAPI(cmd, s); err != nil {
+			jww.ERROR.Printf("Could not serve: %v\n", err)
+			os.Exit(-1)
+		}
+	},
+}
+
+// newAPIServer returns the server of the activities, with the ServerToken
+func newAPIServer() *server.Server {
+	s := server.New(viper.GetString("ServerToken"))
+	activities := server.Activities(apiLibrary())
+	s.Handle("/activities", activities)
+	s.Handle("/activities/", activities)
+	return s
+}
+
+// apiLibrary returns the activities served, of the workout database
+func apiLibrary() server.Library {
+	return server.Library{
+		Open:    workoutDatabase,
+		LogFile: activityLogFile,
+		Import:  importLog}
+}
+
+// activityLogFile returns the raw log of an activity in the workout folder
+func activityLogFile(id int64) string {
+	return viper.GetString("WorkoutFolder") + string(os.PathSeparator) + util.MillisToZulu(id) + ".log"
+}
+
+// importLog saves the activity of a raw log received, e.g. from another
+// installation
+func importLog(log io.Reader, details server.ActivityDetails) (*collector.Activity, error) {
+	logFile := viper.GetString("TempFolder") + string(os.PathSeparator) + randomId() + ".log"
+	f, err := os.Create(logFile)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(f, log)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	defer os.Remove(logFile)
+	if err != nil {
+		return nil, err
+	}
+	activity := importActivity(logFile, false, details)
+	if activity == nil {
+		return nil, errors.New("could not import the activity, empty, invalid or already saved")
+	}
+	return activity, nil
+}
+
+// serveAPI serves on the address of the flags or else of the configuration,
+// over TLS with the certificate given, or self-signed in the working folder
+func serveAPI(cmd *cobra.Command, s *server.Server) error {
+	if !cmd.Flags().Changed("listen") {
+		listenAddress = viper.GetString("ServerAddress")
+	}
+	if !cmd.Flags().Changed("tls-cert") {
+		tlsCert = viper.GetString("ServerTLSCert")
+	}
+	if !cmd.Flags().Changed("tls-key") {
+		tlsKey = viper.GetString("ServerTLSKey")
+	}
+	if !cmd.Flags().Changed("self-signed") {
+		selfSigned = viper.GetBool("ServerSelfSigned")
+	}
+	if !cmd.Flags().Changed("advertise") {
+		advertise = viper.GetBool("ServerAdvertise")
+	}
+
+	if selfSigned && tlsCert == "" {
+		folder := viper.GetString("WorkingFolder") + string(os.PathSeparator)
+		tlsCert = folder + "server.crt"
+		tlsKey = folder + "server.key"
+		hostname, _ := os.Hostname()
+		if err := server.SelfSignedCertificate(tlsCert, tlsKey, []string{hostname, "localhost", "127.0.0.1"}); err != nil {
+			return err
+		}
+		jww.INFO.Printf("Using the self-signed certificate %s\n", tlsCert)
+	}
+	if (tlsCert == "") != (tlsKey == "") {
+		return errors.New("a TLS certificate needs its key, and a key its certificate")
+	}
+	if s.Token == "" && !loopback(listenAddress) {
+		jww.WARN.Println("Serving beyond localhost without a ServerToken, anyone on the network can change the activities")
+	}
+	// only the servers reachable from the LAN are advertised on it
+	if advertise && !loopback(listenAddress) {
+		if a, err := advertiseServer(s); err != nil {
+			jww.WARN.Printf("Could not advertise the server on the LAN: %v\n", err)
+		} else {
+			defer a.Close()
+		}
+	}
+	return s.ListenAndServe(listenAddress, tlsCert, tlsKey)
+}
+
+// advertiseServer advertises the server with mDNS as _oarsman._tcp, with
+// whether it serves over TLS and needs a token
+func advertiseServer(s *server.Server) (*server.Advertiser, error) {
+	_, p, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return nil, err
+	}
+	text := []string{"version=" + s4.Version, "tls=0", "auth=0"}
+	if tlsCert != "" {
+		text[1] = "tls=1"
+	}
+	if s.Token != "" {
+		text[2] = "auth=1"
+	}
+	service, err := server.LocalService(port, text)
+	if err != nil {
+		return nil, err
+	}
+	return server.Advertise(service)
+}
+
+// loopback tells whether the address only listens on the local machine
+func loopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return strings.EqualFold(host, "localhost") || (ip != nil && ip.IsLoopback())
+}
+
+// addServeFlags adds the flags of the address and TLS of the server
+func addServeFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&listenAddress, "listen", "", "address to serve on, e.g. :8080 (defaults to ServerAddress in the config)")
+	cmd.Flags().StringVar(&tlsCert, "tls-cert", "", "TLS certificate file, to serve over HTTPS")
+	cmd.Flags().StringVar(&tlsKey, "tls-key", "", "TLS key file of the certificate")
+	cmd.Flags().BoolVar(&selfSigned, "self-signed", false, "serve over HTTPS with a self-signed certificate, generated in the working folder")
+	cmd.Flags().BoolVar(&advertise, "advertise", true, "advertise the server on the LAN with mDNS, unless only on localhost (defaults to ServerAdvertise in the config)")
+}
+
+func init() {
+	addServeFlags(serveCmd)
+}
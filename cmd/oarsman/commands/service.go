@@ -0,0 +1,147 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+var serviceUser string
+var serviceCommand string
+var serviceOutput string
+var serviceEnvironment []string
+
+// serviceUnit is the systemd unit running oarsman, restarted whenever it
+// stops, e.g. on a crash, and started on boot
+var serviceUnit = template.Must(template.New("unit").Parse(`[Unit]
+Description=Oarsman WaterRower S4 {{.Command}}
+After=network.target
+
+[Service]
+Type=simple
+User={{.User}}
+SupplementaryGroups=dialout
+Environment=HOME={{.Home}}
+{{- range .Environment}}
+Environment={{.}}
+{{- end}}
+ExecStart={{.ExecStart}}
+Restart=always
+RestartSec=10
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Manage oarsman as a system service",
+	Long: `
+Runs oarsman as a systemd service, so that e.g. a Raspberry Pi next
+to the rower records every session again after a reboot.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+var serviceInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Write the systemd unit of the daemon",
+	Long: `
+Writes the systemd unit running the daemon as the given user, with the
+serial device, config file and environment given, restarted whenever
+it stops. Another command can be run instead with --command, e.g.
+serve, the device being the daemon's only. The unit is then enabled with:
+
+    sudo systemctl daemon-reload
+    sudo systemctl enable --now oarsman`,
+	Run: func(cmd *cobra.Command, args []string) {
+		unit, err := systemdUnit()
+		if err != nil {
+			jww.ERROR.Printf("Could not write the unit: %v\n", err)
+			os.Exit(-1)
+		}
+		if serviceOutput == "-" {
+			os.Stdout.Write(unit)
+			return
+		}
+		if err := ioutil.WriteFile(serviceOutput, unit, 0644); err != nil {
+			jww.ERROR.Printf("Could not write the unit: %v\n", err)
+			os.Exit(-1)
+		}
+		fmt.Printf("Unit written to %s, enable it with:\n", serviceOutput)
+		fmt.Printf("    sudo systemctl daemon-reload && sudo systemctl enable --now %s\n", strings.TrimSuffix(filepath.Base(serviceOutput), ".service"))
+	},
+}
+
+// systemdUnit returns the unit running this executable with the command,
+// passing on the device of the daemon and the config file
+func systemdUnit() ([]byte, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	account, err := user.Current()
+	if serviceUser != "" {
+		account, err = user.Lookup(serviceUser)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{executable, serviceCommand}
+	if serialDevice != "" {
+		// the other commands run as services, e.g. serve, have no device
+		if serviceCommand != "daemon" {
+			return nil, fmt.Errorf("--device is only passed to the daemon, not to %s", serviceCommand)
+		}
+		args = append(args, "--device="+serialDevice)
+	}
+	if CfgFile != "" {
+		config, err := filepath.Abs(CfgFile)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--config="+config)
+	}
+
+	for i, arg := range args {
+		args[i] = execArgument(arg)
+	}
+
+	var unit bytes.Buffer
+	err = serviceUnit.Execute(&unit, struct {
+		Command     string
+		User        string
+		Home        string
+		Environment []string
+		ExecStart   string
+	}{serviceCommand, account.Username, account.HomeDir, serviceEnvironment, strings.Join(args, " ")})
+	return unit.Bytes(), err
+}
+
+// execArgument quotes the argument of ExecStart if it has spaces, quotes or
+// backslashes, and escapes the specifiers and variables of systemd in it
+func execArgument(arg string) string {
+	arg = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+	if !strings.ContainsAny(arg, " \t\"'\\") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+func init() {
+	serviceInstallCmd.Flags().StringVar(&serviceUser, "user", "", "user running the service (defaults to the current user)")
+	serviceInstallCmd.Flags().StringVar(&serviceCommand, "command", "daemon", "oarsman command run by the service")
+	serviceInstallCmd.Flags().StringVar(&serialDevice, "device", "", "serial device of the S4, e.g. /dev/ttyACM0")
+	serviceInstallCmd.Flags().StringSliceVar(&serviceEnvironment, "env", nil, "environment variables of the service, e.g. TZ=Europe/London")
+	serviceInstallCmd.Flags().StringVar(&serviceOutput, "output", "/etc/systemd/system/oarsman.service", "unit file to write, - for stdout")
+	serviceCmd.AddCommand(serviceInstallCmd)
+}
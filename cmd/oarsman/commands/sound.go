@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/olympum/oarsman/coach"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// default sounds of the cues, as terminal bell sequences
+var defaultCueSounds = map[string]string{
+	string(coach.CueSplit):         "bell",
+	string(coach.CueIntervalStart): "bell:3",
+	string(coach.CueIntervalEnd):   "bell:2",
+	string(coach.CueZoneLeft):      "bell:4",
+	string(coach.CueZoneBack):      "",
+}
+
+func defaultSoundPlayer() string {
+	if runtime.GOOS == "darwin" {
+		return "afplay"
+	}
+	return "aplay"
+}
+
+func defaultSpeechCommand() string {
+	if runtime.GOOS == "darwin" {
+		return "say"
+	}
+	return "espeak"
+}
+
+// speak says the text with the SpeechCommand, without waiting for the end
+// of the speech
+func speak(text string) {
+	command := exec.Command(viper.GetString("SpeechCommand"), text)
+	if err := command.Start(); err != nil {
+		jww.ERROR.Printf("Could not say %q: %v\n", text, err)
+		return
+	}
+	go command.Wait()
+}
+
+// soundAlerter returns the alerter of the CueSounds: "bell" or "bell:n"
+// rings the terminal bell n times, anything else is a sound file played
+// with the SoundPlayer
+func soundAlerter() coach.Alerter {
+	sounds := viper.GetStringMapString("CueSounds")
+	bell := coach.Bell{Out: os.Stdout, Rings: map[coach.Cue]int{}}
+	files := coach.SoundFile{Player: viper.GetString("SoundPlayer"), Files: map[coach.Cue]string{}}
+	for cue, sound := range defaultCueSounds {
+		if configured, ok := sounds[cue]; ok {
+			sound = configured
+		}
+		switch {
+		case sound == "":
+		case sound == "bell":
+			bell.Rings[coach.Cue(cue)] = 1
+		case strings.HasPrefix(sound, "bell:"):
+			bell.Rings[coach.Cue(cue)], _ = strconv.Atoi(strings.TrimPrefix(sound, "bell:"))
+		default:
+			files.Files[coach.Cue(cue)] = sound
+		}
+	}
+	return coach.Alerters{bell, files}
+}
+
+// newAlerter returns the alerter of the AlertBackends: "sound" for the
+// CueSounds, "webhook" to post the cues to the AlertWebhookURL and "mqtt"
+// to publish them to the AlertMQTTTopic of the AlertMQTTBroker, and "gpio"
+// for a buzzer on the GPIOBuzzerPin
+func newAlerter() (coach.Alerter, error) {
+	alerters := coach.Alerters{}
+	for _, backend := range viper.GetStringSlice("AlertBackends") {
+		switch backend {
+		case "sound":
+			alerters = append(alerters, soundAlerter())
+		case "webhook":
+			url := viper.GetString("AlertWebhookURL")
+			if url == "" {
+				return nil, fmt.Errorf("no AlertWebhookURL for the webhook alerts")
+			}
+			alerters = append(alerters, coach.Webhook{URL: url})
+		case "mqtt":
+			broker := viper.GetString("AlertMQTTBroker")
+			if broker == "" {
+				return nil, fmt.Errorf("no AlertMQTTBroker for the MQTT alerts")
+			}
+			alerters = append(alerters, coach.MQTT{Broker: broker, Topic: viper.GetString("AlertMQTTTopic"), ClientID: fmt.Sprintf("oarsman-%d", os.Getpid())})
+		case "gpio":
+			buzzer, err := buzzerAlerter()
+			if err != nil {
+				return nil, err
+			}
+			alerters = append(alerters, buzzer)
+		default:
+			return nil, fmt.Errorf("unknown alert backend %s, sound, webhook, mqtt or gpio", backend)
+		}
+	}
+	return alerters, nil
+}
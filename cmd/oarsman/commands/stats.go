@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/olympum/oarsman/collector"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"time"
+)
+
+var statsDays int
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show training statistics and race predictions",
+	Long: `
+Shows statistics derived from the recent activities in the database,
+including 2k, 5k and 10k race time predictions from the best recent
+efforts, using Paul's law and a critical power model.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		showStats()
+	},
+}
+
+func recentActivities(activities []*collector.Activity, days int) []*collector.Activity {
+	since := time.Now().AddDate(0, 0, -days).UnixNano() / 1000000
+	recent := []*collector.Activity{}
+	for _, activity := range activities {
+		if activity.StartTimeMilliseconds >= since {
+			recent = append(recent, activity)
+		}
+	}
+	return recent
+}
+
+func formatDuration(seconds float64) string {
+	s := int64(seconds + 0.5)
+	return fmt.Sprintf("%d:%02d:%02d", s/3600, s%3600/60, s%60)
+}
+
+func showStats() {
+	database := openDatabase()
+	defer database.Close()
+
+	activities := recentActivities(database.ListActivities(), statsDays)
+	if len(activities) == 0 {
+		jww.INFO.Printf("No activities found in the last %d days\n", statsDays)
+		return
+	}
+
+	fmt.Printf("Race predictions from %d activities in the last %d days\n", len(activities), statsDays)
+	fmt.Println("distance,paul,critical_power,low,high")
+	for _, p := range collector.PredictRaceTimes(activities, []uint64{2000, 5000, 10000}) {
+		cp := "-"
+		if p.CPSeconds > 0 {
+			cp = formatDuration(p.CPSeconds)
+		}
+		fmt.Printf("%d,%s,%s,%s,%s\n",
+			p.DistanceMeters,
+			formatDuration(p.PaulSeconds),
+			cp,
+			formatDuration(p.LowSeconds),
+			formatDuration(p.HighSeconds))
+	}
+}
+
+func init() {
+	statsCmd.Flags().IntVar(&statsDays, "days", 90, "number of days of recent training to use")
+}
@@ -0,0 +1,36 @@
+package commands
+
+import (
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/s4"
+	"github.com/olympum/oarsman/storage"
+	jww "github.com/spf13/jwalterweatherman"
+)
+
+// saveStrokes saves the stroke profiles of the raw log of an activity, if the
+// log has pulses
+func saveStrokes(database *storage.OarsmanDB, id int64, logFile string) []collector.StrokeProfile {
+	events, err := s4.ReadLog(logFile)
+	if err != nil {
+		jww.ERROR.Printf("Could not read the strokes of activity %d: %v\n", id, err)
+		return nil
+	}
+	strokes := collector.NewStrokeProfiles(events)
+	if len(strokes) == 0 {
+		return nil
+	}
+	if err := database.InsertStrokes(id, strokes); err != nil {
+		jww.ERROR.Printf("Could not save the strokes of activity %d: %v\n", id, err)
+	}
+	return strokes
+}
+
+// activityStrokes returns the stroke profiles of an activity, computed from
+// its raw log and saved if they were not yet, e.g. for the activities
+// imported before the strokes were profiled
+func activityStrokes(database *storage.OarsmanDB, id int64) []collector.StrokeProfile {
+	if strokes := database.FindStrokesByActivityId(id); strokes != nil {
+		return strokes
+	}
+	return saveStrokes(database, id, workoutLogFile(id))
+}
@@ -0,0 +1,164 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/s4"
+	"github.com/olympum/oarsman/util"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"time"
+)
+
+var summaryWeeks int
+
+var summaryCmd = &cobra.Command{
+	Use:   "summary",
+	Short: "Summarize the workout history",
+	Long: `
+Summarizes all the activities in the database: totals, day and week
+rowing streaks, and the sessions of recent weeks against the weekly
+target (WeeklyTarget configuration parameter). With an activity id,
+summarizes the pacing of that piece instead: per-quarter and per-500m
+splits, positive or negative splitting, fade and stroke rate drift,
+and the rhythm: the variability of the stroke durations over the
+piece and each lap, rated steady up to RhythmSteadyPercent, variable
+up to RhythmVariablePercent and erratic above.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		if activityId > 0 {
+			summarizePacing(activityId)
+		} else {
+			summarizeActivities()
+		}
+	},
+}
+
+func summarizeActivities() {
+	database := openDatabase()
+	defer database.Close()
+
+	activities := database.ListActivities()
+	if len(activities) == 0 {
+		jww.INFO.Println("No activities found")
+		return
+	}
+
+	var distance uint64
+	var duration int64
+	for _, activity := range activities {
+		distance += activity.DistanceMeters
+		duration += activity.TotalTimeSeconds
+	}
+	fmt.Printf("Activities: %d\n", len(activities))
+	fmt.Printf("Total distance: %d m\n", distance)
+	fmt.Printf("Total time: %d:%02d:%02d\n", duration/3600, duration%3600/60, duration%60)
+
+	now := time.Now()
+	streaks := collector.ActivityStreaks(activities, now)
+	fmt.Printf("Day streak: %d (longest %d)\n", streaks.CurrentDays, streaks.LongestDays)
+	fmt.Printf("Week streak: %d (longest %d)\n", streaks.CurrentWeeks, streaks.LongestWeeks)
+
+	target := viper.GetInt("WeeklyTarget")
+	weeks := collector.WeeklySummaries(activities, now, summaryWeeks)
+	met := 0
+	fmt.Println()
+	fmt.Println("week,sessions,distance,duration,target_met")
+	for _, week := range weeks {
+		ok := week.Sessions >= target
+		if ok {
+			met++
+		}
+		fmt.Printf("%s,%d,%d,%d,%v\n",
+			week.Start.Format("2006-01-02"),
+			week.Sessions,
+			week.DistanceMeters,
+			week.TotalTimeSeconds,
+			ok)
+	}
+	fmt.Printf("Weekly target of %d sessions met %d of the last %d weeks\n", target, met, len(weeks))
+}
+
+func summarizePacing(activityId int64) {
+	database := openDatabase()
+	defer database.Close()
+
+	activity := database.FindActivityById(activityId)
+	if activity == nil {
+		jww.ERROR.Printf("Activity %d not found\n", activityId)
+		return
+	}
+	activity = replayActivity(activity)
+	if activity == nil {
+		jww.ERROR.Printf("Could not read workout log for activity %d\n", activityId)
+		return
+	}
+
+	summarizeRhythm(activity)
+	if activity.DifficultyScore != 0 {
+		fmt.Printf("Difficulty: %.1f/10\n\n", activity.DifficultyScore)
+	}
+	if activity.DecouplingPercent != 0 {
+		fmt.Printf("Aerobic decoupling: %.1f%%", activity.DecouplingPercent)
+		if threshold := viper.GetFloat64("DecouplingThresholdPercent"); activity.DecouplingPercent > threshold {
+			fmt.Printf(" (above %.1f%%, heart rate drifted)", threshold)
+		}
+		fmt.Println()
+		fmt.Println()
+	}
+
+	pacing := activity.Pacing()
+	if pacing == nil {
+		jww.INFO.Println("Not enough distance to analyse pacing")
+		return
+	}
+
+	fmt.Println("split,offset,distance,pace,ave_cadence")
+	for _, split := range pacing.Splits {
+		fmt.Printf("%d,%d,%d,%s,%d\n", split.Number, split.Offset, split.DistanceMeters, util.SecondsToPace(split.Pace()), split.AverageCadenceRpm)
+	}
+	fmt.Println()
+	fmt.Println("quarter,offset,distance,pace,ave_cadence")
+	for _, split := range pacing.Quarters {
+		fmt.Printf("%d,%d,%d,%s,%d\n", split.Number, split.Offset, split.DistanceMeters, util.SecondsToPace(split.Pace()), split.AverageCadenceRpm)
+	}
+	fmt.Println()
+	fmt.Printf("Halves: %s, %s (%s split)\n", util.SecondsToPace(pacing.FirstHalfPace), util.SecondsToPace(pacing.SecondHalfPace), pacing.Splitting)
+	fmt.Printf("Fade: %.1f%%\n", pacing.FadePercent)
+	fmt.Printf("Stroke rate drift: %+d spm\n", pacing.StrokeRateDrift)
+}
+
+// summarizeRhythm shows the variability of the stroke durations over the
+// activity and each lap, rated with the RhythmSteadyPercent and
+// RhythmVariablePercent of the athlete
+func summarizeRhythm(activity *collector.Activity) {
+	events, err := s4.ReadLog(workoutLogFile(activity.StartTimeMilliseconds))
+	if err != nil {
+		jww.ERROR.Printf("Could not read workout log for activity %d\n", activity.StartTimeMilliseconds)
+		return
+	}
+	thresholds := collector.RhythmThresholds{
+		Steady:   viper.GetFloat64("RhythmSteadyPercent"),
+		Variable: viper.GetFloat64("RhythmVariablePercent")}
+	rhythm, laps := activity.Rhythms(events)
+	if rhythm.Strokes == 0 {
+		jww.INFO.Println("Not enough strokes to analyse rhythm")
+		return
+	}
+
+	fmt.Println("lap,strokes,mean_stroke_ms,deviation_ms,variability,rating")
+	for i, lap := range laps {
+		if lap.Strokes == 0 {
+			continue
+		}
+		fmt.Printf("%d,%d,%.0f,%.0f,%.1f%%,%s\n", i+1, lap.Strokes, lap.MeanMilliseconds, lap.DeviationMilliseconds, lap.VariabilityPercent, thresholds.Rating(lap))
+	}
+	fmt.Printf("Rhythm: %.1f%% stroke duration variability over %d strokes (%s)\n", rhythm.VariabilityPercent, rhythm.Strokes, thresholds.Rating(rhythm))
+	fmt.Println()
+}
+
+func init() {
+	summaryCmd.Flags().Int64Var(&activityId, "id", -1, "id of activity to analyse pacing of")
+	summaryCmd.Flags().IntVar(&summaryWeeks, "weeks", 8, "number of recent weeks to report")
+}
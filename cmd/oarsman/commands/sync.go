@@ -0,0 +1,141 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/olympum/oarsman/collector"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var syncDryRun bool
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Synchronize the activities with another installation",
+	Long: `
+Reconciles the activities with another oarsman installation serving
+them (serve or daemon --serve), e.g. the Raspberry Pi at the rower:
+the activities missing on either side are transferred with their raw
+logs, in both directions. Activities are matched by fingerprint, and
+those recorded with the same id but different data on each side are
+reported and left as they are.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		syncActivities(cmd)
+	},
+}
+
+func syncActivities(cmd *cobra.Command) {
+	database, err := workoutDatabase()
+	if err != nil {
+		jww.ERROR.Println("Could not open the database", err)
+		return
+	}
+	local := map[int64]*collector.Activity{}
+	for _, activity := range database.ListActivities() {
+		local[activity.StartTimeMilliseconds] = activity
+	}
+	database.Close()
+
+	response := remoteDo(cmd, "GET", "/activities", nil)
+	var remoteActivities []*collector.Activity
+	err = json.NewDecoder(response.Body).Decode(&remoteActivities)
+	response.Body.Close()
+	if err != nil {
+		jww.ERROR.Printf("Invalid activities from %s: %v\n", remoteURL, err)
+		os.Exit(-1)
+	}
+	remote := map[int64]*collector.Activity{}
+	for _, activity := range remoteActivities {
+		remote[activity.StartTimeMilliseconds] = activity
+	}
+
+	downloaded, uploaded, conflicts := 0, 0, 0
+	for id, activity := range remote {
+		other, ok := local[id]
+		switch {
+		case !ok && activity.Source != "":
+			jww.WARN.Printf("Activity %d imported from %s has no raw log, not downloaded\n", id, activity.Source)
+		case !ok:
+			if downloadActivity(cmd, activity) {
+				downloaded++
+			}
+		case other.Fingerprint() != activity.Fingerprint():
+			jww.WARN.Printf("Activity %d differs between the installations (%s here, %s remotely), left as is\n", id, other.Fingerprint(), activity.Fingerprint())
+			conflicts++
+		}
+	}
+	for id, activity := range local {
+		if _, ok := remote[id]; ok {
+			continue
+		}
+		if activity.Source != "" {
+			jww.WARN.Printf("Activity %d imported from %s has no raw log, not uploaded\n", id, activity.Source)
+		} else if uploadActivity(cmd, activity) {
+			uploaded++
+		}
+	}
+	jww.INFO.Printf("Downloaded %d, uploaded %d activities, %d conflicts\n", downloaded, uploaded, conflicts)
+}
+
+// downloadActivity imports the raw log of the remote activity
+func downloadActivity(cmd *cobra.Command, activity *collector.Activity) bool {
+	jww.INFO.Printf("Downloading activity %d\n", activity.StartTimeMilliseconds)
+	if syncDryRun {
+		return true
+	}
+	logFile := viper.GetString("TempFolder") + string(os.PathSeparator) + randomId() + ".log"
+	f, err := os.Create(logFile)
+	if err != nil {
+		jww.ERROR.Println(err)
+		return false
+	}
+	defer os.Remove(logFile)
+	response := remoteDo(cmd, "GET", fmt.Sprintf("/activities/%d/log", activity.StartTimeMilliseconds), nil)
+	_, err = io.Copy(f, response.Body)
+	response.Body.Close()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		jww.ERROR.Printf("Could not download activity %d: %v\n", activity.StartTimeMilliseconds, err)
+		return false
+	}
+	return importActivity(logFile, false, activityDetails(activity)) != nil
+}
+
+// uploadActivity sends the raw log of the local activity to be imported
+func uploadActivity(cmd *cobra.Command, activity *collector.Activity) bool {
+	jww.INFO.Printf("Uploading activity %d\n", activity.StartTimeMilliseconds)
+	f, err := os.Open(activityLogFile(activity.StartTimeMilliseconds))
+	if err != nil {
+		jww.WARN.Printf("No raw log for activity %d, not uploaded\n", activity.StartTimeMilliseconds)
+		return false
+	}
+	defer f.Close()
+	if syncDryRun {
+		return true
+	}
+	query := url.Values{}
+	query.Set("timezone", activity.Timezone)
+	query.Set("tank", activity.TankNotes)
+	query.Set("recovered", strconv.FormatBool(activity.Recovered))
+	query.Set("workout", activity.Workout)
+	query.Set("notes", activity.Notes)
+	query.Set("tags", strings.Join(activity.Tags, ","))
+	response := remoteDo(cmd, "POST", "/activities?"+query.Encode(), f)
+	response.Body.Close()
+	return true
+}
+
+func init() {
+	addRemoteFlags(syncCmd.Flags())
+	syncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "only list the activities that would be transferred")
+}
@@ -0,0 +1,413 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/olympum/oarsman/coach"
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/plan"
+	"github.com/olympum/oarsman/s4"
+	"github.com/olympum/oarsman/server"
+	"github.com/olympum/oarsman/util"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+var distance uint64
+var duration time.Duration
+var intervals string
+var debug bool
+var fromMonitor bool
+var tank string
+var rate string
+var cues bool
+var speakInterval time.Duration
+var heartRateZone string
+var powerZone string
+var targetPace string
+var displayDistance string
+var displayIntensity string
+var restDisplayIntensity string
+var serialDevice string
+var trainPlan bool
+
+var trainCmd = &cobra.Command{
+	Use:   "train",
+	Short: "Start a rowing workout activity",
+	Long: `
+Send workout instructions to rowing monitor and start collecting
+rowing event data till workout is completed. Data is not saved in
+the database (use the import command to save it in the database).`,
+	Run: func(cmd *cobra.Command, args []string) {
+		InitializeConfig()
+		var planned *plan.Scheduled
+		if trainPlan {
+			session := plannedSession()
+			planned = &session
+			if !cmd.Flags().Changed("distance") && !cmd.Flags().Changed("duration") && intervals == "" {
+				distance = session.DistanceMeters
+				duration = time.Duration(session.DurationSeconds) * time.Second
+			}
+			jww.INFO.Printf("Session %s of week %d of the plan\n", session.Name, session.Week)
+		}
+		// the intervals or the duration, when given, take over the default
+		// distance
+		builder := s4.NewWorkout()
+		if fromMonitor {
+			builder.FromMonitor()
+		} else if intervals != "" {
+			parsed, err := s4.ParseIntervals(intervals)
+			if err != nil {
+				jww.ERROR.Printf("Invalid intervals: %v\n", err)
+				os.Exit(-1)
+			}
+			builder.Intervals(parsed...)
+			if cmd.Flags().Changed("duration") {
+				builder.Duration(duration)
+			}
+			if cmd.Flags().Changed("distance") {
+				builder.Distance(distance)
+			}
+		} else if duration > 0 {
+			builder.Duration(duration)
+		} else {
+			builder.Distance(distance)
+		}
+		if _, ok := s4.DistanceDisplays[displayDistance]; displayDistance != "" && !ok {
+			jww.ERROR.Printf("Unknown distance display unit %s\n", displayDistance)
+			os.Exit(-1)
+		}
+		if _, ok := s4.IntensityDisplays[displayIntensity]; displayIntensity != "" && !ok {
+			jww.ERROR.Printf("Unknown intensity display unit %s\n", displayIntensity)
+			os.Exit(-1)
+		}
+		if _, ok := s4.IntensityDisplays[restDisplayIntensity]; restDisplayIntensity != "" && !ok {
+			jww.ERROR.Printf("Unknown rest intensity display unit %s\n", restDisplayIntensity)
+			os.Exit(-1)
+		}
+		builder.Display(s4.DistanceDisplays[displayDistance], s4.IntensityDisplays[displayIntensity])
+		workout, err := builder.Build()
+		if err != nil {
+			jww.ERROR.Printf("Invalid workout: %v\n", err)
+			os.Exit(exitCode(err))
+		}
+		if fromMonitor {
+			jww.INFO.Println("Waiting for a workout started on the monitor")
+		} else if intervals != "" {
+			jww.INFO.Printf("Starting interval workout: %s\n", workout.Name())
+		} else if duration > 0 {
+			jww.INFO.Printf("Starting single duration workout: %v\n", duration)
+		} else {
+			jww.INFO.Printf("Starting single distance workout: %d meters\n", distance)
+		}
+
+		if !cmd.Flags().Changed("tank") {
+			tank = viper.GetString("TankNotes")
+			if viper.GetBool("TankPrompt") {
+				tank = promptTankNotes(tank)
+			}
+		}
+
+		if !cmd.Flags().Changed("rate") {
+			rate = viper.GetString("MetronomeRate")
+			if planned != nil && planned.Rate != "" {
+				rate = planned.Rate
+			}
+		}
+		var ratePlan []coach.RateSegment
+		if rate != "" {
+			ratePlan, err = coach.ParseRatePlan(rate)
+			if err != nil {
+				jww.ERROR.Printf("Invalid stroke rate: %v\n", err)
+				os.Exit(-1)
+			}
+		}
+
+		var workoutCues *coach.Cues
+		if cues || viper.GetBool("Cues") {
+			workoutCues = newWorkoutCues(cmd)
+		}
+
+		if !cmd.Flags().Changed("speak") {
+			speakInterval = viper.GetDuration("SpeakInterval")
+		}
+		if speakInterval != 0 && speakInterval < time.Second {
+			jww.ERROR.Printf("Invalid speak interval %v, at least 1s\n", speakInterval)
+			os.Exit(-1)
+		}
+
+		if !cmd.Flags().Changed("pace") {
+			targetPace = viper.GetString("TargetPace")
+		}
+		pace, err := coach.ParsePace(targetPace)
+		if err != nil {
+			jww.ERROR.Printf("Invalid target pace: %v\n", err)
+			os.Exit(-1)
+		}
+		heartRate, power := targetZones(cmd)
+
+		eventChannel := make(chan s4.AtomicEvent)
+
+		stamp := util.MillisToZulu(time.Now().UnixNano() / 1000000)
+		tempFile := viper.GetString("TempFolder") + string(os.PathSeparator) + stamp + ".log"
+		logged := make(chan bool)
+		if !cmd.Flags().Changed("device") {
+			serialDevice = viper.GetString("SerialDevice")
+		}
+		s, err := s4.NewS4(eventChannel, nil, s4.WithDebug(debug), s4.WithDevice(serialDevice), s4.WithOdometer(viper.GetString("OdometerAddress")))
+		if err != nil {
+			os.Exit(exitCode(err))
+		}
+		go s4.LogEvents(eventChannel, tempFile, viper.GetInt64("LogSegmentBytes"), logged)
+		states, _ := s.Subscribe(s4.MetricWorkoutState)
+		publisher := newPublisher()
+		publishEvents(publisher, s)
+		showDashboard(newScreen(), s)
+		driveFeedback(newFeedback(), s)
+		if ratePlan != nil {
+			ticks, _ := s.Subscribe()
+			go coach.NewMetronome(ratePlan, metronomeBeat()).Run(ticks)
+		}
+		if restDisplayIntensity != "" {
+			intervalEvents, _ := s.Subscribe(s4.MetricInterval)
+			go switchDisplay(s, s4.IntensityDisplays[displayIntensity], s4.IntensityDisplays[restDisplayIntensity], intervalEvents)
+		}
+		if workoutCues != nil {
+			cueEvents, _ := s.Subscribe(s4.MetricWorkoutState, s4.MetricTotalDistance, s4.MetricHeartRate, s4.MetricWatts)
+			go workoutCues.Run(cueEvents)
+		}
+		// the readout rewrites its line, only worth it on a terminal
+		if (pace > 0 || heartRate != (coach.Zone{}) || power != (coach.Zone{})) && terminal() {
+			readoutEvents, _ := s.Subscribe()
+			go coach.NewPacer(pace, heartRate, power, liveReadout(pace > 0, heartRate != (coach.Zone{}), power != (coach.Zone{}), os.Getenv("NO_COLOR") == "")).Run(readoutEvents)
+		}
+		if speakInterval > 0 {
+			summaryEvents, _ := s.Subscribe()
+			go coach.NewSummaries(speakInterval, func(text string) {
+				jww.INFO.Printf("%s\n", text)
+				speak(text)
+			}).Run(summaryEvents)
+		}
+
+		ch := make(chan os.Signal)
+		signal.Notify(ch, os.Interrupt, os.Kill)
+		go func() {
+			for sig := range ch {
+				jww.INFO.Printf("Terminating workout (received %s signal)\n", sig.String())
+				s.Exit()
+				<-logged
+				os.Exit(0)
+			}
+		}()
+
+		failed := make(chan error, 1)
+		go func() {
+			failed <- s.Run(&workout)
+		}()
+
+		// the workout ends when completed on the monitor, or on RETURN
+		ended := make(chan bool, 1)
+		go func() {
+			var buffer [1]byte
+			os.Stdin.Read(buffer[:])
+			ended <- true
+		}()
+		jww.INFO.Println(">>> Press RETURN to end workout ... <<<")
+	wait:
+		for {
+			select {
+			case state, ok := <-states:
+				if !ok {
+					// the driver has ended the workout
+					err = <-failed
+					break wait
+				}
+				jww.INFO.Printf("Workout %s\n", state.Text)
+			case <-ended:
+				break wait
+			}
+		}
+
+		s.Exit()
+		<-logged
+
+		if err == nil {
+			jww.INFO.Println("Workout completed successfully")
+		} else {
+			jww.ERROR.Printf("Workout failed: %v\n", err)
+		}
+
+		// the session of the plan names the workout rather than its limit
+		name := workout.Name()
+		if planned != nil {
+			name = planned.Name
+		}
+		activity := importActivity(tempFile, false, server.ActivityDetails{
+			TankNotes: tank,
+			Workout:   name,
+			Notes:     activityNotes,
+			Tags:      collector.ParseTags(activityTags)})
+
+		if activity != nil {
+			// the workout log is now saved in the workout folder
+			os.Remove(tempFile)
+			exportActivity(activity.StartTimeMilliseconds)
+			publishActivity(publisher, activity)
+		}
+		if err != nil {
+			os.Exit(exitCode(err))
+		}
+	},
+}
+
+// switchDisplay switches the intensity window of the S4 display to rest
+// during the rests between intervals, and back to work (or the time per 500
+// meters if empty) when the next interval starts
+func switchDisplay(s s4.S4Interface, work s4.IntensityDisplay, rest s4.IntensityDisplay, events <-chan s4.Event) {
+	if work == "" {
+		work = s4.IntensityPer500m
+	}
+	for event := range events {
+		intensity := work
+		if event.Text == s4.IntervalRest {
+			intensity = rest
+		}
+		if err := s.SetDisplay("", intensity); err != nil {
+			jww.ERROR.Printf("Could not switch the display of interval %d: %v\n", event.Value, err)
+		}
+	}
+}
+
+// newWorkoutCues returns the cues of the splits, intervals and zones, with
+// the zones of the flags or else of the configuration
+func newWorkoutCues(cmd *cobra.Command) *coach.Cues {
+	heartRate, power := targetZones(cmd)
+	alerter, err := newAlerter()
+	if err != nil {
+		jww.ERROR.Printf("Invalid alerts: %v\n", err)
+		os.Exit(-1)
+	}
+	return coach.NewCues(uint64(viper.GetInt64("CueSplitMeters")), heartRate, power, func(cue coach.Cue, text string) {
+		jww.INFO.Printf("%s\n", text)
+		// alerting without holding the events, e.g. on a slow network
+		go func() {
+			if err := alerter.Alert(cue, text); err != nil {
+				jww.ERROR.Printf("Could not alert %s: %v\n", cue, err)
+			}
+		}()
+	})
+}
+
+// targetZones returns the heart rate and power zones of the flags or else
+// of the configuration, exiting if invalid
+func targetZones(cmd *cobra.Command) (coach.Zone, coach.Zone) {
+	if !cmd.Flags().Changed("hr-zone") {
+		heartRateZone = viper.GetString("HeartRateZone")
+	}
+	if !cmd.Flags().Changed("power-zone") {
+		powerZone = viper.GetString("PowerZone")
+	}
+	heartRate, err := coach.ParseZone(heartRateZone)
+	if err != nil {
+		jww.ERROR.Printf("Invalid heart rate zone: %v\n", err)
+		os.Exit(-1)
+	}
+	power, err := coach.ParseZone(powerZone)
+	if err != nil {
+		jww.ERROR.Printf("Invalid power zone: %v\n", err)
+		os.Exit(-1)
+	}
+	return heartRate, power
+}
+
+// the ANSI colours of the deviations from the targets: green on target,
+// amber (yellow) slightly off and red far off
+var deviationColours = map[coach.Deviation]string{
+	coach.OnTarget:    "\033[32m",
+	coach.SlightlyOff: "\033[33m",
+	coach.FarOff:      "\033[31m",
+}
+
+// terminal tells whether the standard output is a terminal
+func terminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// liveReadout rewrites a terminal line with the pace, its delta with the
+// target pace, the heart rate and the power, those with a target and a
+// reading coloured by their deviation when colour is set
+func liveReadout(pace bool, heartRate bool, power bool, colour bool) func(readout coach.Readout) {
+	paint := func(text string, target bool, reading bool, deviation coach.Deviation) string {
+		if !colour || !target || !reading {
+			return text
+		}
+		return deviationColours[deviation] + text + "\033[0m"
+	}
+	return func(r coach.Readout) {
+		parts := []string{paint(util.SecondsToPace(r.Pace)+" /500m", pace, r.Pace > 0, r.PaceDeviation)}
+		if pace {
+			parts = append(parts, paint(fmt.Sprintf("%+.1fs", r.DeltaSeconds), pace, true, r.DeltaDeviation))
+		}
+		bpm := "- bpm"
+		if r.HeartRate > 0 {
+			bpm = fmt.Sprintf("%d bpm", r.HeartRate)
+		}
+		parts = append(parts,
+			paint(bpm, heartRate, r.HeartRate > 0, r.HeartRateDeviation),
+			paint(fmt.Sprintf("%d W", r.Watts), power, r.Watts > 0, r.PowerDeviation),
+			fmt.Sprintf("%d m", r.DistanceMeters))
+		fmt.Printf("\r%s\033[K", strings.Join(parts, "  "))
+	}
+}
+
+// metronomeBeat rings the terminal bell and flashes the rate on every beat
+func metronomeBeat() func(spm uint64) {
+	beats := 0
+	return func(spm uint64) {
+		beats++
+		marker := ">>>"
+		if beats%2 == 0 {
+			marker = "<<<"
+		}
+		fmt.Printf("\a\r%s %d spm ", marker, spm)
+	}
+}
+
+// promptTankNotes asks for the tank water level and calibration notes,
+// keeping the current ones on an empty answer
+func promptTankNotes(current string) string {
+	fmt.Printf("Tank level and calibration notes [%s]: ", current)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if line = strings.TrimSpace(line); line != "" {
+		return line
+	}
+	return current
+}
+
+func init() {
+	trainCmd.Flags().BoolVar(&debug, "debug", false, "debug communication data packets")
+	trainCmd.Flags().StringVar(&serialDevice, "device", "", "serial device of the S4, e.g. /dev/ttyACM0 (defaults to SerialDevice in the config, or the first USB modem found)")
+	trainCmd.Flags().Uint64Var(&distance, "distance", 2000, "distance of workout (in meters)")
+	trainCmd.Flags().DurationVar(&duration, "duration", 0, "duration of workout (e.g. 1800s or 45m)")
+	trainCmd.Flags().StringVar(&intervals, "intervals", "", "intervals of the workout, with their rests, e.g. 8x500m/1:30r, 4x4:00/1:00r or 1000m/2:00r+500m/1:00r")
+	trainCmd.Flags().BoolVar(&trainPlan, "plan", false, "row the session of the day of the training plan, its target and rate unless given")
+	trainCmd.Flags().StringVar(&rate, "rate", "", "stroke rate of the metronome, e.g. 24, or per segment, e.g. 20@500,24@1500,28 (meters) or 20@10m,24")
+	trainCmd.Flags().BoolVar(&cues, "cues", false, "play sounds at every split, interval and when out of the target zones")
+	trainCmd.Flags().DurationVar(&speakInterval, "speak", 0, "speak a status summary at every interval, e.g. 2m")
+	trainCmd.Flags().StringVar(&heartRateZone, "hr-zone", "", "target heart rate zone for the cues and the live readout, e.g. 140-160")
+	trainCmd.Flags().StringVar(&powerZone, "power-zone", "", "target power zone for the cues and the live readout, e.g. 180-220")
+	trainCmd.Flags().StringVar(&targetPace, "pace", "", "target pace per 500 m for the live readout, e.g. 2:05 (defaults to TargetPace in the config)")
+	trainCmd.Flags().StringVar(&tank, "tank", "", "tank water level and calibration notes (defaults to TankNotes in the config)")
+	trainCmd.Flags().StringVar(&activityNotes, "notes", "", "notes on the workout, to find it with search (see also the note command)")
+	trainCmd.Flags().StringVar(&activityTags, "tags", "", "comma separated tags of the workout, e.g. threshold,race")
+	trainCmd.Flags().BoolVar(&fromMonitor, "from-monitor", false, "record the workout programmed on the monitor's buttons")
+	trainCmd.Flags().StringVar(&displayDistance, "display-distance", "", "distance shown on the monitor: meters, miles, km or nautical")
+	trainCmd.Flags().StringVar(&displayIntensity, "display-intensity", "", "intensity shown on the monitor: m/s, mph, 500m, 2km, watts or cal/h")
+	trainCmd.Flags().StringVar(&restDisplayIntensity, "rest-display-intensity", "", "intensity shown on the monitor during the rests between intervals, e.g. cal/h")
+}
@@ -2,6 +2,7 @@ package commands
 
 import (
 	"fmt"
+	"github.com/olympum/oarsman/s4"
 	"github.com/spf13/cobra"
 )
 
@@ -17,3 +18,8 @@ The version number for this Oarsman build`,
 		fmt.Println("Oarsman for WaterRower S4 2.10,", VERSION, "-- Revision ", DEV)
 	},
 }
+
+func init() {
+	// recorded with every workout
+	s4.Version = VERSION + "-" + DEV
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"github.com/olympum/oarsman/commands"
+	"github.com/olympum/oarsman/cmd/oarsman/commands"
 	"runtime"
 )
 
@@ -0,0 +1,168 @@
+package coach
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"time"
+)
+
+// Alerter signals a cue to the rower, e.g. with a sound
+type Alerter interface {
+	Alert(cue Cue, text string) error
+}
+
+// Alerters signals a cue with every alerter, e.g. a sound on the desktop
+// and a message to a speaker wired to a Raspberry Pi
+type Alerters []Alerter
+
+func (alerters Alerters) Alert(cue Cue, text string) error {
+	var first error
+	for _, alerter := range alerters {
+		if err := alerter.Alert(cue, text); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Bell rings the terminal bell a number of times per cue, not at all for
+// the cues missing
+type Bell struct {
+	Out   io.Writer
+	Rings map[Cue]int
+}
+
+func (b Bell) Alert(cue Cue, text string) error {
+	for i := 0; i < b.Rings[cue]; i++ {
+		if i > 0 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		if _, err := fmt.Fprint(b.Out, "\a"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SoundFile plays a sound file per cue with the sound player command of
+// the OS, e.g. afplay or aplay, without waiting for the end of the sound
+type SoundFile struct {
+	Player string
+	Files  map[Cue]string
+}
+
+func (s SoundFile) Alert(cue Cue, text string) error {
+	file, ok := s.Files[cue]
+	if !ok || file == "" {
+		return nil
+	}
+	command := exec.Command(s.Player, file)
+	if err := command.Start(); err != nil {
+		return fmt.Errorf("could not play %s: %v", file, err)
+	}
+	go command.Wait()
+	return nil
+}
+
+// alertMessage is the JSON message of the webhook and MQTT alerts
+type alertMessage struct {
+	Cue  Cue    `json:"cue"`
+	Text string `json:"text"`
+	Time int64  `json:"time"` // milliseconds since the Unix epoch
+}
+
+func newAlertMessage(cue Cue, text string) []byte {
+	message, _ := json.Marshal(alertMessage{Cue: cue, Text: text, Time: time.Now().UnixNano() / 1000000})
+	return message
+}
+
+// alertTimeout bounds the time to deliver a webhook or MQTT alert
+const alertTimeout = 5 * time.Second
+
+// Webhook posts the cues as JSON messages, e.g.
+// {"cue":"split","text":"500 meters","time":1500000000000}
+type Webhook struct {
+	URL string
+}
+
+func (w Webhook) Alert(cue Cue, text string) error {
+	client := &http.Client{Timeout: alertTimeout}
+	response, err := client.Post(w.URL, "application/json", bytes.NewReader(newAlertMessage(cue, text)))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s answered %s", w.URL, response.Status)
+	}
+	return nil
+}
+
+// MQTT publishes the cues as JSON messages, like the webhook, to a topic of
+// an MQTT broker, e.g. "localhost:1883". Alerts being rare, every alert is
+// published on its own connection, at most once (QoS 0).
+type MQTT struct {
+	Broker   string
+	Topic    string
+	ClientID string
+}
+
+func (m MQTT) Alert(cue Cue, text string) error {
+	conn, err := net.DialTimeout("tcp", m.Broker, alertTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(alertTimeout))
+
+	// CONNECT with the MQTT 3.1.1 protocol and a clean session
+	connect := mqttString("MQTT")
+	connect = append(connect, 4, 0x02, 0, 60)
+	connect = append(connect, mqttString(m.ClientID)...)
+	if _, err := conn.Write(mqttPacket(0x10, connect)); err != nil {
+		return err
+	}
+	connack := make([]byte, 4)
+	if _, err := io.ReadFull(conn, connack); err != nil {
+		return err
+	}
+	if connack[0] != 0x20 || connack[3] != 0 {
+		return errors.New("connection refused by the MQTT broker " + m.Broker)
+	}
+
+	publish := append(mqttString(m.Topic), newAlertMessage(cue, text)...)
+	if _, err := conn.Write(mqttPacket(0x30, publish)); err != nil {
+		return err
+	}
+	_, err = conn.Write(mqttPacket(0xE0, nil))
+	return err
+}
+
+// mqttString encodes a string prefixed by its length
+func mqttString(s string) []byte {
+	return append([]byte{byte(len(s) >> 8), byte(len(s))}, s...)
+}
+
+// mqttPacket encodes a packet of a type with its remaining length
+func mqttPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
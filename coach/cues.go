@@ -0,0 +1,139 @@
+package coach
+
+import (
+	"fmt"
+	"github.com/olympum/oarsman/s4"
+	"strconv"
+	"strings"
+)
+
+// Cue is a moment of the workout worth signalling to the rower
+type Cue string
+
+const (
+	CueSplit         Cue = "split"          // every split distance, e.g. 500 meters
+	CueIntervalStart Cue = "interval_start" // rowing again after a rest
+	CueIntervalEnd   Cue = "interval_end"   // rowing stopped, e.g. for a rest
+	CueZoneLeft      Cue = "zone_left"      // heart rate or power out of its target zone
+	CueZoneBack      Cue = "zone_back"      // heart rate or power back in its target zone
+)
+
+// Zone is a target range of heart rate or power, with 0 for no bound
+type Zone struct {
+	Min uint64
+	Max uint64
+}
+
+// ParseZone parses a zone such as "140-160", "140-" or "-160"; an empty
+// zone has no bounds
+func ParseZone(zone string) (Zone, error) {
+	if zone == "" {
+		return Zone{}, nil
+	}
+	tokens := strings.SplitN(zone, "-", 2)
+	if len(tokens) != 2 {
+		return Zone{}, fmt.Errorf("invalid zone %q, e.g. 140-160", zone)
+	}
+	var z Zone
+	var err error
+	if tokens[0] != "" {
+		if z.Min, err = strconv.ParseUint(tokens[0], 10, 64); err != nil {
+			return Zone{}, fmt.Errorf("invalid zone %q, e.g. 140-160", zone)
+		}
+	}
+	if tokens[1] != "" {
+		if z.Max, err = strconv.ParseUint(tokens[1], 10, 64); err != nil {
+			return Zone{}, fmt.Errorf("invalid zone %q, e.g. 140-160", zone)
+		}
+	}
+	if z.Max > 0 && z.Min > z.Max {
+		return Zone{}, fmt.Errorf("invalid zone %q, the minimum is above the maximum", zone)
+	}
+	return z, nil
+}
+
+func (z Zone) contains(v uint64) bool {
+	return v >= z.Min && (z.Max == 0 || v <= z.Max)
+}
+
+func (z Zone) empty() bool {
+	return z.Min == 0 && z.Max == 0
+}
+
+// Cues signals the splits, the starts and ends of the intervals, and the
+// heart rate and power leaving or coming back to their target zones
+type Cues struct {
+	SplitMeters uint64 // 0 for no split cues
+	HeartRate   Zone
+	Power       Zone
+
+	cue func(cue Cue, text string)
+
+	split     uint64
+	resting   bool
+	outOfZone map[s4.Metric]bool
+}
+
+// NewCues returns the cues calling cue with a description, e.g.
+// (CueSplit, "500 meters")
+func NewCues(splitMeters uint64, heartRate Zone, power Zone, cue func(cue Cue, text string)) *Cues {
+	return &Cues{SplitMeters: splitMeters, HeartRate: heartRate, Power: power, cue: cue, outOfZone: map[s4.Metric]bool{}}
+}
+
+// Run signals the cues until the events end, as subscribed with
+// s4.Subscribe for the workout state, distance, heart rate and power
+func (c *Cues) Run(events <-chan s4.Event) {
+	for event := range events {
+		c.consume(event)
+	}
+}
+
+func (c *Cues) consume(event s4.Event) {
+	switch event.Metric {
+	case s4.MetricWorkoutState:
+		switch s4.WorkoutState(event.Value) {
+		case s4.WorkoutPaused:
+			c.resting = true
+			c.cue(CueIntervalEnd, "rest")
+		case s4.WorkoutStarted:
+			if c.resting {
+				c.resting = false
+				c.cue(CueIntervalStart, "go")
+			}
+		}
+	case s4.MetricTotalDistance:
+		if c.SplitMeters == 0 {
+			return
+		}
+		split := event.Value / c.SplitMeters
+		if split > c.split {
+			c.split = split
+			c.cue(CueSplit, fmt.Sprintf("%d meters", split*c.SplitMeters))
+		}
+	case s4.MetricHeartRate:
+		c.zone(event.Metric, "heart rate", c.HeartRate, event.Value)
+	case s4.MetricWatts:
+		c.zone(event.Metric, "power", c.Power, event.Value)
+	}
+}
+
+// zone signals a value leaving or coming back to its zone, ignoring the
+// values while resting and the missing readings
+func (c *Cues) zone(metric s4.Metric, name string, zone Zone, v uint64) {
+	if zone.empty() || c.resting || v == 0 {
+		return
+	}
+	out := !zone.contains(v)
+	if out == c.outOfZone[metric] {
+		return
+	}
+	c.outOfZone[metric] = out
+	switch {
+	case !out:
+		c.cue(CueZoneBack, fmt.Sprintf("%s back in zone", name))
+	case v < zone.Min:
+		c.cue(CueZoneLeft, fmt.Sprintf("%s low, %d", name, v))
+	default:
+		c.cue(CueZoneLeft, fmt.Sprintf("%s high, %d", name, v))
+	}
+}
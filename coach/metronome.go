@@ -0,0 +1,114 @@
+package coach
+
+import (
+	"fmt"
+	"github.com/olympum/oarsman/s4"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateSegment is a part of the workout rowed at a stroke rate, until a
+// distance or a duration from the start of the workout, or until the end of
+// the workout if neither is set
+type RateSegment struct {
+	Spm      uint64 // strokes per minute
+	Meters   uint64
+	Duration time.Duration
+}
+
+// ParseRatePlan parses a stroke rate, e.g. "24", or a rate per segment,
+// e.g. "20@500,24@1500,28" for 20 spm up to 500 meters, 24 spm up to 1500
+// meters and 28 spm after, or "20@10m,24" for 20 spm the first 10 minutes
+func ParseRatePlan(plan string) ([]RateSegment, error) {
+	segments := []RateSegment{}
+	for _, item := range strings.Split(plan, ",") {
+		tokens := strings.SplitN(strings.TrimSpace(item), "@", 2)
+		spm, err := strconv.ParseUint(tokens[0], 10, 64)
+		if err != nil || spm == 0 {
+			return nil, fmt.Errorf("invalid stroke rate %q", tokens[0])
+		}
+		segment := RateSegment{Spm: spm}
+		if len(tokens) == 2 {
+			if meters, err := strconv.ParseUint(tokens[1], 10, 64); err == nil {
+				segment.Meters = meters
+			} else if duration, err := time.ParseDuration(tokens[1]); err == nil {
+				segment.Duration = duration
+			} else {
+				return nil, fmt.Errorf("invalid segment end %q, meters or a duration", tokens[1])
+			}
+		}
+		segments = append(segments, segment)
+	}
+	return segments, nil
+}
+
+// Metronome beats at the stroke rate of the current segment from the start
+// of the workout. It follows the time of the events of the driver, i.e. the
+// clock of the recording, so the beats keep in step with the recorded
+// strokes whatever the delays of the subscriber.
+type Metronome struct {
+	segments []RateSegment
+	beat     func(spm uint64)
+
+	start    int64 // time of the start of the workout, 0 until started
+	next     int64 // time of the next beat
+	distance uint64
+}
+
+// NewMetronome returns a metronome calling beat on every beat
+func NewMetronome(segments []RateSegment, beat func(spm uint64)) *Metronome {
+	return &Metronome{segments: segments, beat: beat}
+}
+
+// Run beats until the events end, as subscribed with s4.Subscribe for every
+// metric: the events of every metric are used as clock ticks
+func (m *Metronome) Run(events <-chan s4.Event) {
+	for event := range events {
+		m.tick(event)
+	}
+}
+
+// spm returns the stroke rate of the segment at the time, 0 if none
+func (m *Metronome) spm(now int64) uint64 {
+	elapsed := time.Duration(now-m.start) * time.Millisecond
+	for _, segment := range m.segments {
+		switch {
+		case segment.Meters > 0 && m.distance < segment.Meters:
+			return segment.Spm
+		case segment.Duration > 0 && elapsed < segment.Duration:
+			return segment.Spm
+		case segment.Meters == 0 && segment.Duration == 0:
+			return segment.Spm
+		}
+	}
+	return 0
+}
+
+func (m *Metronome) tick(event s4.Event) {
+	switch event.Metric {
+	case s4.MetricWorkoutState:
+		if s4.WorkoutState(event.Value) == s4.WorkoutStarted && m.start == 0 {
+			m.start = event.Time
+			m.next = event.Time
+		}
+	case s4.MetricTotalDistance:
+		m.distance = event.Value
+	}
+	if m.start == 0 || event.Time < m.next {
+		return
+	}
+
+	spm := m.spm(event.Time)
+	if spm == 0 {
+		// past the last segment
+		m.next = event.Time + 1000
+		return
+	}
+	m.beat(spm)
+	m.next += int64(60000 / spm)
+	if m.next <= event.Time {
+		// the events were interrupted, e.g. by a pause
+		m.next = event.Time + int64(60000/spm)
+	}
+}
@@ -0,0 +1,167 @@
+package coach
+
+import (
+	"fmt"
+	"github.com/olympum/oarsman/s4"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Deviation is how far a live reading is from its target
+type Deviation int
+
+const (
+	OnTarget    Deviation = iota
+	SlightlyOff           // e.g. a second or two off the target pace
+	FarOff
+)
+
+// the tolerances of the pace, in seconds per 500 meters either way
+const (
+	paceOnTargetSeconds    = 1.0
+	paceSlightlyOffSeconds = 3.0
+)
+
+// the tolerances of the time ahead or behind the target pace, in seconds
+const (
+	deltaOnTargetSeconds    = 2.0
+	deltaSlightlyOffSeconds = 10.0
+)
+
+// the readings out of a zone by less than this fraction of its bound are
+// slightly off, e.g. 5 bpm over a 100 bpm bound
+const zoneSlightlyOff = 0.05
+
+// the time between two readouts, in milliseconds
+const readoutIntervalMillis = 1000
+
+// ParsePace parses a pace per 500 meters such as "2:05" or "1:58.5", in
+// seconds; an empty pace is 0, no target
+func ParsePace(pace string) (float64, error) {
+	if pace == "" {
+		return 0, nil
+	}
+	tokens := strings.SplitN(pace, ":", 2)
+	if len(tokens) != 2 {
+		return 0, fmt.Errorf("invalid pace %q, e.g. 2:05", pace)
+	}
+	minutes, err := strconv.ParseUint(tokens[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid pace %q, e.g. 2:05", pace)
+	}
+	seconds, err := strconv.ParseFloat(tokens[1], 64)
+	if err != nil || seconds < 0 || seconds >= 60 {
+		return 0, fmt.Errorf("invalid pace %q, e.g. 2:05", pace)
+	}
+	if p := float64(minutes)*60 + seconds; p > 0 {
+		return p, nil
+	}
+	return 0, fmt.Errorf("invalid pace %q, e.g. 2:05", pace)
+}
+
+// Readout is the live status of the workout against its targets, the
+// deviations OnTarget when there is no target
+type Readout struct {
+	DistanceMeters     uint64
+	Pace               float64 // seconds per 500 meters from the speed, 0 if unknown
+	PaceDeviation      Deviation
+	DeltaSeconds       float64 // behind the target pace over the distance rowed, negative when ahead
+	DeltaDeviation     Deviation
+	HeartRate          uint64
+	HeartRateDeviation Deviation
+	Watts              uint64
+	PowerDeviation     Deviation
+}
+
+// Pacer gives a readout of the pace, heart rate and power against their
+// targets every second from the start of the workout, e.g. for a colour
+// coded terminal line. Like the summaries, it follows the time of the
+// events of the driver.
+type Pacer struct {
+	Pace      float64 // seconds per 500 meters, 0 for no target
+	HeartRate Zone
+	Power     Zone
+
+	readout func(readout Readout)
+
+	start   int64 // time of the start of the workout, 0 until started
+	next    int64 // time of the next readout
+	current Readout
+}
+
+// NewPacer returns the pacer calling readout every second
+func NewPacer(pace float64, heartRate Zone, power Zone, readout func(readout Readout)) *Pacer {
+	return &Pacer{Pace: pace, HeartRate: heartRate, Power: power, readout: readout}
+}
+
+// Run gives the readouts until the events end, as subscribed with
+// s4.Subscribe for every metric: the events of every metric are used as
+// clock ticks
+func (p *Pacer) Run(events <-chan s4.Event) {
+	for event := range events {
+		p.tick(event)
+	}
+}
+
+func (p *Pacer) tick(event s4.Event) {
+	switch event.Metric {
+	case s4.MetricWorkoutState:
+		if s4.WorkoutState(event.Value) == s4.WorkoutStarted && p.start == 0 {
+			p.start = event.Time
+			p.next = event.Time + readoutIntervalMillis
+		}
+	case s4.MetricTotalDistance:
+		p.current.DistanceMeters = event.Value
+	case s4.MetricSpeed:
+		p.current.Pace = 0
+		if event.Value > 0 {
+			p.current.Pace = 500 / (float64(event.Value) / 100)
+		}
+	case s4.MetricHeartRate:
+		p.current.HeartRate = event.Value
+	case s4.MetricWatts:
+		p.current.Watts = event.Value
+	}
+	if p.start == 0 || event.Time < p.next {
+		return
+	}
+
+	r := p.current
+	if p.Pace > 0 {
+		if r.Pace > 0 {
+			r.PaceDeviation = deviation(math.Abs(r.Pace-p.Pace), paceOnTargetSeconds, paceSlightlyOffSeconds)
+		}
+		r.DeltaSeconds = float64(event.Time-p.start)/1000 - float64(r.DistanceMeters)*p.Pace/500
+		r.DeltaDeviation = deviation(math.Abs(r.DeltaSeconds), deltaOnTargetSeconds, deltaSlightlyOffSeconds)
+	}
+	r.HeartRateDeviation = p.HeartRate.deviation(r.HeartRate)
+	r.PowerDeviation = p.Power.deviation(r.Watts)
+	p.readout(r)
+	for p.next <= event.Time {
+		p.next += readoutIntervalMillis
+	}
+}
+
+func deviation(off float64, onTarget float64, slightlyOff float64) Deviation {
+	switch {
+	case off <= onTarget:
+		return OnTarget
+	case off <= slightlyOff:
+		return SlightlyOff
+	}
+	return FarOff
+}
+
+// deviation returns how far the reading is from the zone, OnTarget for the
+// missing readings
+func (z Zone) deviation(v uint64) Deviation {
+	if z.empty() || v == 0 || z.contains(v) {
+		return OnTarget
+	}
+	bound := z.Min
+	if z.Max > 0 && v > z.Max {
+		bound = z.Max
+	}
+	return deviation(math.Abs(float64(v)-float64(bound)), 0, float64(bound)*zoneSlightlyOff)
+}
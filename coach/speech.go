@@ -0,0 +1,86 @@
+package coach
+
+import (
+	"fmt"
+	"github.com/olympum/oarsman/s4"
+	"strings"
+	"time"
+)
+
+// Summaries gives a status summary of the workout at every interval from
+// its start, e.g. "1000 meters, 2:04 average, rate 22, heart rate 158", to
+// be spoken to a rower facing away from any display. Like the metronome, it
+// follows the time of the events of the driver.
+type Summaries struct {
+	Interval time.Duration
+
+	summary func(text string)
+
+	start      int64 // time of the start of the workout, 0 until started
+	next       int64 // time of the next summary
+	distance   uint64
+	strokeRate uint64
+	heartRate  uint64
+}
+
+// NewSummaries returns the summaries calling summary at every interval
+func NewSummaries(interval time.Duration, summary func(text string)) *Summaries {
+	return &Summaries{Interval: interval, summary: summary}
+}
+
+// Run gives the summaries until the events end, as subscribed with
+// s4.Subscribe for every metric: the events of every metric are used as
+// clock ticks
+func (s *Summaries) Run(events <-chan s4.Event) {
+	for event := range events {
+		s.tick(event)
+	}
+}
+
+func (s *Summaries) tick(event s4.Event) {
+	// the events are timed to the millisecond, a shorter interval would
+	// never move the next summary on
+	step := s.Interval.Nanoseconds() / 1000000
+	if step <= 0 {
+		return
+	}
+	switch event.Metric {
+	case s4.MetricWorkoutState:
+		if s4.WorkoutState(event.Value) == s4.WorkoutStarted && s.start == 0 {
+			s.start = event.Time
+			s.next = event.Time + step
+		}
+	case s4.MetricTotalDistance:
+		s.distance = event.Value
+	case s4.MetricStrokeRate:
+		s.strokeRate = event.Value
+	case s4.MetricHeartRate:
+		s.heartRate = event.Value
+	}
+	if s.start == 0 || event.Time < s.next {
+		return
+	}
+
+	s.summary(s.text(event.Time))
+	for s.next <= event.Time {
+		// skipping the summaries missed, e.g. during a pause
+		s.next += step
+	}
+}
+
+// text returns the summary at the time, leaving out the missing readings
+func (s *Summaries) text(now int64) string {
+	parts := []string{fmt.Sprintf("%d meters", s.distance)}
+	if s.distance > 0 {
+		// average pace per 500 meters since the start
+		pace := int64(float64(now-s.start) / 1000 * 500 / float64(s.distance))
+		parts = append(parts, fmt.Sprintf("%d:%02d average", pace/60, pace%60))
+	}
+	if s.strokeRate > 0 {
+		parts = append(parts, fmt.Sprintf("rate %d", s.strokeRate))
+	}
+	if s.heartRate > 0 {
+		parts = append(parts, fmt.Sprintf("heart rate %d", s.heartRate))
+	}
+	return strings.Join(parts, ", ")
+}
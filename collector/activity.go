@@ -0,0 +1,198 @@
+package collector
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"github.com/olympum/oarsman/s4"
+)
+
+// Activity is a workout, summarized like a lap over all its laps. In JSON
+// the summary fields are followed by the laps, e.g.
+//
+//	{"start_time_milliseconds":1415685752225, ..., "laps":[{...}]}
+type Activity struct {
+	Lap
+	laps    []*Lap
+	strokes []StrokeProfile
+
+	Recovered bool   `json:"recovered"`  // rebuilt from an interrupted workout log
+	Timezone  string `json:"timezone"`   // IANA timezone where the workout took place
+	TankNotes string `json:"tank_notes"` // water level and calibration of the tank, as power and pace depend on them
+
+	Workout string   `json:"workout"` // name of the workout, e.g. "2000m" or the session of the plan
+	Notes   string   `json:"notes"`   // notes of the athlete, e.g. how the session went
+	Tags    []string `json:"tags"`    // e.g. "threshold" or "race", see ParseTags
+
+	PreRollMilliseconds int64 `json:"pre_roll_milliseconds"` // connection and handshake time before the first stroke
+
+	DecouplingPercent float64 `json:"decoupling_percent"` // aerobic decoupling of a steady session, 0 if not steady or without heart rate
+
+	AutoIntervals bool `json:"auto_intervals"` // laps detected from the power of a just row session, see DetectIntervals
+
+	TrainingLoad    float64 `json:"training_load"`    // zone weighted heart rate impulse, see Load
+	DifficultyScore float64 `json:"difficulty_score"` // from 0 for an easy spin to 10, see Difficulty
+
+	Device s4.Device `json:"device"` // monitor and software that recorded the activity
+
+	Source string `json:"source"` // "" when recorded by oarsman, else e.g. "concept2" for a summary imported without its raw log
+}
+
+// activityJSON adds the laps to the JSON of an activity
+type activityJSON struct {
+	*activityFields
+	Laps []*Lap `json:"laps"`
+}
+
+// activityFields has the fields but not the methods of Activity, so it can
+// be marshalled without recursing into MarshalJSON
+type activityFields Activity
+
+// MarshalJSON has a value receiver so that activities are marshalled with
+// their laps whether passed by value or by pointer
+func (activity Activity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(activityJSON{(*activityFields)(&activity), activity.laps})
+}
+
+func (activity *Activity) UnmarshalJSON(b []byte) error {
+	v := activityJSON{activityFields: (*activityFields)(activity)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	activity.laps = v.Laps
+	if activity.laps == nil {
+		activity.laps = []*Lap{}
+	}
+	return nil
+}
+
+func NewActivity(lap *Lap, laps []*Lap) *Activity {
+	var _laps []*Lap
+	if laps != nil {
+		_laps = laps
+	} else {
+		_laps = []*Lap{}
+	}
+
+	var activity *Activity
+	if lap == nil {
+		activity = &Activity{laps: _laps}
+	} else {
+		activity = &Activity{Lap: *lap, laps: _laps}
+	}
+	return activity.update()
+}
+
+// Samples returns the samples of all laps in time order
+func (activity *Activity) Samples() []s4.Sample {
+	events := activity.Events()
+	samples := make([]s4.Sample, len(events))
+	for i, event := range events {
+		samples[i] = event.Sample()
+	}
+	return samples
+}
+
+func (activity *Activity) Laps() []*Lap {
+	return activity.laps
+}
+
+// WithLaps returns a copy of the activity with the given laps, e.g. the laps
+// of an activity read without them
+func (activity *Activity) WithLaps(laps []*Lap) *Activity {
+	withLaps := *activity
+	withLaps.laps = laps
+	return &withLaps
+}
+
+// Strokes returns the stroke profiles of the activity, nil unless set with
+// WithStrokes
+func (activity *Activity) Strokes() []StrokeProfile {
+	return activity.strokes
+}
+
+// WithStrokes returns a copy of the activity with the given stroke profiles,
+// e.g. read from the database or computed from the raw log
+func (activity *Activity) WithStrokes(strokes []StrokeProfile) *Activity {
+	withStrokes := *activity
+	withStrokes.strokes = strokes
+	return &withStrokes
+}
+
+// Fingerprint identifies the activity across installations: its id, the
+// start time, with the distance and time rowed, so that two different
+// activities recorded with the same id are told apart
+func (activity *Activity) Fingerprint() string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%d/%d/%d", activity.StartTimeMilliseconds, activity.DistanceMeters, activity.TotalTimeSeconds)))
+	return fmt.Sprintf("%x", sum[:8])
+}
+
+func (activity *Activity) addLap() *Lap {
+	lap := NewLap()
+	activity.laps = append(activity.laps, &lap)
+	return &lap
+}
+
+func (activity *Activity) firstLap() *Lap {
+	if len(activity.laps) == 0 {
+		return nil
+	}
+
+	return activity.laps[0]
+}
+
+func (activity *Activity) lastLap() *Lap {
+	if len(activity.laps) == 0 {
+		return nil
+	}
+
+	return activity.laps[len(activity.laps)-1]
+}
+
+func (activity *Activity) update() *Activity {
+	first := activity.firstLap()
+	last := activity.lastLap()
+
+	if first == nil || last == nil {
+		return activity
+	}
+
+	activity.StartTimeMilliseconds = first.StartTimeMilliseconds
+	activity.StartTimeSeconds = first.StartTimeSeconds
+	activity.StartTimeZulu = first.StartTimeZulu
+	activity.KCalories = last.KCalories
+
+	for _, l := range activity.laps {
+		if l.Rest {
+			continue
+		}
+		activity.TotalTimeSeconds += l.TotalTimeSeconds
+		activity.DistanceMeters += l.DistanceMeters
+
+		if l.MaximumCadenceRpm > activity.MaximumCadenceRpm {
+			activity.MaximumCadenceRpm = l.MaximumCadenceRpm
+		}
+		if l.MaximumHeartRateBpm > activity.MaximumHeartRateBpm {
+			activity.MaximumHeartRateBpm = l.MaximumHeartRateBpm
+		}
+		if l.MaximumPowerWatts > activity.MaximumPowerWatts {
+			activity.MaximumPowerWatts = l.MaximumPowerWatts
+		}
+		if l.MaximumSpeedMs > activity.MaximumSpeedMs {
+			activity.MaximumSpeedMs = l.MaximumSpeedMs
+		}
+
+		weight := uint64(l.TotalTimeSeconds)
+		activity.AverageCadenceRpm += l.AverageCadenceRpm * weight
+		activity.AverageHeartRateBpm += l.AverageHeartRateBpm * weight
+		activity.AveragePowerWatts += l.AveragePowerWatts * weight
+	}
+
+	activity.AverageCadenceRpm = uint64(float64(activity.AverageCadenceRpm) / float64(activity.TotalTimeSeconds))
+	activity.AverageHeartRateBpm = uint64(float64(activity.AverageHeartRateBpm) / float64(activity.TotalTimeSeconds))
+	activity.AveragePowerWatts = uint64(float64(activity.AveragePowerWatts) / float64(activity.TotalTimeSeconds))
+	activity.AverageSpeedMs = float64(activity.DistanceMeters) / float64(activity.TotalTimeSeconds)
+
+	return activity
+
+}
@@ -0,0 +1,100 @@
+package collector
+
+import (
+	"github.com/olympum/oarsman/s4"
+)
+
+type EventCollector struct {
+	channel  <-chan s4.AggregateEvent
+	activity *Activity
+}
+
+func NewEventCollector(aggregateEventChannel <-chan s4.AggregateEvent) *EventCollector {
+	return &EventCollector{channel: aggregateEventChannel, activity: NewActivity(nil, nil)}
+}
+
+// a rest shorter than this stays in the lap it interrupts, rather than
+// becoming a rest lap of its own
+const minRestMillis = 20000
+
+func (collector *EventCollector) Run() {
+	activity := collector.activity
+	activity.addLap()
+
+	// the events of a rest, until long enough for a rest lap
+	var rest []s4.AggregateEvent
+	for event := range collector.channel {
+		if s4.Debug {
+			s4.Log().Debugf("Received event to collect: %v", event)
+		}
+		if event.Pre_roll_milliseconds > 0 {
+			activity.PreRollMilliseconds = event.Pre_roll_milliseconds
+		}
+		if event.Device != nil {
+			activity.Device = *event.Device
+		}
+		if event.Rest && !activity.lastLap().Rest {
+			rest = append(rest, event)
+			if event.Time-rest[0].Time_start < minRestMillis {
+				continue
+			}
+			collector.startLap(true, event)
+			for _, e := range rest {
+				collector.add(e)
+			}
+			rest = nil
+			continue
+		}
+		collector.addShortRest(rest)
+		rest = nil
+		if event.Rest != activity.lastLap().Rest {
+			collector.startLap(event.Rest, event)
+		}
+		collector.add(event)
+	}
+	collector.addShortRest(rest)
+}
+
+// startLap starts a rest lap, or a lap after a rest, at the end of the
+// previous lap like the auto-laps
+func (collector *EventCollector) startLap(rest bool, event s4.AggregateEvent) {
+	last := collector.activity.lastLap()
+	if len(last.events) > 1 {
+		boundary := last.events[len(last.events)-1]
+		last = collector.activity.addLap()
+		last.AddEvent(boundary)
+	}
+	last.Rest = rest
+	s4.Log().Debugf("Rest %v from %d meters", rest, event.Total_distance_meters)
+}
+
+// addShortRest adds the events of a rest too short for a lap of its own to
+// the current lap, as a pause of the lap rather than a rest
+func (collector *EventCollector) addShortRest(rest []s4.AggregateEvent) {
+	for _, e := range rest {
+		e.Rest = false
+		collector.add(e)
+	}
+}
+
+// add adds the event to the current lap, and starts an auto-lap every 2000
+// meters rowed
+func (collector *EventCollector) add(event s4.AggregateEvent) {
+	activity := collector.activity
+	activity.lastLap().AddEvent(event)
+	if !event.Rest && event.Total_distance_meters > 0 && event.Total_distance_meters%2000 == 0 {
+		lap := activity.addLap()
+		s4.Log().Debugf("Added auto-lap at %d meters", event.Total_distance_meters)
+		lap.AddEvent(event)
+	}
+}
+
+func (collector *EventCollector) Activity() *Activity {
+	activity := collector.activity
+	if activity.firstLap() == nil || len(activity.firstLap().events) == 0 {
+		return nil
+	}
+	activity.update()
+	activity.DecouplingPercent = activity.Decoupling()
+	return activity
+}
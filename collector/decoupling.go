@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"math"
+)
+
+// sessions shorter than this are too short for the heart rate to drift
+const minDecouplingSeconds = 20 * 60
+
+// sessions whose power varies more than this, e.g. intervals, are not steady
+const maxSteadyPowerVariabilityPercent = 20
+
+// Decoupling returns the aerobic decoupling of a steady session, in percent:
+// how much the ratio of power to heart rate fell from the first half to the
+// second half of the time rowed. Above about 5%, the heart rate drifted up
+// for the same power, the aerobic base not yet carrying the session. It is 0
+// for the sessions that are short, not steady or without heart rate, and for
+// the activities read from the database without their events.
+func (activity *Activity) Decoupling() float64 {
+	events := []int{}
+	all := activity.Events()
+	for i, e := range all {
+		if !e.Rest && e.Watts > 0 && e.Heart_rate > 0 {
+			events = append(events, i)
+		}
+	}
+	if len(events) < 2 || all[events[len(events)-1]].Time-all[events[0]].Time < minDecouplingSeconds*1000 {
+		return 0
+	}
+
+	// steady if the power varies little around its mean
+	var sum, squares float64
+	for _, i := range events {
+		w := float64(all[i].Watts)
+		sum += w
+		squares += w * w
+	}
+	n := float64(len(events))
+	mean := sum / n
+	if math.Sqrt(squares/n-mean*mean)/mean*100 > maxSteadyPowerVariabilityPercent {
+		return 0
+	}
+
+	middle := all[events[0]].Time + (all[events[len(events)-1]].Time-all[events[0]].Time)/2
+	var power, heartRate [2]float64
+	for _, i := range events {
+		half := 0
+		if all[i].Time >= middle {
+			half = 1
+		}
+		power[half] += float64(all[i].Watts)
+		heartRate[half] += float64(all[i].Heart_rate)
+	}
+	first := power[0] / heartRate[0]
+	second := power[1] / heartRate[1]
+	return (first - second) / first * 100
+}
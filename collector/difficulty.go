@@ -0,0 +1,52 @@
+package collector
+
+import (
+	"math"
+)
+
+// the highest difficulty, e.g. of a long session of hard intervals
+const maxDifficulty = 10
+
+// Difficulty returns how hard the session was, from 0 for a short easy spin
+// to 10: the intensity, as the training load per minute (see Load), squared,
+// times the square root of the minutes rowed, raised by the variability of
+// the power and by the intervals. Without heart rate the intensity counts as
+// endurance (Z2), so the hard sessions score lower. It needs the events of
+// the activity.
+func (activity *Activity) Difficulty(maxHeartRateBpm uint64) float64 {
+	minutes := float64(activity.TotalTimeSeconds) / 60
+	if minutes <= 0 {
+		return 0
+	}
+	intensity := activity.Load(maxHeartRateBpm) / minutes
+
+	// the variation of the power while rowing, e.g. of pieces and paddles
+	var n, sum, squares float64
+	for _, e := range activity.Events() {
+		if !e.Rest && e.Watts > 0 {
+			n++
+			sum += float64(e.Watts)
+			squares += float64(e.Watts) * float64(e.Watts)
+		}
+	}
+	variability := 0.0
+	if n > 1 {
+		mean := sum / n
+		variability = math.Min(math.Sqrt(math.Max(squares/n-mean*mean, 0))/mean, 1)
+	}
+
+	// the intervals separated by rests, or detected in a just row session
+	intervals := 0
+	for _, lap := range activity.laps {
+		if lap.Rest {
+			intervals++
+		}
+	}
+	if activity.AutoIntervals {
+		intervals = len(activity.laps) / 2
+	}
+
+	factor := 1 + variability + 0.05*math.Min(float64(intervals), 10)
+	difficulty := math.Min(intensity*intensity*math.Sqrt(minutes)*factor/10, maxDifficulty)
+	return math.Floor(difficulty*10+0.5) / 10
+}
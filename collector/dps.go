@@ -0,0 +1,150 @@
+package collector
+
+import (
+	"github.com/olympum/oarsman/s4"
+	"math"
+	"sort"
+)
+
+// strokes within this many strokes per minute of a rate are rowed at it
+const strokeRateTolerance = 1
+
+// StrokeDistance is the distance gained by one stroke, from its start to the
+// start of the next one
+type StrokeDistance struct {
+	StartTimeMilliseconds int64
+	Meters                float64
+	StrokeRate            float64 // strokes per minute, from the duration of the stroke
+}
+
+// distanceCrossing is the time a whole meter was first read
+type distanceCrossing struct {
+	time   int64
+	meters uint64
+}
+
+// NewStrokeDistances returns the distance per stroke of every stroke of the
+// events of a raw log. The distance is only read in whole meters, so it is
+// interpolated between the times each meter was first read. The strokes of
+// a rest, and the last stroke, are left out.
+func NewStrokeDistances(events []s4.AtomicEvent) []StrokeDistance {
+	crossings := []distanceCrossing{}
+	starts := []int64{}
+	for _, e := range events {
+		switch e.Label {
+		case string(s4.MetricTotalDistance):
+			if len(crossings) == 0 || e.Value > crossings[len(crossings)-1].meters {
+				crossings = append(crossings, distanceCrossing{e.Time, e.Value})
+			}
+		case string(s4.MetricStrokeStart):
+			starts = append(starts, e.Time)
+		}
+	}
+
+	strokes := []StrokeDistance{}
+	for i := 1; i < len(starts); i++ {
+		duration := starts[i] - starts[i-1]
+		if duration <= 0 || duration > maxStrokeMillis {
+			continue
+		}
+		from, ok := distanceAt(crossings, starts[i-1])
+		if !ok {
+			continue
+		}
+		to, ok := distanceAt(crossings, starts[i])
+		if !ok || to <= from {
+			continue
+		}
+		strokes = append(strokes, StrokeDistance{
+			StartTimeMilliseconds: starts[i-1],
+			Meters:                to - from,
+			StrokeRate:            60000 / float64(duration)})
+	}
+	return strokes
+}
+
+// distanceAt interpolates the distance at a time between the crossings
+// around it, not ok outside of them
+func distanceAt(crossings []distanceCrossing, t int64) (float64, bool) {
+	i := sort.Search(len(crossings), func(i int) bool { return crossings[i].time > t })
+	if i == 0 || i == len(crossings) {
+		return 0, false
+	}
+	before, after := crossings[i-1], crossings[i]
+	ratio := float64(t-before.time) / float64(after.time-before.time)
+	return float64(before.meters) + ratio*float64(after.meters-before.meters), true
+}
+
+// RateDistance is the average distance per stroke at a stroke rate
+type RateDistance struct {
+	StrokeRate uint64
+	Strokes    int
+	Meters     float64
+}
+
+// DistancePerStrokeByRate returns the average distance per stroke at every
+// stroke rate rowed, by increasing rate
+func DistancePerStrokeByRate(strokes []StrokeDistance) []RateDistance {
+	byRate := map[uint64]*RateDistance{}
+	for _, stroke := range strokes {
+		rate := uint64(stroke.StrokeRate + 0.5)
+		r, ok := byRate[rate]
+		if !ok {
+			r = &RateDistance{StrokeRate: rate}
+			byRate[rate] = r
+		}
+		r.Strokes++
+		r.Meters += stroke.Meters
+	}
+	rates := []RateDistance{}
+	for _, r := range byRate {
+		r.Meters /= float64(r.Strokes)
+		rates = append(rates, *r)
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i].StrokeRate < rates[j].StrokeRate })
+	return rates
+}
+
+// AverageDistancePerStroke returns the average distance per stroke, and the
+// number of strokes, of the strokes rowed within a stroke per minute of the
+// rate, or of all the strokes for rate 0
+func AverageDistancePerStroke(strokes []StrokeDistance, rate uint64) (float64, int) {
+	meters := 0.0
+	n := 0
+	for _, stroke := range strokes {
+		if rate > 0 && math.Abs(stroke.StrokeRate-float64(rate)) > strokeRateTolerance {
+			continue
+		}
+		meters += stroke.Meters
+		n++
+	}
+	if n == 0 {
+		return 0, 0
+	}
+	return meters / float64(n), n
+}
+
+// DistancePerStrokeTrend returns the change of the distance per stroke over
+// time, in meters per 30 days, from the least squares line through the
+// distance per stroke of the activities by start time, 0 for fewer than two
+// activities
+func DistancePerStrokeTrend(startTimesMilliseconds []int64, meters []float64) float64 {
+	n := float64(len(meters))
+	if len(meters) < 2 || len(startTimesMilliseconds) != len(meters) {
+		return 0
+	}
+	const month = 30 * 24 * 3600 * 1000.0
+	var sumX, sumY, sumXY, sumXX float64
+	for i, y := range meters {
+		x := float64(startTimesMilliseconds[i]-startTimesMilliseconds[0]) / month
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denominator
+}
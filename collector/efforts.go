@@ -0,0 +1,58 @@
+package collector
+
+// EffortDistances are the distances of the best efforts saved with every
+// activity, e.g. for the leaderboards
+var EffortDistances = []uint64{500, 1000, 2000, 5000, 6000, 10000}
+
+// Effort is the fastest time over a distance within an activity, e.g. the
+// fastest 500 m of a 5k
+type Effort struct {
+	StartTimeMilliseconds int64 // of the activity
+	DistanceMeters        uint64
+	Milliseconds          int64
+}
+
+// Pace returns the pace of the effort in seconds per 500 meters
+func (effort Effort) Pace() float64 {
+	return float64(effort.Milliseconds) / 1000 * 500 / float64(effort.DistanceMeters)
+}
+
+// BestEfforts returns the fastest time over each distance rowed in one go
+// within the activity, between the times the meters were first read, the
+// rests included. The distances longer than the activity are left out. It
+// needs the events of the activity.
+func (activity *Activity) BestEfforts(distances []uint64) []Effort {
+	crossings := []distanceCrossing{}
+	for _, e := range activity.Events() {
+		if len(crossings) == 0 || e.Total_distance_meters > crossings[len(crossings)-1].meters {
+			crossings = append(crossings, distanceCrossing{e.Time, e.Total_distance_meters})
+		}
+	}
+
+	efforts := []Effort{}
+	for _, distance := range distances {
+		var best int64
+		i := 0
+		for j := range crossings {
+			for i+1 < j && crossings[j].meters-crossings[i+1].meters >= distance {
+				i++
+			}
+			rowed := crossings[j].meters - crossings[i].meters
+			if rowed < distance {
+				continue
+			}
+			// the time of the distance itself, the meters read being whole
+			millis := (crossings[j].time - crossings[i].time) * int64(distance) / int64(rowed)
+			if best == 0 || millis < best {
+				best = millis
+			}
+		}
+		if best > 0 {
+			efforts = append(efforts, Effort{
+				StartTimeMilliseconds: activity.StartTimeMilliseconds,
+				DistanceMeters:        distance,
+				Milliseconds:          best})
+		}
+	}
+	return efforts
+}
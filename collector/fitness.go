@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"time"
+)
+
+// the time constants, in days, of the fitness (chronic training load) and
+// of the fatigue (acute training load)
+const (
+	fitnessDays = 42
+	fatigueDays = 7
+)
+
+// the zone of the time rowed without heart rate, e.g. without a chest strap
+const defaultLoadZone = 2
+
+// Fitness is the training load of a day with the fitness, fatigue and form
+// it leaves: the fitness and the fatigue are the exponentially weighted
+// averages of the daily load over 42 and 7 days, and the form is the fitness
+// less the fatigue of the day before, positive when fresh.
+type Fitness struct {
+	Date    time.Time
+	Load    float64
+	Fitness float64 // chronic training load, CTL
+	Fatigue float64 // acute training load, ATL
+	Form    float64 // training stress balance, TSB
+}
+
+// Load returns the training load of the activity, its zone weighted heart
+// rate impulse: the minutes in each heart rate zone times the number of the
+// zone, relative to the athlete maximum heart rate. The minutes without heart
+// rate count as endurance (Z2), so that every session adds to the load. It
+// needs the events of the activity; without them, e.g. for a summary
+// imported from another logbook, every minute counts in the zone of the
+// average heart rate.
+func (activity *Activity) Load(maxHeartRateBpm uint64) float64 {
+	if len(activity.Events()) == 0 && activity.AverageHeartRateBpm > 0 && maxHeartRateBpm > 0 {
+		percent := activity.AverageHeartRateBpm * 100 / maxHeartRateBpm
+		for z, zone := range HeartRateZones {
+			if percent >= zone.Low && percent < zone.High {
+				return float64(activity.TotalTimeSeconds) / 60 * float64(z+1)
+			}
+		}
+	}
+	load := 0.0
+	var seconds int64
+	for z, zone := range activity.HeartRateZoneDistribution(maxHeartRateBpm) {
+		load += float64(zone.Seconds) / 60 * float64(z+1)
+		seconds += zone.Seconds
+	}
+	if missing := activity.TotalTimeSeconds - seconds; missing > 0 {
+		load += float64(missing) / 60 * defaultLoadZone
+	}
+	return load
+}
+
+// FitnessSeries returns the fitness, fatigue and form of every day from the
+// first activity to now, from the training load saved with the activities,
+// in the time zone of now
+func FitnessSeries(activities []*Activity, now time.Time) []Fitness {
+	if len(activities) == 0 {
+		return []Fitness{}
+	}
+	loads := map[time.Time]float64{}
+	first := day(now)
+	for _, activity := range activities {
+		d := day(activityTime(activity, now.Location()))
+		loads[d] += activity.TrainingLoad
+		if d.Before(first) {
+			first = d
+		}
+	}
+
+	series := []Fitness{}
+	var fitness, fatigue float64
+	for d := first; !d.After(day(now)); d = d.AddDate(0, 0, 1) {
+		form := fitness - fatigue
+		fitness += (loads[d] - fitness) / fitnessDays
+		fatigue += (loads[d] - fatigue) / fatigueDays
+		series = append(series, Fitness{Date: d, Load: loads[d], Fitness: fitness, Fatigue: fatigue, Form: form})
+	}
+	return series
+}
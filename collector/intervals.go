@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"sort"
+)
+
+// work and recovery shorter than this are part of their neighbours, e.g. a
+// few weak strokes within a burst
+const minIntervalMilliseconds = 20 * 1000
+
+// the power of the work is at least this many times the power of the
+// recovery for a session to have intervals
+const minIntervalPowerRatio = 1.5
+
+// DetectIntervals returns a copy of a just row activity with a lap for every
+// work and recovery interval, told apart by power, so that unplanned bursts
+// are analysed and exported like programmed intervals. The recovery laps are
+// rowed, and counted in the activity summary. It returns nil if the activity
+// has no such structure, or already has rests.
+func (activity *Activity) DetectIntervals() *Activity {
+	events := activity.Events()
+	if len(events) < 2 {
+		return nil
+	}
+	for _, lap := range activity.laps {
+		if lap.Rest {
+			return nil
+		}
+	}
+
+	// the threshold between the usual power of the recovery and of the work
+	watts := []float64{}
+	for _, e := range events {
+		if e.Watts > 0 {
+			watts = append(watts, float64(e.Watts))
+		}
+	}
+	if len(watts) < 2 {
+		return nil
+	}
+	sort.Float64s(watts)
+	low := watts[len(watts)/5]
+	high := watts[len(watts)*4/5]
+	if low == 0 || high < low*minIntervalPowerRatio {
+		return nil
+	}
+	threshold := (low + high) / 2
+
+	// the events starting each interval, merging the short ones
+	work := make([]bool, len(events))
+	for i, e := range events {
+		work[i] = float64(e.Watts) >= threshold
+	}
+	starts := intervalStarts(work)
+	for merged := true; merged && len(starts) > 1; {
+		merged = false
+		for n := range starts {
+			end := events[len(events)-1].Time
+			if n+1 < len(starts) {
+				end = events[starts[n+1]].Time
+			}
+			if end-events[starts[n]].Time >= minIntervalMilliseconds {
+				continue
+			}
+			// flipped to its neighbours, then the intervals are found again
+			for i := starts[n]; i < len(events) && (n+1 == len(starts) || i < starts[n+1]); i++ {
+				work[i] = !work[i]
+			}
+			starts = intervalStarts(work)
+			merged = true
+			break
+		}
+	}
+	intervals := 0
+	for _, start := range starts {
+		if work[start] {
+			intervals++
+		}
+	}
+	if intervals < 2 {
+		return nil
+	}
+
+	// laps starting at the end of the previous one, like the rests
+	laps := []*Lap{}
+	next := 0
+	for i, e := range events {
+		if next < len(starts) && i == starts[next] {
+			lap := NewLap()
+			if i > 0 {
+				lap.AddEvent(events[i-1])
+			}
+			laps = append(laps, &lap)
+			next++
+		}
+		laps[len(laps)-1].AddEvent(e)
+	}
+
+	detected := NewActivity(nil, laps)
+	detected.Recovered = activity.Recovered
+	detected.Timezone = activity.Timezone
+	detected.TankNotes = activity.TankNotes
+	detected.Workout = activity.Workout
+	detected.Notes = activity.Notes
+	detected.Tags = activity.Tags
+	detected.PreRollMilliseconds = activity.PreRollMilliseconds
+	detected.DecouplingPercent = activity.DecouplingPercent
+	detected.TrainingLoad = activity.TrainingLoad
+	detected.DifficultyScore = activity.DifficultyScore
+	detected.Device = activity.Device
+	detected.strokes = activity.strokes
+	detected.AutoIntervals = true
+	return detected
+}
+
+// intervalStarts returns the indexes of the events starting each run of work
+// or recovery
+func intervalStarts(work []bool) []int {
+	starts := []int{0}
+	for i := 1; i < len(work); i++ {
+		if work[i] != work[i-1] {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
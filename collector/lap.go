@@ -0,0 +1,95 @@
+package collector
+
+import (
+	"github.com/olympum/oarsman/s4"
+	"github.com/olympum/oarsman/util"
+)
+
+// Lap is the summary of a lap, or of a whole activity. The JSON names are
+// the database column names.
+type Lap struct {
+	events          []s4.AggregateEvent
+	sumHeartRateBpm uint64
+	sumCadenceRpm   uint64
+	sumPowerWatts   uint64
+
+	StartTimeMilliseconds int64   `json:"start_time_milliseconds"` // since the Unix epoch, also the id of an activity
+	StartTimeSeconds      int64   `json:"start_time_seconds"`      // since the Unix epoch
+	StartTimeZulu         string  `json:"start_time_zulu"`         // RFC3339 in UTC
+	TotalTimeSeconds      int64   `json:"total_time_seconds"`
+	DistanceMeters        uint64  `json:"distance_meters"`
+	MaximumSpeedMs        float64 `json:"maximum_speed_m_s"` // meters per second
+	AverageSpeedMs        float64 `json:"average_speed_m_s"` // meters per second
+	KCalories             uint64  `json:"kcalories"`
+	AverageHeartRateBpm   uint64  `json:"average_heart_rate_bpm"` // beats per minute, 0 without a heart rate monitor
+	MaximumHeartRateBpm   uint64  `json:"maximum_heart_rate_bpm"` // beats per minute
+	AverageCadenceRpm     uint64  `json:"average_cadence_rpm"`    // strokes per minute
+	MaximumCadenceRpm     uint64  `json:"maximum_cadence_rpm"`    // strokes per minute
+	AveragePowerWatts     uint64  `json:"average_power_watts"`
+	MaximumPowerWatts     uint64  `json:"maximum_power_watts"`
+	Rest                  bool    `json:"rest"` // a rest between intervals, not counted in the activity summary
+}
+
+func NewLap() Lap {
+	return Lap{events: []s4.AggregateEvent{}}
+}
+
+// Samples returns the samples recorded during the lap
+func (lap *Lap) Samples() []s4.Sample {
+	samples := make([]s4.Sample, len(lap.events))
+	for i, event := range lap.events {
+		samples[i] = event.Sample()
+	}
+	return samples
+}
+
+// Events returns the aggregate events recorded during the lap
+func (lap *Lap) Events() []s4.AggregateEvent {
+	return lap.events
+}
+
+func (lap *Lap) AddEvent(event s4.AggregateEvent) {
+	if event.Time == 0 {
+		return
+	}
+	if lap.StartTimeMilliseconds == 0 {
+		lap.StartTimeMilliseconds = event.Time
+	}
+	lap.events = append(lap.events, event)
+
+	if event.Speed_m_s > lap.MaximumSpeedMs {
+		lap.MaximumSpeedMs = event.Speed_m_s
+	}
+	if event.Heart_rate > lap.MaximumHeartRateBpm {
+		lap.MaximumHeartRateBpm = event.Heart_rate
+	}
+	if event.Watts > lap.MaximumPowerWatts {
+		lap.MaximumPowerWatts = event.Watts
+	}
+	if event.Stroke_rate > lap.MaximumCadenceRpm {
+		lap.MaximumCadenceRpm = event.Stroke_rate
+	}
+	lap.sumHeartRateBpm += event.Heart_rate
+	lap.sumPowerWatts += event.Watts
+	lap.sumCadenceRpm += event.Stroke_rate
+
+	lap.calculate()
+}
+
+func (lap *Lap) calculate() {
+	numSamples := len(lap.events)
+
+	first := lap.events[0]
+	last := lap.events[numSamples-1]
+
+	lap.StartTimeSeconds = lap.StartTimeMilliseconds / 1000
+	lap.StartTimeZulu = util.MillisToZulu(lap.StartTimeMilliseconds)
+	lap.TotalTimeSeconds = (last.Time - first.Time) / 1000
+	lap.DistanceMeters = last.Total_distance_meters - first.Total_distance_meters
+	lap.AverageSpeedMs = float64(lap.DistanceMeters) / float64(lap.TotalTimeSeconds)
+	lap.KCalories = (last.Calories - first.Calories) / 1000
+	lap.AverageHeartRateBpm = uint64(float64(lap.sumHeartRateBpm) / float64(numSamples))
+	lap.AverageCadenceRpm = uint64(float64(lap.sumCadenceRpm) / float64(numSamples))
+	lap.AveragePowerWatts = uint64(float64(lap.sumPowerWatts) / float64(numSamples))
+
+}
@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"sort"
+)
+
+// OdometerGap is the distance rowed on the monitor between two activities
+// without being recorded, e.g. with oarsman not running
+type OdometerGap struct {
+	From             *Activity // the last activity with an odometer reading before the gap
+	To               *Activity // the activity whose reading reveals the gap
+	UnrecordedMeters uint64
+}
+
+// Odometer returns the lifetime distance of the activities, and the meters
+// rowed without being recorded between them, from the odometer of the
+// monitor read when each activity started: the odometer going up by more
+// than the distance recorded in between, by more than tolerance meters. A
+// reading going down, e.g. a replaced monitor, starts over.
+func Odometer(activities []*Activity, toleranceMeters uint64) (uint64, []OdometerGap) {
+	sorted := make([]*Activity, len(activities))
+	copy(sorted, activities)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].StartTimeMilliseconds < sorted[j].StartTimeMilliseconds })
+
+	var total uint64
+	gaps := []OdometerGap{}
+	var from *Activity
+	var recorded uint64 // since the reading of from
+	for _, activity := range sorted {
+		total += activity.DistanceMeters
+		reading := activity.Device.OdometerMeters
+		if reading == 0 {
+			recorded += activity.DistanceMeters
+			continue
+		}
+		if from != nil && reading > from.Device.OdometerMeters+recorded+toleranceMeters {
+			gaps = append(gaps, OdometerGap{
+				From:             from,
+				To:               activity,
+				UnrecordedMeters: reading - from.Device.OdometerMeters - recorded})
+		}
+		from = activity
+		recorded = activity.DistanceMeters
+	}
+	return total, gaps
+}
@@ -0,0 +1,71 @@
+package collector
+
+const (
+	EvenSplit     = "even"
+	NegativeSplit = "negative"
+	PositiveSplit = "positive"
+)
+
+// halves within this difference, in seconds per 500m, are even splits
+const evenSplitTolerance = 0.5
+
+type PacingAnalysis struct {
+	Quarters        []Split
+	Splits          []Split // every 500m
+	FirstHalfPace   float64 // seconds per 500m
+	SecondHalfPace  float64 // seconds per 500m
+	Splitting       string
+	FadePercent     float64 // last quarter pace over the fastest quarter pace
+	StrokeRateDrift int64   // last quarter over first quarter stroke rate
+}
+
+// Pacing analyses how the piece was paced over its distance
+func (activity *Activity) Pacing() *PacingAnalysis {
+	events := activity.Events()
+	if len(events) < 2 {
+		return nil
+	}
+	first := events[0].Total_distance_meters
+	last := events[len(events)-1].Total_distance_meters
+	if last <= first+4 {
+		return nil
+	}
+	distance := int64(last - first)
+
+	analysis := &PacingAnalysis{
+		Quarters: activity.Splits(SplitByDistance, (distance+3)/4),
+		Splits:   activity.Splits(SplitByDistance, 500),
+	}
+
+	halves := activity.Splits(SplitByDistance, (distance+1)/2)
+	if len(halves) >= 2 {
+		analysis.FirstHalfPace = halves[0].Pace()
+		analysis.SecondHalfPace = halves[1].Pace()
+		delta := analysis.SecondHalfPace - analysis.FirstHalfPace
+		switch {
+		case delta > evenSplitTolerance:
+			analysis.Splitting = PositiveSplit
+		case delta < -evenSplitTolerance:
+			analysis.Splitting = NegativeSplit
+		default:
+			analysis.Splitting = EvenSplit
+		}
+	}
+
+	quarters := analysis.Quarters
+	if len(quarters) > 0 {
+		fastest := 0.0
+		for _, q := range quarters {
+			if q.Pace() > 0 && (fastest == 0 || q.Pace() < fastest) {
+				fastest = q.Pace()
+			}
+		}
+		lastQuarter := quarters[len(quarters)-1]
+		if fastest > 0 {
+			analysis.FadePercent = (lastQuarter.Pace() - fastest) * 100.0 / fastest
+		}
+		analysis.StrokeRateDrift = int64(lastQuarter.AverageCadenceRpm) - int64(quarters[0].AverageCadenceRpm)
+	}
+
+	return analysis
+}
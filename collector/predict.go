@@ -0,0 +1,129 @@
+package collector
+
+import (
+	"math"
+	"sort"
+)
+
+// Concept2 power formula, watts = 2.8 / (seconds per meter)^3
+const powerFactor = 2.8
+
+type Prediction struct {
+	DistanceMeters uint64
+	PaulSeconds    float64 // best Paul's law prediction
+	CPSeconds      float64 // critical power model prediction, 0 if not available
+	LowSeconds     float64
+	HighSeconds    float64
+}
+
+type effort struct {
+	distance float64 // meters
+	seconds  float64
+}
+
+func (e effort) watts() float64 {
+	return powerFactor * math.Pow(e.distance/e.seconds, 3)
+}
+
+// paulsLaw predicts the time over distance from an effort: the 500m split
+// slows 5 seconds for every doubling of distance
+func paulsLaw(e effort, distance float64) float64 {
+	split := 500.0 * e.seconds / e.distance
+	split += 5.0 * math.Log2(distance/e.distance)
+	return split * distance / 500.0
+}
+
+// criticalPower fits work = CP * t + W' over the efforts by least squares
+func criticalPower(efforts []effort) (float64, float64, bool) {
+	if len(efforts) < 2 {
+		return 0, 0, false
+	}
+	var sumT, sumW, sumTT, sumTW float64
+	for _, e := range efforts {
+		work := e.watts() * e.seconds
+		sumT += e.seconds
+		sumW += work
+		sumTT += e.seconds * e.seconds
+		sumTW += e.seconds * work
+	}
+	n := float64(len(efforts))
+	denominator := n*sumTT - sumT*sumT
+	if denominator == 0 {
+		return 0, 0, false
+	}
+	cp := (n*sumTW - sumT*sumW) / denominator
+	wPrime := (sumW - cp*sumT) / n
+	if cp <= 0 || wPrime < 0 {
+		return 0, 0, false
+	}
+	return cp, wPrime, true
+}
+
+// criticalPowerTime solves distance = v(P(t)) * t, with P(t) = CP + W'/t, by
+// bisection
+func criticalPowerTime(cp float64, wPrime float64, distance float64) float64 {
+	covered := func(t float64) float64 {
+		watts := cp + wPrime/t
+		return math.Cbrt(watts/powerFactor) * t
+	}
+	low, high := 1.0, 36000.0
+	for i := 0; i < 60; i++ {
+		t := (low + high) / 2
+		if covered(t) < distance {
+			low = t
+		} else {
+			high = t
+		}
+	}
+	return (low + high) / 2
+}
+
+// PredictRaceTimes predicts the race times over the distances from the best
+// efforts of the activities. Each activity is an effort over its whole
+// distance and time, ranked by its Paul's law 2k equivalent. The critical
+// power model is fitted over the five best efforts, and the range covers the
+// Paul's law predictions of the three best efforts and the critical power
+// prediction.
+func PredictRaceTimes(activities []*Activity, distances []uint64) []Prediction {
+	efforts := []effort{}
+	for _, activity := range activities {
+		if activity.DistanceMeters == 0 || activity.TotalTimeSeconds == 0 {
+			continue
+		}
+		efforts = append(efforts, effort{distance: float64(activity.DistanceMeters), seconds: float64(activity.TotalTimeSeconds)})
+	}
+	if len(efforts) == 0 {
+		return nil
+	}
+
+	sort.Slice(efforts, func(i, j int) bool {
+		return paulsLaw(efforts[i], 2000) < paulsLaw(efforts[j], 2000)
+	})
+	best := efforts
+	if len(best) > 5 {
+		best = best[:5]
+	}
+	cp, wPrime, cpOk := criticalPower(best)
+	if len(best) > 3 {
+		best = best[:3]
+	}
+
+	predictions := []Prediction{}
+	for _, d := range distances {
+		distance := float64(d)
+		times := []float64{}
+		for _, e := range best {
+			times = append(times, paulsLaw(e, distance))
+		}
+		sort.Float64s(times)
+
+		prediction := Prediction{DistanceMeters: d, PaulSeconds: times[0], LowSeconds: times[0], HighSeconds: times[len(times)-1]}
+		if cpOk {
+			prediction.CPSeconds = criticalPowerTime(cp, wPrime, distance)
+			prediction.LowSeconds = math.Min(prediction.LowSeconds, prediction.CPSeconds)
+			prediction.HighSeconds = math.Max(prediction.HighSeconds, prediction.CPSeconds)
+		}
+		predictions = append(predictions, prediction)
+	}
+	return predictions
+}
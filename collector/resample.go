@@ -0,0 +1,106 @@
+package collector
+
+import (
+	"github.com/olympum/oarsman/s4"
+	"time"
+)
+
+// Resample returns a copy of the activity with the events of each lap merged
+// into samples spanning at least every, for exports to platforms limiting
+// the file size. Stroke rate, power and heart rate are averaged over each
+// sample weighted by time, speed is recomputed from the distance, and the
+// activity and lap summaries (including the maximum heart rate) are kept
+// from the original events.
+func (activity *Activity) Resample(every time.Duration) *Activity {
+	resampled := *activity
+	resampled.laps = []*Lap{}
+	for _, lap := range activity.laps {
+		l := *lap
+		l.events = resampleEvents(lap.events, int64(every/time.Millisecond))
+		resampled.laps = append(resampled.laps, &l)
+	}
+	return &resampled
+}
+
+// ResampleStream merges the events received into samples spanning at least
+// every, like Resample, starting a new sample at the start of each lap
+func ResampleStream(events <-chan s4.AggregateEvent, every time.Duration, laps []*Lap) <-chan s4.AggregateEvent {
+	resampled := make(chan s4.AggregateEvent)
+	go func() {
+		everyMillis := int64(every / time.Millisecond)
+		bucket := []s4.AggregateEvent{}
+		n := 0
+		for e := range events {
+			lapStart := n+1 < len(laps) && e.Time >= laps[n+1].StartTimeMilliseconds
+			if len(bucket) > 0 && (lapStart || e.Time-bucket[0].Time >= everyMillis) {
+				resampled <- mergeEvents(bucket)
+				bucket = bucket[:0]
+			}
+			if lapStart {
+				n++
+			}
+			bucket = append(bucket, e)
+		}
+		if len(bucket) > 0 {
+			resampled <- mergeEvents(bucket)
+		}
+		close(resampled)
+	}()
+	return resampled
+}
+
+func resampleEvents(events []s4.AggregateEvent, everyMillis int64) []s4.AggregateEvent {
+	if everyMillis <= 0 || len(events) == 0 {
+		return events
+	}
+
+	resampled := []s4.AggregateEvent{}
+	start := 0
+	for i := 1; i <= len(events); i++ {
+		if i < len(events) && events[i].Time-events[start].Time < everyMillis {
+			continue
+		}
+		resampled = append(resampled, mergeEvents(events[start:i]))
+		start = i
+	}
+	return resampled
+}
+
+// mergeEvents merges consecutive aggregate events into one
+func mergeEvents(events []s4.AggregateEvent) s4.AggregateEvent {
+	first := events[0]
+	merged := events[len(events)-1]
+	merged.Time_start = first.Time_start
+	merged.Start_distance_meters = first.Start_distance_meters
+	if len(events) == 1 {
+		return merged
+	}
+
+	var weights, heartRateWeights int64
+	var strokeRate, watts, heartRate int64
+	for _, e := range events {
+		weight := e.Time - e.Time_start
+		if weight <= 0 {
+			weight = 1
+		}
+		weights += weight
+		strokeRate += int64(e.Stroke_rate) * weight
+		watts += int64(e.Watts) * weight
+		// samples without heart rate do not lower the average
+		if e.Heart_rate > 0 {
+			heartRate += int64(e.Heart_rate) * weight
+			heartRateWeights += weight
+		}
+	}
+	merged.Stroke_rate = uint64(strokeRate / weights)
+	merged.Watts = uint64(watts / weights)
+	if heartRateWeights > 0 {
+		merged.Heart_rate = uint64(heartRate / heartRateWeights)
+	}
+
+	deltaTime := merged.Time - merged.Time_start
+	if deltaTime > 0 && merged.Total_distance_meters > merged.Start_distance_meters {
+		merged.Speed_m_s = float64(merged.Total_distance_meters-merged.Start_distance_meters) * 1000.0 / float64(deltaTime)
+	}
+	return merged
+}
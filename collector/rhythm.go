@@ -0,0 +1,113 @@
+package collector
+
+import (
+	"github.com/olympum/oarsman/s4"
+	"math"
+)
+
+// the first strokes of a piece, rowed faster to get going, are not steady
+const startStrokes = 5
+
+// Rhythm is the variability of the stroke durations of a steady piece, a
+// proxy for the consistency of the rhythm
+type Rhythm struct {
+	Strokes               int
+	MeanMilliseconds      float64
+	DeviationMilliseconds float64 // standard deviation
+	VariabilityPercent    float64 // the deviation over the mean
+}
+
+// RhythmThresholds rate the variability of an athlete, in percent
+type RhythmThresholds struct {
+	Steady   float64 // at most this variability is steady
+	Variable float64 // at most this variability is variable, above erratic
+}
+
+// Rating returns "steady", "variable" or "erratic"
+func (t RhythmThresholds) Rating(rhythm Rhythm) string {
+	switch {
+	case rhythm.VariabilityPercent <= t.Steady:
+		return "steady"
+	case rhythm.VariabilityPercent <= t.Variable:
+		return "variable"
+	}
+	return "erratic"
+}
+
+// strokeTiming is the start and duration of a stroke
+type strokeTiming struct {
+	start    int64
+	duration int64
+}
+
+// strokeTimings returns the strokes of the events of a raw log, from a
+// stroke start to the next one, leaving out the pauses
+func strokeTimings(events []s4.AtomicEvent) []strokeTiming {
+	timings := []strokeTiming{}
+	var last int64
+	for _, e := range events {
+		if e.Label != string(s4.MetricStrokeStart) {
+			continue
+		}
+		if last > 0 && e.Time > last && e.Time-last <= maxStrokeMillis {
+			timings = append(timings, strokeTiming{last, e.Time - last})
+		}
+		last = e.Time
+	}
+	return timings
+}
+
+func newRhythm(timings []strokeTiming) Rhythm {
+	rhythm := Rhythm{Strokes: len(timings)}
+	if len(timings) == 0 {
+		return rhythm
+	}
+	for _, t := range timings {
+		rhythm.MeanMilliseconds += float64(t.duration)
+	}
+	rhythm.MeanMilliseconds /= float64(len(timings))
+	for _, t := range timings {
+		d := float64(t.duration) - rhythm.MeanMilliseconds
+		rhythm.DeviationMilliseconds += d * d
+	}
+	rhythm.DeviationMilliseconds = math.Sqrt(rhythm.DeviationMilliseconds / float64(len(timings)))
+	rhythm.VariabilityPercent = rhythm.DeviationMilliseconds / rhythm.MeanMilliseconds * 100
+	return rhythm
+}
+
+// Rhythms returns the rhythm of the whole activity and of each of its laps,
+// from the events of its raw log, the rests having no strokes. The first
+// strokes of the activity and of each interval after a rest are left out.
+func (activity *Activity) Rhythms(events []s4.AtomicEvent) (Rhythm, []Rhythm) {
+	timings := strokeTimings(events)
+	steady := []strokeTiming{}
+	laps := make([]Rhythm, len(activity.laps))
+	start := true
+	for i, lap := range activity.laps {
+		if lap.Rest {
+			start = true
+			continue
+		}
+		end := lap.StartTimeMilliseconds + lap.TotalTimeSeconds*1000
+		if len(lap.events) > 0 {
+			end = lap.events[len(lap.events)-1].Time
+		}
+		inLap := []strokeTiming{}
+		for _, t := range timings {
+			if t.start >= lap.StartTimeMilliseconds && t.start < end {
+				inLap = append(inLap, t)
+			}
+		}
+		if start {
+			if len(inLap) > startStrokes {
+				inLap = inLap[startStrokes:]
+			} else {
+				inLap = nil
+			}
+			start = false
+		}
+		laps[i] = newRhythm(inLap)
+		steady = append(steady, inLap...)
+	}
+	return newRhythm(steady), laps
+}
@@ -0,0 +1,118 @@
+package collector
+
+import (
+	"github.com/olympum/oarsman/s4"
+)
+
+const (
+	SplitByDistance = "distance"
+	SplitByTime     = "time"
+)
+
+type Split struct {
+	Number               int
+	Offset               int64
+	DistanceMeters       uint64
+	DurationMilliseconds int64
+	AverageSpeedMs       float64
+	AverageHeartRateBpm  uint64
+	AverageCadenceRpm    uint64
+	AveragePowerWatts    uint64
+}
+
+// Pace returns the split pace in seconds per 500 meters
+func (split Split) Pace() float64 {
+	return PaceOf(split.AverageSpeedMs)
+}
+
+// Events returns the aggregate events of all laps in time order, skipping
+// the event duplicated at the start of each auto-lap
+func (activity *Activity) Events() []s4.AggregateEvent {
+	events := []s4.AggregateEvent{}
+	var last int64
+	for _, lap := range activity.laps {
+		for _, event := range lap.events {
+			if event.Time <= last {
+				continue
+			}
+			events = append(events, event)
+			last = event.Time
+		}
+	}
+	return events
+}
+
+// Splits groups the activity events into consecutive splits of size meters
+// (SplitByDistance) or size seconds (SplitByTime), measured from the first
+// event of the activity. The rests are left out of the distance splits.
+func (activity *Activity) Splits(by string, size int64) []Split {
+	events := activity.Events()
+	if len(events) == 0 || size <= 0 {
+		return nil
+	}
+
+	origin := events[0]
+	splits := []Split{}
+	var split *Split
+	var samples uint64
+	var sumHeartRate, sumCadence, sumPower uint64
+	previous := origin
+
+	closeSplit := func() {
+		if split == nil || samples == 0 {
+			return
+		}
+		split.AverageHeartRateBpm = sumHeartRate / samples
+		split.AverageCadenceRpm = sumCadence / samples
+		split.AveragePowerWatts = sumPower / samples
+		if split.DurationMilliseconds > 0 {
+			split.AverageSpeedMs = float64(split.DistanceMeters) * 1000.0 / float64(split.DurationMilliseconds)
+		}
+		splits = append(splits, *split)
+	}
+
+	for _, event := range events[1:] {
+		if event.Rest && by != SplitByTime {
+			previous = event
+			continue
+		}
+		var position int64
+		if by == SplitByTime {
+			position = (event.Time - origin.Time) / 1000
+		} else if event.Total_distance_meters > origin.Total_distance_meters {
+			position = int64(event.Total_distance_meters - origin.Total_distance_meters)
+		}
+		number := int(position/size) + 1
+		// an event landing exactly on a boundary closes the current split
+		if position > 0 && position%size == 0 {
+			number--
+		}
+
+		if split == nil || number != split.Number {
+			closeSplit()
+			split = &Split{Number: number, Offset: int64(number-1) * size}
+			samples, sumHeartRate, sumCadence, sumPower = 0, 0, 0, 0
+		}
+
+		split.DurationMilliseconds += event.Time - previous.Time
+		if event.Total_distance_meters > previous.Total_distance_meters {
+			split.DistanceMeters += event.Total_distance_meters - previous.Total_distance_meters
+		}
+		sumHeartRate += event.Heart_rate
+		sumCadence += event.Stroke_rate
+		sumPower += event.Watts
+		samples++
+		previous = event
+	}
+	closeSplit()
+
+	return splits
+}
+
+// PaceOf returns the pace in seconds per 500m at the speed, 0 if not moving
+func PaceOf(speedMs float64) float64 {
+	if speedMs <= 0 {
+		return 0
+	}
+	return 500.0 / speedMs
+}
@@ -0,0 +1,143 @@
+package collector
+
+import (
+	"github.com/olympum/oarsman/util"
+	"time"
+)
+
+type Streaks struct {
+	CurrentDays  int
+	LongestDays  int
+	CurrentWeeks int
+	LongestWeeks int
+}
+
+type WeekSummary struct {
+	Start            time.Time
+	Sessions         int
+	DistanceMeters   uint64
+	TotalTimeSeconds int64
+}
+
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// week returns the Monday starting the week of t
+func week(t time.Time) time.Time {
+	d := day(t)
+	offset := (int(d.Weekday()) + 6) % 7
+	return d.AddDate(0, 0, -offset)
+}
+
+// activityTime returns the wall clock start time of the activity in the
+// timezone where it took place, expressed in location so that days and weeks
+// line up with now
+func activityTime(activity *Activity, location *time.Location) time.Time {
+	t := time.Unix(activity.StartTimeMilliseconds/1000, 0)
+	if activity.Timezone == "" {
+		return t.In(location)
+	}
+	t = t.In(util.Location(activity.Timezone))
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, location)
+}
+
+// LocalTime returns the wall clock start time of the activity in the timezone
+// where it took place, expressed in location, e.g. to match it with the day
+// of a training plan
+func (activity *Activity) LocalTime(location *time.Location) time.Time {
+	return activityTime(activity, location)
+}
+
+// streak returns the current and longest run of consecutive periods with at
+// least one session. The current run is still alive if the last session was
+// in the previous period.
+func streak(periods map[time.Time]bool, now time.Time, next func(time.Time) time.Time, previous func(time.Time) time.Time) (int, int) {
+	longest := 0
+	for start := range periods {
+		if periods[previous(start)] {
+			continue
+		}
+		length := 0
+		for p := start; periods[p]; p = next(p) {
+			length++
+		}
+		if length > longest {
+			longest = length
+		}
+	}
+
+	current := 0
+	p := now
+	if !periods[p] {
+		p = previous(p)
+	}
+	for ; periods[p]; p = previous(p) {
+		current++
+	}
+	return current, longest
+}
+
+// ActivityStreaks computes the day and week streaks of the activities, in the
+// time zone of now
+func ActivityStreaks(activities []*Activity, now time.Time) Streaks {
+	days := map[time.Time]bool{}
+	weeks := map[time.Time]bool{}
+	for _, activity := range activities {
+		t := activityTime(activity, now.Location())
+		days[day(t)] = true
+		weeks[week(t)] = true
+	}
+
+	streaks := Streaks{}
+	streaks.CurrentDays, streaks.LongestDays = streak(days, day(now),
+		func(t time.Time) time.Time { return t.AddDate(0, 0, 1) },
+		func(t time.Time) time.Time { return t.AddDate(0, 0, -1) })
+	streaks.CurrentWeeks, streaks.LongestWeeks = streak(weeks, week(now),
+		func(t time.Time) time.Time { return t.AddDate(0, 0, 7) },
+		func(t time.Time) time.Time { return t.AddDate(0, 0, -7) })
+	return streaks
+}
+
+// BestWeek returns the week (Monday to Sunday) with the most meters rowed, in
+// location
+func BestWeek(activities []*Activity, location *time.Location) WeekSummary {
+	weeks := map[time.Time]*WeekSummary{}
+	best := WeekSummary{}
+	for _, activity := range activities {
+		w := week(activityTime(activity, location))
+		summary, ok := weeks[w]
+		if !ok {
+			summary = &WeekSummary{Start: w}
+			weeks[w] = summary
+		}
+		summary.Sessions++
+		summary.DistanceMeters += activity.DistanceMeters
+		summary.TotalTimeSeconds += activity.TotalTimeSeconds
+		if summary.DistanceMeters > best.DistanceMeters {
+			best = *summary
+		}
+	}
+	return best
+}
+
+// WeeklySummaries returns the sessions, distance and time of the last n weeks
+// (Monday to Sunday), most recent last
+func WeeklySummaries(activities []*Activity, now time.Time, n int) []WeekSummary {
+	summaries := make([]WeekSummary, n)
+	current := week(now)
+	for i := range summaries {
+		summaries[i].Start = current.AddDate(0, 0, -7*(n-1-i))
+	}
+	for _, activity := range activities {
+		w := week(activityTime(activity, now.Location()))
+		for i := range summaries {
+			if summaries[i].Start.Equal(w) {
+				summaries[i].Sessions++
+				summaries[i].DistanceMeters += activity.DistanceMeters
+				summaries[i].TotalTimeSeconds += activity.TotalTimeSeconds
+			}
+		}
+	}
+	return summaries
+}
@@ -0,0 +1,232 @@
+package collector
+
+import (
+	"github.com/olympum/oarsman/s4"
+	"sort"
+)
+
+// the S4 counts the pulses of the paddle wheel every 25 ms
+const pulseIntervalMillis = 25
+
+// strokes longer than this, e.g. the last one before a rest, are not profiled
+const maxStrokeMillis = 6000
+
+// StrokeProfile is the speed through one stroke, every 25 ms from the pulses
+// of the paddle wheel: a pseudo force curve showing how the drive is applied,
+// which the monitor alone cannot show
+type StrokeProfile struct {
+	StartTimeMilliseconds int64     `json:"start_time_milliseconds"`
+	DriveMilliseconds     int64     `json:"drive_milliseconds"` // 0 if the end of the drive is unknown
+	Speeds                []float64 `json:"speeds_m_s"`         // every 25 ms from the start of the stroke
+}
+
+// DurationMilliseconds returns the duration of the stroke, drive and recovery
+func (p StrokeProfile) DurationMilliseconds() int64 {
+	return int64(len(p.Speeds)) * pulseIntervalMillis
+}
+
+// Accelerations returns the accelerations between the speeds, in m/s²
+func (p StrokeProfile) Accelerations() []float64 {
+	if len(p.Speeds) < 2 {
+		return nil
+	}
+	accelerations := make([]float64, len(p.Speeds)-1)
+	for i := range accelerations {
+		accelerations[i] = (p.Speeds[i+1] - p.Speeds[i]) * 1000 / pulseIntervalMillis
+	}
+	return accelerations
+}
+
+// PeakSpeed returns the highest speed of the stroke, in m/s
+func (p StrokeProfile) PeakSpeed() float64 {
+	peak := 0.0
+	for _, v := range p.Speeds {
+		if v > peak {
+			peak = v
+		}
+	}
+	return peak
+}
+
+// PeakAcceleration returns the highest acceleration of the stroke, in m/s²
+func (p StrokeProfile) PeakAcceleration() float64 {
+	peak := 0.0
+	for _, v := range p.Accelerations() {
+		if v > peak {
+			peak = v
+		}
+	}
+	return peak
+}
+
+// NewStrokeProfiles returns the profile of every stroke of the events of a
+// raw log, from a stroke start to the next one. The pulses are converted to
+// speeds with the distance rowed over the log, so that no calibration of the
+// paddle wheel is needed. Logs without pulses, e.g. recorded before they
+// were logged, have no profiles.
+func NewStrokeProfiles(events []s4.AtomicEvent) []StrokeProfile {
+	var pulses, first, last uint64
+	distanceSeen := false
+	for _, e := range events {
+		switch e.Label {
+		case string(s4.MetricPulses):
+			pulses += e.Value
+		case string(s4.MetricTotalDistance):
+			if !distanceSeen {
+				first = e.Value
+				distanceSeen = true
+			}
+			last = e.Value
+		}
+	}
+	if pulses == 0 || last <= first {
+		return nil
+	}
+	metersPerPulse := float64(last-first) / float64(pulses)
+
+	profiles := []StrokeProfile{}
+	var current *StrokeProfile
+	for _, e := range events {
+		switch e.Label {
+		case string(s4.MetricStrokeStart):
+			if current != nil && current.DurationMilliseconds() <= maxStrokeMillis && current.PeakSpeed() > 0 {
+				profiles = append(profiles, *current)
+			}
+			current = &StrokeProfile{StartTimeMilliseconds: e.Time}
+		case string(s4.MetricStrokeEnd):
+			if current != nil && current.DriveMilliseconds == 0 {
+				current.DriveMilliseconds = e.Time - current.StartTimeMilliseconds
+			}
+		case string(s4.MetricPulses):
+			if current == nil {
+				continue
+			}
+			// placed by time, the wheel sending no pulses while stopped
+			i := int((e.Time - current.StartTimeMilliseconds) / pulseIntervalMillis)
+			if i > maxStrokeMillis/pulseIntervalMillis {
+				continue
+			}
+			for len(current.Speeds) <= i {
+				current.Speeds = append(current.Speeds, 0)
+			}
+			current.Speeds[i] += float64(e.Value) * metersPerPulse * 1000 / pulseIntervalMillis
+		}
+	}
+	// the last stroke, not followed by another, is left out as incomplete
+	return profiles
+}
+
+// AverageStrokeProfile returns the average of the profiles over the median
+// duration of the strokes, nil if there are none
+func AverageStrokeProfile(profiles []StrokeProfile) *StrokeProfile {
+	if len(profiles) == 0 {
+		return nil
+	}
+	lengths := make([]int, len(profiles))
+	var drive, drives int64
+	for i, p := range profiles {
+		lengths[i] = len(p.Speeds)
+		if p.DriveMilliseconds > 0 {
+			drive += p.DriveMilliseconds
+			drives++
+		}
+	}
+	sort.Ints(lengths)
+
+	average := &StrokeProfile{
+		StartTimeMilliseconds: profiles[0].StartTimeMilliseconds,
+		Speeds:                make([]float64, lengths[len(lengths)/2])}
+	if drives > 0 {
+		average.DriveMilliseconds = drive / drives
+	}
+	for i := range average.Speeds {
+		n := 0
+		for _, p := range profiles {
+			if i < len(p.Speeds) {
+				average.Speeds[i] += p.Speeds[i]
+				n++
+			}
+		}
+		average.Speeds[i] /= float64(n)
+	}
+	return average
+}
+
+// Stroke is the summary of one stroke, from its start to the start of the
+// next one, with the last values the monitor sent during the stroke
+type Stroke struct {
+	StartTimeMilliseconds int64
+	DurationMilliseconds  int64
+	DriveMilliseconds     int64  // 0 if the end of the drive is unknown
+	DistanceMeters        uint64 // total distance at the end of the stroke
+	StrokeMeters          uint64 // distance of the stroke itself
+	StrokeRate            uint64
+	Watts                 uint64
+	SpeedMs               float64 // 0 if the monitor sent no speed
+	HeartRate             uint64
+	Calories              uint64 // total at the end of the stroke, in thousandths of kcal
+}
+
+// Pace returns the pace of the stroke in seconds per 500 meters, from the
+// speed of the monitor or else from the distance of the stroke, 0 if none
+func (stroke Stroke) Pace() float64 {
+	if stroke.SpeedMs > 0 {
+		return 500 / stroke.SpeedMs
+	}
+	if stroke.StrokeMeters == 0 {
+		return 0
+	}
+	return float64(stroke.DurationMilliseconds) / 1000 * 500 / float64(stroke.StrokeMeters)
+}
+
+// NewStrokes returns every stroke of the events of a raw log, e.g. for the
+// stroke by stroke exports. The last stroke, not followed by another, ends
+// with the last event.
+func NewStrokes(events []s4.AtomicEvent) []Stroke {
+	strokes := []Stroke{}
+	var current *Stroke
+	var startMeters, distance, rate, watts, heartRate, calories uint64
+	var speed float64
+	end := func(t int64) {
+		if current == nil {
+			return
+		}
+		current.DurationMilliseconds = t - current.StartTimeMilliseconds
+		current.DistanceMeters = distance
+		current.StrokeMeters = distance - startMeters
+		current.StrokeRate = rate
+		current.Watts = watts
+		current.SpeedMs = speed
+		current.HeartRate = heartRate
+		current.Calories = calories
+		strokes = append(strokes, *current)
+	}
+	for _, e := range events {
+		switch e.Label {
+		case string(s4.MetricStrokeStart):
+			end(e.Time)
+			current = &Stroke{StartTimeMilliseconds: e.Time}
+			startMeters = distance
+		case string(s4.MetricStrokeEnd):
+			if current != nil && current.DriveMilliseconds == 0 {
+				current.DriveMilliseconds = e.Time - current.StartTimeMilliseconds
+			}
+		case string(s4.MetricTotalDistance):
+			distance = e.Value
+		case string(s4.MetricStrokeRate):
+			rate = e.Value
+		case string(s4.MetricWatts):
+			watts = e.Value
+		case string(s4.MetricSpeed):
+			speed = float64(e.Value) / 100
+		case string(s4.MetricHeartRate):
+			heartRate = e.Value
+		case string(s4.MetricCalories):
+			calories = e.Value
+		}
+	}
+	if len(events) > 0 {
+		end(events[len(events)-1].Time)
+	}
+	return strokes
+}
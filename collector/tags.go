@@ -0,0 +1,21 @@
+package collector
+
+import (
+	"strings"
+)
+
+// ParseTags returns the tags of a comma separated list, e.g. "threshold,
+// 8x500", in lower case, without the empty and repeated ones
+func ParseTags(list string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
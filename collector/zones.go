@@ -0,0 +1,52 @@
+package collector
+
+type Zone struct {
+	Name string
+	Low  uint64 // percent of maximum heart rate, inclusive
+	High uint64 // percent of maximum heart rate, exclusive
+}
+
+var HeartRateZones = []Zone{
+	Zone{"Z1 Recovery", 0, 60},
+	Zone{"Z2 Endurance", 60, 70},
+	Zone{"Z3 Tempo", 70, 80},
+	Zone{"Z4 Threshold", 80, 90},
+	Zone{"Z5 Maximum", 90, 1000}}
+
+type ZoneTime struct {
+	Zone
+	Seconds int64
+}
+
+// HeartRateZoneDistribution returns the time spent in each heart rate zone,
+// relative to the athlete maximum heart rate. Samples without heart rate are
+// not counted.
+func (activity *Activity) HeartRateZoneDistribution(maxHeartRateBpm uint64) []ZoneTime {
+	distribution := make([]ZoneTime, len(HeartRateZones))
+	for i, zone := range HeartRateZones {
+		distribution[i].Zone = zone
+	}
+	if maxHeartRateBpm == 0 {
+		return distribution
+	}
+
+	millis := make([]int64, len(HeartRateZones))
+	events := activity.Events()
+	for i := 1; i < len(events); i++ {
+		e := events[i]
+		if e.Heart_rate == 0 {
+			continue
+		}
+		percent := e.Heart_rate * 100 / maxHeartRateBpm
+		for z, zone := range HeartRateZones {
+			if percent >= zone.Low && percent < zone.High {
+				millis[z] += e.Time - events[i-1].Time
+				break
+			}
+		}
+	}
+	for z := range distribution {
+		distribution[z].Seconds = millis[z] / 1000
+	}
+	return distribution
+}
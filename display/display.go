@@ -0,0 +1,92 @@
+package display
+
+import (
+	"fmt"
+	"github.com/olympum/oarsman/s4"
+	"github.com/olympum/oarsman/util"
+)
+
+// Screen shows lines of text, e.g. a small OLED display on a Raspberry Pi
+// strapped to the rower
+type Screen interface {
+	Show(lines []string) error
+}
+
+// DashboardMetrics are the metrics shown on the dashboard
+var DashboardMetrics = []s4.Metric{
+	s4.MetricTotalDistance,
+	s4.MetricStrokeRate,
+	s4.MetricSpeed,
+	s4.MetricHeartRate,
+}
+
+// the time between two refreshes of the screen, much longer than the 25 ms
+// of the driver so that the I2C bus keeps up
+const refreshMillis = 500
+
+// Dashboard shows the live pace, stroke rate, heart rate and distance of the
+// workout on a screen, one per line:
+//
+//	2:04.3/500
+//	22 spm
+//	158 bpm
+//	1234 m
+type Dashboard struct {
+	screen Screen
+
+	refreshed  int64 // time of the last refresh
+	failing    bool
+	speed      uint64
+	strokeRate uint64
+	heartRate  uint64
+	distance   uint64
+}
+
+// NewDashboard returns the dashboard shown on the screen
+func NewDashboard(screen Screen) *Dashboard {
+	return &Dashboard{screen: screen}
+}
+
+// Run shows the dashboard until the events end, as subscribed with
+// s4.Subscribe for the DashboardMetrics. The first failure of the screen is
+// logged, the next ones until it recovers are not.
+func (d *Dashboard) Run(events <-chan s4.Event) {
+	for event := range events {
+		switch event.Metric {
+		case s4.MetricTotalDistance:
+			d.distance = event.Value
+		case s4.MetricStrokeRate:
+			d.strokeRate = event.Value
+		case s4.MetricSpeed:
+			d.speed = event.Value
+		case s4.MetricHeartRate:
+			d.heartRate = event.Value
+		}
+		if event.Time-d.refreshed < refreshMillis {
+			continue
+		}
+		d.refreshed = event.Time
+		err := d.screen.Show(d.lines())
+		if err != nil && !d.failing {
+			s4.Log().Errorf("Could not show the dashboard: %v", err)
+		}
+		d.failing = err != nil
+	}
+}
+
+func (d *Dashboard) lines() []string {
+	pace := "-"
+	if d.speed > 0 {
+		// the speed is in cm/s
+		pace = util.SecondsToPace(50000/float64(d.speed)) + "/500"
+	}
+	heartRate := "- bpm"
+	if d.heartRate > 0 {
+		heartRate = fmt.Sprintf("%d bpm", d.heartRate)
+	}
+	return []string{
+		pace,
+		fmt.Sprintf("%d spm", d.strokeRate),
+		heartRate,
+		fmt.Sprintf("%d m", d.distance)}
+}
@@ -0,0 +1,25 @@
+package display
+
+// font are the 5x7 glyphs of the characters shown on the dashboard, one byte
+// per column with the top row in the least significant bit. Other characters
+// are shown blank.
+var font = map[rune][5]byte{
+	'0': {0x3E, 0x51, 0x49, 0x45, 0x3E},
+	'1': {0x00, 0x42, 0x7F, 0x40, 0x00},
+	'2': {0x42, 0x61, 0x51, 0x49, 0x46},
+	'3': {0x21, 0x41, 0x45, 0x4B, 0x31},
+	'4': {0x18, 0x14, 0x12, 0x7F, 0x10},
+	'5': {0x27, 0x45, 0x45, 0x45, 0x39},
+	'6': {0x3C, 0x4A, 0x49, 0x49, 0x30},
+	'7': {0x01, 0x71, 0x09, 0x05, 0x03},
+	'8': {0x36, 0x49, 0x49, 0x49, 0x36},
+	'9': {0x06, 0x49, 0x49, 0x29, 0x1E},
+	':': {0x00, 0x36, 0x36, 0x00, 0x00},
+	'.': {0x00, 0x60, 0x60, 0x00, 0x00},
+	'/': {0x20, 0x10, 0x08, 0x04, 0x02},
+	'-': {0x08, 0x08, 0x08, 0x08, 0x08},
+	'b': {0x7F, 0x48, 0x44, 0x44, 0x38},
+	'm': {0x7C, 0x04, 0x18, 0x04, 0x78},
+	'p': {0x7C, 0x14, 0x14, 0x14, 0x08},
+	's': {0x48, 0x54, 0x54, 0x54, 0x20},
+}
@@ -0,0 +1,23 @@
+package display
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// the ioctl of the Linux i2c-dev interface setting the address of the device
+// the reads and writes go to
+const i2cSlave = 0x0703
+
+func openI2C(bus string, address int) (io.WriteCloser, error) {
+	f, err := os.OpenFile(bus, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), i2cSlave, uintptr(address)); errno != 0 {
+		f.Close()
+		return nil, errno
+	}
+	return f, nil
+}
@@ -0,0 +1,12 @@
+// +build !linux
+
+package display
+
+import (
+	"errors"
+	"io"
+)
+
+func openI2C(bus string, address int) (io.WriteCloser, error) {
+	return nil, errors.New("I2C displays are only supported on Linux")
+}
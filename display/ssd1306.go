@@ -0,0 +1,131 @@
+package display
+
+import (
+	"io"
+)
+
+// the geometry of the SSD1306 128x64 OLED displays, in pages of 8 rows
+const (
+	ssd1306Width  = 128
+	ssd1306Height = 64
+	ssd1306Pages  = ssd1306Height / 8
+)
+
+// the glyphs are drawn at twice their size, so that the 4 lines of 10
+// characters can be read from the seat
+const (
+	glyphScale = 2
+	cellWidth  = 6 * glyphScale // a column of space between characters
+	cellHeight = 8 * glyphScale // and a row between lines
+)
+
+// the control bytes preceding the commands and the display data
+const (
+	ssd1306Command = 0x00
+	ssd1306Data    = 0x40
+)
+
+// the initialization of the display: charge pump on, horizontal addressing,
+// rotated so that the header pins are on top
+var ssd1306Init = []byte{
+	0xAE,       // display off
+	0xD5, 0x80, // clock divide ratio
+	0xA8, 0x3F, // multiplex ratio, 64 rows
+	0xD3, 0x00, // no display offset
+	0x40,       // start line 0
+	0x8D, 0x14, // charge pump on
+	0x20, 0x00, // horizontal addressing
+	0xA1,       // segment remap
+	0xC8,       // COM scan decreasing
+	0xDA, 0x12, // COM pins
+	0x81, 0xCF, // contrast
+	0xD9, 0xF1, // pre-charge period
+	0xDB, 0x40, // VCOMH deselect level
+	0xA4, // display the RAM
+	0xA6, // not inverted
+	0xAF, // display on
+}
+
+// SSD1306 is a 128x64 OLED display driven by an SSD1306 controller, the most
+// common small display of the Raspberry Pi, on an I2C bus
+type SSD1306 struct {
+	bus    io.WriteCloser // addressed to the display
+	buffer [ssd1306Width * ssd1306Pages]byte
+}
+
+// OpenSSD1306 opens the display at the address (usually 0x3C) of the I2C
+// bus, e.g. /dev/i2c-1 on a Raspberry Pi, and initializes it
+func OpenSSD1306(bus string, address int) (*SSD1306, error) {
+	device, err := openI2C(bus, address)
+	if err != nil {
+		return nil, err
+	}
+	d := &SSD1306{bus: device}
+	if err := d.command(ssd1306Init...); err != nil {
+		device.Close()
+		return nil, err
+	}
+	return d, d.Show(nil)
+}
+
+// Show shows the lines, 4 lines of 10 characters at most
+func (d *SSD1306) Show(lines []string) error {
+	for i := range d.buffer {
+		d.buffer[i] = 0
+	}
+	for row, line := range lines {
+		column := 0
+		for _, c := range line {
+			d.draw(c, column*cellWidth, row*cellHeight)
+			column++
+		}
+	}
+
+	// the whole display, from the top left
+	if err := d.command(0x21, 0, ssd1306Width-1, 0x22, 0, ssd1306Pages-1); err != nil {
+		return err
+	}
+	// in chunks, as some I2C adapters limit the length of a transfer
+	for i := 0; i < len(d.buffer); i += 32 {
+		if _, err := d.bus.Write(append([]byte{ssd1306Data}, d.buffer[i:i+32]...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close switches the display off and closes the bus
+func (d *SSD1306) Close() error {
+	d.command(0xAE)
+	return d.bus.Close()
+}
+
+// draw draws the glyph of the character at the position in pixels, scaled,
+// clipped to the display
+func (d *SSD1306) draw(c rune, x int, y int) {
+	glyph := font[c]
+	for column, bits := range glyph {
+		for row := 0; row < 7; row++ {
+			if bits&(1<<uint(row)) == 0 {
+				continue
+			}
+			for dx := 0; dx < glyphScale; dx++ {
+				for dy := 0; dy < glyphScale; dy++ {
+					d.set(x+column*glyphScale+dx, y+row*glyphScale+dy)
+				}
+			}
+		}
+	}
+}
+
+func (d *SSD1306) set(x int, y int) {
+	if x < 0 || x >= ssd1306Width || y < 0 || y >= ssd1306Height {
+		return
+	}
+	d.buffer[(y/8)*ssd1306Width+x] |= 1 << uint(y%8)
+}
+
+func (d *SSD1306) command(bytes ...byte) error {
+	_, err := d.bus.Write(append([]byte{ssd1306Command}, bytes...))
+	return err
+}
@@ -0,0 +1,49 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/util"
+	"strings"
+	"time"
+)
+
+const icsTimeFormat = "20060102T150405Z"
+
+// ICSWriter writes the activities as iCalendar (RFC 5545) events, with the
+// distance and duration in the event description
+func ICSWriter(activities []*collector.Activity, writer *bufio.Writer) {
+	w := writer
+	stamp := time.Now().UTC().Format(icsTimeFormat)
+
+	fmt.Fprint(w, "BEGIN:VCALENDAR\r\n")
+	fmt.Fprint(w, "VERSION:2.0\r\n")
+	fmt.Fprint(w, "PRODID:-//olympum//Oarsman//EN\r\n")
+	fmt.Fprint(w, "CALSCALE:GREGORIAN\r\n")
+	fmt.Fprint(w, "X-WR-CALNAME:Oarsman workouts\r\n")
+	for _, activity := range activities {
+		start := time.Unix(activity.StartTimeMilliseconds/1000, 0).UTC()
+		end := start.Add(time.Duration(activity.TotalTimeSeconds) * time.Second)
+		description := []string{
+			fmt.Sprintf("Local start: %s", util.MillisToLocal(activity.StartTimeMilliseconds, activity.Timezone)),
+			fmt.Sprintf("Distance: %d m", activity.DistanceMeters),
+			fmt.Sprintf("Duration: %s", formatSeconds(activity.TotalTimeSeconds)),
+		}
+		if activity.AverageHeartRateBpm > 0 {
+			description = append(description, fmt.Sprintf("Average heart rate: %d bpm", activity.AverageHeartRateBpm))
+		}
+
+		fmt.Fprint(w, "BEGIN:VEVENT\r\n")
+		fmt.Fprintf(w, "UID:%d@oarsman\r\n", activity.StartTimeMilliseconds)
+		fmt.Fprintf(w, "DTSTAMP:%s\r\n", stamp)
+		fmt.Fprintf(w, "DTSTART:%s\r\n", start.Format(icsTimeFormat))
+		fmt.Fprintf(w, "DTEND:%s\r\n", end.Format(icsTimeFormat))
+		fmt.Fprintf(w, "SUMMARY:Rowing %d m\r\n", activity.DistanceMeters)
+		fmt.Fprintf(w, "DESCRIPTION:%s\r\n", strings.Join(description, "\\n"))
+		fmt.Fprint(w, "END:VEVENT\r\n")
+	}
+	fmt.Fprint(w, "END:VCALENDAR\r\n")
+
+	w.Flush()
+}
@@ -0,0 +1,263 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/s4"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+)
+
+const (
+	chartWidth       = 960
+	chartPanelHeight = 160
+	chartMargin      = 40
+)
+
+type chartTrace struct {
+	label    string
+	unit     string
+	color    color.RGBA
+	values   []float64
+	inverted bool // faster up for pace
+}
+
+type chartData struct {
+	duration float64   // seconds
+	times    []float64 // seconds since start
+	traces   []chartTrace
+	laps     []float64 // lap start times, seconds since start
+}
+
+func newChartData(activity *collector.Activity) *chartData {
+	events := activity.Events()
+	if len(events) == 0 {
+		return nil
+	}
+	start := events[0].Time
+
+	data := &chartData{}
+	pace := chartTrace{label: "Pace", unit: "s/500m", color: color.RGBA{0x1f, 0x77, 0xb4, 0xff}, inverted: true}
+	heartRate := chartTrace{label: "Heart rate", unit: "bpm", color: color.RGBA{0xd6, 0x27, 0x28, 0xff}}
+	watts := chartTrace{label: "Power", unit: "W", color: color.RGBA{0xff, 0x7f, 0x0e, 0xff}}
+	strokeRate := chartTrace{label: "Stroke rate", unit: "spm", color: color.RGBA{0x2c, 0xa0, 0x2c, 0xff}}
+	for _, e := range events {
+		data.times = append(data.times, float64(e.Time-start)/1000.0)
+		if e.Speed_m_s > 0 {
+			pace.values = append(pace.values, 500.0/e.Speed_m_s)
+		} else {
+			pace.values = append(pace.values, 0)
+		}
+		heartRate.values = append(heartRate.values, float64(e.Heart_rate))
+		watts.values = append(watts.values, float64(e.Watts))
+		strokeRate.values = append(strokeRate.values, float64(e.Stroke_rate))
+	}
+	data.traces = []chartTrace{pace, heartRate, watts, strokeRate}
+	data.duration = data.times[len(data.times)-1]
+
+	for _, lap := range activity.Laps() {
+		if lap.StartTimeMilliseconds > 0 {
+			data.laps = append(data.laps, float64(lap.StartTimeMilliseconds-start)/1000.0)
+		}
+	}
+	return data
+}
+
+// bounds returns the range of the non-zero values of the trace
+func (trace chartTrace) bounds() (float64, float64) {
+	min, max := 0.0, 0.0
+	for _, v := range trace.values {
+		if v == 0 {
+			continue
+		}
+		if min == 0 || v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	if max == min {
+		max = min + 1
+	}
+	return min, max
+}
+
+func (data *chartData) x(t float64) float64 {
+	if data.duration == 0 {
+		return chartMargin
+	}
+	return chartMargin + t/data.duration*(chartWidth-2*chartMargin)
+}
+
+// newStrokeChartData charts the speed and acceleration through a stroke,
+// with the drive shaded like a lap
+func newStrokeChartData(profile *collector.StrokeProfile) *chartData {
+	if profile == nil || len(profile.Speeds) < 2 {
+		return nil
+	}
+	data := &chartData{}
+	speed := chartTrace{label: "Speed", unit: "m/s", color: color.RGBA{0x1f, 0x77, 0xb4, 0xff}, values: profile.Speeds}
+	acceleration := chartTrace{label: "Acceleration", unit: "m/s2", color: color.RGBA{0x94, 0x67, 0xbd, 0xff}, values: profile.Accelerations()}
+	for i := range profile.Speeds {
+		data.times = append(data.times, float64(i)*0.025)
+	}
+	data.traces = []chartTrace{speed, acceleration}
+	data.duration = data.times[len(data.times)-1]
+	if profile.DriveMilliseconds > 0 {
+		data.laps = []float64{0, float64(profile.DriveMilliseconds) / 1000.0}
+	}
+	return data
+}
+
+// y maps a value in [min, max] into the panel, inverted for pace so that
+// faster is always up
+func (data *chartData) y(panel int, v float64, min float64, max float64, inverted bool) float64 {
+	top := float64(panel*chartPanelHeight + chartMargin/2)
+	height := float64(chartPanelHeight - chartMargin)
+	ratio := (v - min) / (max - min)
+	if inverted {
+		ratio = 1 - ratio
+	}
+	return top + height*(1-ratio)
+}
+
+func (data *chartData) height() int {
+	return len(data.traces) * chartPanelHeight
+}
+
+// SVGWriter renders pace, heart rate, power and stroke rate traces, with the
+// laps (intervals) shaded in alternating bands
+func SVGWriter(activity *collector.Activity, writer *bufio.Writer) {
+	data := newChartData(activity)
+	if data == nil {
+		s4.Log().Infof("Empty activity")
+		return
+	}
+
+	data.writeSVG(writer)
+	writer.Flush()
+}
+
+func (data *chartData) writeSVG(w io.Writer) {
+	fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"sans-serif\" font-size=\"11\">\n", chartWidth, data.height())
+	fmt.Fprintf(w, "<rect width=\"%d\" height=\"%d\" fill=\"white\"/>\n", chartWidth, data.height())
+
+	// intervals overlay
+	for n, start := range data.laps {
+		if n%2 == 1 {
+			continue
+		}
+		end := data.duration
+		if n+1 < len(data.laps) {
+			end = data.laps[n+1]
+		}
+		fmt.Fprintf(w, "<rect x=\"%.1f\" y=\"0\" width=\"%.1f\" height=\"%d\" fill=\"#f0f0f0\"/>\n", data.x(start), data.x(end)-data.x(start), data.height())
+	}
+
+	for panel, trace := range data.traces {
+		min, max := trace.bounds()
+		top := panel*chartPanelHeight + chartMargin/2
+		fmt.Fprintf(w, "<text x=\"%d\" y=\"%d\">%s (%s) %.0f-%.0f</text>\n", chartMargin, top-4, trace.label, trace.unit, min, max)
+		fmt.Fprintf(w, "<polyline fill=\"none\" stroke=\"#%02x%02x%02x\" stroke-width=\"1.5\" points=\"", trace.color.R, trace.color.G, trace.color.B)
+		for i, v := range trace.values {
+			if v == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "%.1f,%.1f ", data.x(data.times[i]), data.y(panel, v, min, max, trace.inverted))
+		}
+		fmt.Fprintln(w, "\"/>")
+	}
+	fmt.Fprintln(w, "</svg>")
+}
+
+// PNGWriter renders the same traces as SVGWriter as a PNG image (without
+// labels)
+func PNGWriter(activity *collector.Activity, writer *bufio.Writer) {
+	data := newChartData(activity)
+	if data == nil {
+		s4.Log().Infof("Empty activity")
+		return
+	}
+
+	if err := data.writePNG(writer); err != nil {
+		s4.Log().Errorf("%v", err)
+	}
+	writer.Flush()
+}
+
+func (data *chartData) writePNG(w io.Writer) error {
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, data.height()))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+
+	band := &image.Uniform{color.RGBA{0xf0, 0xf0, 0xf0, 0xff}}
+	for n, start := range data.laps {
+		if n%2 == 1 {
+			continue
+		}
+		end := data.duration
+		if n+1 < len(data.laps) {
+			end = data.laps[n+1]
+		}
+		r := image.Rect(int(data.x(start)), 0, int(data.x(end)), data.height())
+		draw.Draw(img, r, band, image.Point{}, draw.Src)
+	}
+
+	for panel, trace := range data.traces {
+		min, max := trace.bounds()
+		started := false
+		var x0, y0 int
+		for i, v := range trace.values {
+			if v == 0 {
+				continue
+			}
+			x1 := int(data.x(data.times[i]))
+			y1 := int(data.y(panel, v, min, max, trace.inverted))
+			if started {
+				drawLine(img, x0, y0, x1, y1, trace.color)
+			}
+			x0, y0, started = x1, y1, true
+		}
+	}
+
+	return png.Encode(w, img)
+}
+
+// drawLine draws a line using Bresenham's algorithm
+func drawLine(img *image.RGBA, x0 int, y0 int, x1 int, y1 int, c color.RGBA) {
+	dx := x1 - x0
+	if dx < 0 {
+		dx = -dx
+	}
+	dy := y1 - y0
+	if dy > 0 {
+		dy = -dy
+	}
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		img.SetRGBA(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
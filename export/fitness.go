@@ -0,0 +1,18 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/olympum/oarsman/collector"
+)
+
+// FitnessCSVWriter writes the daily training load, fitness, fatigue and form
+// as CSV, e.g. for plotting in a spreadsheet
+func FitnessCSVWriter(series []collector.Fitness, writer *bufio.Writer) {
+	w := writer
+	fmt.Fprintln(w, "date,load,fitness,fatigue,form")
+	for _, f := range series {
+		fmt.Fprintf(w, "%s,%.1f,%.1f,%.1f,%.1f\n", f.Date.Format("2006-01-02"), f.Load, f.Fitness, f.Fatigue, f.Form)
+	}
+	w.Flush()
+}
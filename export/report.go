@@ -0,0 +1,253 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/s4"
+	"github.com/olympum/oarsman/util"
+	"html"
+)
+
+func formatSeconds(seconds int64) string {
+	return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+}
+
+// HTMLReportWriter returns a writer producing a self-contained HTML report
+// with the activity summary, 500m splits, heart rate zones and charts
+func HTMLReportWriter(maxHeartRateBpm uint64) WriterFunc {
+	return func(activity *collector.Activity, writer *bufio.Writer) {
+		data := newChartData(activity)
+		if data == nil {
+			s4.Log().Infof("Empty activity")
+			return
+		}
+
+		w := writer
+		title := "Oarsman workout " + activity.StartTimeZulu
+		fmt.Fprintln(w, "<!DOCTYPE html>")
+		fmt.Fprintln(w, "<html><head><meta charset=\"utf-8\">")
+		fmt.Fprintf(w, "<title>%s</title>\n", html.EscapeString(title))
+		fmt.Fprintln(w, "<style>body{font-family:sans-serif;margin:2em}table{border-collapse:collapse;margin-bottom:2em}td,th{border:1px solid #ccc;padding:4px 8px;text-align:right}</style>")
+		fmt.Fprintln(w, "</head><body>")
+		fmt.Fprintf(w, "<h1>%s</h1>\n", html.EscapeString(title))
+
+		fmt.Fprintln(w, "<h2>Summary</h2>")
+		fmt.Fprintln(w, "<table>")
+		for _, row := range summaryRows(activity) {
+			fmt.Fprintf(w, "<tr><th>%s</th><td>%s</td></tr>\n", row[0], html.EscapeString(row[1]))
+		}
+		fmt.Fprintln(w, "</table>")
+
+		fmt.Fprintln(w, "<h2>Splits</h2>")
+		fmt.Fprintln(w, "<table>")
+		fmt.Fprintln(w, "<tr><th>Split</th><th>Distance</th><th>Time</th><th>Pace</th><th>Ave HR</th><th>Ave SPM</th><th>Ave W</th></tr>")
+		for _, split := range activity.Splits(collector.SplitByDistance, 500) {
+			fmt.Fprintf(w, "<tr><td>%d</td><td>%d</td><td>%s</td><td>%s</td><td>%d</td><td>%d</td><td>%d</td></tr>\n",
+				split.Number,
+				split.DistanceMeters,
+				formatSeconds(split.DurationMilliseconds/1000),
+				util.SecondsToPace(split.Pace()),
+				split.AverageHeartRateBpm,
+				split.AverageCadenceRpm,
+				split.AveragePowerWatts)
+		}
+		fmt.Fprintln(w, "</table>")
+
+		if pacing := activity.Pacing(); pacing != nil {
+			fmt.Fprintln(w, "<h2>Pacing</h2>")
+			fmt.Fprintln(w, "<table>")
+			for _, row := range pacingRows(pacing) {
+				fmt.Fprintf(w, "<tr><th>%s</th><td>%s</td></tr>\n", row[0], html.EscapeString(row[1]))
+			}
+			fmt.Fprintln(w, "</table>")
+		}
+
+		fmt.Fprintf(w, "<h2>Heart rate zones (max %d bpm)</h2>\n", maxHeartRateBpm)
+		fmt.Fprintln(w, "<table>")
+		for _, zone := range activity.HeartRateZoneDistribution(maxHeartRateBpm) {
+			fmt.Fprintf(w, "<tr><th>%s</th><td>%s</td></tr>\n", zone.Name, formatSeconds(zone.Seconds))
+		}
+		fmt.Fprintln(w, "</table>")
+
+		fmt.Fprintln(w, "<h2>Charts</h2>")
+		data.writeSVG(w)
+
+		if strokes := activity.Strokes(); len(strokes) > 0 {
+			fmt.Fprintln(w, "<h2>Stroke profile</h2>")
+			fmt.Fprintln(w, "<table>")
+			for _, row := range strokeRows(strokes) {
+				fmt.Fprintf(w, "<tr><th>%s</th><td>%s</td></tr>\n", row[0], html.EscapeString(row[1]))
+			}
+			fmt.Fprintln(w, "</table>")
+			if strokeData := newStrokeChartData(collector.AverageStrokeProfile(strokes)); strokeData != nil {
+				strokeData.writeSVG(w)
+			}
+		}
+
+		fmt.Fprintln(w, "</body></html>")
+		w.Flush()
+	}
+}
+
+// MarkdownReportWriter returns a writer producing a Markdown report with the
+// same content as the HTML report, the charts embedded as a PNG data URI
+func MarkdownReportWriter(maxHeartRateBpm uint64) WriterFunc {
+	return func(activity *collector.Activity, writer *bufio.Writer) {
+		data := newChartData(activity)
+		if data == nil {
+			s4.Log().Infof("Empty activity")
+			return
+		}
+
+		w := writer
+		fmt.Fprintf(w, "# Oarsman workout %s\n\n", activity.StartTimeZulu)
+
+		fmt.Fprintln(w, "## Summary")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| | |")
+		fmt.Fprintln(w, "|---|---:|")
+		for _, row := range summaryRows(activity) {
+			fmt.Fprintf(w, "| %s | %s |\n", row[0], row[1])
+		}
+		fmt.Fprintln(w)
+
+		fmt.Fprintln(w, "## Splits")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Split | Distance | Time | Pace | Ave HR | Ave SPM | Ave W |")
+		fmt.Fprintln(w, "|---:|---:|---:|---:|---:|---:|---:|")
+		for _, split := range activity.Splits(collector.SplitByDistance, 500) {
+			fmt.Fprintf(w, "| %d | %d | %s | %s | %d | %d | %d |\n",
+				split.Number,
+				split.DistanceMeters,
+				formatSeconds(split.DurationMilliseconds/1000),
+				util.SecondsToPace(split.Pace()),
+				split.AverageHeartRateBpm,
+				split.AverageCadenceRpm,
+				split.AveragePowerWatts)
+		}
+		fmt.Fprintln(w)
+
+		if pacing := activity.Pacing(); pacing != nil {
+			fmt.Fprintln(w, "## Pacing")
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "| | |")
+			fmt.Fprintln(w, "|---|---:|")
+			for _, row := range pacingRows(pacing) {
+				fmt.Fprintf(w, "| %s | %s |\n", row[0], row[1])
+			}
+			fmt.Fprintln(w)
+		}
+
+		fmt.Fprintf(w, "## Heart rate zones (max %d bpm)\n\n", maxHeartRateBpm)
+		fmt.Fprintln(w, "| Zone | Time |")
+		fmt.Fprintln(w, "|---|---:|")
+		for _, zone := range activity.HeartRateZoneDistribution(maxHeartRateBpm) {
+			fmt.Fprintf(w, "| %s | %s |\n", zone.Name, formatSeconds(zone.Seconds))
+		}
+		fmt.Fprintln(w)
+
+		fmt.Fprintln(w, "## Charts")
+		fmt.Fprintln(w)
+		var b bytes.Buffer
+		if err := data.writePNG(&b); err != nil {
+			s4.Log().Errorf("%v", err)
+		} else {
+			fmt.Fprintf(w, "![charts](data:image/png;base64,%s)\n", base64.StdEncoding.EncodeToString(b.Bytes()))
+		}
+
+		if strokes := activity.Strokes(); len(strokes) > 0 {
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "## Stroke profile")
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "| | |")
+			fmt.Fprintln(w, "|---|---:|")
+			for _, row := range strokeRows(strokes) {
+				fmt.Fprintf(w, "| %s | %s |\n", row[0], row[1])
+			}
+			if strokeData := newStrokeChartData(collector.AverageStrokeProfile(strokes)); strokeData != nil {
+				b.Reset()
+				if err := strokeData.writePNG(&b); err != nil {
+					s4.Log().Errorf("%v", err)
+				} else {
+					fmt.Fprintf(w, "\n![stroke profile](data:image/png;base64,%s)\n", base64.StdEncoding.EncodeToString(b.Bytes()))
+				}
+			}
+		}
+		w.Flush()
+	}
+}
+
+func summaryRows(activity *collector.Activity) [][2]string {
+	rows := [][2]string{
+		{"Start time", util.MillisToLocal(activity.StartTimeMilliseconds, activity.Timezone)},
+		{"Distance", fmt.Sprintf("%d m", activity.DistanceMeters)},
+		{"Duration", formatSeconds(activity.TotalTimeSeconds)},
+		{"Average pace", util.SecondsToPace(collector.PaceOf(activity.AverageSpeedMs))},
+		{"Best pace", util.SecondsToPace(collector.PaceOf(activity.MaximumSpeedMs))},
+		{"Average stroke rate", fmt.Sprintf("%d spm", activity.AverageCadenceRpm)},
+		{"Maximum stroke rate", fmt.Sprintf("%d spm", activity.MaximumCadenceRpm)},
+		{"Average power", fmt.Sprintf("%d W", activity.AveragePowerWatts)},
+		{"Maximum power", fmt.Sprintf("%d W", activity.MaximumPowerWatts)},
+		{"Average heart rate", fmt.Sprintf("%d bpm", activity.AverageHeartRateBpm)},
+		{"Maximum heart rate", fmt.Sprintf("%d bpm", activity.MaximumHeartRateBpm)},
+		{"Calories", fmt.Sprintf("%d kcal", activity.KCalories)},
+	}
+	if activity.Device.Model > 0 {
+		rows = append(rows, [2]string{"Monitor", fmt.Sprintf("S%d %s", activity.Device.Model, activity.Device.Firmware)})
+	}
+	if activity.PreRollMilliseconds > 0 {
+		rows = append(rows, [2]string{"Pre-roll", formatSeconds(activity.PreRollMilliseconds / 1000)})
+	}
+	if activity.TankNotes != "" {
+		rows = append(rows, [2]string{"Tank", activity.TankNotes})
+	}
+	return rows
+}
+
+// pacingRows describes the pacing analysis as label and value pairs
+func pacingRows(pacing *collector.PacingAnalysis) [][2]string {
+	rows := [][2]string{}
+	for _, q := range pacing.Quarters {
+		rows = append(rows, [2]string{
+			fmt.Sprintf("Quarter %d", q.Number),
+			fmt.Sprintf("%s /500m, %d spm", util.SecondsToPace(q.Pace()), q.AverageCadenceRpm)})
+	}
+	rows = append(rows,
+		[2]string{"First half", util.SecondsToPace(pacing.FirstHalfPace) + " /500m"},
+		[2]string{"Second half", util.SecondsToPace(pacing.SecondHalfPace) + " /500m"},
+		[2]string{"Splitting", pacing.Splitting},
+		[2]string{"Fade", fmt.Sprintf("%.1f%%", pacing.FadePercent)},
+		[2]string{"Stroke rate drift", fmt.Sprintf("%+d spm", pacing.StrokeRateDrift)})
+	return rows
+}
+
+// strokeRows describes the stroke profiles as label and value pairs: the
+// average timing of the strokes, and their average peaks
+func strokeRows(strokes []collector.StrokeProfile) [][2]string {
+	var drive, recovery, drives int64
+	var peakSpeed, peakAcceleration float64
+	for _, stroke := range strokes {
+		peakSpeed += stroke.PeakSpeed()
+		peakAcceleration += stroke.PeakAcceleration()
+		if stroke.DriveMilliseconds > 0 {
+			drive += stroke.DriveMilliseconds
+			recovery += stroke.DurationMilliseconds() - stroke.DriveMilliseconds
+			drives++
+		}
+	}
+	n := float64(len(strokes))
+	rows := [][2]string{{"Strokes", fmt.Sprintf("%d", len(strokes))}}
+	if drives > 0 {
+		rows = append(rows,
+			[2]string{"Drive", fmt.Sprintf("%.2f s", float64(drive)/float64(drives)/1000)},
+			[2]string{"Recovery", fmt.Sprintf("%.2f s", float64(recovery)/float64(drives)/1000)},
+			[2]string{"Drive to recovery", fmt.Sprintf("1:%.1f", float64(recovery)/float64(drive))})
+	}
+	rows = append(rows,
+		[2]string{"Peak speed", fmt.Sprintf("%.2f m/s", peakSpeed/n)},
+		[2]string{"Peak acceleration", fmt.Sprintf("%.1f m/s2", peakAcceleration/n)})
+	return rows
+}
@@ -0,0 +1,68 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/util"
+	"strings"
+	"time"
+)
+
+// RowProCSVWriter writes the activity in the CSV layout of the RowPro (Digital
+// Rowing) exports, as read by club logging tools and rowingdata: a session
+// line with the totals and averages, then one row per stroke with the time
+// and pace in milliseconds, the distance in meters and the calories burnt so
+// far
+func RowProCSVWriter(activity *collector.Activity, strokes []collector.Stroke, writer *bufio.Writer) {
+	w := writer
+	start := activity.StartTimeMilliseconds
+	date := time.Unix(start/1000, start%1000*1000000).In(util.Location(activity.Timezone))
+	var pace int64
+	if activity.DistanceMeters > 0 {
+		pace = activity.TotalTimeSeconds * 1000 * 500 / int64(activity.DistanceMeters)
+	}
+	name := "Oarsman " + date.Format("2006-01-02 15:04")
+	fmt.Fprintln(w, "RowPro CSV Export File")
+	fmt.Fprintln(w, "Date,TotalTime,TotalDistance,AvgPace,AvgSPM,AvgWatts,AvgHR,MaxHR,Cals,Name")
+	fmt.Fprintf(w, "%s,%d,%d,%d,%d,%d,%d,%d,%d,%s\n",
+		date.Format("02/01/2006 15:04:05"),
+		activity.TotalTimeSeconds*1000,
+		activity.DistanceMeters,
+		pace,
+		activity.AverageCadenceRpm,
+		activity.AveragePowerWatts,
+		activity.AverageHeartRateBpm,
+		activity.MaximumHeartRateBpm,
+		activity.KCalories,
+		strings.Replace(name, ",", " ", -1))
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Time,Distance,Pace,Watts,Cals,SPM,HR,DutyCycle,Rowfile_Id")
+	var first *collector.Stroke
+	for i := range strokes {
+		stroke := strokes[i]
+		end := stroke.StartTimeMilliseconds + stroke.DurationMilliseconds
+		// the strokes of the pre-roll, before the activity starts
+		if end <= start {
+			continue
+		}
+		if first == nil {
+			first = &strokes[i]
+		}
+		var duty float64
+		if stroke.DriveMilliseconds > 0 && stroke.DurationMilliseconds > 0 {
+			duty = float64(stroke.DriveMilliseconds) / float64(stroke.DurationMilliseconds)
+		}
+		fmt.Fprintf(w, "%d,%d,%.0f,%d,%d,%d,%d,%.2f,%d\n",
+			end-start,
+			stroke.DistanceMeters,
+			stroke.Pace()*1000,
+			stroke.Watts,
+			(stroke.Calories-first.Calories+500)/1000,
+			stroke.StrokeRate,
+			stroke.HeartRate,
+			duty,
+			start)
+	}
+	w.Flush()
+}
@@ -0,0 +1,47 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/olympum/oarsman/collector"
+)
+
+// StrokeWriterFunc writes the activity stroke by stroke, with the strokes of
+// its raw log, see collector.NewStrokes
+type StrokeWriterFunc func(activity *collector.Activity, strokes []collector.Stroke, writer *bufio.Writer)
+
+// ErgDataCSVWriter writes the activity stroke by stroke in the CSV dialect of
+// ErgData and the Concept2 logbook, which painsled also writes and analysis
+// tools such as rowingdata and rowsandall read: one row per stroke with the
+// time and distance at its end, the pace in seconds per 500 m, and the
+// calories per hour of the Concept2 formula from the power
+func ErgDataCSVWriter(activity *collector.Activity, strokes []collector.Stroke, writer *bufio.Writer) {
+	w := writer
+	fmt.Fprintln(w, `"Number","Time (seconds)","Distance (meters)","Pace (seconds)","Watts","Cal/Hr","Stroke Rate","Heart Rate"`)
+	start := activity.StartTimeMilliseconds
+	n := 0
+	for _, stroke := range strokes {
+		end := stroke.StartTimeMilliseconds + stroke.DurationMilliseconds
+		// the strokes of the pre-roll, before the activity starts
+		if end <= start {
+			continue
+		}
+		n++
+		fmt.Fprintf(w, "%d,%.1f,%d,%.1f,%d,%.0f,%d,%d\n",
+			n,
+			float64(end-start)/1000,
+			stroke.DistanceMeters,
+			stroke.Pace(),
+			stroke.Watts,
+			caloriesPerHour(stroke.Watts),
+			stroke.StrokeRate,
+			stroke.HeartRate)
+	}
+	w.Flush()
+}
+
+// caloriesPerHour returns the calories per hour of the Concept2 formula, 4
+// times the power in kcal/h (a 25% efficiency) plus 300 for the body at rest
+func caloriesPerHour(watts uint64) float64 {
+	return float64(watts)*4*0.8604 + 300
+}
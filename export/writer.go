@@ -0,0 +1,220 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/s4"
+	"github.com/olympum/oarsman/util"
+	"os"
+	"time"
+)
+
+type WriterFunc func(activity *collector.Activity, writer *bufio.Writer)
+
+// StreamWriterFunc writes the activity sample by sample as the events are
+// received, using the lap summaries for what precedes the samples, so that
+// the events are never all held in memory
+type StreamWriterFunc func(activity *collector.Activity, laps []*collector.Lap, events <-chan s4.AggregateEvent, writer *bufio.Writer)
+
+// streamLaps feeds the events of the laps to a channel, skipping the event
+// duplicated at the start of each auto-lap
+func streamLaps(laps []*collector.Lap) <-chan s4.AggregateEvent {
+	events := make(chan s4.AggregateEvent)
+	go func() {
+		var last int64
+		for _, lap := range laps {
+			for _, event := range lap.Events() {
+				if event.Time <= last {
+					continue
+				}
+				events <- event
+				last = event.Time
+			}
+		}
+		close(events)
+	}()
+	return events
+}
+
+func CSVWriter(activity *collector.Activity, writer *bufio.Writer) {
+	laps := activity.Laps()
+	if len(laps) == 0 {
+		s4.Log().Infof("Empty activity")
+		return
+	}
+	CSVStreamWriter(activity, laps, streamLaps(laps), writer)
+}
+
+func CSVStreamWriter(activity *collector.Activity, laps []*collector.Lap, events <-chan s4.AggregateEvent, writer *bufio.Writer) {
+	s4.Log().Infof("Writing %d laps in CSV", len(laps))
+	location := util.Location(activity.Timezone)
+	fmt.Fprint(writer, "time,total_distance_meters,stroke_rate,watts,calories,speed_m_s,heart_rate,local_time\n")
+	for event := range events {
+		fmt.Fprintf(writer, "%d,%d,%d,%d,%d,%.2f,%d,%s\n",
+			event.Time,
+			event.Total_distance_meters,
+			event.Stroke_rate,
+			event.Watts,
+			event.Calories,
+			event.Speed_m_s,
+			event.Heart_rate,
+			time.Unix(event.Time/1000, event.Time%1000*1000000).In(location).Format(time.RFC3339))
+	}
+	writer.Flush()
+}
+
+func TCXWriter(activity *collector.Activity, writer *bufio.Writer) {
+	laps := activity.Laps()
+	if len(laps) == 0 {
+		s4.Log().Infof("Empty activity")
+		return
+	}
+	TCXStreamWriter(activity, laps, streamLaps(laps), writer)
+}
+
+func writeTCXLapStart(w *bufio.Writer, lap *collector.Lap) {
+	fmt.Fprintf(w, "<Lap StartTime=\"%s\">\n", lap.StartTimeZulu)
+	fmt.Fprintf(w, "<TotalTimeSeconds>%d</TotalTimeSeconds>\n", lap.TotalTimeSeconds)
+	fmt.Fprintf(w, "<DistanceMeters>%d</DistanceMeters>\n", lap.DistanceMeters)
+	fmt.Fprintf(w, "<MaximumSpeed>%f</MaximumSpeed>\n", lap.MaximumSpeedMs)
+	fmt.Fprintf(w, "<Calories>%d</Calories>\n", lap.KCalories)
+	fmt.Fprintln(w, "<AverageHeartRateBpm>")
+	fmt.Fprintf(w, "<Value>%d</Value>\n", lap.AverageHeartRateBpm)
+	fmt.Fprintln(w, "</AverageHeartRateBpm>")
+	fmt.Fprintln(w, "<MaximumHeartRateBpm>")
+	fmt.Fprintf(w, "<Value>%d</Value>\n", lap.MaximumHeartRateBpm)
+	fmt.Fprintln(w, "</MaximumHeartRateBpm>")
+	if lap.Rest {
+		fmt.Fprintln(w, "<Intensity>Resting</Intensity>")
+	} else {
+		fmt.Fprintln(w, "<Intensity>Active</Intensity>")
+	}
+	fmt.Fprintln(w, "<TriggerMethod>Manual</TriggerMethod>")
+	fmt.Fprintln(w, "<Track>")
+}
+
+func writeTCXLapEnd(w *bufio.Writer) {
+	fmt.Fprintln(w, "</Track>")
+	fmt.Fprintln(w, "</Lap>")
+}
+
+func writeTCXTrackpoint(w *bufio.Writer, e s4.AggregateEvent) {
+	fmt.Fprintln(w, "<Trackpoint>")
+	fmt.Fprintf(w, "<Time>%s</Time>\n", util.MillisToZulu(e.Time))
+	fmt.Fprintf(w, "<DistanceMeters>%d</DistanceMeters>\n", e.Total_distance_meters)
+	fmt.Fprintln(w, "<HeartRateBpm xsi:type=\"HeartRateInBeatsPerMinute_t\">")
+	fmt.Fprintf(w, "<Value>%d</Value>\n", e.Heart_rate)
+	fmt.Fprintln(w, "</HeartRateBpm>")
+	fmt.Fprintf(w, "<Cadence>%d</Cadence>\n", e.Stroke_rate)
+	fmt.Fprintln(w, "<Extensions>")
+	fmt.Fprintln(w, "<TPX xmlns=\"http://www.garmin.com/xmlschemas/ActivityExtension/v2\">")
+	fmt.Fprintf(w, "<Speed>%.2f</Speed>\n", e.Speed_m_s)
+	fmt.Fprintf(w, "<Watts>%d</Watts>\n", e.Watts)
+	fmt.Fprintln(w, "</TPX>")
+	fmt.Fprintln(w, "</Extensions>")
+	fmt.Fprintln(w, "</Trackpoint>")
+}
+
+// TCXStreamWriter writes the lap headers from the lap summaries and the
+// trackpoints as the events are received. An event at the start of a lap
+// closes the previous lap and opens the next one, as with the auto-laps of
+// the collector.
+func TCXStreamWriter(activity *collector.Activity, laps []*collector.Lap, events <-chan s4.AggregateEvent, writer *bufio.Writer) {
+	if len(laps) == 0 {
+		// no lap summaries, the whole activity as a single lap
+		laps = []*collector.Lap{&activity.Lap}
+	}
+	s4.Log().Infof("Writing %d laps in TCX", len(laps))
+
+	// header
+	w := writer
+	fmt.Fprintln(w, "<?xml version=\"1.0\"?>")
+	fmt.Fprintln(w, "<TrainingCenterDatabase xmlns=\"http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2\" xmlns:xsi=\"http://www.w3.org/2001/XMLSchema-instance\" xsi:schemaLocation=\"http://www.garmin.com/xmlschemas/ActivityExtension/v2 http://www.garmin.com/xmlschemas/ActivityExtensionv2.xsd http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2 http://www.garmin.com/xmlschemas/TrainingCenterDatabasev2.xsd\">")
+	fmt.Fprintln(w, "<Activities>")
+	fmt.Fprintln(w, "<Activity Sport=\"Other\">")
+	fmt.Fprintf(w, "<Id>%s</Id>\n", laps[0].StartTimeZulu)
+	fmt.Fprint(w, "<Creator><Name>Oarsman (WaterRower S4)</Name></Creator>")
+
+	n := 0
+	s4.Log().Infof("Writing lap %d (%v meters)", n, laps[n].DistanceMeters)
+	writeTCXLapStart(w, laps[n])
+	for e := range events {
+		if n+1 < len(laps) && e.Time >= laps[n+1].StartTimeMilliseconds {
+			if e.Time == laps[n+1].StartTimeMilliseconds {
+				writeTCXTrackpoint(w, e)
+			}
+			writeTCXLapEnd(w)
+			n++
+			s4.Log().Infof("Writing lap %d (%v meters)", n, laps[n].DistanceMeters)
+			writeTCXLapStart(w, laps[n])
+		}
+		writeTCXTrackpoint(w, e)
+	}
+	writeTCXLapEnd(w)
+
+	fmt.Fprintln(w, "</Activity>")
+	fmt.Fprintln(w, "</Activities>")
+	fmt.Fprintln(w, "</TrainingCenterDatabase>")
+
+	w.Flush()
+}
+
+// JSONSchemaVersion is the version of the JSON export format, increased
+// with the same policy as s4.LogSchemaVersion: only for incompatible
+// changes, so readers are to ignore the fields they do not know
+const JSONSchemaVersion = 1
+
+// JSONStreamWriter writes the schema version and the activity with its
+// laps, followed by the samples as they are received:
+//
+//	{"version":1,"activity":{...},"samples":[{...},...]}
+func JSONStreamWriter(activity *collector.Activity, laps []*collector.Lap, events <-chan s4.AggregateEvent, writer *bufio.Writer) {
+	s4.Log().Infof("Writing %d laps in JSON", len(laps))
+	b, err := json.Marshal(activity.WithLaps(laps))
+	if err != nil {
+		s4.Log().Errorf("%v", err)
+		for range events {
+		}
+		return
+	}
+	fmt.Fprintf(writer, "{\"version\":%d,\"activity\":%s,\"samples\":[", JSONSchemaVersion, b)
+	separator := ""
+	for event := range events {
+		b, _ := json.Marshal(event.Sample())
+		fmt.Fprintf(writer, "%s\n%s", separator, b)
+		separator = ","
+	}
+	fmt.Fprint(writer, "]}\n")
+	writer.Flush()
+}
+
+func ExportCollectorEvents(activity *collector.Activity, filename string, writerFunc WriterFunc) {
+	f, err := os.Create(filename)
+	if err != nil {
+		s4.Log().Errorf("Could not create %s\n", filename)
+	}
+	defer f.Close()
+
+	var w *bufio.Writer
+	w = bufio.NewWriter(f)
+	s4.Log().Infof("Writing aggregate data to %s\n", f.Name())
+	writerFunc(activity, w)
+}
+
+// ExportStream writes the events to filename as they are received
+func ExportStream(activity *collector.Activity, laps []*collector.Lap, events <-chan s4.AggregateEvent, filename string, writerFunc StreamWriterFunc) {
+	f, err := os.Create(filename)
+	if err != nil {
+		s4.Log().Errorf("Could not create %s\n", filename)
+		// drain the channel so the replay is not blocked
+		for range events {
+		}
+		return
+	}
+	defer f.Close()
+
+	s4.Log().Infof("Writing aggregate data to %s\n", f.Name())
+	writerFunc(activity, laps, events, bufio.NewWriter(f))
+}
@@ -0,0 +1,100 @@
+package gpio
+
+import (
+	"github.com/olympum/oarsman/coach"
+	"github.com/olympum/oarsman/s4"
+	"time"
+)
+
+// Feedback drives LEDs wired to the GPIO pins of a head unit: one pulsed on
+// every stroke, and one per zone lit while the heart rate or power is below,
+// in or above its target zone
+type Feedback struct {
+	Stroke Output        // nil for no stroke LED
+	Pulse  time.Duration // of the stroke LED
+
+	ZoneMetric s4.Metric // s4.MetricHeartRate or s4.MetricWatts
+	Zone       coach.Zone
+	Below      Output // nil for no LED
+	In         Output
+	Above      Output
+
+	lit Output // the zone LED lit, nil if none
+}
+
+// Metrics returns the metrics to subscribe to for the feedback
+func (f *Feedback) Metrics() []s4.Metric {
+	return []s4.Metric{s4.MetricStrokeStart, f.ZoneMetric}
+}
+
+// Run drives the LEDs until the events end, as subscribed with s4.Subscribe
+// for the Metrics, and then switches them off
+func (f *Feedback) Run(events <-chan s4.Event) {
+	for event := range events {
+		switch event.Metric {
+		case s4.MetricStrokeStart:
+			if f.Stroke == nil {
+				continue
+			}
+			f.Stroke.Set(true)
+			time.AfterFunc(f.Pulse, func() { f.Stroke.Set(false) })
+		case f.ZoneMetric:
+			f.light(f.zoneOutput(event.Value))
+		}
+	}
+	f.light(nil)
+}
+
+// zoneOutput returns the LED of the zone of the value, nil for the missing
+// readings
+func (f *Feedback) zoneOutput(v uint64) Output {
+	switch {
+	case v == 0 || (f.Zone.Min == 0 && f.Zone.Max == 0):
+		return nil
+	case v < f.Zone.Min:
+		return f.Below
+	case f.Zone.Max > 0 && v > f.Zone.Max:
+		return f.Above
+	}
+	return f.In
+}
+
+// light lights the LED, switching off the one lit
+func (f *Feedback) light(output Output) {
+	if output == f.lit {
+		return
+	}
+	if f.lit != nil {
+		f.lit.Set(false)
+	}
+	if output != nil {
+		output.Set(true)
+	}
+	f.lit = output
+}
+
+// Buzzer sounds a buzzer a number of times per cue, e.g. at the interval
+// boundaries, not at all for the cues missing
+type Buzzer struct {
+	Output Output
+	Beeps  map[coach.Cue]int
+}
+
+// the length of a beep, and of the silence between two
+const beepMillis = 150
+
+func (b Buzzer) Alert(cue coach.Cue, text string) error {
+	for i := 0; i < b.Beeps[cue]; i++ {
+		if i > 0 {
+			time.Sleep(beepMillis * time.Millisecond)
+		}
+		if err := b.Output.Set(true); err != nil {
+			return err
+		}
+		time.Sleep(beepMillis * time.Millisecond)
+		if err := b.Output.Set(false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
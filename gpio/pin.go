@@ -0,0 +1,72 @@
+package gpio
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+)
+
+// the sysfs interface of the GPIO pins of Linux, e.g. on a Raspberry Pi,
+// numbered as BCM pins
+const sysfsGPIO = "/sys/class/gpio"
+
+// the time for udev to give access to a pin once exported
+const exportTimeout = time.Second
+
+// Output is a digital output, e.g. an LED or a buzzer on a GPIO pin
+type Output interface {
+	Set(on bool) error
+}
+
+// Pin is a GPIO pin set as output
+type Pin struct {
+	Number int
+
+	value *os.File
+}
+
+// OpenPin exports the pin, e.g. 17 for BCM 17 (physical pin 11 of a
+// Raspberry Pi), and sets it as output, off
+func OpenPin(number int) (*Pin, error) {
+	folder := fmt.Sprintf("%s/gpio%d", sysfsGPIO, number)
+	if _, err := os.Stat(folder); os.IsNotExist(err) {
+		if err := ioutil.WriteFile(sysfsGPIO+"/export", []byte(strconv.Itoa(number)), 0); err != nil {
+			return nil, fmt.Errorf("could not export GPIO %d: %v", number, err)
+		}
+	}
+	// the files of the pin are only writable once udev has set their group
+	deadline := time.Now().Add(exportTimeout)
+	for {
+		err := ioutil.WriteFile(folder+"/direction", []byte("low"), 0)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("could not set GPIO %d as output: %v", number, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	value, err := os.OpenFile(folder+"/value", os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not open GPIO %d: %v", number, err)
+	}
+	return &Pin{Number: number, value: value}, nil
+}
+
+// Set switches the pin on (high) or off (low)
+func (p *Pin) Set(on bool) error {
+	level := []byte("0")
+	if on {
+		level = []byte("1")
+	}
+	_, err := p.value.WriteAt(level, 0)
+	return err
+}
+
+// Close switches the pin off, leaving it exported
+func (p *Pin) Close() error {
+	p.Set(false)
+	return p.value.Close()
+}
@@ -0,0 +1,165 @@
+package logbook
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/util"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Source is the source of the activities imported from the logbook
+const Source = "concept2"
+
+// the layout of the dates of the logbook, in the local time of the workout
+const dateLayout = "2006-01-02 15:04:05"
+
+// the columns of the logbook CSV export read, by their header
+const (
+	columnID          = "Log ID"
+	columnDate        = "Date"
+	columnDescription = "Description"
+	columnTime        = "Work Time (Seconds)"
+	columnRest        = "Rest Time (Seconds)"
+	columnDistance    = "Work Distance"
+	columnRate        = "Stroke Rate/Cadence"
+	columnWatts       = "Avg Watts"
+	columnCalories    = "Total Cal"
+	columnHeartRate   = "Avg Heart Rate"
+	columnType        = "Type"
+	columnComments    = "Comments"
+)
+
+// Result is a workout of the Concept2 logbook, as exported to CSV from the
+// season or history pages of log.concept2.com
+type Result struct {
+	ID                  string
+	Date                time.Time
+	Description         string  // the workout, e.g. "2000m", "30:00" or "4x500m/1:00r"
+	Type                string  // the machine, e.g. "RowErg", "SkiErg" or "BikeErg"
+	Seconds             float64 // work time, the rests left out
+	RestSeconds         float64 // rest time of the intervals, 0 for a single piece
+	DistanceMeters      uint64  // work distance
+	StrokeRate          uint64
+	AveragePowerWatts   uint64
+	KCalories           uint64
+	AverageHeartRateBpm uint64 // 0 without a heart rate monitor
+	Comments            string
+}
+
+// Rowing tells whether the result was rowed, rather than skied or biked
+func (result Result) Rowing() bool {
+	machine := strings.ToLower(result.Type)
+	return !strings.Contains(machine, "ski") && !strings.Contains(machine, "bike")
+}
+
+// ReadCSV reads the results of a logbook CSV export, their dates in
+// location
+func ReadCSV(r io.Reader, location *time.Location) ([]Result, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid logbook export: %v", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	for _, name := range []string{columnDate, columnTime, columnDistance} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("invalid logbook export, no %q column", name)
+		}
+	}
+
+	results := []Result{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return results, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		value := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		number := func(name string) uint64 {
+			v, _ := strconv.ParseFloat(value(name), 64)
+			if v < 0 {
+				return 0
+			}
+			return uint64(v + 0.5)
+		}
+		date, err := time.ParseInLocation(dateLayout, value(columnDate), location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q on line %d, e.g. 2016-03-07 07:30:00", value(columnDate), line)
+		}
+		seconds, err := strconv.ParseFloat(value(columnTime), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid work time %q on line %d", value(columnTime), line)
+		}
+		rest, _ := strconv.ParseFloat(value(columnRest), 64)
+		results = append(results, Result{
+			ID:                  value(columnID),
+			Date:                date,
+			Description:         value(columnDescription),
+			Type:                value(columnType),
+			Seconds:             seconds,
+			RestSeconds:         rest,
+			DistanceMeters:      number(columnDistance),
+			StrokeRate:          number(columnRate),
+			AveragePowerWatts:   number(columnWatts),
+			KCalories:           number(columnCalories),
+			AverageHeartRateBpm: number(columnHeartRate),
+			Comments:            value(columnComments)})
+	}
+}
+
+// Activity returns the activity of the result: a summary without laps nor
+// events, as the logbook keeps no samples, in the IANA timezone given
+func (result Result) Activity(timezone string) *collector.Activity {
+	activity := collector.NewActivity(nil, nil)
+	millis := result.Date.UnixNano() / 1000000
+	activity.StartTimeMilliseconds = millis
+	activity.StartTimeSeconds = millis / 1000
+	activity.StartTimeZulu = util.MillisToZulu(millis)
+	activity.TotalTimeSeconds = int64(result.Seconds + 0.5)
+	activity.DistanceMeters = result.DistanceMeters
+	if result.Seconds > 0 {
+		activity.AverageSpeedMs = float64(result.DistanceMeters) / result.Seconds
+	}
+	activity.KCalories = result.KCalories
+	activity.AverageHeartRateBpm = result.AverageHeartRateBpm
+	activity.AverageCadenceRpm = result.StrokeRate
+	activity.AveragePowerWatts = result.AveragePowerWatts
+	activity.Timezone = timezone
+	activity.Workout = result.Description
+	activity.Notes = result.Comments
+	activity.Source = Source
+	return activity
+}
+
+// Efforts returns the effort of a result over one of the distances, e.g. a
+// 2k test, as the logbook keeps no samples for the efforts within; the
+// intervals, rowed with rests, are no effort
+func (result Result) Efforts(distances []uint64) []collector.Effort {
+	if result.RestSeconds > 0 {
+		return nil
+	}
+	for _, distance := range distances {
+		if result.DistanceMeters == distance && result.Seconds > 0 {
+			return []collector.Effort{{
+				StartTimeMilliseconds: result.Date.UnixNano() / 1000000,
+				DistanceMeters:        distance,
+				Milliseconds:          int64(result.Seconds * 1000)}}
+		}
+	}
+	return nil
+}
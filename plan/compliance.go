@@ -0,0 +1,93 @@
+package plan
+
+import (
+	"github.com/olympum/oarsman/collector"
+	"time"
+)
+
+// a session is completed by an activity of at least this fraction of its
+// target, e.g. a 7600 m row for an 8000 m session stopped short
+const completedFactor = 0.9
+
+// Week is how much of a week of the plan was rowed
+type Week struct {
+	Number           int // from 1
+	Start            time.Time
+	Sessions         int
+	Completed        int
+	PlannedMeters    uint64 // of the distance sessions
+	PlannedSeconds   uint64 // of the duration sessions
+	DistanceMeters   uint64 // of all the activities of the week
+	TotalTimeSeconds int64
+}
+
+// CompliancePercent returns the share of the sessions of the week completed
+func (w Week) CompliancePercent() float64 {
+	if w.Sessions == 0 {
+		return 0
+	}
+	return 100 * float64(w.Completed) / float64(w.Sessions)
+}
+
+// completes returns whether the activity reaches the target of the session
+func completes(activity *collector.Activity, session Scheduled) bool {
+	if session.DistanceMeters > 0 {
+		return float64(activity.DistanceMeters) >= completedFactor*float64(session.DistanceMeters)
+	}
+	return float64(activity.TotalTimeSeconds) >= completedFactor*float64(session.DurationSeconds)
+}
+
+// Track sets the activity completing each session of the schedule, and
+// returns the compliance of every week. A session is completed by an
+// activity of its week reaching its target, preferably on its day, so
+// that a session moved to another day of the week still counts; every
+// activity completes one session at most.
+func Track(schedule []Scheduled, activities []*collector.Activity, location *time.Location) []Week {
+	weeks := []Week{}
+	byWeek := map[time.Time][]*collector.Activity{}
+	for _, activity := range activities {
+		w := monday(activity.LocalTime(location))
+		byWeek[w] = append(byWeek[w], activity)
+	}
+
+	used := map[int64]bool{}
+	match := func(session *Scheduled, sameDay bool) {
+		for _, activity := range byWeek[monday(session.Date)] {
+			if used[activity.StartTimeMilliseconds] || !completes(activity, *session) {
+				continue
+			}
+			if sameDay && !day(activity.LocalTime(location)).Equal(session.Date) {
+				continue
+			}
+			session.ActivityID = activity.StartTimeMilliseconds
+			used[activity.StartTimeMilliseconds] = true
+			return
+		}
+	}
+	for _, sameDay := range []bool{true, false} {
+		for i := range schedule {
+			if schedule[i].ActivityID == 0 {
+				match(&schedule[i], sameDay)
+			}
+		}
+	}
+
+	for _, session := range schedule {
+		if len(weeks) == 0 || weeks[len(weeks)-1].Number != session.Week {
+			w := Week{Number: session.Week, Start: monday(session.Date)}
+			for _, activity := range byWeek[w.Start] {
+				w.DistanceMeters += activity.DistanceMeters
+				w.TotalTimeSeconds += activity.TotalTimeSeconds
+			}
+			weeks = append(weeks, w)
+		}
+		w := &weeks[len(weeks)-1]
+		w.Sessions++
+		if session.ActivityID != 0 {
+			w.Completed++
+		}
+		w.PlannedMeters += session.DistanceMeters
+		w.PlannedSeconds += session.DurationSeconds
+	}
+	return weeks
+}
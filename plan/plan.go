@@ -0,0 +1,169 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DateLayout is the layout of the start date of a plan, e.g. "2016-03-07"
+const DateLayout = "2006-01-02"
+
+// the targets of a deload week, as a fraction of the targets the week would
+// otherwise have
+const deloadFactor = 0.8
+
+// Plan is a training plan of several weeks, e.g. a 2k preparation block,
+// repeating the same sessions every week with targets growing by
+// ProgressionPercent per week. In JSON, e.g.
+//
+//	{"name": "2k prep", "weeks": 8, "progression_percent": 5, "deload_every": 4,
+//	 "sessions": [{"day": "monday", "name": "steady", "distance_meters": 8000, "rate": "20"},
+//	              {"day": "thursday", "name": "pieces", "duration_seconds": 1800, "rate": "24"},
+//	              {"day": "saturday", "name": "test", "distance_meters": 2000, "progression_percent": 0}]}
+type Plan struct {
+	Name               string    `json:"name"`
+	Start              string    `json:"start,omitempty"` // the week of the date, from Monday, e.g. "2016-03-07"
+	Weeks              int       `json:"weeks"`
+	ProgressionPercent float64   `json:"progression_percent"`    // growth of the targets per week, compounded
+	DeloadEvery        int       `json:"deload_every,omitempty"` // every n-th week is lighter, 0 for none
+	Sessions           []Session `json:"sessions"`
+}
+
+// Session is a session of the first week of a plan, with a single distance
+// or duration target
+type Session struct {
+	Day                string   `json:"day"` // e.g. "monday" or "mon"
+	Name               string   `json:"name"`
+	DistanceMeters     uint64   `json:"distance_meters,omitempty"`
+	DurationSeconds    uint64   `json:"duration_seconds,omitempty"`
+	Rate               string   `json:"rate,omitempty"`                // stroke rate of the metronome, as with train --rate
+	ProgressionPercent *float64 `json:"progression_percent,omitempty"` // in place of the one of the plan, e.g. 0 for a test
+}
+
+// Scheduled is a session of a plan on its date, with the target of its week
+type Scheduled struct {
+	Date            time.Time
+	Week            int  // from 1
+	Deload          bool // lighter than the weeks around it
+	Name            string
+	DistanceMeters  uint64
+	DurationSeconds uint64
+	Rate            string
+	ActivityID      int64 // the activity completing the session, 0 if not completed, see Track
+}
+
+// Read reads and checks the plan of a JSON file
+func Read(file string) (*Plan, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var p Plan
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("invalid plan %s: %v", file, err)
+	}
+	if err := p.check(); err != nil {
+		return nil, fmt.Errorf("invalid plan %s: %v", file, err)
+	}
+	return &p, nil
+}
+
+// Write saves the plan as JSON
+func (p *Plan) Write(file string) error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, b, 0644)
+}
+
+func (p *Plan) check() error {
+	if p.Weeks <= 0 {
+		return fmt.Errorf("no weeks")
+	}
+	if len(p.Sessions) == 0 {
+		return fmt.Errorf("no sessions")
+	}
+	if p.Start != "" {
+		if _, err := time.Parse(DateLayout, p.Start); err != nil {
+			return fmt.Errorf("invalid start %q, e.g. 2016-03-07", p.Start)
+		}
+	}
+	for _, session := range p.Sessions {
+		if _, err := weekday(session.Day); err != nil {
+			return err
+		}
+		if (session.DistanceMeters == 0) == (session.DurationSeconds == 0) {
+			return fmt.Errorf("session %q needs either a distance or a duration", session.Name)
+		}
+	}
+	return nil
+}
+
+// weekday parses the day of a session, its name or its first three letters
+func weekday(day string) (time.Weekday, error) {
+	day = strings.ToLower(day)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if day == name || day == name[:3] {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid day %q, e.g. monday", day)
+}
+
+// day returns the midnight starting the day of t
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// monday returns the Monday starting the week of t
+func monday(t time.Time) time.Time {
+	d := day(t)
+	return d.AddDate(0, 0, -((int(d.Weekday()) + 6) % 7))
+}
+
+// StartDate returns the Monday the plan starts, in location
+func (p *Plan) StartDate(location *time.Location) time.Time {
+	start, _ := time.ParseInLocation(DateLayout, p.Start, location)
+	return monday(start)
+}
+
+// Schedule returns the sessions of every week of the plan in date order, the
+// targets rounded to 100 meters or a minute
+func (p *Plan) Schedule(location *time.Location) []Scheduled {
+	start := p.StartDate(location)
+	schedule := []Scheduled{}
+	for week := 0; week < p.Weeks; week++ {
+		deload := p.DeloadEvery > 0 && (week+1)%p.DeloadEvery == 0
+		for _, session := range p.Sessions {
+			progression := p.ProgressionPercent
+			if session.ProgressionPercent != nil {
+				progression = *session.ProgressionPercent
+			}
+			// the sessions not progressing, e.g. tests, are not lighter either
+			lighter := deload && progression != 0
+			factor := math.Pow(1+progression/100, float64(week))
+			if lighter {
+				factor *= deloadFactor
+			}
+			d, _ := weekday(session.Day)
+			schedule = append(schedule, Scheduled{
+				Date:            start.AddDate(0, 0, 7*week+(int(d)+6)%7),
+				Week:            week + 1,
+				Deload:          lighter,
+				Name:            session.Name,
+				DistanceMeters:  uint64(math.Floor(float64(session.DistanceMeters)*factor/100+0.5)) * 100,
+				DurationSeconds: uint64(math.Floor(float64(session.DurationSeconds)*factor/60+0.5)) * 60,
+				Rate:            session.Rate})
+		}
+	}
+	// the sessions of the same day in the order of the plan
+	sort.SliceStable(schedule, func(i, j int) bool { return schedule[i].Date.Before(schedule[j].Date) })
+	return schedule
+}
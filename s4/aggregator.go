@@ -1,7 +1,7 @@
 package s4
 
 import (
-	jww "github.com/spf13/jwalterweatherman"
+	"sync"
 )
 
 type AggregateEvent struct {
@@ -14,6 +14,9 @@ type AggregateEvent struct {
 	Calories              uint64
 	Speed_m_s             float64
 	Heart_rate            uint64
+	Pre_roll_milliseconds int64   // set on the event marking the activity start
+	Device                *Device // set on the event marking the activity start
+	Rest                  bool    // in the rest of an interval
 }
 
 const MAX_RESOLUTION_MILLIS = 10000
@@ -22,13 +25,28 @@ type Aggregator struct {
 	event                 *AggregateEvent
 	atomicEventChannel    chan<- AtomicEvent
 	aggregateEventChannel chan<- AggregateEvent
+	mutex                 sync.Mutex
+	closed                bool
+	log                   logger
+	subscribers           subscribers
+
+	// the activity starts at the first stroke or distance increment, the
+	// connection and handshake time before is pre-roll
+	started         bool
+	device          Device
+	preRollStart    int64
+	preRollDistance uint64
+	distanceSeen    bool
+
+	// in the rest of an interval, as the interval events tell
+	resting bool
 }
 
-func newAggregator(atomicEventChannel chan<- AtomicEvent, aggregateEventChannel chan<- AggregateEvent) Aggregator {
-	return Aggregator{
+func newAggregator(atomicEventChannel chan<- AtomicEvent, aggregateEventChannel chan<- AggregateEvent) *Aggregator {
+	return &Aggregator{
 		atomicEventChannel:    atomicEventChannel,
 		aggregateEventChannel: aggregateEventChannel,
-		event: &AggregateEvent{}}
+		event:                 &AggregateEvent{}}
 }
 
 func (aggregator *Aggregator) send(event *AggregateEvent) bool {
@@ -38,39 +56,152 @@ func (aggregator *Aggregator) send(event *AggregateEvent) bool {
 
 	toBeSent := *event
 
-	newEvent := AggregateEvent{}
-	newEvent.Start_distance_meters = toBeSent.Total_distance_meters
-	newEvent.Total_distance_meters = toBeSent.Total_distance_meters
-	aggregator.event = &newEvent
+	// the current event is reset in place, to avoid an allocation per event
+	*aggregator.event = AggregateEvent{
+		Start_distance_meters: toBeSent.Total_distance_meters,
+		Total_distance_meters: toBeSent.Total_distance_meters}
 
 	aggregator.aggregateEventChannel <- toBeSent
-	jww.DEBUG.Print("Sent aggregate event", event)
+	if Debug {
+		aggregator.log.Debugf("Sent aggregate event %v", toBeSent)
+	}
 	return true
 }
 
 func (aggregator *Aggregator) complete() {
+	aggregator.mutex.Lock()
+	defer aggregator.mutex.Unlock()
+
+	if !aggregator.closed {
+		aggregator.flush()
+	}
+}
+
+// close completes the current aggregate event and closes the channels, so
+// that the logger and collector know the workout has ended. Events consumed
+// after closing are dropped.
+func (aggregator *Aggregator) close() {
+	aggregator.mutex.Lock()
+	defer aggregator.mutex.Unlock()
+
+	if aggregator.closed {
+		return
+	}
+	aggregator.flush()
+	aggregator.closed = true
+	aggregator.subscribers.close()
+	if aggregator.atomicEventChannel != nil {
+		close(aggregator.atomicEventChannel)
+	}
+	if aggregator.aggregateEventChannel != nil {
+		close(aggregator.aggregateEventChannel)
+	}
+}
+
+func (aggregator *Aggregator) flush() {
 	e := aggregator.event
 	delta_time := float64(e.Time - e.Time_start)
 	delta_distance := float64(e.Total_distance_meters - e.Start_distance_meters)
 	if delta_time > 0 && delta_distance > 0 {
 		e.Speed_m_s = delta_distance * 1000.0 / delta_time
+		e.Rest = aggregator.resting
 		aggregator.send(e)
+	} else if aggregator.resting && delta_distance == 0 && delta_time >= MAX_RESOLUTION_MILLIS {
+		aggregator.sendRest(e)
+	}
+}
+
+// sendRest sends a period of the rest of an interval without any distance
+// rowed, keeping the heart rate to analyse its recovery between intervals.
+// A stop outside of the rests, e.g. to fix a foot strap, is not a rest.
+func (aggregator *Aggregator) sendRest(e *AggregateEvent) {
+	e.Speed_m_s = 0
+	e.Stroke_rate = 0
+	e.Watts = 0
+	e.Rest = true
+	aggregator.send(e)
+}
+
+// rest completes the current event at the start and at the end of the rest
+// of an interval, so that the rests start and end with the intervals, the
+// end of a rest even if shorter than the resolution
+func (aggregator *Aggregator) rest(resting bool) {
+	if resting == aggregator.resting {
+		return
+	}
+	e := aggregator.event
+	if aggregator.resting && e.Total_distance_meters == e.Start_distance_meters && e.Time > e.Time_start {
+		aggregator.sendRest(e)
+	} else {
+		aggregator.flush()
+	}
+	aggregator.resting = resting
+}
+
+// start checks whether the atomic event starts the activity and, if so, sends
+// an aggregate event marking the start with the pre-roll time
+func (aggregator *Aggregator) start(atomicEvent AtomicEvent) bool {
+	e := aggregator.event
+	started := atomicEvent.Label == "stroke_start"
+	if atomicEvent.Label == "total_distance_meters" {
+		if !aggregator.distanceSeen {
+			aggregator.distanceSeen = true
+			aggregator.preRollDistance = atomicEvent.Value
+		}
+		if atomicEvent.Value > aggregator.preRollDistance {
+			started = true
+		} else {
+			e.Total_distance_meters = atomicEvent.Value
+		}
+	}
+	if !started {
+		return false
 	}
 
+	aggregator.started = true
+	aggregator.log.Debugf("Activity started after %d ms pre-roll", atomicEvent.Time-aggregator.preRollStart)
+	e.Time_start = atomicEvent.Time
+	e.Time = atomicEvent.Time
+	e.Start_distance_meters = e.Total_distance_meters
+	e.Pre_roll_milliseconds = atomicEvent.Time - aggregator.preRollStart
+	device := aggregator.device
+	e.Device = &device
+	aggregator.send(e)
+	return true
 }
 
 func (aggregator *Aggregator) consume(atomicEvent AtomicEvent) {
+	aggregator.mutex.Lock()
+	defer aggregator.mutex.Unlock()
+
+	if aggregator.closed {
+		return
+	}
+
+	aggregator.subscribers.publish(atomicEvent)
 	if aggregator.atomicEventChannel != nil {
 		aggregator.atomicEventChannel <- atomicEvent
-		jww.DEBUG.Print("Sent atomic event", atomicEvent)
+		if Debug {
+			aggregator.log.Debugf("Sent atomic event %v", atomicEvent)
+		}
 	}
 
 	if aggregator.aggregateEventChannel == nil {
 		return
 	}
 
+	if aggregator.preRollStart == 0 {
+		aggregator.preRollStart = atomicEvent.Time
+	}
+	if aggregator.device.update(atomicEvent) {
+		return
+	}
+
+	if !aggregator.started && !aggregator.start(atomicEvent) {
+		return
+	}
+
 	aggregateEvent := aggregator.event
-	jww.DEBUG.Println("Current aggregate event", aggregateEvent)
 	if aggregateEvent.Time_start == 0 {
 		aggregateEvent.Time_start = atomicEvent.Time
 	}
@@ -95,17 +226,20 @@ func (aggregator *Aggregator) consume(atomicEvent AtomicEvent) {
 		if v > 0 {
 			aggregateEvent.Heart_rate = v
 		}
+	case "interval":
+		aggregator.rest(atomicEvent.Text == IntervalRest)
 	}
 
 	if aggregateEvent.Time-aggregateEvent.Time_start >= MAX_RESOLUTION_MILLIS {
-		aggregator.complete()
+		aggregator.flush()
 	}
 
 	// auto-laps every 2000 meters
 	if aggregateEvent.Total_distance_meters%2000 == 0 {
-		aggregator.complete()
+		aggregator.flush()
 	}
 
-	jww.DEBUG.Println("Current aggregate event", aggregateEvent)
-
+	if Debug {
+		aggregator.log.Debugf("Current aggregate event %v", aggregateEvent)
+	}
 }
@@ -0,0 +1,26 @@
+package s4
+
+import (
+	"testing"
+)
+
+func BenchmarkAggregatorConsume(b *testing.B) {
+	aggregateEvents := make(chan AggregateEvent, 64)
+	go func() {
+		for range aggregateEvents {
+		}
+	}()
+	aggregator := newAggregator(nil, aggregateEvents)
+	labels := []string{"stroke_start", "stroke_rate", "watts", "heart_rate", "total_distance_meters", "stroke_end"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// an event every 25 ms and a meter every 10 events
+		aggregator.consume(AtomicEvent{
+			Time:  int64(i) * 25,
+			Label: labels[i%len(labels)],
+			Value: uint64(i/10 + 1)})
+	}
+	b.StopTimer()
+	aggregator.close()
+}
@@ -0,0 +1,42 @@
+package s4
+
+// MemoryMapRevision identifies the set of S4 memory locations polled during
+// a workout and their polling intervals, to be bumped whenever g_memorymap
+// changes
+const MemoryMapRevision = 2
+
+// Version identifies the oarsman build recording the workout, set by the
+// application
+var Version = "unknown"
+
+// Device describes the monitor and software that recorded an activity
+type Device struct {
+	Model             uint64 `json:"monitor_model"`    // S4 monitor model number, e.g. 4
+	Firmware          string `json:"firmware_version"` // S4 firmware version, e.g. 02.10
+	SerialDevice      string `json:"serial_device"`    // serial port the monitor was connected to
+	Version           string `json:"oarsman_version"`  // oarsman version
+	MemoryMapRevision uint64 `json:"memory_map_revision"`
+	OdometerMeters    uint64 `json:"odometer_meters"` // lifetime distance of the monitor when connected, 0 if not read
+}
+
+// update records a device metadata event, and returns false for any other
+// event
+func (device *Device) update(event AtomicEvent) bool {
+	switch event.Label {
+	case "monitor_model":
+		device.Model = event.Value
+	case "firmware_version":
+		device.Firmware = event.Text
+	case "serial_device":
+		device.SerialDevice = event.Text
+	case "oarsman_version":
+		device.Version = event.Text
+	case "memory_map_revision":
+		device.MemoryMapRevision = event.Value
+	case "odometer_meters":
+		device.OdometerMeters = event.Value
+	default:
+		return false
+	}
+	return true
+}
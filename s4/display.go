@@ -0,0 +1,122 @@
+package s4
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrDisplayQueueFull is returned by SetDisplay when the display packets
+// are queued faster than they are sent to the S4
+var ErrDisplayQueueFull = errors.New("S4 display queue full")
+
+// DistanceDisplay is the unit of the distance window of the S4 display. In a
+// distance or interval workout the window counts down the distance left.
+type DistanceDisplay string
+
+const (
+	DistanceMeters        DistanceDisplay = "ME"
+	DistanceMiles         DistanceDisplay = "MI"
+	DistanceKilometers    DistanceDisplay = "KM"
+	DistanceNauticalMiles DistanceDisplay = "NM"
+)
+
+// IntensityDisplay is the unit of the intensity window of the S4 display
+type IntensityDisplay string
+
+const (
+	IntensityMetersPerSecond IntensityDisplay = "MS"
+	IntensityMilesPerHour    IntensityDisplay = "MPH"
+	IntensityPer500m         IntensityDisplay = "500" // time per 500 meters
+	IntensityPer2km          IntensityDisplay = "2KM" // time per 2 kilometers
+	IntensityWatts           IntensityDisplay = "WA"
+	IntensityCaloriesPerHour IntensityDisplay = "CH"
+)
+
+// DistanceDisplays and IntensityDisplays name the display units, e.g. for
+// command line flags
+var DistanceDisplays = map[string]DistanceDisplay{
+	"meters":   DistanceMeters,
+	"miles":    DistanceMiles,
+	"km":       DistanceKilometers,
+	"nautical": DistanceNauticalMiles,
+}
+
+var IntensityDisplays = map[string]IntensityDisplay{
+	"m/s":   IntensityMetersPerSecond,
+	"mph":   IntensityMilesPerHour,
+	"500m":  IntensityPer500m,
+	"2km":   IntensityPer2km,
+	"watts": IntensityWatts,
+	"cal/h": IntensityCaloriesPerHour,
+}
+
+// displayPackets returns the packets switching the display to the units,
+// leaving the windows with an empty unit as they are
+func displayPackets(distance DistanceDisplay, intensity IntensityDisplay) ([]Packet, error) {
+	packets := []Packet{}
+	if distance != "" {
+		if !knownDistanceDisplay(distance) {
+			return nil, fmt.Errorf("unknown distance display unit %q", distance)
+		}
+		packets = append(packets, Packet{cmd: DisplaySetDistanceRequest, data: []byte(distance)})
+	}
+	if intensity != "" {
+		if !knownIntensityDisplay(intensity) {
+			return nil, fmt.Errorf("unknown intensity display unit %q", intensity)
+		}
+		packets = append(packets, Packet{cmd: DisplaySetIntensityRequest, data: []byte(intensity)})
+	}
+	return packets, nil
+}
+
+func knownDistanceDisplay(distance DistanceDisplay) bool {
+	for _, d := range DistanceDisplays {
+		if d == distance {
+			return true
+		}
+	}
+	return false
+}
+
+func knownIntensityDisplay(intensity IntensityDisplay) bool {
+	for _, i := range IntensityDisplays {
+		if i == intensity {
+			return true
+		}
+	}
+	return false
+}
+
+// SetDisplay switches the display of the S4 to the units during the
+// workout, e.g. to the distance left in kilometers and the watts for a
+// power interval. An empty unit leaves its window as it is. It never
+// blocks: the packets are sent with the next packet read once the workout
+// is programmed, and ErrDisplayQueueFull is returned if too many are
+// pending.
+func (s4 *S4) SetDisplay(distance DistanceDisplay, intensity IntensityDisplay) error {
+	packets, err := displayPackets(distance, intensity)
+	if err != nil {
+		return err
+	}
+	for _, p := range packets {
+		select {
+		case s4.display <- p:
+		default:
+			return ErrDisplayQueueFull
+		}
+	}
+	return nil
+}
+
+// writeDisplay writes the display packets queued by SetDisplay, from the
+// reading goroutine so that writes are never interleaved
+func (s4 *S4) writeDisplay() {
+	for {
+		select {
+		case p := <-s4.display:
+			s4.write(p)
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package s4
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The kinds of failures of the driver. The errors returned are either one of
+// these or an *Error of one of these kinds, see Cause.
+var (
+	ErrPortNotFound         = errors.New("S4 USB serial modem port not found")
+	ErrUnsupportedFirmware  = errors.New("unsupported monitor or firmware")
+	ErrWorkoutLimitExceeded = errors.New("workout exceeds the limits of the S4")
+	ErrWorkoutRejected      = errors.New("workout not accepted by the S4")
+	ErrConnectionLost       = errors.New("connection to the S4 lost")
+)
+
+// Error is a failure of one of the kinds above, with its details
+type Error struct {
+	Kind   error
+	Detail string
+}
+
+func (e *Error) Error() string {
+	return e.Kind.Error() + ": " + e.Detail
+}
+
+// Unwrap returns the kind of the error, so that errors.Is matches it
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+func newError(kind error, format string, v ...interface{}) error {
+	return &Error{Kind: kind, Detail: fmt.Sprintf(format, v...)}
+}
+
+// Cause returns the kind of an error of the driver, e.g. ErrConnectionLost,
+// or err itself if it has no kind
+func Cause(err error) error {
+	if e, ok := err.(*Error); ok {
+		return e.Kind
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package s4
+
+import (
+	"log"
+)
+
+// Debug enables the diagnostics of the driver, e.g. every event aggregated,
+// which are discarded by default whatever the logger
+var Debug = false
+
+// Logger receives the messages of the driver, so that applications can
+// route them into their own logging
+type Logger interface {
+	Debugf(format string, v ...interface{})
+	Infof(format string, v ...interface{})
+	Errorf(format string, v ...interface{})
+}
+
+// StdLogger logs to a standard library logger, or to the standard logger if
+// l is nil, prefixing the messages with their level
+func StdLogger(l *log.Logger) Logger {
+	return stdLogger{l: l}
+}
+
+type stdLogger struct {
+	l *log.Logger
+}
+
+func (lg stdLogger) printf(format string, v ...interface{}) {
+	if lg.l != nil {
+		lg.l.Printf(format, v...)
+	} else {
+		log.Printf(format, v...)
+	}
+}
+
+func (lg stdLogger) Debugf(format string, v ...interface{}) {
+	lg.printf("DEBUG "+format, v...)
+}
+
+func (lg stdLogger) Infof(format string, v ...interface{}) {
+	lg.printf("INFO "+format, v...)
+}
+
+func (lg stdLogger) Errorf(format string, v ...interface{}) {
+	lg.printf("ERROR "+format, v...)
+}
+
+var defaultLogger Logger = StdLogger(nil)
+
+// SetLogger sets the logger of the messages not tied to a driver (e.g. of
+// replays and exports), and of the drivers created without WithLogger. It
+// is to be called before using the package; nil restores the standard
+// logger.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = StdLogger(nil)
+	}
+	defaultLogger = l
+}
+
+// logger writes to l, or to the default logger if l is nil, and discards
+// the debug messages unless Debug is enabled
+type logger struct {
+	l Logger
+}
+
+func (lg logger) target() Logger {
+	if lg.l != nil {
+		return lg.l
+	}
+	return defaultLogger
+}
+
+func (lg logger) Debugf(format string, v ...interface{}) {
+	if Debug {
+		lg.target().Debugf(format, v...)
+	}
+}
+
+func (lg logger) Infof(format string, v ...interface{}) {
+	lg.target().Infof(format, v...)
+}
+
+func (lg logger) Errorf(format string, v ...interface{}) {
+	lg.target().Errorf(format, v...)
+}
+
+// std logs the messages not tied to a driver
+var std logger
+
+// Log returns the logger of the messages not tied to a driver, for the
+// packages built on the driver. Its debug messages are discarded unless
+// Debug is enabled.
+func Log() Logger {
+	return std
+}
+
+func debugf(format string, v ...interface{}) {
+	std.Debugf(format, v...)
+}
+
+func infof(format string, v ...interface{}) {
+	std.Infof(format, v...)
+}
+
+func errorf(format string, v ...interface{}) {
+	std.Errorf(format, v...)
+}
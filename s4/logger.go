@@ -1,27 +1,287 @@
 package s4
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
-	jww "github.com/spf13/jwalterweatherman"
+	"io"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func Logger(ch <-chan AtomicEvent, out string) {
-	var writer *os.File
-	if out != "" {
-		f, err := os.Create(out)
+// PartialLogSuffix is appended to the log file name while it is being
+// written, the log is renamed to its final name once complete
+const PartialLogSuffix = ".partial"
+
+// LogIndexSuffix is appended to the log file name for the index of the
+// completed segments of a segmented log
+const LogIndexSuffix = ".index"
+
+// LogSchemaVersion is the version of the raw log record format, written in
+// every record.
+//
+// The version is only increased for incompatible changes, i.e. a field
+// removed or renamed, or a change of the meaning or units of a field or
+// metric. New metrics and new optional fields are added without a new
+// version, so readers are to ignore the fields and metrics they do not
+// know. Readers accept the records from MinLogSchemaVersion up to their
+// own LogSchemaVersion, and skip and report the records of newer versions
+// rather than misreading them.
+const LogSchemaVersion = 1
+
+// MinLogSchemaVersion is the oldest version of the raw log record format
+// that can still be read
+const MinLogSchemaVersion = 1
+
+// LogRecord is a raw log line: newline-delimited JSON, one event per line,
+// e.g. {"v":1,"t":1415611737000,"m":"stroke_rate","val":22}
+type LogRecord struct {
+	Version int    `json:"v"`           // schema version
+	Time    int64  `json:"t"`           // milliseconds since the Unix epoch
+	Metric  string `json:"m"`           // event label, e.g. total_distance_meters
+	Value   uint64 `json:"val"`         // event value, in the units of the metric
+	Text    string `json:"s,omitempty"` // metadata value, e.g. the firmware version
+}
+
+// how often the buffered events are flushed and synced to disk
+const logSyncInterval = 5 * time.Second
+
+// logFile writes events to a single file, or to a sequence of segments of
+// bounded size when segmentBytes is not zero. Each completed segment is
+// synced and recorded in the index, so a crash loses at most the segment
+// being written.
+type logFile struct {
+	out          string
+	segmentBytes int64
+	segment      int
+	written      int64
+	f            *os.File
+	writer       *bufio.Writer
+	index        *os.File
+	buffer       []byte
+}
+
+// LogSegmentName returns the file name of a segment of a segmented log, the
+// first segment is number 1
+func LogSegmentName(out string, segment int) string {
+	return fmt.Sprintf("%s.%06d", out, segment)
+}
+
+func (file *logFile) open() error {
+	name := file.out + PartialLogSuffix
+	if file.segmentBytes > 0 {
+		file.segment++
+		name = LogSegmentName(file.out, file.segment)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	file.f = f
+	file.written = 0
+	if file.writer == nil {
+		file.writer = bufio.NewWriter(f)
+	} else {
+		file.writer.Reset(f)
+	}
+	return nil
+}
+
+func (file *logFile) sync() {
+	if err := file.writer.Flush(); err != nil {
+		errorf("%v", err)
+	}
+	if file.out != "" {
+		if err := file.f.Sync(); err != nil {
+			errorf("%v", err)
+		}
+	}
+}
+
+// rotate completes the current segment, records it in the index and starts
+// the next one
+func (file *logFile) rotate() error {
+	file.sync()
+	file.f.Close()
+
+	if file.index == nil {
+		index, err := os.Create(file.out + LogIndexSuffix)
 		if err != nil {
-			jww.ERROR.Println(err)
+			return err
+		}
+		file.index = index
+	}
+	fmt.Fprintln(file.index, LogSegmentName(file.out, file.segment))
+	file.index.Sync()
+
+	return file.open()
+}
+
+// appendLogRecord appends the event as a LogRecord line to b, producing the
+// same output as encoding/json without allocating for every event
+func appendLogRecord(b []byte, event AtomicEvent) []byte {
+	b = append(b, `{"v":`...)
+	b = strconv.AppendInt(b, LogSchemaVersion, 10)
+	b = append(b, `,"t":`...)
+	b = strconv.AppendInt(b, event.Time, 10)
+	b = append(b, `,"m":`...)
+	b = appendJSONString(b, event.Label)
+	b = append(b, `,"val":`...)
+	b = strconv.AppendUint(b, event.Value, 10)
+	if event.Text != "" {
+		b = append(b, `,"s":`...)
+		b = appendJSONString(b, event.Text)
+	}
+	return append(b, "}\n"...)
+}
+
+func appendJSONString(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c >= 0x7f || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			// needs escaping, rare enough to leave it to encoding/json
+			quoted, _ := json.Marshal(s)
+			return append(b, quoted...)
+		}
+	}
+	b = append(b, '"')
+	b = append(b, s...)
+	return append(b, '"')
+}
+
+func (file *logFile) write(event AtomicEvent) {
+	file.buffer = appendLogRecord(file.buffer[:0], event)
+	n, _ := file.writer.Write(file.buffer)
+	file.written += int64(n)
+	if file.segmentBytes > 0 && file.written >= file.segmentBytes {
+		if err := file.rotate(); err != nil {
+			errorf("%v", err)
+		}
+	}
+}
+
+// close completes the log and renames it to its final name, merging the
+// segments if any
+func (file *logFile) close() {
+	file.sync()
+	file.f.Close()
+
+	if file.segmentBytes > 0 {
+		if file.index != nil {
+			file.index.Close()
+		}
+		if err := MergeLogSegments(file.out); err != nil {
+			errorf("%v", err)
+		}
+		return
+	}
+
+	if err := os.Rename(file.f.Name(), file.out); err != nil {
+		errorf("%v", err)
+	}
+}
+
+// MergeLogSegments concatenates the segments of a segmented log, including
+// the last segment not yet recorded in the index, into the final log file
+// and removes the segments and the index
+func MergeLogSegments(out string) error {
+	segments := []string{}
+	index, err := os.Open(out + LogIndexSuffix)
+	if err == nil {
+		scanner := bufio.NewScanner(index)
+		for scanner.Scan() {
+			if name := strings.TrimSpace(scanner.Text()); name != "" {
+				segments = append(segments, name)
+			}
+		}
+		index.Close()
+	}
+	// the segment being written when the log was closed or interrupted
+	last := LogSegmentName(out, len(segments)+1)
+	if _, err := os.Stat(last); err == nil {
+		segments = append(segments, last)
+	}
+
+	merged, err := os.Create(out + PartialLogSuffix)
+	if err != nil {
+		return err
+	}
+	for _, name := range segments {
+		segment, err := os.Open(name)
+		if err != nil {
+			errorf("%v", err)
+			continue
+		}
+		_, err = io.Copy(merged, segment)
+		segment.Close()
+		if err != nil {
+			merged.Close()
+			return err
+		}
+	}
+	if err := merged.Sync(); err != nil {
+		merged.Close()
+		return err
+	}
+	merged.Close()
+
+	if err := os.Rename(merged.Name(), out); err != nil {
+		return err
+	}
+	for _, name := range segments {
+		os.Remove(name)
+	}
+	os.Remove(out + LogIndexSuffix)
+	return nil
+}
+
+// LogEvents writes the events to out (stdout if empty) until the channel is
+// closed, and then closes done (if not nil). The file is synced to disk
+// periodically, and only renamed to out once all events are written, so an
+// interrupted workout never leaves a truncated log under the final name.
+// With segmentBytes other than zero the log is written in segments of about
+// that size, merged into out when complete.
+func LogEvents(ch <-chan AtomicEvent, out string, segmentBytes int64, done chan<- bool) {
+	if done != nil {
+		defer close(done)
+	}
+
+	file := &logFile{out: out}
+	if out != "" {
+		file.segmentBytes = segmentBytes
+		if err := file.open(); err != nil {
+			errorf("%v", err)
+			// drain the channel so the workout is not blocked
+			for range ch {
+			}
+			return
 		}
-		writer = f
 	} else {
-		writer = os.Stdout
+		file.f = os.Stdout
+		file.writer = bufio.NewWriter(os.Stdout)
 	}
 
-	jww.INFO.Printf("Writing to %s\n", writer.Name())
+	infof("Writing to %s\n", file.f.Name())
+
+	ticker := time.NewTicker(logSyncInterval)
+	defer ticker.Stop()
 
 	for {
-		event := <-ch
-		fmt.Fprintf(writer, "%d %s:%d\n", event.Time, event.Label, event.Value)
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				if out != "" {
+					file.close()
+				} else {
+					file.sync()
+				}
+				return
+			}
+			file.write(event)
+		case <-ticker.C:
+			file.sync()
+		}
 	}
 }
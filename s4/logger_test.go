@@ -0,0 +1,19 @@
+package s4
+
+import (
+	"testing"
+)
+
+func BenchmarkAppendLogRecord(b *testing.B) {
+	events := []AtomicEvent{
+		{Time: 1415611737000, Label: "stroke_rate", Value: 22},
+		{Time: 1415611737250, Label: "total_distance_meters", Value: 1234},
+		{Time: 1415611737300, Label: "workout_state", Value: uint64(WorkoutStarted), Text: "started"},
+	}
+	var buffer []byte
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buffer = appendLogRecord(buffer[:0], events[i%len(events)])
+	}
+}
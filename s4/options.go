@@ -0,0 +1,76 @@
+package s4
+
+import (
+	"io"
+	"strings"
+	"time"
+)
+
+// Option configures the driver created by NewS4
+type Option func(*S4)
+
+// WithDevice connects to the S4 on the given serial device, instead of the
+// first USB serial modem found under /dev
+func WithDevice(name string) Option {
+	return func(s4 *S4) {
+		s4.device = name
+	}
+}
+
+// WithBaud sets the baud rate of the serial port, 115200 by default
+func WithBaud(baud int) Option {
+	return func(s4 *S4) {
+		s4.baud = baud
+	}
+}
+
+// WithReadTimeout ends the workout when nothing is received from the S4 for
+// the given duration; by default the driver waits forever
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(s4 *S4) {
+		s4.readTimeout = timeout
+	}
+}
+
+// WithLogger logs the messages of the driver to l instead of the standard
+// logger, e.g. s4.WithLogger(s4.StdLogger(log.New(w, "s4 ", 0)))
+func WithLogger(l Logger) Option {
+	return func(s4 *S4) {
+		s4.log = logger{l: l}
+	}
+}
+
+// WithClock timestamps the events with the given clock instead of the
+// system time
+func WithClock(clock func() time.Time) Option {
+	return func(s4 *S4) {
+		s4.now = func() int64 {
+			return clock().UnixNano() / int64(time.Millisecond)
+		}
+	}
+}
+
+// WithTransport talks to the S4 over the given connection instead of
+// opening a serial port, e.g. a network bridge or a simulated monitor
+func WithTransport(transport io.ReadWriteCloser) Option {
+	return func(s4 *S4) {
+		s4.port = transport
+	}
+}
+
+// WithOdometer reads the lifetime distance of the monitor once connected,
+// as the odometer_meters event, from the 3 byte memory location at the given
+// address (3 hex digits). The location is not part of the published S4
+// memory map, so it depends on the firmware.
+func WithOdometer(address string) Option {
+	return func(s4 *S4) {
+		s4.odometerAddress = strings.ToUpper(address)
+	}
+}
+
+// WithDebug logs every packet exchanged with the S4, when Debug is enabled
+func WithDebug(debug bool) Option {
+	return func(s4 *S4) {
+		s4.debug = debug
+	}
+}
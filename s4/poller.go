@@ -0,0 +1,124 @@
+package s4
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// a request without response after this long is considered lost and the
+// memory location is read again
+const pollTimeoutMillis = 1000
+
+// the polling backs off while the smoothed round-trip time is above the slow
+// threshold, and speeds up again while it is below the fast threshold
+const (
+	pollSlowRttMillis = 150
+	pollFastRttMillis = 60
+	pollMaxBackoff    = 8
+)
+
+// pollEntry tracks the reads of one memory location
+type pollEntry struct {
+	address   string
+	memory    MemoryEntry
+	requested int64 // time of the outstanding request, 0 if none
+	due       int64 // time from which the location can be read again
+}
+
+// poller is the polling plan for the memory locations captured during a
+// workout. Each location has at most one outstanding request, and is read
+// again once its interval has elapsed since the previous response, so that
+// slowly changing values (heart rate, calories) do not take link capacity
+// from distance and speed.
+//
+// The S4 returns at most three consecutive bytes per read, and the captured
+// locations are further apart than that, so every location is read on its
+// own, with the multi-byte values (e.g. distance low and high bytes) read
+// with a single double or triple read.
+//
+// The round-trip time of every request is measured, and the intervals are
+// stretched by a backoff factor while the monitor is slow to respond, so
+// each firmware is polled as densely as it can keep up with.
+type poller struct {
+	entries   []*pollEntry
+	byAddress map[string]*pollEntry
+	rtt       float64 // smoothed round-trip time, in milliseconds
+	backoff   float64 // interval multiplier, at least 1
+	log       logger
+}
+
+func newPoller(memorymap map[string]MemoryEntry) *poller {
+	addresses := []string{}
+	for address := range memorymap {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	p := &poller{byAddress: map[string]*pollEntry{}, backoff: 1}
+	for _, address := range addresses {
+		e := &pollEntry{address: address, memory: memorymap[address]}
+		p.entries = append(p.entries, e)
+		p.byAddress[address] = e
+	}
+	return p
+}
+
+// due returns the locations to be read now, and marks them as requested
+func (p *poller) due(now int64) []*pollEntry {
+	due := []*pollEntry{}
+	for _, e := range p.entries {
+		if e.requested > 0 {
+			if now-e.requested < pollTimeoutMillis {
+				continue
+			}
+			// lost, as slow as it gets
+			p.sample(pollTimeoutMillis)
+		} else if now < e.due {
+			continue
+		}
+		e.requested = now
+		due = append(due, e)
+	}
+	return due
+}
+
+// received records the response for a location
+func (p *poller) received(address string, now int64) {
+	e, ok := p.byAddress[address]
+	if !ok {
+		return
+	}
+	if e.requested > 0 {
+		p.sample(now - e.requested)
+	}
+	e.requested = 0
+	e.due = now + p.interval(e)
+}
+
+// interval returns the time to wait before reading the location again, in
+// milliseconds, stretched by the backoff
+func (p *poller) interval(e *pollEntry) int64 {
+	interval := float64(e.memory.interval/time.Millisecond) * p.backoff
+	return int64(interval + (p.backoff-1)*p.rtt)
+}
+
+// sample records a round-trip time and adapts the backoff
+func (p *poller) sample(rtt int64) {
+	if p.rtt == 0 {
+		p.rtt = float64(rtt)
+	} else {
+		p.rtt += (float64(rtt) - p.rtt) / 8
+	}
+
+	backoff := p.backoff
+	if p.rtt > pollSlowRttMillis {
+		backoff = math.Min(p.backoff*1.25, pollMaxBackoff)
+	} else if p.rtt < pollFastRttMillis {
+		backoff = math.Max(p.backoff/1.05, 1)
+	}
+	if backoff != p.backoff && Debug {
+		p.log.Debugf("Polling backoff %.2f (round-trip time %.0f ms)\n", backoff, p.rtt)
+	}
+	p.backoff = backoff
+}
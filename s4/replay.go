@@ -2,7 +2,7 @@ package s4
 
 import (
 	"bufio"
-	jww "github.com/spf13/jwalterweatherman"
+	"encoding/json"
 	"os"
 	"strconv"
 	"strings"
@@ -11,7 +11,7 @@ import (
 
 type ReplayS4 struct {
 	scanner    *bufio.Scanner
-	aggregator Aggregator
+	aggregator *Aggregator
 	replay     bool
 	debug      bool
 }
@@ -19,44 +19,126 @@ type ReplayS4 struct {
 func NewReplayS4(eventChannel chan<- AtomicEvent, aggregateEventChannel chan<- AggregateEvent, debug bool, replayfile string, replay bool) (S4Interface, error) {
 	f, err := os.Open(replayfile)
 	if err != nil {
-		jww.FATAL.Printf("Could not read %s\n", replayfile)
+		errorf("Could not read %s\n", replayfile)
 		return nil, err
 	}
-	jww.DEBUG.Printf("Reading from %s\n", f.Name())
+	debugf("Reading from %s\n", f.Name())
 	s := bufio.NewScanner(f)
 	aggregator := newAggregator(eventChannel, aggregateEventChannel)
 	return &ReplayS4{scanner: s, aggregator: aggregator, replay: replay, debug: debug}, nil
 }
 
-func (s4 *ReplayS4) Run(workout *S4Workout) {
+// Run replays the log, returning the error reading it, if any
+func (s4 *ReplayS4) Run(workout *S4Workout) error {
+	newer := 0
 	for s4.scanner.Scan() {
-		line := s4.scanner.Text()
-		tokens := strings.Split(line, " ")
-		if len(tokens) < 2 {
+		event, version, ok := parseLogLine(s4.scanner.Text())
+		if !ok {
+			if version > LogSchemaVersion {
+				newer++
+			}
 			continue
 		}
-		time, _ := strconv.ParseInt(tokens[0], 10, 64)
-		if time == 0 {
-			// skip incorrect rows
-			continue
-		}
-		values := strings.Split(tokens[1], ":")
-		if len(values) < 2 {
-			continue
-		}
-		label := values[0]
-		value, _ := strconv.ParseUint(values[1], 10, 64)
-		event := AtomicEvent{Time: time, Label: label, Value: value}
 		if s4.debug {
-			jww.DEBUG.Println(event)
+			debugf("%v", event)
 		}
 		s4.aggregator.consume(event)
 		if s4.replay {
 			t.Sleep(t.Millisecond * 25)
 		}
 	}
-	s4.aggregator.complete()
+	if newer > 0 {
+		errorf("Skipped %d events of a log schema version newer than %d\n", newer, LogSchemaVersion)
+	}
+	s4.aggregator.close()
+	return s4.scanner.Err()
+}
+
+// Subscribe taps the replayed events, see S4.Subscribe
+func (s4 *ReplayS4) Subscribe(metrics ...Metric) (<-chan Event, func()) {
+	return s4.aggregator.subscribers.subscribe(metrics)
 }
 
 func (s4 *ReplayS4) Exit() {
 }
+
+// SetDisplay does nothing, a replay has no display
+func (s4 *ReplayS4) SetDisplay(distance DistanceDisplay, intensity IntensityDisplay) error {
+	return nil
+}
+
+// parseLogLine parses a raw log line, either a JSON LogRecord or the legacy
+// format, e.g. "1415611737000 stroke_rate:22", returning the schema version
+// of the line (0 for the legacy format). Records of versions that cannot be
+// read are not ok.
+func parseLogLine(line string) (AtomicEvent, int, bool) {
+	if strings.HasPrefix(line, "{") {
+		var record LogRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return AtomicEvent{}, 0, false
+		}
+		if record.Version < MinLogSchemaVersion || record.Version > LogSchemaVersion || record.Time == 0 {
+			return AtomicEvent{}, record.Version, false
+		}
+		return AtomicEvent{Time: record.Time, Label: record.Metric, Value: record.Value, Text: record.Text}, record.Version, true
+	}
+
+	tokens := strings.Split(line, " ")
+	if len(tokens) < 2 {
+		return AtomicEvent{}, 0, false
+	}
+	time, _ := strconv.ParseInt(tokens[0], 10, 64)
+	if time == 0 {
+		// skip incorrect rows
+		return AtomicEvent{}, 0, false
+	}
+	values := strings.Split(tokens[1], ":")
+	if len(values) < 2 {
+		return AtomicEvent{}, 0, false
+	}
+	label := values[0]
+	value, _ := strconv.ParseUint(values[1], 10, 64)
+	return AtomicEvent{Time: time, Label: label, Value: value}, 0, true
+}
+
+// LogTimeRange returns the times of the first and last events of a raw log
+func LogTimeRange(logfile string) (int64, int64, error) {
+	f, err := os.Open(logfile)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var first, last int64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		event, _, ok := parseLogLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		if first == 0 {
+			first = event.Time
+		}
+		last = event.Time
+	}
+	return first, last, scanner.Err()
+}
+
+// ReadLog returns the events of a raw log, e.g. to analyse the pulses and
+// strokes left out of the aggregate events
+func ReadLog(logfile string) ([]AtomicEvent, error) {
+	f, err := os.Open(logfile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	events := []AtomicEvent{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if event, _, ok := parseLogLine(scanner.Text()); ok {
+			events = append(events, event)
+		}
+	}
+	return events, scanner.Err()
+}
@@ -0,0 +1,108 @@
+package s4
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// number of lines buffered between the serial reader and the parser, a power
+// of two
+const ringSize = 1024
+
+// errQuit is returned by peek once asked to quit
+var errQuit = errors.New("quit")
+
+// lineRing is a single producer, single consumer ring buffer of lines. The
+// serial reader goroutine puts the received lines without ever blocking or
+// taking a lock, so slow packet handlers cannot delay reads and overflow the
+// OS serial buffer; if the parser falls a full ring behind, lines are
+// dropped and counted.
+type lineRing struct {
+	// accessed atomically, first in the struct for 64-bit alignment on 32-bit
+	// platforms
+	head    uint64 // next slot to read, advanced by the consumer
+	tail    uint64 // next slot to write, advanced by the producer
+	dropped uint64
+	closed  uint32
+
+	slots [ringSize][]byte
+	ready chan struct{}
+	err   error
+}
+
+func newLineRing() *lineRing {
+	return &lineRing{ready: make(chan struct{}, 1)}
+}
+
+func (r *lineRing) signal() {
+	select {
+	case r.ready <- struct{}{}:
+	default:
+	}
+}
+
+// put copies the line into the ring, and returns false if the ring is full
+func (r *lineRing) put(line []byte) bool {
+	tail := atomic.LoadUint64(&r.tail)
+	if tail-atomic.LoadUint64(&r.head) == ringSize {
+		atomic.AddUint64(&r.dropped, 1)
+		return false
+	}
+	slot := tail % ringSize
+	r.slots[slot] = append(r.slots[slot][:0], line...)
+	atomic.StoreUint64(&r.tail, tail+1)
+	r.signal()
+	return true
+}
+
+// close marks the end of the input, with the read error if any
+func (r *lineRing) close(err error) {
+	r.err = err
+	atomic.StoreUint32(&r.closed, 1)
+	r.signal()
+}
+
+// peek waits for the next line, which is valid until advance is called, for
+// up to timeout (forever if 0). It returns io.EOF once the ring is closed and
+// empty, and errQuit as soon as quit is closed, even if lines are pending.
+func (r *lineRing) peek(timeout time.Duration, quit <-chan struct{}) ([]byte, error) {
+	var expired <-chan time.Time
+	for {
+		select {
+		case <-quit:
+			return nil, errQuit
+		default:
+		}
+		head := atomic.LoadUint64(&r.head)
+		if head != atomic.LoadUint64(&r.tail) {
+			return r.slots[head%ringSize], nil
+		}
+		if atomic.LoadUint32(&r.closed) == 1 {
+			// lines put before closing are visible once closed is
+			if head != atomic.LoadUint64(&r.tail) {
+				continue
+			}
+			return nil, io.EOF
+		}
+		if timeout > 0 && expired == nil {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			expired = timer.C
+		}
+		select {
+		case <-r.ready:
+		case <-quit:
+			return nil, errQuit
+		case <-expired:
+			return nil, fmt.Errorf("nothing received from the S4 for %v", timeout)
+		}
+	}
+}
+
+// advance releases the line returned by peek
+func (r *lineRing) advance() {
+	atomic.AddUint64(&r.head, 1)
+}
@@ -0,0 +1,119 @@
+package s4
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLineRingOrder(t *testing.T) {
+	// a few times around the ring, the producer retrying when it is full
+	const lines = 5*ringSize + 3
+	ring := newLineRing()
+	var full uint64
+	go func() {
+		for i := 0; i < lines; i++ {
+			line := []byte(fmt.Sprintf("IDD055%04X", i))
+			for !ring.put(line) {
+				atomic.AddUint64(&full, 1)
+				runtime.Gosched()
+			}
+		}
+		ring.close(nil)
+	}()
+
+	quit := make(chan struct{})
+	for i := 0; ; i++ {
+		b, err := ring.peek(time.Second, quit)
+		if err == io.EOF {
+			if i != lines {
+				t.Fatalf("ended after %d lines, want %d", i, lines)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("IDD055%04X", i); string(b) != want {
+			t.Fatalf("line %d is %q, want %q", i, b, want)
+		}
+		ring.advance()
+	}
+	if dropped, full := atomic.LoadUint64(&ring.dropped), atomic.LoadUint64(&full); dropped != full {
+		t.Errorf("dropped %d lines, the ring was full %d times", dropped, full)
+	}
+}
+
+func TestLineRingDropped(t *testing.T) {
+	ring := newLineRing()
+	for i := 0; i < ringSize; i++ {
+		if !ring.put([]byte(fmt.Sprint(i))) {
+			t.Fatalf("line %d dropped before the ring is full", i)
+		}
+	}
+	if ring.put([]byte("dropped")) || ring.put([]byte("dropped")) {
+		t.Fatal("line put in a full ring")
+	}
+	if ring.dropped != 2 {
+		t.Errorf("dropped %d lines, want 2", ring.dropped)
+	}
+
+	// the slot released is reused by the next line, after the others
+	quit := make(chan struct{})
+	if b, _ := ring.peek(0, quit); string(b) != "0" {
+		t.Fatalf("first line %q, want 0", b)
+	}
+	ring.advance()
+	if !ring.put([]byte("wrapped")) {
+		t.Fatal("line dropped once a slot is released")
+	}
+	ring.close(nil)
+	var last string
+	n := 0
+	for {
+		b, err := ring.peek(0, quit)
+		if err == io.EOF {
+			break
+		}
+		last = string(b)
+		n++
+		ring.advance()
+	}
+	if n != ringSize || last != "wrapped" {
+		t.Errorf("read %d more lines up to %q, want %d up to wrapped", n, last, ringSize)
+	}
+}
+
+func TestLineRingQuit(t *testing.T) {
+	ring := newLineRing()
+	quit := make(chan struct{})
+	if _, err := ring.peek(10*time.Millisecond, quit); err == nil || err == io.EOF || err == errQuit {
+		t.Errorf("peek of a silent ring returned %v, want a timeout", err)
+	}
+
+	// quitting wakes the consumer waiting
+	peeked := make(chan error)
+	go func() {
+		_, err := ring.peek(0, quit)
+		peeked <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(quit)
+	select {
+	case err := <-peeked:
+		if err != errQuit {
+			t.Errorf("peek returned %v once quit, want errQuit", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("peek still waiting once quit")
+	}
+
+	// even with lines pending
+	ring.put([]byte("PING"))
+	if _, err := ring.peek(0, quit); err != errQuit {
+		t.Errorf("peek returned %v with a line pending once quit, want errQuit", err)
+	}
+}
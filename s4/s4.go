@@ -2,14 +2,14 @@ package s4
 
 import (
 	"bufio"
-	"bytes"
 	"github.com/huin/goserial"
-	jww "github.com/spf13/jwalterweatherman"
 	"io"
 	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -39,8 +39,10 @@ const (
 )
 
 type S4Interface interface {
-	Run(workout *S4Workout)
+	Run(workout *S4Workout) error
 	Exit()
+	Subscribe(metrics ...Metric) (<-chan Event, func())
+	SetDisplay(distance DistanceDisplay, intensity IntensityDisplay) error
 }
 
 type Packet struct {
@@ -49,23 +51,15 @@ type Packet struct {
 }
 
 func (p Packet) Bytes() []byte {
-	var b bytes.Buffer
-	b.Write([]byte(p.cmd))
-	if p.data != nil {
-		b.Write(p.data)
-	}
-	b.Write([]byte("\n"))
-	return b.Bytes()
+	return p.appendTo(nil)
 }
 
-const (
-	Unset             = 0
-	ResetWaitingPing  = 1
-	ResetPingReceived = 2
-	WorkoutStarted    = 3
-	WorkoutCompleted  = 4
-	WorkoutExited     = 5
-)
+// appendTo appends the packet to b, to reuse the buffer between writes
+func (p Packet) appendTo(b []byte) []byte {
+	b = append(b, p.cmd...)
+	b = append(b, p.data...)
+	return append(b, '\n')
+}
 
 const (
 	Meters = "1"
@@ -75,14 +69,40 @@ type AtomicEvent struct {
 	Time  int64
 	Label string
 	Value uint64
+	Text  string // for metadata events, e.g. firmware_version
 }
 
 type S4 struct {
-	port       io.ReadWriteCloser
-	scanner    *bufio.Scanner
-	workout    *S4Workout
-	aggregator Aggregator
-	debug      bool
+	port        io.ReadWriteCloser
+	scanner     *bufio.Scanner
+	workout     *S4Workout
+	aggregator  *Aggregator
+	poller      *poller
+	debug       bool
+	device      string
+	baud        int
+	readTimeout time.Duration
+	log         logger
+	now         func() int64
+	buffer      []byte
+	err         error         // the first failure, ending the workout
+	display     chan Packet   // display packets queued by SetDisplay
+	quit        chan struct{} // closed by Exit to end the workout
+	quitOnce    sync.Once
+
+	odometerAddress string // read once connected, empty for none
+
+	// workout progress
+	startedAt      int64
+	lastStroke     int64
+	distanceMeters uint64
+	limitReadAt    int64
+
+	// interval progress, of the current interval from 0
+	interval       int
+	resting        bool
+	intervalAt     int64
+	intervalMeters uint64
 }
 
 func findUsbSerialModem() string {
@@ -97,77 +117,173 @@ func findUsbSerialModem() string {
 	return ""
 }
 
-func openPort() io.ReadWriteCloser {
-	name := findUsbSerialModem()
-	if len(name) == 0 {
-		jww.FATAL.Println("S4 USB serial modem port not found")
-		os.Exit(-1)
+func (s4 *S4) openPort() error {
+	if len(s4.device) == 0 {
+		s4.device = findUsbSerialModem()
+	}
+	if len(s4.device) == 0 {
+		return ErrPortNotFound
 	}
 
-	c := &goserial.Config{Name: name, Baud: 115200, CRLFTranslate: true}
+	c := &goserial.Config{Name: s4.device, Baud: s4.baud, CRLFTranslate: true}
 	p, err := goserial.OpenPort(c)
+	if os.IsNotExist(err) {
+		return newError(ErrPortNotFound, "%v", err)
+	}
 	if err != nil {
-		jww.FATAL.Println(err)
-		os.Exit(-1)
+		return err
 	}
+	s4.port = p
+	return nil
+}
 
-	return p
+// NewS4 connects to the S4, by default on the first USB serial modem found,
+// sending the raw events to eventChannel and the aggregated ones to
+// aggregateEventChannel (either can be nil). It fails with ErrPortNotFound
+// when there is no such serial port.
+func NewS4(eventChannel chan<- AtomicEvent, aggregateEventChannel chan<- AggregateEvent, options ...Option) (S4Interface, error) {
+	s4 := &S4{baud: 115200, now: millis, display: make(chan Packet, 8), quit: make(chan struct{})}
+	for _, option := range options {
+		option(s4)
+	}
+	if s4.port == nil {
+		if err := s4.openPort(); err != nil {
+			s4.log.Errorf("%v", err)
+			return nil, err
+		}
+	}
+	s4.scanner = bufio.NewScanner(s4.port)
+	s4.aggregator = newAggregator(eventChannel, aggregateEventChannel)
+	s4.aggregator.log = s4.log
+	s4.poller = newPoller(g_memorymap)
+	s4.poller.log = s4.log
+	return s4, nil
 }
 
-func NewS4(eventChannel chan<- AtomicEvent, aggregateEventChannel chan<- AggregateEvent, debug bool) S4Interface {
-	p := openPort()
-	aggregator := newAggregator(eventChannel, aggregateEventChannel)
-	s4 := S4{port: p, scanner: bufio.NewScanner(p), aggregator: aggregator, debug: debug}
-	return &s4
+// fail records the first failure, which ends the workout
+func (s4 *S4) fail(err error) {
+	if s4.err == nil {
+		s4.log.Errorf("%v", err)
+		s4.err = err
+	}
 }
 
 func (s4 *S4) write(p Packet) {
-	n, err := s4.port.Write(p.Bytes())
+	if s4.err != nil {
+		return
+	}
+	s4.buffer = p.appendTo(s4.buffer[:0])
+	n, err := s4.port.Write(s4.buffer)
 	if err != nil {
-		jww.FATAL.Println(err)
-		os.Exit(-1)
+		s4.fail(newError(ErrConnectionLost, "%v", err))
+		return
 	}
 	if s4.debug {
-		jww.DEBUG.Printf("written %s (%d+1 bytes)", strings.TrimRight(string(p.Bytes()), "\n"), n-1)
+		s4.log.Debugf("written %s (%d+1 bytes)", strings.TrimRight(string(s4.buffer), "\n"), n-1)
 	}
 	time.Sleep(25 * time.Millisecond) // yield per spec
 }
 
-func (s4 *S4) read() {
+// receive reads lines from the serial port into the ring, on its own
+// goroutine so that reads are never delayed by packet handling
+func (s4 *S4) receive(ring *lineRing) {
 	for s4.scanner.Scan() {
 		b := s4.scanner.Bytes()
 		if len(b) > 0 {
-			if s4.debug {
-				jww.DEBUG.Printf("read %s (%d+1 bytes)", string(b), len(b))
-			}
-			s4.onPacketReceived(b)
-			if s4.workout.state == WorkoutCompleted || s4.workout.state == WorkoutExited {
-				return
+			ring.put(b)
+		}
+	}
+	ring.close(s4.scanner.Err())
+}
+
+func (s4 *S4) read() {
+	ring := newLineRing()
+	go s4.receive(ring)
+	defer func() {
+		if dropped := atomic.LoadUint64(&ring.dropped); dropped > 0 {
+			s4.log.Errorf("Dropped %d packets, processing could not keep up with the S4\n", dropped)
+		}
+	}()
+
+	for {
+		b, err := ring.peek(s4.readTimeout, s4.quit)
+		if err == io.EOF {
+			break
+		}
+		if err == errQuit {
+			return
+		}
+		if err != nil {
+			s4.fail(newError(ErrConnectionLost, "%v", err))
+			return
+		}
+		if s4.debug {
+			s4.log.Debugf("read %s (%d+1 bytes)", string(b), len(b))
+		}
+		s4.onPacketReceived(b)
+		ring.advance()
+		if s4.err != nil {
+			return
+		}
+		s4.checkProgress(s4.now())
+		if s4.workout.state == WorkoutProgrammed {
+			s4.writeDisplay()
+			if s4.workout.fromMonitor {
+				s4.pollWorkoutLimit(s4.now())
 			}
 		}
+		if s4.workout.state == WorkoutStarted || s4.workout.state == WorkoutPaused {
+			s4.writeDisplay()
+			s4.poll()
+		}
+		if s4.workout.state == WorkoutCompleted || s4.workout.state == WorkoutExited {
+			return
+		}
 	}
 
-	if err := s4.scanner.Err(); err != nil {
-		jww.FATAL.Println(err)
-		os.Exit(-1)
+	if err := ring.err; err != nil {
+		s4.fail(newError(ErrConnectionLost, "%v", err))
 	}
 }
 
-func (s4 *S4) Run(workout *S4Workout) {
+// Run runs the workout until it is completed or exited, returning the
+// failure that ended it, if any: ErrConnectionLost when the S4 cannot be
+// written to or read from (or is silent for longer than the read timeout),
+// ErrUnsupportedFirmware when the monitor is not a supported S4, or
+// ErrWorkoutRejected when the workout limit read back once programmed is
+// not the one sent. The serial port is closed once the workout ends, so
+// that it can be opened again for the next workout.
+func (s4 *S4) Run(workout *S4Workout) error {
 	// send connection command and start listening
 	s4.workout = workout
-	s4.workout.state = Unset
+	s4.workout.state = WorkoutUnset
+	now := s4.now()
+	s4.aggregator.consume(AtomicEvent{Time: now, Label: "oarsman_version", Text: Version})
+	s4.aggregator.consume(AtomicEvent{Time: now, Label: "serial_device", Text: s4.device})
+	s4.aggregator.consume(AtomicEvent{Time: now, Label: "memory_map_revision", Value: MemoryMapRevision})
 	s4.write(Packet{cmd: UsbRequest})
 	s4.read()
-	s4.Exit()
-}
-
-func (s4 *S4) Exit() {
 	if s4.workout.state != WorkoutExited {
 		s4.write(Packet{cmd: ExitRequest})
-		s4.workout.state = WorkoutExited
-		s4.aggregator.complete()
+		s4.setState(WorkoutExited)
 	}
+	s4.aggregator.close()
+	s4.port.Close()
+	return s4.err
+}
+
+// Subscribe taps the live events of the given metrics, or of every metric if
+// none given, until the returned cancel function is called or the workout
+// ends. Events are dropped if the subscriber falls behind.
+func (s4 *S4) Subscribe(metrics ...Metric) (<-chan Event, func()) {
+	return s4.aggregator.subscribers.subscribe(metrics)
+}
+
+// Exit ends the workout, even while the S4 is silent, and can be called from
+// any goroutine and more than once. Run exits the S4 and returns shortly
+// after.
+func (s4 *S4) Exit() {
+	s4.quitOnce.Do(func() { close(s4.quit) })
 }
 
 func (s4 *S4) onPacketReceived(b []byte) {
@@ -177,6 +293,10 @@ func (s4 *S4) onPacketReceived(b []byte) {
 	// E : ERROR
 	// P : PING, P
 	// S : SS, SE
+	if len(b) == 0 {
+		s4.unknownPacketHandler(b)
+		return
+	}
 	c := b[0]
 	switch c {
 	case '_':
@@ -192,16 +312,20 @@ func (s4 *S4) onPacketReceived(b []byte) {
 	case 'S':
 		s4.strokeHandler(b)
 	default:
-		jww.INFO.Printf("Unrecognized packet: %s", string(b))
+		s4.unknownPacketHandler(b)
 	}
 }
 
+func (s4 *S4) unknownPacketHandler(b []byte) {
+	s4.log.Infof("Unrecognized packet: %s", string(b))
+}
+
 func (s4 *S4) wRHandler(b []byte) {
 	s := string(b)
 	if s == "_WR_" {
 		s4.write(Packet{cmd: ModelInformationRequest})
 	} else {
-		jww.INFO.Printf("Unknown WaterRower init command %s\n", s)
+		s4.log.Infof("Unknown WaterRower init command %s\n", s)
 	}
 }
 
@@ -211,32 +335,53 @@ func (s4 *S4) readMemoryRequest(address string, size string) {
 	s4.write(Packet{cmd: cmd, data: data})
 }
 
+// poll requests the memory locations due to be read
+func (s4 *S4) poll() {
+	for _, e := range s4.poller.due(s4.now()) {
+		// the round-trip time is measured from the actual write, as
+		// every write is followed by a pause
+		e.requested = s4.now()
+		s4.readMemoryRequest(e.address, e.memory.size)
+	}
+}
+
 func (s4 *S4) oKHandler() {
 	s4.aggregator.consume(AtomicEvent{
-		Time:  millis(),
+		Time:  s4.now(),
 		Label: "okay",
 		Value: 0})
 }
 
 func (s4 *S4) errorHandler() {
-	if s4.workout.state == ResetPingReceived {
+	if s4.workout.state == WorkoutProgrammed {
 		s4.write(Packet{cmd: ResetRequest})
-		s4.workout.state = ResetWaitingPing
+		s4.setState(WorkoutConnected)
 	}
 }
 
 func (s4 *S4) pingHandler(b []byte) {
+	if len(b) < 3 {
+		s4.unknownPacketHandler(b)
+		return
+	}
 	c := b[1]
 	switch c {
 	case 'I': // PING
-		if s4.workout.state == ResetWaitingPing {
-			s4.workout.state = ResetPingReceived
+		if string(b) != PingResponse {
+			s4.unknownPacketHandler(b)
+			return
+		}
+		if s4.workout.state == WorkoutConnected {
 			for e := s4.workout.workoutPackets.Front(); e != nil; e = e.Next() {
 				s4.write(e.Value.(Packet))
 			}
+			s4.setState(WorkoutProgrammed)
+			if s4.workout.limit > 0 {
+				s4.readMemoryRequest(workoutLimitAddress, "D")
+			}
 		}
 		s4.aggregator.consume(AtomicEvent{
-			Time:  millis(),
+			Time:  s4.now(),
 			Label: "ping",
 			Value: 0})
 	default: // P
@@ -244,79 +389,124 @@ func (s4 *S4) pingHandler(b []byte) {
 		// detector such that a pulse train containing 57 pulses per
 		// revolution can be recorded for the purposes of paddle speed
 		// measurement
-		pulses := string(b[1:3])
-		value, _ := strconv.ParseUint(pulses, 16, 8)
+		value, ok := parseHex(b[1:3])
+		if !ok {
+			s4.parseError(b, "invalid pulse count")
+			return
+		}
 		s4.aggregator.consume(AtomicEvent{
-			Time:  millis(),
+			Time:  s4.now(),
 			Label: "pulses_per_25ms",
 			Value: value})
 	}
 }
 
 type MemoryEntry struct {
-	label string
-	size  string
-	base  int
+	label    string
+	size     string
+	base     int
+	interval time.Duration // minimum time between reads, 0 for continuous
 }
 
 var g_memorymap = map[string]MemoryEntry{
-	"055": MemoryEntry{"total_distance_meters", "D", 16},
-	"1A9": MemoryEntry{"stroke_rate", "S", 16},
-	"088": MemoryEntry{"watts", "D", 16},
-	"08A": MemoryEntry{"calories", "T", 16},
-	"148": MemoryEntry{"speed_cm_s", "D", 16},
-	"1A0": MemoryEntry{"heart_rate", "D", 16}}
+	"055": MemoryEntry{"total_distance_meters", "D", 16, 0},
+	"1A9": MemoryEntry{"stroke_rate", "S", 16, 500 * time.Millisecond},
+	"088": MemoryEntry{"watts", "D", 16, 250 * time.Millisecond},
+	"08A": MemoryEntry{"calories", "T", 16, time.Second},
+	"148": MemoryEntry{"speed_cm_s", "D", 16, 250 * time.Millisecond},
+	"1A0": MemoryEntry{"heart_rate", "D", 16, 500 * time.Millisecond}}
 
 func (s4 *S4) strokeHandler(b []byte) {
+	if len(b) < 2 {
+		s4.unknownPacketHandler(b)
+		return
+	}
 	c := b[1]
 	switch c {
 	case 'S': // SS
-		if s4.workout.state == ResetPingReceived {
-			s4.workout.state = WorkoutStarted
-			// these are the things we want captured from the S4
-			for address, mmap := range g_memorymap {
-				s4.readMemoryRequest(address, mmap.size)
-			}
+		s4.lastStroke = s4.now()
+		if s4.workout.state == WorkoutProgrammed {
+			s4.startedAt = s4.lastStroke
+			s4.setState(WorkoutStarted)
 		}
 		s4.aggregator.consume(AtomicEvent{
-			Time:  millis(),
+			Time:  s4.now(),
 			Label: "stroke_start",
 			Value: 1})
 	case 'E': // SE
 		s4.aggregator.consume(AtomicEvent{
-			Time:  millis(),
+			Time:  s4.now(),
 			Label: "stroke_end",
 			Value: 0})
+	default:
+		s4.unknownPacketHandler(b)
 	}
 }
 
+func (s4 *S4) parseError(b []byte, reason string) {
+	s4.log.Errorf("Could not parse packet %q: %s\n", string(b), reason)
+	s4.aggregator.consume(AtomicEvent{
+		Time:  s4.now(),
+		Label: "parse_error",
+		Value: 0})
+}
+
 func (s4 *S4) informationHandler(b []byte) {
+	if len(b) < 2 {
+		s4.unknownPacketHandler(b)
+		return
+	}
 	c1 := b[1]
 	switch c1 {
 	case 'V': // version
 		// e.g. IV40210
+		if len(b) < 7 {
+			s4.parseError(b, "model information too short")
+			return
+		}
 		msg := string(b)
-		jww.INFO.Printf("WaterRower S%s %s.%s\n", msg[2:3], msg[3:5], msg[5:7])
+		s4.log.Infof("WaterRower S%s %s.%s\n", msg[2:3], msg[3:5], msg[5:7])
 		model, _ := strconv.ParseInt(msg[2:3], 0, 0)  // 4
 		fwHigh, _ := strconv.ParseInt(msg[3:5], 0, 0) // 2
 		fwLow, _ := strconv.ParseInt(msg[5:7], 0, 0)  // 10
 		if model != 4 {
-			jww.INFO.Println("not an S4 monitor")
+			s4.fail(newError(ErrUnsupportedFirmware, "not an S4 monitor (S%s)", msg[2:3]))
+			return
 		}
 		if fwHigh != 2 {
-			jww.INFO.Println("unsupported major S4 firmware version")
+			s4.fail(newError(ErrUnsupportedFirmware, "unsupported major S4 firmware version %s.%s", msg[3:5], msg[5:7]))
+			return
 		}
 		if fwLow != 10 {
-			jww.INFO.Println("unsupported minor S4 firmware version")
+			s4.log.Infof("unsupported minor S4 firmware version")
+		}
+		s4.aggregator.consume(AtomicEvent{
+			Time:  s4.now(),
+			Label: "monitor_model",
+			Value: uint64(model)})
+		s4.aggregator.consume(AtomicEvent{
+			Time:  s4.now(),
+			Label: "firmware_version",
+			Text:  msg[3:5] + "." + msg[5:7]})
+
+		if s4.odometerAddress != "" {
+			s4.readMemoryRequest(s4.odometerAddress, "T")
 		}
 
-		// we are ready to start workout
-		s4.workout.state = ResetWaitingPing
-		s4.write(Packet{cmd: ResetRequest})
+		// we are ready to start workout, keeping the workout programmed on
+		// the monitor if any
+		if !s4.workout.fromMonitor {
+			s4.write(Packet{cmd: ResetRequest})
+		}
+		s4.setState(WorkoutConnected)
 
 	case 'D': // memory value
+		// e.g. IDD0550A1F: size, 3 hex digit address, 2 hex digits per byte
+		if len(b) < 6 {
+			s4.parseError(b, "memory value too short")
+			return
+		}
 		size := b[2]
-		address := string(b[3:6])
 
 		var l int
 		switch size {
@@ -326,21 +516,81 @@ func (s4 *S4) informationHandler(b []byte) {
 			l = 2
 		case 'T':
 			l = 3
+		default:
+			s4.parseError(b, "unknown memory size")
+			return
+		}
+
+		address := string(b[3:6])
+		if _, err := strconv.ParseUint(address, 16, 12); err != nil {
+			s4.parseError(b, "invalid memory address")
+			return
+		}
+		if address == workoutLimitAddress && len(b) == 6+2*l {
+			if v, ok := parseHex(b[6:]); ok {
+				s4.verifyWorkout(v)
+				return
+			}
 		}
-		v, err := strconv.ParseUint(string(b[6:(6+2*l)]), 16, 8*l)
-		if err == nil {
-			s4.aggregator.consume(AtomicEvent{
-				Time:  millis(),
-				Label: g_memorymap[address].label,
-				Value: v})
-			// we re-request the data
-			if s4.workout.state == WorkoutStarted {
-				s4.readMemoryRequest(address, string(size))
+		if address == s4.odometerAddress && len(b) == 6+2*l {
+			if v, ok := parseHex(b[6:]); ok {
+				s4.aggregator.consume(AtomicEvent{
+					Time:  s4.now(),
+					Label: "odometer_meters",
+					Value: v})
+				return
 			}
-		} else {
-			jww.INFO.Println("error parsing int: ", err)
 		}
+		mmap, ok := g_memorymap[address]
+		if !ok {
+			s4.parseError(b, "unexpected memory address")
+			return
+		}
+		// a corrupted value must not stop polling
+		s4.poller.received(address, s4.now())
+
+		if len(b) != 6+2*l {
+			s4.parseError(b, "memory value length does not match size")
+			return
+		}
+		v, ok := parseHex(b[6:(6 + 2*l)])
+		if !ok {
+			s4.parseError(b, "invalid memory value")
+			return
+		}
+		if mmap.label == string(MetricTotalDistance) {
+			s4.distanceMeters = v
+		}
+		s4.aggregator.consume(AtomicEvent{
+			Time:  s4.now(),
+			Label: mmap.label,
+			Value: v})
+	default:
+		s4.parseError(b, "unknown information packet")
+	}
+}
+
+// parseHex parses an unsigned hexadecimal number of up to 16 digits, without
+// converting the packet bytes to a string
+func parseHex(b []byte) (uint64, bool) {
+	if len(b) == 0 || len(b) > 16 {
+		return 0, false
+	}
+	var v uint64
+	for _, c := range b {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'A' && c <= 'F':
+			c -= 'A' - 10
+		case c >= 'a' && c <= 'f':
+			c -= 'a' - 10
+		default:
+			return 0, false
+		}
+		v = v<<4 | uint64(c)
 	}
+	return v, true
 }
 
 func millis() int64 {
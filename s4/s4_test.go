@@ -0,0 +1,229 @@
+package s4
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func BenchmarkPacketAppendTo(b *testing.B) {
+	p := Packet{cmd: ReadMemoryRequest, data: []byte("D055")}
+	var buffer []byte
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buffer = p.appendTo(buffer[:0])
+	}
+}
+
+// testLogger keeps the messages logged
+type testLogger struct {
+	messages []string
+}
+
+func (l *testLogger) Debugf(format string, v ...interface{}) {}
+
+func (l *testLogger) Infof(format string, v ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, v...))
+}
+
+func (l *testLogger) Errorf(format string, v ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, v...))
+}
+
+func (l *testLogger) logged(prefix string) bool {
+	for _, message := range l.messages {
+		if strings.HasPrefix(message, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// testPort keeps the packets written, and has nothing to read
+type testPort struct {
+	written bytes.Buffer
+}
+
+func (p *testPort) Read(b []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (p *testPort) Write(b []byte) (int, error) {
+	return p.written.Write(b)
+}
+
+func (p *testPort) Close() error {
+	return nil
+}
+
+// testS4 is a driver connected to a test port, for the packets handled
+type testS4 struct {
+	*S4
+	port   *testPort
+	log    *testLogger
+	events chan AtomicEvent
+}
+
+func newTestS4(t *testing.T) *testS4 {
+	ts := &testS4{port: &testPort{}, log: &testLogger{}, events: make(chan AtomicEvent, 64)}
+	clock := func() time.Time { return time.Unix(1415611737, 0) }
+	s, err := NewS4(ts.events, nil, WithTransport(ts.port), WithLogger(ts.log), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.S4 = s.(*S4)
+	workout := NewS4Workout()
+	ts.workout = &workout
+	return ts
+}
+
+// labels returns the labels of the events sent since last called
+func (ts *testS4) labels() []string {
+	var labels []string
+	for {
+		select {
+		case event := <-ts.events:
+			labels = append(labels, event.Label)
+		default:
+			return labels
+		}
+	}
+}
+
+func TestInformationHandler(t *testing.T) {
+	for _, test := range []struct {
+		packet string
+		labels string // of the events sent, comma separated
+	}{
+		{"IDD0550A1F", "total_distance_meters"},
+		{"IDS1A916", "stroke_rate"},
+		{"IV40210", "monitor_model,firmware_version,workout_state"},
+		{"IV50210", ""}, // not an S4, failing
+		{"I", ""},       // unrecognized
+		{"IV", "parse_error"},
+		{"IV4021", "parse_error"},
+		{"IX", "parse_error"},
+		{"ID", "parse_error"},
+		{"IDD05", "parse_error"},
+		{"IDD055", "parse_error"},
+		{"IDD0550A1", "parse_error"},
+		{"IDD0550A1F0", "parse_error"},
+		{"IDX0550A1F", "parse_error"},
+		{"ID\x000550A1F", "parse_error"},
+		{"IDDZZZ0A1F", "parse_error"},
+		{"IDD-550A1F", "parse_error"},
+		{"IDD0550A1G", "parse_error"},
+		{"IDD055 A1F", "parse_error"},
+		{"IDS1A9zz", "parse_error"},
+		{"IDD7FF0A1F", "parse_error"},
+	} {
+		ts := newTestS4(t)
+		ts.informationHandler([]byte(test.packet))
+		if labels := strings.Join(ts.labels(), ","); labels != test.labels {
+			t.Errorf("%q sent %q, want %q", test.packet, labels, test.labels)
+		}
+		if test.labels == "parse_error" && !ts.log.logged("Could not parse packet") {
+			t.Errorf("%q not logged as a parse error: %q", test.packet, ts.log.messages)
+		}
+	}
+}
+
+func TestInformationHandlerMonitors(t *testing.T) {
+	ts := newTestS4(t)
+	ts.informationHandler([]byte("I"))
+	if !ts.log.logged("Unrecognized packet") {
+		t.Errorf("logged %q, want the packet unrecognized", ts.log.messages)
+	}
+
+	ts = newTestS4(t)
+	ts.informationHandler([]byte("IV50210"))
+	if Cause(ts.err) != ErrUnsupportedFirmware {
+		t.Errorf("failed with %v, want ErrUnsupportedFirmware", ts.err)
+	}
+
+	ts = newTestS4(t)
+	ts.informationHandler([]byte("IV40210"))
+	if ts.err != nil || ts.workout.state != WorkoutConnected {
+		t.Errorf("state %s with %v, want connected", ts.workout.state, ts.err)
+	}
+	if written := ts.port.written.String(); written != ResetRequest+"\n" {
+		t.Errorf("written %q, want the reset", written)
+	}
+}
+
+func TestOnPacketReceived(t *testing.T) {
+	for _, test := range []struct {
+		packet  string
+		labels  string // of the events sent, comma separated
+		unknown bool   // logged as unrecognized
+	}{
+		{"", "", true},
+		{"S", "", true},
+		{"SS", "stroke_start", false},
+		{"SE", "stroke_end", false},
+		{"SX", "", true},
+		{"SSX", "stroke_start", false},
+		{"P", "", true},
+		{"PI", "", true},
+		{"PIN", "", true},
+		{"PING", "ping", false},
+		{"PINGS", "", true},
+		{"P1A", "pulses_per_25ms", false},
+		{"P1", "", true},
+		{"PZZ", "parse_error", false},
+		{"P1Z", "parse_error", false},
+		{"OK", "okay", false},
+		{"ERROR", "", false},
+		{"X", "", true},
+		{"\x00", "", true},
+		{"_", "", false},
+	} {
+		ts := newTestS4(t)
+		ts.onPacketReceived([]byte(test.packet))
+		if labels := strings.Join(ts.labels(), ","); labels != test.labels {
+			t.Errorf("%q sent %q, want %q", test.packet, labels, test.labels)
+		}
+		if unknown := ts.log.logged("Unrecognized packet"); unknown != test.unknown {
+			t.Errorf("%q unrecognized %v, want %v", test.packet, unknown, test.unknown)
+		}
+		if test.labels == "parse_error" && !ts.log.logged("Could not parse packet") {
+			t.Errorf("%q not logged as a parse error: %q", test.packet, ts.log.messages)
+		}
+	}
+}
+
+func TestPingAndStrokeHandlers(t *testing.T) {
+	// the workout is programmed on the first ping once connected
+	ts := newTestS4(t)
+	ts.workout.state = WorkoutConnected
+	ts.workout.workoutPackets.PushBack(Packet{cmd: WorkoutSetDistanceRequest, data: []byte(Meters + "07D0")})
+	ts.pingHandler([]byte("PING"))
+	if ts.workout.state != WorkoutProgrammed {
+		t.Errorf("state %s after the ping, want programmed", ts.workout.state)
+	}
+	if written := ts.port.written.String(); written != WorkoutSetDistanceRequest+Meters+"07D0\n" {
+		t.Errorf("written %q, want the workout", written)
+	}
+
+	// and started on the first stroke
+	ts.labels()
+	ts.strokeHandler([]byte("SS"))
+	if ts.workout.state != WorkoutStarted || ts.startedAt == 0 {
+		t.Errorf("state %s after the stroke, want started", ts.workout.state)
+	}
+	if labels := strings.Join(ts.labels(), ","); labels != "workout_state,stroke_start" {
+		t.Errorf("stroke sent %q", labels)
+	}
+
+	// a truncated ping leaves the workout as it is
+	ts = newTestS4(t)
+	ts.workout.state = WorkoutConnected
+	ts.pingHandler([]byte("PI"))
+	if ts.workout.state != WorkoutConnected {
+		t.Errorf("state %s after a truncated ping, want connected", ts.workout.state)
+	}
+}
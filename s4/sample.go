@@ -0,0 +1,28 @@
+package s4
+
+// Sample is the state of the rower at a point of an activity, the stable
+// form of an aggregate event for storage, exports and other programs
+type Sample struct {
+	TimeMilliseconds int64   `json:"time_milliseconds"` // since the Unix epoch
+	DistanceMeters   uint64  `json:"distance_meters"`   // total since the start of the workout
+	StrokeRateSpm    uint64  `json:"stroke_rate_spm"`   // strokes per minute
+	PowerWatts       uint64  `json:"power_watts"`
+	Calories         uint64  `json:"calories"`       // total since the start of the workout, in calories (not kcal)
+	SpeedMs          float64 `json:"speed_m_s"`      // meters per second
+	HeartRateBpm     uint64  `json:"heart_rate_bpm"` // beats per minute, 0 without a heart rate monitor
+	Rest             bool    `json:"rest,omitempty"` // in the rest of an interval
+}
+
+// Sample returns the sample at the end of the aggregate event
+func (event AggregateEvent) Sample() Sample {
+	return Sample{
+		TimeMilliseconds: event.Time,
+		DistanceMeters:   event.Total_distance_meters,
+		StrokeRateSpm:    event.Stroke_rate,
+		PowerWatts:       event.Watts,
+		Calories:         event.Calories,
+		SpeedMs:          event.Speed_m_s,
+		HeartRateBpm:     event.Heart_rate,
+		Rest:             event.Rest,
+	}
+}
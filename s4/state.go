@@ -0,0 +1,163 @@
+package s4
+
+import (
+	"time"
+)
+
+// WorkoutState is the lifecycle of a workout run on the S4. Every change is
+// emitted as a workout_state event, with the state as value and its name as
+// text.
+type WorkoutState int
+
+const (
+	WorkoutUnset      WorkoutState = iota // not connected yet
+	WorkoutConnected                      // the S4 answered and is being reset
+	WorkoutProgrammed                     // the workout is sent, waiting for the first stroke
+	WorkoutStarted
+	WorkoutPaused // no stroke for a while after starting
+	WorkoutCompleted
+	WorkoutExited
+)
+
+// the workout is paused when no stroke starts for this long
+const pauseAfterMillis = 10000
+
+// a workout from the monitor or a just row workout is completed when no
+// stroke starts for this long, as its limit is not known to oarsman
+const monitorIdleMillis = 120000
+
+// the text of the interval events, the work or the rest of an interval
+const (
+	IntervalWork = "work"
+	IntervalRest = "rest"
+)
+
+var workoutStateNames = []string{"unset", "connected", "programmed", "started", "paused", "completed", "exited"}
+
+func (state WorkoutState) String() string {
+	if state < 0 || int(state) >= len(workoutStateNames) {
+		return "unknown"
+	}
+	return workoutStateNames[state]
+}
+
+// workoutTransitions are the allowed state changes, any state can exit
+var workoutTransitions = map[WorkoutState][]WorkoutState{
+	WorkoutUnset:      {WorkoutConnected},
+	WorkoutConnected:  {WorkoutProgrammed},
+	WorkoutProgrammed: {WorkoutConnected, WorkoutStarted}, // reset again if the S4 rejects the workout
+	WorkoutStarted:    {WorkoutPaused, WorkoutCompleted},
+	WorkoutPaused:     {WorkoutStarted, WorkoutCompleted},
+}
+
+// CanTransitionTo tells whether the workout can move from state to next
+func (state WorkoutState) CanTransitionTo(next WorkoutState) bool {
+	if next == WorkoutExited {
+		return state != WorkoutExited
+	}
+	for _, allowed := range workoutTransitions[state] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// setState moves the workout to the next state and emits the change,
+// ignoring the transitions not allowed
+func (s4 *S4) setState(next WorkoutState) bool {
+	state := s4.workout.state
+	if !state.CanTransitionTo(next) {
+		s4.log.Errorf("Invalid workout state change from %s to %s\n", state, next)
+		return false
+	}
+	s4.workout.state = next
+	s4.log.Debugf("Workout %s\n", next)
+	s4.aggregator.consume(AtomicEvent{
+		Time:  s4.now(),
+		Label: string(MetricWorkoutState),
+		Value: uint64(next),
+		Text:  next.String()})
+	return true
+}
+
+// checkProgress completes single distance and duration workouts once their
+// target is reached, interval workouts once their last interval is rowed,
+// and workouts without a known limit once idle, and pauses or resumes the
+// workout on the strokes
+func (s4 *S4) checkProgress(now int64) {
+	workout := s4.workout
+	state := workout.state
+	if state != WorkoutStarted && state != WorkoutPaused {
+		return
+	}
+	switch {
+	case len(workout.intervals) > 0 && s4.advanceInterval(now):
+		s4.setState(WorkoutCompleted)
+	case workout.distanceMeters > 0 && s4.distanceMeters >= workout.distanceMeters:
+		s4.setState(WorkoutCompleted)
+	case workout.durationMillis > 0 && now-s4.startedAt >= workout.durationMillis:
+		s4.setState(WorkoutCompleted)
+	case workout.untilIdle && now-s4.lastStroke >= monitorIdleMillis:
+		s4.setState(WorkoutCompleted)
+	case state == WorkoutStarted && now-s4.lastStroke >= pauseAfterMillis:
+		s4.setState(WorkoutPaused)
+	case state == WorkoutPaused && now-s4.lastStroke < pauseAfterMillis:
+		s4.setState(WorkoutStarted)
+	}
+}
+
+// advanceInterval follows the intervals as programmed on the S4, from the
+// work of an interval to its rest once its distance or duration is rowed,
+// and to the next interval once rested, emitting an interval event at every
+// change. It returns true once the last interval is rowed, its rest is not
+// part of the workout.
+func (s4 *S4) advanceInterval(now int64) bool {
+	intervals := s4.workout.intervals
+	if s4.intervalAt == 0 {
+		// the first interval starts with the first stroke
+		s4.startInterval(s4.startedAt, false)
+		return false
+	}
+	interval := intervals[s4.interval]
+	if s4.resting {
+		if now-s4.intervalAt >= int64(interval.Rest/time.Millisecond) {
+			s4.interval++
+			s4.startInterval(now, false)
+		}
+		return false
+	}
+	if interval.Distance > 0 && s4.distanceMeters < s4.intervalMeters+interval.Distance {
+		return false
+	}
+	if interval.Duration > 0 && now-s4.intervalAt < int64(interval.Duration/time.Millisecond) {
+		return false
+	}
+	if s4.interval == len(intervals)-1 {
+		return true
+	}
+	if interval.Rest > 0 {
+		s4.startInterval(now, true)
+	} else {
+		s4.interval++
+		s4.startInterval(now, false)
+	}
+	return false
+}
+
+// startInterval starts the work or the rest of the current interval
+func (s4 *S4) startInterval(now int64, rest bool) {
+	s4.resting = rest
+	s4.intervalAt = now
+	s4.intervalMeters = s4.distanceMeters
+	text := IntervalWork
+	if rest {
+		text = IntervalRest
+	}
+	s4.log.Debugf("Interval %d %s", s4.interval+1, text)
+	s4.aggregator.consume(AtomicEvent{
+		Time:  now,
+		Label: string(MetricInterval),
+		Value: uint64(s4.interval + 1),
+		Text:  text})
+}
@@ -0,0 +1,106 @@
+package s4
+
+import (
+	"sync"
+)
+
+// Metric names a kind of live event, as labelled in the workout log
+type Metric string
+
+const (
+	MetricTotalDistance Metric = "total_distance_meters"
+	MetricStrokeRate    Metric = "stroke_rate" // strokes per minute
+	MetricWatts         Metric = "watts"
+	MetricCalories      Metric = "calories"
+	MetricSpeed         Metric = "speed_cm_s" // centimeters per second
+	MetricHeartRate     Metric = "heart_rate" // beats per minute
+	MetricStrokeStart   Metric = "stroke_start"
+	MetricStrokeEnd     Metric = "stroke_end"
+	MetricPulses        Metric = "pulses_per_25ms"
+	MetricWorkoutState  Metric = "workout_state" // a WorkoutState
+	MetricInterval      Metric = "interval"      // the interval from 1, with IntervalWork or IntervalRest as text
+)
+
+// Event is a live event of a subscribed metric, e.g. in JSON
+// {"time_milliseconds":1415611737000,"metric":"stroke_rate","value":22}
+type Event struct {
+	Time   int64  `json:"time_milliseconds"` // since the Unix epoch
+	Metric Metric `json:"metric"`
+	Value  uint64 `json:"value"`
+	Text   string `json:"text,omitempty"` // for metadata, e.g. the firmware_version
+}
+
+// events buffered for each subscriber, the events of a subscriber falling
+// further behind are dropped rather than delaying the driver
+const subscriberBuffer = 64
+
+type subscriber struct {
+	metrics map[Metric]bool // every metric if empty
+	events  chan Event
+}
+
+// subscribers fans the live events out to the subscribers
+type subscribers struct {
+	mutex  sync.Mutex
+	all    map[*subscriber]bool
+	closed bool
+}
+
+// subscribe returns the channel of the events of the metrics (of every
+// metric if none given), and the function to cancel the subscription,
+// which closes the channel. The channel is also closed when the workout
+// ends.
+func (s *subscribers) subscribe(metrics []Metric) (<-chan Event, func()) {
+	sub := &subscriber{metrics: map[Metric]bool{}, events: make(chan Event, subscriberBuffer)}
+	for _, metric := range metrics {
+		sub.metrics[metric] = true
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		close(sub.events)
+		return sub.events, func() {}
+	}
+	if s.all == nil {
+		s.all = map[*subscriber]bool{}
+	}
+	s.all[sub] = true
+
+	cancel := func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.all[sub] {
+			delete(s.all, sub)
+			close(sub.events)
+		}
+	}
+	return sub.events, cancel
+}
+
+func (s *subscribers) publish(atomicEvent AtomicEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	metric := Metric(atomicEvent.Label)
+	for sub := range s.all {
+		if len(sub.metrics) > 0 && !sub.metrics[metric] {
+			continue
+		}
+		select {
+		case sub.events <- Event{Time: atomicEvent.Time, Metric: metric, Value: atomicEvent.Value, Text: atomicEvent.Text}:
+		default:
+		}
+	}
+}
+
+func (s *subscribers) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closed = true
+	for sub := range s.all {
+		close(sub.events)
+	}
+	s.all = nil
+}
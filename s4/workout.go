@@ -3,41 +3,381 @@ package s4
 import (
 	"container/list"
 	"fmt"
-	jww "github.com/spf13/jwalterweatherman"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// limits of the workouts the S4 can be programmed with
+const (
+	MaxWorkoutSeconds = 18000 // 5 hours
+	MaxWorkoutMeters  = 64000
+	maxRestSeconds    = 0xFFFF
+	endOfIntervals    = "FFFF"
+)
+
+// the memory location of the limit of the programmed workout (of its first
+// interval for interval workouts), in meters or seconds, read back to
+// verify that the S4 accepted the workout
+const workoutLimitAddress = "1B6"
+
 type S4Workout struct {
 	workoutPackets *list.List
-	state          int
+	state          WorkoutState
+
+	// target of a single workout, to detect its completion
+	distanceMeters uint64
+	durationMillis int64
+
+	// limit expected in the workout limit location once programmed
+	limit uint64
+
+	// programmed on the buttons of the monitor rather than by oarsman
+	fromMonitor bool
+
+	// completed once the rower is idle, as the limit is not known
+	untilIdle bool
+
+	// of an interval workout, completed once the last one is rowed
+	intervals []Interval
+
+	// e.g. "2000m", "30:00" or "8x500m/1:30r", see Name
+	name string
+}
+
+// Name returns the name of the workout in the notation of the Concept2
+// logbook, e.g. "2000m", "30:00", "8x500m/1:30r" or "just row"
+func (workout S4Workout) Name() string {
+	return workout.name
 }
 
 func NewS4Workout() S4Workout {
-	workout := S4Workout{workoutPackets: list.New(), state: Unset}
+	workout := S4Workout{workoutPackets: list.New(), state: WorkoutUnset}
 	return workout
 }
 
-func (workout S4Workout) AddSingleWorkout(duration time.Duration, distanceMeters uint64) {
-	// prepare workout instructions
-	durationSeconds := uint64(duration.Seconds())
-	var workoutPacket Packet
+// Interval is one interval of an interval workout, either a distance or a
+// duration, followed by a rest
+type Interval struct {
+	Distance uint64 // meters
+	Duration time.Duration
+	Rest     time.Duration
+}
+
+// WorkoutBuilder defines the workout programmed into the S4, either a single
+// distance, a single duration, or intervals
+//
+//	workout, err := s4.NewWorkout().Distance(2000).Build()
+type WorkoutBuilder struct {
+	duration  time.Duration
+	distance  uint64
+	intervals []Interval
+
+	fromMonitor bool
+	justRow     bool
+
+	distanceDisplay  DistanceDisplay
+	intensityDisplay IntensityDisplay
+}
+
+func NewWorkout() *WorkoutBuilder {
+	return &WorkoutBuilder{}
+}
+
+// Duration defines a single duration workout
+func (b *WorkoutBuilder) Duration(duration time.Duration) *WorkoutBuilder {
+	b.duration = duration
+	return b
+}
+
+// Distance defines a single distance workout, in meters
+func (b *WorkoutBuilder) Distance(meters uint64) *WorkoutBuilder {
+	b.distance = meters
+	return b
+}
+
+// Intervals adds intervals to an interval workout, which must all be
+// distances or all be durations
+func (b *WorkoutBuilder) Intervals(intervals ...Interval) *WorkoutBuilder {
+	b.intervals = append(b.intervals, intervals...)
+	return b
+}
+
+// FromMonitor defines a workout programmed on the buttons of the S4 rather
+// than by oarsman: the S4 is not reset, and the workout is recorded from the
+// first stroke until the rower is idle for a while
+func (b *WorkoutBuilder) FromMonitor() *WorkoutBuilder {
+	b.fromMonitor = true
+	return b
+}
+
+// JustRow defines a workout without any limit: the S4 is reset, and the
+// workout is recorded from the first stroke until the rower is idle for a
+// while
+func (b *WorkoutBuilder) JustRow() *WorkoutBuilder {
+	b.justRow = true
+	return b
+}
+
+// Display switches the display of the S4 to the units once the workout is
+// programmed; an empty unit leaves its window as it is
+func (b *WorkoutBuilder) Display(distance DistanceDisplay, intensity IntensityDisplay) *WorkoutBuilder {
+	b.distanceDisplay = distance
+	b.intensityDisplay = intensity
+	return b
+}
+
+// Build validates the workout against the limits of the S4 and returns it
+// ready to be run. A workout beyond the limits is an ErrWorkoutLimitExceeded.
+func (b *WorkoutBuilder) Build() (S4Workout, error) {
+	workout := NewS4Workout()
+	packets := workout.workoutPackets
+
+	switch {
+	case b.duration > 0 && b.distance > 0:
+		return workout, fmt.Errorf("a workout has either a duration or a distance, not both")
+	case len(b.intervals) > 0 && (b.duration > 0 || b.distance > 0):
+		return workout, fmt.Errorf("an interval workout has no overall duration or distance")
+	case b.fromMonitor && (b.duration > 0 || b.distance > 0 || len(b.intervals) > 0):
+		return workout, fmt.Errorf("a workout from the monitor has no duration, distance or intervals")
+	case b.justRow && (b.duration > 0 || b.distance > 0 || len(b.intervals) > 0 || b.fromMonitor):
+		return workout, fmt.Errorf("a just row workout has no duration, distance, intervals or monitor workout")
+	case b.fromMonitor:
+		workout.fromMonitor = true
+		workout.untilIdle = true
+		workout.name = "from the monitor"
+	case b.justRow:
+		workout.untilIdle = true
+		workout.name = "just row"
+	case b.duration > 0:
+		seconds, err := workoutSeconds(b.duration)
+		if err != nil {
+			return workout, err
+		}
+		packets.PushBack(Packet{cmd: WorkoutSetDurationRequest, data: []byte(fmt.Sprintf("%04X", seconds))})
+		workout.durationMillis = int64(seconds) * 1000
+		workout.limit = seconds
+		workout.name = clock(b.duration)
+	case b.distance > 0:
+		if err := checkWorkoutMeters(b.distance); err != nil {
+			return workout, err
+		}
+		packets.PushBack(Packet{cmd: WorkoutSetDistanceRequest, data: []byte(Meters + fmt.Sprintf("%04X", b.distance))})
+		workout.distanceMeters = b.distance
+		workout.limit = b.distance
+		workout.name = fmt.Sprintf("%dm", b.distance)
+	case len(b.intervals) > 0:
+		byDistance := b.intervals[0].Distance > 0
+		for i, interval := range b.intervals {
+			packet, err := intervalPacket(i, interval, byDistance)
+			if err != nil {
+				return workout, err
+			}
+			packets.PushBack(packet)
+		}
+		packets.PushBack(Packet{cmd: AddIntervalWorkoutRequest, data: []byte(endOfIntervals)})
+		if byDistance {
+			workout.limit = b.intervals[0].Distance
+		} else {
+			workout.limit = uint64(b.intervals[0].Duration / time.Second)
+		}
+		workout.intervals = append([]Interval(nil), b.intervals...)
+		workout.name = intervalsName(b.intervals)
+	default:
+		return workout, fmt.Errorf("the workout has no duration, distance or intervals")
+	}
+
+	display, err := displayPackets(b.distanceDisplay, b.intensityDisplay)
+	if err != nil {
+		return workout, err
+	}
+	for _, packet := range display {
+		packets.PushBack(packet)
+	}
+	return workout, nil
+}
+
+// clock returns the duration as e.g. "30:00" or "1:00:00"
+func clock(duration time.Duration) string {
+	seconds := int64(duration / time.Second)
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// intervalsName returns the name of the intervals, e.g. "8x500m/1:30r", or
+// the intervals one after the other when they differ, e.g.
+// "1000m/2:00r + 500m/1:00r"
+func intervalsName(intervals []Interval) string {
+	names := make([]string, len(intervals))
+	same := true
+	for i, interval := range intervals {
+		if interval.Distance > 0 {
+			names[i] = fmt.Sprintf("%dm", interval.Distance)
+		} else {
+			names[i] = clock(interval.Duration)
+		}
+		names[i] += "/" + clock(interval.Rest) + "r"
+		same = same && names[i] == names[0]
+	}
+	if same {
+		return fmt.Sprintf("%dx%s", len(intervals), names[0])
+	}
+	return strings.Join(names, " + ")
+}
 
-	if durationSeconds > 0 {
-		jww.INFO.Printf("Starting single duration workout: %d seconds\n", durationSeconds)
-		if durationSeconds >= 18000 {
-			jww.FATAL.Printf("Workout time must be less than 18,000 seconds (was %d)\n", durationSeconds)
+// ParseIntervals parses intervals in the notation of Name, e.g.
+// "8x500m/1:30r", "4x4:00/1:00r" or "1000m/2:00r + 500m/1:00r"
+func ParseIntervals(s string) ([]Interval, error) {
+	var intervals []Interval
+	for _, part := range strings.Split(s, "+") {
+		part = strings.TrimSpace(part)
+		count := 1
+		if i := strings.Index(part, "x"); i >= 0 {
+			n, err := strconv.Atoi(part[:i])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid number of intervals in %q", part)
+			}
+			count = n
+			part = part[i+1:]
 		}
-		payload := fmt.Sprintf("%04X", durationSeconds)
-		workoutPacket = Packet{cmd: WorkoutSetDurationRequest, data: []byte(payload)}
-	} else if distanceMeters > 0 {
-		jww.INFO.Printf("Starting single distance workout: %d meters\n", distanceMeters)
-		if distanceMeters >= 64000 {
-			jww.FATAL.Printf("Workout distance must be less than 64,000 meters (was %d)\n", distanceMeters)
+		slash := strings.Index(part, "/")
+		if slash < 0 || !strings.HasSuffix(part, "r") {
+			return nil, fmt.Errorf("invalid interval %q, e.g. 500m/1:30r or 4:00/1:00r", part)
+		}
+		var interval Interval
+		work := part[:slash]
+		if strings.HasSuffix(work, "m") {
+			meters, err := strconv.ParseUint(strings.TrimSuffix(work, "m"), 10, 64)
+			if err != nil || meters == 0 {
+				return nil, fmt.Errorf("invalid interval distance %q", work)
+			}
+			interval.Distance = meters
+		} else {
+			d, err := parseClock(work)
+			if err != nil || d == 0 {
+				return nil, fmt.Errorf("invalid interval duration %q", work)
+			}
+			interval.Duration = d
+		}
+		rest, err := parseClock(strings.TrimSuffix(part[slash+1:], "r"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval rest %q", part[slash+1:])
+		}
+		interval.Rest = rest
+		for i := 0; i < count; i++ {
+			intervals = append(intervals, interval)
+		}
+	}
+	return intervals, nil
+}
+
+// parseClock parses a duration as written by clock, e.g. "1:30" or "1:00:00"
+func parseClock(s string) (time.Duration, error) {
+	fields := strings.Split(s, ":")
+	if len(fields) < 2 || len(fields) > 3 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	var seconds int64
+	for _, field := range fields {
+		n, err := strconv.ParseInt(field, 10, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid time %q", s)
 		}
-		payload := Meters + fmt.Sprintf("%04X", distanceMeters)
-		workoutPacket = Packet{cmd: WorkoutSetDistanceRequest, data: []byte(payload)}
+		seconds = seconds*60 + n
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func workoutSeconds(duration time.Duration) (uint64, error) {
+	seconds := uint64(duration / time.Second)
+	if seconds == 0 {
+		return 0, fmt.Errorf("workout time must be at least 1 second (was %v)", duration)
+	}
+	if seconds >= MaxWorkoutSeconds {
+		return 0, newError(ErrWorkoutLimitExceeded, "workout time must be less than 18,000 seconds (was %d)", seconds)
+	}
+	return seconds, nil
+}
+
+func checkWorkoutMeters(meters uint64) error {
+	if meters >= MaxWorkoutMeters {
+		return newError(ErrWorkoutLimitExceeded, "workout distance must be less than 64,000 meters (was %d)", meters)
+	}
+	return nil
+}
+
+// intervalError adds the interval to the details of err, keeping its kind
+func intervalError(i int, err error) error {
+	if e, ok := err.(*Error); ok {
+		return newError(e.Kind, "interval %d: %s", i+1, e.Detail)
+	}
+	return fmt.Errorf("interval %d: %v", i+1, err)
+}
+
+// intervalPacket returns the packet defining the interval i, the first one
+// setting whether the intervals are distances or durations
+func intervalPacket(i int, interval Interval, byDistance bool) (Packet, error) {
+	if interval.Distance > 0 && interval.Duration > 0 {
+		return Packet{}, fmt.Errorf("interval %d has both a distance and a duration", i+1)
+	}
+	if byDistance != (interval.Distance > 0) {
+		return Packet{}, fmt.Errorf("interval %d mixes distance and duration intervals", i+1)
+	}
+	if interval.Rest < 0 || interval.Rest/time.Second >= maxRestSeconds {
+		return Packet{}, newError(ErrWorkoutLimitExceeded, "interval %d rest must be less than %d seconds (was %v)", i+1, maxRestSeconds, interval.Rest)
+	}
+	rest := fmt.Sprintf("%04X", uint64(interval.Rest/time.Second))
+
+	var value string
+	if byDistance {
+		if err := checkWorkoutMeters(interval.Distance); err != nil {
+			return Packet{}, intervalError(i, err)
+		}
+		value = fmt.Sprintf("%04X", interval.Distance)
 	} else {
-		jww.FATAL.Println("Undefined workout")
+		seconds, err := workoutSeconds(interval.Duration)
+		if err != nil {
+			return Packet{}, intervalError(i, err)
+		}
+		value = fmt.Sprintf("%04X", seconds)
+	}
+
+	switch {
+	case i > 0:
+		return Packet{cmd: AddIntervalWorkoutRequest, data: []byte(value + rest)}, nil
+	case byDistance:
+		return Packet{cmd: IntervalWorkoutSetDistanceRequest, data: []byte(Meters + value + rest)}, nil
+	default:
+		return Packet{cmd: IntervalWorkoutSetDurationRequest, data: []byte(value + rest)}, nil
+	}
+}
+
+// verifyWorkout checks the workout limit read back from the S4 once the
+// workout is programmed, as a rejected workout is otherwise only noticed
+// when the session does not end as expected. For a workout from the
+// monitor, the limit becomes non-zero once programmed on its buttons.
+func (s4 *S4) verifyWorkout(limit uint64) {
+	if s4.workout.fromMonitor {
+		if limit != 0 && s4.workout.limit == 0 {
+			s4.workout.limit = limit
+			s4.log.Infof("Workout programmed on the monitor (limit %d)\n", limit)
+		}
+		return
+	}
+	if limit != s4.workout.limit {
+		s4.fail(newError(ErrWorkoutRejected, "programmed limit %d, read back %d", s4.workout.limit, limit))
+		return
+	}
+	s4.log.Debugf("Workout limit %d verified", limit)
+}
+
+// pollWorkoutLimit reads the workout limit every second while waiting for a
+// workout from the monitor
+func (s4 *S4) pollWorkoutLimit(now int64) {
+	if now-s4.limitReadAt >= 1000 {
+		s4.limitReadAt = now
+		s4.readMemoryRequest(workoutLimitAddress, "D")
 	}
-	workout.workoutPackets.PushFront(workoutPacket)
 }
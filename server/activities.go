@@ -0,0 +1,133 @@
+package server
+
+import (
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/storage"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Library is where the activities served are kept
+type Library struct {
+	// Open opens the database, on every request so that the activities
+	// saved meanwhile, e.g. by the daemon, are served
+	Open func() (*storage.OarsmanDB, error)
+	// LogFile returns the raw log of an activity
+	LogFile func(id int64) string
+	// Import saves the activity of a raw log with what is not recorded in
+	// the log itself
+	Import func(log io.Reader, details ActivityDetails) (*collector.Activity, error)
+}
+
+// ActivityDetails are the details of an activity not recorded in its raw
+// log, sent as query parameters with the log
+type ActivityDetails struct {
+	Timezone  string
+	TankNotes string
+	Recovered bool
+	Workout   string
+	Notes     string
+	Tags      []string
+}
+
+type activities struct {
+	library Library
+}
+
+// Activities returns the handler of the activities, to be registered on
+// "/activities" and "/activities/":
+//
+//	GET /activities               the activities
+//	POST /activities              imports a raw log, with the timezone,
+//	                              tank, recovered, workout, notes and tags
+//	                              (comma separated) query parameters
+//	GET /activities/{id}          an activity with its laps
+//	GET /activities/{id}/log      the raw log of an activity
+//	DELETE /activities/{id}       removes an activity from the database
+func Activities(library Library) http.Handler {
+	return &activities{library: library}
+}
+
+func (a *activities) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/activities"), "/")
+	if path == "" && r.Method == "POST" {
+		a.importLog(w, r)
+		return
+	}
+
+	database, err := a.library.Open()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "could not open the database")
+		return
+	}
+	defer database.Close()
+
+	if path == "" {
+		if r.Method != "GET" {
+			writeError(w, http.StatusMethodNotAllowed, r.Method+" not allowed")
+			return
+		}
+		list := database.ListActivities()
+		if list == nil {
+			list = []*collector.Activity{}
+		}
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+
+	tokens := strings.Split(path, "/")
+	id, err := strconv.ParseInt(tokens[0], 10, 64)
+	if err != nil || len(tokens) > 2 || (len(tokens) == 2 && tokens[1] != "log") {
+		writeError(w, http.StatusNotFound, "unknown path "+r.URL.Path)
+		return
+	}
+	activity := database.FindActivityById(id)
+	if activity == nil {
+		writeError(w, http.StatusNotFound, "unknown activity "+tokens[0])
+		return
+	}
+	switch {
+	case len(tokens) == 2 && r.Method == "GET":
+		a.serveLog(w, r, id)
+	case len(tokens) == 2:
+		writeError(w, http.StatusMethodNotAllowed, r.Method+" not allowed")
+	case r.Method == "GET":
+		writeJSON(w, http.StatusOK, activity.WithLaps(database.FindLapsByParentId(id)))
+	case r.Method == "DELETE":
+		database.RemoveActivityById(id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, r.Method+" not allowed")
+	}
+}
+
+func (a *activities) serveLog(w http.ResponseWriter, r *http.Request, id int64) {
+	f, err := os.Open(a.library.LogFile(id))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "no raw log for activity "+strconv.FormatInt(id, 10))
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	io.Copy(w, f)
+}
+
+func (a *activities) importLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	details := ActivityDetails{
+		Timezone:  query.Get("timezone"),
+		TankNotes: query.Get("tank"),
+		Recovered: query.Get("recovered") == "true",
+		Workout:   query.Get("workout"),
+		Notes:     query.Get("notes"),
+		Tags:      collector.ParseTags(query.Get("tags"))}
+	activity, err := a.library.Import(r.Body, details)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, activity)
+}
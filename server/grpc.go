@@ -0,0 +1,357 @@
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/s4"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// GRPCService is the path of the gRPC service, see api/oarsman.proto, to
+// register the handler on
+const GRPCService = "/oarsman.v1.Oarsman/"
+
+// the largest request accepted, the requests of the service are tiny
+const maxGRPCRequestBytes = 64 * 1024
+
+// the gRPC status codes returned
+const (
+	grpcOK                 = 0
+	grpcInvalidArgument    = 3
+	grpcNotFound           = 5
+	grpcFailedPrecondition = 9
+	grpcUnimplemented      = 12
+	grpcInternal           = 13
+	grpcUnavailable        = 14
+	grpcUnauthenticated    = 16
+)
+
+// grpcStatus is the status a call ends with
+type grpcStatus struct {
+	code    int
+	message string
+}
+
+func grpcError(code int, format string, v ...interface{}) *grpcStatus {
+	return &grpcStatus{code: code, message: fmt.Sprintf(format, v...)}
+}
+
+type grpcService struct {
+	recorder   Recorder // nil if no sessions are recorded, e.g. by serve
+	library    Library
+	authorized func(r *http.Request) bool
+}
+
+// GRPC returns the handler of the gRPC service, to be registered on
+// GRPCService, with the sessions of the recorder (none if nil) and the
+// activities of the library. The calls starting or stopping a workout need
+// the bearer token, as the mutating requests of the HTTP API. gRPC needs
+// HTTP/2, which ListenAndServe offers over TLS only.
+func (s *Server) GRPC(recorder Recorder, library Library) http.Handler {
+	return &grpcService{recorder: recorder, library: library, authorized: s.authorized}
+}
+
+// grpcRequest tells whether the request is a gRPC call, which reports its
+// failures in its trailers rather than as JSON
+func grpcRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+func (g *grpcService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || !grpcRequest(r) {
+		writeError(w, http.StatusUnsupportedMediaType, "gRPC calls only")
+		return
+	}
+	if r.ProtoMajor != 2 {
+		writeError(w, http.StatusHTTPVersionNotSupported, "gRPC needs HTTP/2, served over TLS only")
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc+proto")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+
+	method := strings.TrimPrefix(r.URL.Path, GRPCService)
+	request, err := readGRPCMessage(r.Body)
+	if err != nil {
+		writeGRPCStatus(w, grpcError(grpcInvalidArgument, "%v", err))
+		return
+	}
+	fields, err := parseProto(request)
+	if err != nil {
+		writeGRPCStatus(w, grpcError(grpcInvalidArgument, "%v", err))
+		return
+	}
+	var status *grpcStatus
+	switch method {
+	case "StreamMetrics":
+		status = g.streamMetrics(w, r, fields)
+	case "StartWorkout":
+		status = g.startWorkout(w, r, fields)
+	case "StopWorkout":
+		status = g.stopWorkout(w, r, fields)
+	case "ListActivities":
+		status = g.listActivities(w, fields)
+	case "GetActivity":
+		status = g.getActivity(w, fields)
+	default:
+		status = grpcError(grpcUnimplemented, "unknown method %s", method)
+	}
+	writeGRPCStatus(w, status)
+}
+
+// readGRPCMessage reads the single message of a unary or server streaming
+// call, prefixed with its compression flag and length
+func readGRPCMessage(body io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return nil, errors.New("missing request message")
+	}
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed messages are not supported")
+	}
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if length > maxGRPCRequestBytes {
+		return nil, fmt.Errorf("request message of %d bytes, at most %d", length, maxGRPCRequestBytes)
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(body, message); err != nil {
+		return nil, errors.New("truncated request message")
+	}
+	return message, nil
+}
+
+func writeGRPCMessage(w http.ResponseWriter, message []byte) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(message)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(message)
+	return err
+}
+
+// writeGRPCStatus ends the call with the status in the trailers, OK if nil
+func writeGRPCStatus(w http.ResponseWriter, status *grpcStatus) {
+	if status == nil {
+		status = &grpcStatus{code: grpcOK}
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(status.code))
+	if status.message != "" {
+		w.Header().Set("Grpc-Message", percentEncode(status.message))
+	}
+}
+
+// percentEncode encodes the status message as gRPC requires, its non
+// printable ASCII bytes and '%' as "%XX"
+func percentEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c > 0x7E || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func (g *grpcService) streamMetrics(w http.ResponseWriter, r *http.Request, fields []protoField) *grpcStatus {
+	if g.recorder == nil {
+		return grpcError(grpcUnavailable, "no sessions recorded, see the daemon command")
+	}
+	metrics := map[s4.Metric]bool{}
+	for _, field := range fields {
+		if field.number == 1 && field.wireType == wireBytes {
+			metrics[s4.Metric(field.bytes)] = true
+		}
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return grpcError(grpcInternal, "streaming not supported")
+	}
+	events, cancel, ok := g.recorder.Subscribe("current")
+	if !ok {
+		return grpcError(grpcFailedPrecondition, "no session in progress")
+	}
+	defer cancel()
+	flusher.Flush()
+	var message []byte
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if len(metrics) > 0 && !metrics[event.Metric] {
+				continue
+			}
+			message = appendMetric(message[:0], event)
+			if err := writeGRPCMessage(w, message); err != nil {
+				return nil
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (g *grpcService) startWorkout(w http.ResponseWriter, r *http.Request, fields []protoField) *grpcStatus {
+	if g.recorder == nil {
+		return grpcError(grpcUnavailable, "no sessions recorded, see the daemon command")
+	}
+	if !g.authorized(r) {
+		return grpcError(grpcUnauthenticated, "a valid bearer token is required")
+	}
+	var request WorkoutRequest
+	for _, field := range fields {
+		switch {
+		case field.number == 1 && field.wireType == wireVarint:
+			request.DistanceMeters = field.varint
+		case field.number == 2 && field.wireType == wireVarint:
+			request.DurationSeconds = field.varint
+		case field.number == 3 && field.wireType == wireBytes:
+			request.TankNotes = string(field.bytes)
+		}
+	}
+	if _, err := request.Build(); err != nil {
+		return grpcError(grpcInvalidArgument, "invalid workout: %v", err)
+	}
+	session, err := g.recorder.Start(request)
+	if err == ErrSessionInProgress {
+		return grpcError(grpcFailedPrecondition, "%v", err)
+	}
+	if err != nil {
+		return grpcError(grpcInternal, "%v", err)
+	}
+	writeGRPCMessage(w, appendSession(nil, session))
+	return nil
+}
+
+func (g *grpcService) stopWorkout(w http.ResponseWriter, r *http.Request, fields []protoField) *grpcStatus {
+	if g.recorder == nil {
+		return grpcError(grpcUnavailable, "no sessions recorded, see the daemon command")
+	}
+	if !g.authorized(r) {
+		return grpcError(grpcUnauthenticated, "a valid bearer token is required")
+	}
+	id := "current"
+	for _, field := range fields {
+		if field.number == 1 && field.wireType == wireBytes && len(field.bytes) > 0 {
+			id = string(field.bytes)
+		}
+	}
+	session, err := g.recorder.Stop(id)
+	if err != nil {
+		return grpcError(grpcNotFound, "%v", err)
+	}
+	writeGRPCMessage(w, appendSession(nil, session))
+	return nil
+}
+
+func (g *grpcService) listActivities(w http.ResponseWriter, fields []protoField) *grpcStatus {
+	var from, to int64
+	for _, field := range fields {
+		switch {
+		case field.number == 1 && field.wireType == wireVarint:
+			from = int64(field.varint)
+		case field.number == 2 && field.wireType == wireVarint:
+			to = int64(field.varint)
+		}
+	}
+	database, err := g.library.Open()
+	if err != nil {
+		return grpcError(grpcInternal, "could not open the database")
+	}
+	defer database.Close()
+
+	var message []byte
+	for _, activity := range database.ListActivities() {
+		id := activity.StartTimeMilliseconds
+		if (from > 0 && id < from) || (to > 0 && id >= to) {
+			continue
+		}
+		message = appendMessageField(message, 1, appendActivity(nil, activity, nil))
+	}
+	writeGRPCMessage(w, message)
+	return nil
+}
+
+func (g *grpcService) getActivity(w http.ResponseWriter, fields []protoField) *grpcStatus {
+	var id int64
+	for _, field := range fields {
+		if field.number == 1 && field.wireType == wireVarint {
+			id = int64(field.varint)
+		}
+	}
+	database, err := g.library.Open()
+	if err != nil {
+		return grpcError(grpcInternal, "could not open the database")
+	}
+	defer database.Close()
+
+	activity := database.FindActivityById(id)
+	if activity == nil {
+		return grpcError(grpcNotFound, "unknown activity %d", id)
+	}
+	writeGRPCMessage(w, appendActivity(nil, activity, database.FindLapsByParentId(id)))
+	return nil
+}
+
+// the messages of api/oarsman.proto
+
+func appendMetric(b []byte, event s4.Event) []byte {
+	b = appendIntField(b, 1, event.Time)
+	b = appendStringField(b, 2, string(event.Metric))
+	b = appendUintField(b, 3, event.Value)
+	return appendStringField(b, 4, event.Text)
+}
+
+func appendSession(b []byte, session Session) []byte {
+	b = appendStringField(b, 1, session.ID)
+	b = appendStringField(b, 2, session.State)
+	b = appendIntField(b, 3, session.ActivityID)
+	b = appendStringField(b, 4, session.Error)
+	b = appendUintField(b, 5, session.DistanceMeters)
+	return appendUintField(b, 6, session.DurationSeconds)
+}
+
+func appendLap(b []byte, lap *collector.Lap) []byte {
+	b = appendIntField(b, 1, lap.StartTimeMilliseconds)
+	b = appendIntField(b, 2, lap.TotalTimeSeconds)
+	b = appendUintField(b, 3, lap.DistanceMeters)
+	b = appendDoubleField(b, 4, lap.MaximumSpeedMs)
+	b = appendDoubleField(b, 5, lap.AverageSpeedMs)
+	b = appendUintField(b, 6, lap.KCalories)
+	b = appendUintField(b, 7, lap.AverageHeartRateBpm)
+	b = appendUintField(b, 8, lap.MaximumHeartRateBpm)
+	b = appendUintField(b, 9, lap.AverageCadenceRpm)
+	b = appendUintField(b, 10, lap.MaximumCadenceRpm)
+	b = appendUintField(b, 11, lap.AveragePowerWatts)
+	b = appendUintField(b, 12, lap.MaximumPowerWatts)
+	return appendBoolField(b, 13, lap.Rest)
+}
+
+// appendActivity appends the activity with its laps, none when listing
+func appendActivity(b []byte, activity *collector.Activity, laps []*collector.Lap) []byte {
+	b = appendMessageField(b, 1, appendLap(nil, &activity.Lap))
+	for _, lap := range laps {
+		b = appendMessageField(b, 2, appendLap(nil, lap))
+	}
+	b = appendBoolField(b, 3, activity.Recovered)
+	b = appendStringField(b, 4, activity.Timezone)
+	b = appendStringField(b, 5, activity.TankNotes)
+	b = appendIntField(b, 6, activity.PreRollMilliseconds)
+	b = appendStringField(b, 7, activity.Workout)
+	b = appendStringField(b, 8, activity.Notes)
+	for _, tag := range activity.Tags {
+		b = appendMessageField(b, 9, []byte(tag))
+	}
+	return b
+}
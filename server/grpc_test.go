@@ -0,0 +1,191 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/olympum/oarsman/s4"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testRecorder struct {
+	started WorkoutRequest
+	events  chan s4.Event
+}
+
+func (r *testRecorder) Start(request WorkoutRequest) (Session, error) {
+	r.started = request
+	return Session{ID: "1", State: "unset", DistanceMeters: request.DistanceMeters}, nil
+}
+
+func (r *testRecorder) Stop(id string) (Session, error) {
+	if id != "current" && id != "1" {
+		return Session{}, errors.New("unknown session " + id)
+	}
+	return Session{ID: "1", State: "exited"}, nil
+}
+
+func (r *testRecorder) Session(id string) (Session, bool) {
+	return Session{ID: "1"}, id == "1"
+}
+
+func (r *testRecorder) Subscribe(id string) (<-chan s4.Event, func(), bool) {
+	return r.events, func() {}, r.events != nil
+}
+
+func newGRPCTestServer(recorder Recorder) *httptest.Server {
+	s := New("secret")
+	s.Handle(GRPCService, s.GRPC(recorder, Library{}))
+	ts := httptest.NewUnstartedServer(s)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	return ts
+}
+
+// callGRPC calls the method with the request message, returning the
+// response messages and the status code
+func callGRPC(t *testing.T, ts *httptest.Server, method string, token string, message []byte) ([][]byte, string) {
+	body := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(message)))
+	body = append(body, message...)
+	request, _ := http.NewRequest("POST", ts.URL+GRPCService+method, bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/grpc")
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	response, err := ts.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.ProtoMajor != 2 {
+		t.Fatalf("served over HTTP/%d", response.ProtoMajor)
+	}
+	var messages [][]byte
+	for {
+		var prefix [5]byte
+		if _, err := io.ReadFull(response.Body, prefix[:]); err != nil {
+			break
+		}
+		m := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+		if _, err := io.ReadFull(response.Body, m); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, m)
+	}
+	return messages, response.Trailer.Get("Grpc-Status")
+}
+
+// stringField returns the string field of the message with the number
+func stringField(t *testing.T, message []byte, number int) string {
+	fields, err := parseProto(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range fields {
+		if field.number == number {
+			return string(field.bytes)
+		}
+	}
+	return ""
+}
+
+func TestGRPCStartWorkout(t *testing.T) {
+	recorder := &testRecorder{}
+	ts := newGRPCTestServer(recorder)
+	defer ts.Close()
+
+	request := appendUintField(nil, 1, 5000)
+	request = appendStringField(request, 3, "17 l")
+	if _, status := callGRPC(t, ts, "StartWorkout", "", request); status != "16" {
+		t.Errorf("status without the token %s, want 16", status)
+	}
+	messages, status := callGRPC(t, ts, "StartWorkout", "secret", request)
+	if status != "0" || len(messages) != 1 {
+		t.Fatalf("status %s with %d messages, want 0 with 1", status, len(messages))
+	}
+	if recorder.started != (WorkoutRequest{DistanceMeters: 5000, TankNotes: "17 l"}) {
+		t.Errorf("started %+v", recorder.started)
+	}
+	if id := stringField(t, messages[0], 1); id != "1" {
+		t.Errorf("session %q, want 1", id)
+	}
+
+	if _, status := callGRPC(t, ts, "StartWorkout", "secret", appendUintField(nil, 1, 100000)); status != "3" {
+		t.Errorf("status of a workout beyond the limits %s, want 3", status)
+	}
+}
+
+func TestGRPCStopWorkout(t *testing.T) {
+	ts := newGRPCTestServer(&testRecorder{})
+	defer ts.Close()
+
+	messages, status := callGRPC(t, ts, "StopWorkout", "secret", nil)
+	if status != "0" || len(messages) != 1 || stringField(t, messages[0], 2) != "exited" {
+		t.Errorf("status %s with %d messages, want the session exited", status, len(messages))
+	}
+	if _, status := callGRPC(t, ts, "StopWorkout", "secret", appendStringField(nil, 1, "2")); status != "5" {
+		t.Errorf("status of an unknown session %s, want 5", status)
+	}
+}
+
+func TestGRPCStreamMetrics(t *testing.T) {
+	events := make(chan s4.Event, 3)
+	events <- s4.Event{Time: 1, Metric: s4.MetricStrokeRate, Value: 22}
+	events <- s4.Event{Time: 2, Metric: s4.MetricWatts, Value: 180}
+	events <- s4.Event{Time: 3, Metric: s4.MetricStrokeRate, Value: 24}
+	close(events)
+	ts := newGRPCTestServer(&testRecorder{events: events})
+	defer ts.Close()
+
+	messages, status := callGRPC(t, ts, "StreamMetrics", "", appendStringField(nil, 1, string(s4.MetricStrokeRate)))
+	if status != "0" || len(messages) != 2 {
+		t.Fatalf("status %s with %d metrics, want 0 with 2", status, len(messages))
+	}
+	for _, message := range messages {
+		if metric := stringField(t, message, 2); metric != string(s4.MetricStrokeRate) {
+			t.Errorf("metric %s streamed", metric)
+		}
+	}
+}
+
+func TestGRPCUnavailableWithoutRecorder(t *testing.T) {
+	ts := newGRPCTestServer(nil)
+	defer ts.Close()
+
+	if _, status := callGRPC(t, ts, "StreamMetrics", "", nil); status != "14" {
+		t.Errorf("status %s, want 14", status)
+	}
+	if _, status := callGRPC(t, ts, "Unknown", "", nil); status != "12" {
+		t.Errorf("status of an unknown method %s, want 12", status)
+	}
+}
+
+func TestParseProto(t *testing.T) {
+	message := appendUintField(nil, 1, 300)
+	message = appendStringField(message, 2, "stroke_rate")
+	message = appendDoubleField(message, 3, 2.5)
+	fields, err := parseProto(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 3 || fields[0].varint != 300 || string(fields[1].bytes) != "stroke_rate" || fields[2].wireType != wireFixed64 {
+		t.Errorf("parsed %+v", fields)
+	}
+
+	for _, invalid := range [][]byte{
+		{0x08},             // varint missing
+		{0x12, 0x05, 'a'},  // length beyond the message
+		{0x19, 0x00},       // fixed64 truncated
+		{0x0B},             // group
+		{0x00, 0x00},       // field 0
+		{0x12, 0xFF, 0xFF}, // length varint truncated
+	} {
+		if _, err := parseProto(invalid); err == nil {
+			t.Errorf("parsed % X", invalid)
+		}
+	}
+}
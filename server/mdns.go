@@ -0,0 +1,467 @@
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/olympum/oarsman/s4"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServiceType is the DNS-SD service type the servers are advertised as on
+// the LAN with multicast DNS (Bonjour)
+const ServiceType = "_oarsman._tcp.local."
+
+// the multicast group and port of mDNS, RFC 6762
+var mdnsAddress = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// the time the records advertised are cached, as recommended for the
+// records other than the host addresses
+const mdnsTTL = 120
+
+// the DNS record types and classes used by DNS-SD
+const (
+	typeA   = 1
+	typePTR = 12
+	typeTXT = 16
+	typeSRV = 33
+	typeANY = 255
+
+	classIN    = 1
+	cacheFlush = 0x8000 // on the class of the records unique to the host
+	unicast    = 0x8000 // on the class of a question, answered to the sender
+)
+
+// Service is an oarsman server on the LAN, as advertised with mDNS
+type Service struct {
+	Instance string   // e.g. "raspberrypi"
+	Host     string   // e.g. "raspberrypi.local."
+	Port     int      // e.g. 8080
+	IPs      []net.IP // IPv4
+	Text     []string // e.g. "tls=1"
+}
+
+// URL returns the URL of the service, over HTTPS when advertised with
+// "tls=1", by its first address
+func (service Service) URL() string {
+	scheme := "http"
+	for _, text := range service.Text {
+		if text == "tls=1" {
+			scheme = "https"
+		}
+	}
+	host := strings.TrimSuffix(service.Host, ".")
+	if len(service.IPs) > 0 {
+		host = service.IPs[0].String()
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, fmt.Sprint(service.Port)))
+}
+
+// instanceName returns the fully qualified name of the service instance,
+// e.g. "raspberrypi._oarsman._tcp.local."
+func (service Service) instanceName() string {
+	return service.Instance + "." + ServiceType
+}
+
+// Advertiser answers the mDNS queries for a service until closed, so that
+// companion apps and other installations find it without configuring its
+// address
+type Advertiser struct {
+	service Service
+	conn    *net.UDPConn
+	once    sync.Once
+}
+
+// LocalService returns the service of this host on the port, with the
+// IPv4 addresses of its interfaces other than the loopback
+func LocalService(port int, text []string) (Service, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return Service{}, err
+	}
+	hostname = strings.SplitN(hostname, ".", 2)[0]
+	service := Service{Instance: hostname, Host: hostname + ".local.", Port: port, Text: text}
+	addresses, err := net.InterfaceAddrs()
+	if err != nil {
+		return Service{}, err
+	}
+	for _, address := range addresses {
+		if ipnet, ok := address.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+			service.IPs = append(service.IPs, ipnet.IP.To4())
+		}
+	}
+	if len(service.IPs) == 0 {
+		return Service{}, errors.New("no network interface to advertise on")
+	}
+	return service, nil
+}
+
+// Advertise announces the service on the LAN and answers the queries for it
+// until the advertiser is closed
+func Advertise(service Service) (*Advertiser, error) {
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsAddress)
+	if err != nil {
+		return nil, err
+	}
+	a := &Advertiser{service: service, conn: conn}
+	go a.answer()
+	// the announcements, twice a second apart, RFC 6762 section 8.3
+	go func() {
+		for i := 0; i < 2; i++ {
+			if _, err := conn.WriteToUDP(a.response(0, nil, mdnsTTL), mdnsAddress); err != nil {
+				return
+			}
+			time.Sleep(time.Second)
+		}
+	}()
+	s4.Log().Infof("Advertising %s on port %d", service.instanceName(), service.Port)
+	return a, nil
+}
+
+// Close sends the goodbye of the service, its records with no time to live,
+// and stops answering
+func (a *Advertiser) Close() error {
+	var err error
+	a.once.Do(func() {
+		a.conn.WriteToUDP(a.response(0, nil, 0), mdnsAddress)
+		err = a.conn.Close()
+	})
+	return err
+}
+
+func (a *Advertiser) answer() {
+	buffer := make([]byte, 9000)
+	for {
+		n, from, err := a.conn.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+		m, err := parseMessage(buffer[:n])
+		if err != nil || m.response {
+			continue
+		}
+		asked := false
+		direct := from.Port != mdnsAddress.Port // a legacy unicast resolver
+		for _, q := range m.questions {
+			if a.answers(q) {
+				asked = true
+				direct = direct || q.class&unicast != 0
+			}
+		}
+		if !asked {
+			continue
+		}
+		if direct {
+			a.conn.WriteToUDP(a.response(m.id, m.questions, mdnsTTL), from)
+		} else {
+			a.conn.WriteToUDP(a.response(0, nil, mdnsTTL), mdnsAddress)
+		}
+	}
+}
+
+// answers tells whether the question is about the service or its host
+func (a *Advertiser) answers(q question) bool {
+	switch {
+	case strings.EqualFold(q.name, ServiceType):
+		return q.rtype == typePTR || q.rtype == typeANY
+	case strings.EqualFold(q.name, a.service.instanceName()):
+		return q.rtype == typeSRV || q.rtype == typeTXT || q.rtype == typeANY
+	case strings.EqualFold(q.name, a.service.Host):
+		return q.rtype == typeA || q.rtype == typeANY
+	}
+	return false
+}
+
+// response returns all the records of the service, for the questions of a
+// legacy unicast resolver if any
+func (a *Advertiser) response(id uint16, questions []question, ttl uint32) []byte {
+	service := a.service
+	instance := service.instanceName()
+	records := []record{
+		{name: ServiceType, rtype: typePTR, class: classIN, ttl: ttl, data: encodeName(instance)},
+		{name: instance, rtype: typeSRV, class: classIN | cacheFlush, ttl: ttl, data: srvData(service)},
+		{name: instance, rtype: typeTXT, class: classIN | cacheFlush, ttl: ttl, data: txtData(service.Text)},
+	}
+	for _, ip := range service.IPs {
+		records = append(records, record{name: service.Host, rtype: typeA, class: classIN | cacheFlush, ttl: ttl, data: ip.To4()})
+	}
+	if id != 0 || len(questions) > 0 {
+		// the unique records are not flushed from the caches of legacy resolvers
+		for i := range records {
+			records[i].class &^= cacheFlush
+		}
+	}
+	// an authoritative answer
+	return message{id: id, response: true, flags: 0x8400, questions: questions, records: records}.encode()
+}
+
+// Browse queries the LAN for the oarsman servers, collecting the answers
+// until the timeout
+func Browse(timeout time.Duration) ([]Service, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	query := message{questions: []question{{name: ServiceType, rtype: typePTR, class: classIN | unicast}}}.encode()
+	if _, err := conn.WriteToUDP(query, mdnsAddress); err != nil {
+		return nil, err
+	}
+
+	instances := []string{}
+	srvs := map[string]record{}
+	txts := map[string][]string{}
+	ips := map[string][]net.IP{}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buffer := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			break
+		}
+		m, err := parseMessage(buffer[:n])
+		if err != nil || !m.response {
+			continue
+		}
+		for _, r := range m.records {
+			name := strings.ToLower(r.name)
+			switch r.rtype {
+			case typePTR:
+				if strings.EqualFold(r.name, ServiceType) && r.target != "" {
+					instances = appendNew(instances, strings.ToLower(r.target))
+				}
+			case typeSRV:
+				srvs[name] = r
+			case typeTXT:
+				txts[name] = r.text
+			case typeA:
+				if len(r.data) == net.IPv4len && !containsIP(ips[name], r.data) {
+					ips[name] = append(ips[name], net.IP(r.data))
+				}
+			}
+		}
+	}
+
+	services := []Service{}
+	for _, instance := range instances {
+		srv, ok := srvs[instance]
+		if !ok {
+			continue
+		}
+		services = append(services, Service{
+			Instance: strings.TrimSuffix(instance, "."+ServiceType),
+			Host:     srv.target,
+			Port:     srv.port,
+			IPs:      ips[strings.ToLower(srv.target)],
+			Text:     txts[instance]})
+	}
+	return services, nil
+}
+
+func appendNew(names []string, name string) []string {
+	for _, n := range names {
+		if n == name {
+			return names
+		}
+	}
+	return append(names, name)
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// message is a DNS message, RFC 1035, with the answer, authority and
+// additional records together
+type message struct {
+	id        uint16
+	response  bool
+	flags     uint16
+	questions []question
+	records   []record
+}
+
+type question struct {
+	name  string
+	rtype uint16
+	class uint16
+}
+
+type record struct {
+	name  string
+	rtype uint16
+	class uint16
+	ttl   uint32
+	data  []byte
+
+	// decoded from the data of the records received
+	target string // PTR and SRV
+	port   int    // SRV
+	text   []string
+}
+
+func (m message) encode() []byte {
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint16(b[0:], m.id)
+	binary.BigEndian.PutUint16(b[2:], m.flags)
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.records)))
+	for _, q := range m.questions {
+		b = append(b, encodeName(q.name)...)
+		b = appendUint16(b, q.rtype)
+		b = appendUint16(b, q.class)
+	}
+	for _, r := range m.records {
+		b = append(b, encodeName(r.name)...)
+		b = appendUint16(b, r.rtype)
+		b = appendUint16(b, r.class)
+		b = appendUint16(b, uint16(r.ttl>>16))
+		b = appendUint16(b, uint16(r.ttl))
+		b = appendUint16(b, uint16(len(r.data)))
+		b = append(b, r.data...)
+	}
+	return b
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+// encodeName encodes a name as its labels, uncompressed
+func encodeName(name string) []byte {
+	b := []byte{}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) > 63 {
+			label = label[:63]
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+func srvData(service Service) []byte {
+	b := []byte{0, 0, 0, 0} // priority and weight
+	b = appendUint16(b, uint16(service.Port))
+	return append(b, encodeName(service.Host)...)
+}
+
+func txtData(text []string) []byte {
+	if len(text) == 0 {
+		return []byte{0}
+	}
+	b := []byte{}
+	for _, t := range text {
+		if len(t) > 255 {
+			t = t[:255]
+		}
+		b = append(b, byte(len(t)))
+		b = append(b, t...)
+	}
+	return b
+}
+
+var errTruncated = errors.New("truncated DNS message")
+
+func parseMessage(b []byte) (message, error) {
+	if len(b) < 12 {
+		return message{}, errTruncated
+	}
+	m := message{
+		id:    binary.BigEndian.Uint16(b[0:]),
+		flags: binary.BigEndian.Uint16(b[2:])}
+	m.response = m.flags&0x8000 != 0
+	questions := int(binary.BigEndian.Uint16(b[4:]))
+	records := int(binary.BigEndian.Uint16(b[6:])) + int(binary.BigEndian.Uint16(b[8:])) + int(binary.BigEndian.Uint16(b[10:]))
+	offset := 12
+	for i := 0; i < questions; i++ {
+		name, next, err := decodeName(b, offset)
+		if err != nil || next+4 > len(b) {
+			return m, errTruncated
+		}
+		m.questions = append(m.questions, question{
+			name:  name,
+			rtype: binary.BigEndian.Uint16(b[next:]),
+			class: binary.BigEndian.Uint16(b[next+2:])})
+		offset = next + 4
+	}
+	for i := 0; i < records; i++ {
+		name, next, err := decodeName(b, offset)
+		if err != nil || next+10 > len(b) {
+			return m, errTruncated
+		}
+		r := record{
+			name:  name,
+			rtype: binary.BigEndian.Uint16(b[next:]),
+			class: binary.BigEndian.Uint16(b[next+2:]),
+			ttl:   binary.BigEndian.Uint32(b[next+4:])}
+		length := int(binary.BigEndian.Uint16(b[next+8:]))
+		start := next + 10
+		if start+length > len(b) {
+			return m, errTruncated
+		}
+		r.data = b[start : start+length]
+		switch r.rtype {
+		case typePTR:
+			r.target, _, _ = decodeName(b, start)
+		case typeSRV:
+			if length > 6 {
+				r.port = int(binary.BigEndian.Uint16(b[start+4:]))
+				r.target, _, _ = decodeName(b, start+6)
+			}
+		case typeTXT:
+			for t := 0; t < length && start+t+1+int(r.data[t]) <= start+length; t += 1 + int(r.data[t]) {
+				if r.data[t] > 0 {
+					r.text = append(r.text, string(r.data[t+1:t+1+int(r.data[t])]))
+				}
+			}
+		}
+		m.records = append(m.records, r)
+		offset = start + length
+	}
+	return m, nil
+}
+
+// decodeName decodes the name at the offset, following the compression
+// pointers, and returns it with the offset following it
+func decodeName(b []byte, offset int) (string, int, error) {
+	labels := []string{}
+	next := -1
+	for jumps := 0; ; {
+		if offset >= len(b) {
+			return "", 0, errTruncated
+		}
+		length := int(b[offset])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case length&0xC0 == 0xC0:
+			if offset+1 >= len(b) || jumps > 16 {
+				return "", 0, errTruncated
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(b[offset:]) & 0x3FFF)
+			jumps++
+		default:
+			if offset+1+length > len(b) {
+				return "", 0, errTruncated
+			}
+			labels = append(labels, string(b[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"net"
+	"testing"
+)
+
+// testAdvertisement is the response advertising a service, as sent
+func testAdvertisement() []byte {
+	a := &Advertiser{service: Service{
+		Instance: "raspberrypi",
+		Host:     "raspberrypi.local.",
+		Port:     8080,
+		IPs:      []net.IP{net.IPv4(192, 168, 1, 20)},
+		Text:     []string{"version=v0.1", "tls=1"}}}
+	return a.response(0, nil, mdnsTTL)
+}
+
+func TestParseMessage(t *testing.T) {
+	m, err := parseMessage(testAdvertisement())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.response || len(m.records) != 4 {
+		t.Fatalf("parsed %+v", m)
+	}
+	ptr, srv, txt, a := m.records[0], m.records[1], m.records[2], m.records[3]
+	if ptr.name != ServiceType || ptr.target != "raspberrypi."+ServiceType {
+		t.Errorf("PTR %s to %s", ptr.name, ptr.target)
+	}
+	if srv.port != 8080 || srv.target != "raspberrypi.local." || srv.class != classIN|cacheFlush {
+		t.Errorf("SRV %+v", srv)
+	}
+	if len(txt.text) != 2 || txt.text[0] != "version=v0.1" || txt.text[1] != "tls=1" {
+		t.Errorf("TXT %q", txt.text)
+	}
+	if !net.IP(a.data).Equal(net.IPv4(192, 168, 1, 20)) {
+		t.Errorf("A %v", a.data)
+	}
+
+	query := message{questions: []question{{name: ServiceType, rtype: typePTR, class: classIN | unicast}}}.encode()
+	if m, err := parseMessage(query); err != nil || m.response || len(m.questions) != 1 || m.questions[0].name != ServiceType {
+		t.Errorf("parsed query %+v, %v", m, err)
+	}
+}
+
+func TestParseMessageTruncated(t *testing.T) {
+	advertisement := testAdvertisement()
+	for n := 0; n < len(advertisement); n++ {
+		if _, err := parseMessage(advertisement[:n]); err == nil {
+			t.Errorf("parsed the first %d of %d bytes", n, len(advertisement))
+		}
+	}
+
+	header := []byte{0, 0, 0x84, 0, 0, 0, 0, 1, 0, 0, 0, 0}
+	for _, test := range []struct {
+		about string
+		b     []byte
+	}{
+		{"record header", append(header, 0, 0, 1, 0)},
+		{"record data", append(header, 0, 0, 1, 0, 1, 0, 0, 0, 0, 0, 4, 192, 168)},
+		{"record counts", []byte{0, 0, 0x84, 0, 0, 0, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0}},
+		{"question", []byte{0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 1}},
+		{"pointer loop", append(header, 0xC0, 12)},
+		{"pointers looping", append(header, 0xC0, 14, 0xC0, 12)},
+		{"pointer beyond", append(header, 0xC0, 0xFF)},
+		{"pointer cut", append(header, 0xC0)},
+		{"label beyond", append(header, 0x3F, 'a', 'b')},
+	} {
+		if m, err := parseMessage(test.b); err == nil {
+			t.Errorf("%s: parsed %+v", test.about, m)
+		}
+	}
+}
+
+func TestParseMessageRecordData(t *testing.T) {
+	header := []byte{0, 0, 0x84, 0, 0, 0, 0, 1, 0, 0, 0, 0}
+	rr := func(rtype byte, data ...byte) []byte {
+		b := append(append([]byte{}, header...), 1, 'a', 0, 0, rtype, 0, 1, 0, 0, 0, 120, 0, byte(len(data)))
+		return append(b, data...)
+	}
+	for _, test := range []struct {
+		about string
+		b     []byte
+		check func(r record) bool
+	}{
+		// the targets beyond the message are left empty
+		{"PTR pointer beyond", rr(typePTR, 0xC0, 0xFF), func(r record) bool { return r.target == "" }},
+		{"PTR pointer loop", rr(typePTR, 0xC0, 25), func(r record) bool { return r.target == "" }},
+		{"PTR compressed", rr(typePTR, 0xC0, 12), func(r record) bool { return r.target == "a." }},
+		{"SRV short", rr(typeSRV, 0, 0, 0, 0, 0x1F), func(r record) bool { return r.port == 0 && r.target == "" }},
+		{"SRV target beyond", rr(typeSRV, 0, 0, 0, 0, 0x1F, 0x90, 0xC0, 0xFF), func(r record) bool { return r.port == 8080 && r.target == "" }},
+		{"TXT beyond", rr(typeTXT, 3, 'a', '=', '1', 9, 'b'), func(r record) bool { return len(r.text) == 1 && r.text[0] == "a=1" }},
+		{"TXT empty", rr(typeTXT, 0), func(r record) bool { return len(r.text) == 0 }},
+	} {
+		m, err := parseMessage(test.b)
+		if err != nil || len(m.records) != 1 || !test.check(m.records[0]) {
+			t.Errorf("%s: parsed %+v, %v", test.about, m.records, err)
+		}
+	}
+}
+
+func TestDecodeName(t *testing.T) {
+	// "local." at 0, "rower" then a pointer to it at 7
+	b := []byte{5, 'l', 'o', 'c', 'a', 'l', 0, 5, 'r', 'o', 'w', 'e', 'r', 0xC0, 0, 0xC0, 15, 0xC0, 19, 0xC0, 17}
+	for _, test := range []struct {
+		offset int
+		name   string
+		next   int
+		fails  bool
+	}{
+		{offset: 0, name: "local.", next: 7},
+		{offset: 7, name: "rower.local.", next: 15},
+		{offset: 13, name: "local.", next: 15},
+		{offset: 15, fails: true}, // a pointer to itself
+		{offset: 17, fails: true}, // pointers to each other
+		{offset: len(b), fails: true},
+		{offset: len(b) + 10, fails: true},
+	} {
+		name, next, err := decodeName(b, test.offset)
+		if test.fails {
+			if err == nil {
+				t.Errorf("decoded %q at %d", name, test.offset)
+			}
+			continue
+		}
+		if err != nil || name != test.name || next != test.next {
+			t.Errorf("decoded %q to %d (%v) at %d, want %q to %d", name, next, err, test.offset, test.name, test.next)
+		}
+	}
+
+	for _, b := range [][]byte{
+		{0xC0},          // pointer cut
+		{0xC0, 0x40},    // pointer beyond
+		{3, 'a', 'b'},   // label cut
+		{1, 'a'},        // end missing
+		{0x80, 'a', 0},  // reserved label type, too long
+		{0xFF, 0xFF, 0}, // pointer beyond
+	} {
+		if name, _, err := decodeName(b, 0); err == nil {
+			t.Errorf("decoded %q from % X", name, b)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/olympum/oarsman/s4"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OverlayFields are the metrics the overlay can show, in the order given to
+// Overlay or to the fields parameter of the page:
+//
+//	pace       the pace per 500 m, from the speed
+//	spm        the stroke rate
+//	hr         the heart rate
+//	distance   the distance rowed
+//	time       the time since rowing started
+//	watts      the power
+//	progress   the progress towards the distance or duration of the workout,
+//	           and the interval rowed if any, work or rest
+var OverlayFields = []string{"pace", "spm", "hr", "distance", "time", "watts", "progress"}
+
+// the time between the checks for a session to start, while the overlay
+// waits for one
+const overlayWaitInterval = time.Second
+
+// the metrics shown by the overlay, leaving out the pulses and strokes of
+// the 25 ms resolution
+var overlayMetrics = map[s4.Metric]bool{
+	s4.MetricWorkoutState:  true,
+	s4.MetricTotalDistance: true,
+	s4.MetricStrokeRate:    true,
+	s4.MetricWatts:         true,
+	s4.MetricSpeed:         true,
+	s4.MetricHeartRate:     true,
+	s4.MetricInterval:      true,
+}
+
+// OverlayMessage is a message of the overlay WebSocket, in JSON either the
+// session started or one of its live events
+type OverlayMessage struct {
+	Session *Session  `json:"session,omitempty"`
+	Event   *s4.Event `json:"event,omitempty"`
+}
+
+type overlay struct {
+	recorder Recorder
+	fields   []string
+}
+
+// Overlay returns the handler of a page showing the live metrics of the
+// sessions of the recorder over a transparent background, e.g. as a
+// browser source of OBS for streaming, to be registered on "/overlay" and
+// "/overlay/":
+//
+//	GET /overlay           the page, with the fields given, or else as
+//	                       ?fields=pace,spm,hr
+//	GET /overlay/events    the session in progress and its live events, as
+//	                       a WebSocket of OverlayMessage, waiting for the
+//	                       next session when none is in progress
+func Overlay(recorder Recorder, fields []string) http.Handler {
+	return &overlay{recorder: recorder, fields: overlayFields(fields)}
+}
+
+// overlayFields returns the known fields, all of them if none are
+func overlayFields(fields []string) []string {
+	known := []string{}
+	for _, field := range fields {
+		field = strings.TrimSpace(strings.ToLower(field))
+		for _, f := range OverlayFields {
+			if field == f {
+				known = append(known, field)
+			}
+		}
+	}
+	if len(known) == 0 {
+		return OverlayFields
+	}
+	return known
+}
+
+func (h *overlay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/overlay"), "/")
+	switch {
+	case r.Method != "GET":
+		writeError(w, http.StatusMethodNotAllowed, r.Method+" not allowed")
+	case path == "":
+		fields := h.fields
+		if query := r.URL.Query().Get("fields"); query != "" {
+			fields = overlayFields(strings.Split(query, ","))
+		}
+		b, _ := json.Marshal(fields)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, overlayPage, b)
+	case path == "events":
+		h.events(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "unknown path "+r.URL.Path)
+	}
+}
+
+// events sends the sessions in progress and their live events over a
+// WebSocket, one after the other, until the client leaves
+func (h *overlay) events(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer ws.Close()
+	for {
+		if session, ok := h.recorder.Session("current"); ok {
+			if events, cancel, ok := h.recorder.Subscribe("current"); ok {
+				err := h.stream(ws, session, events)
+				cancel()
+				if err != nil {
+					return
+				}
+				continue
+			}
+		}
+		select {
+		case <-ws.closed:
+			return
+		case <-time.After(overlayWaitInterval):
+		}
+	}
+}
+
+// stream sends the session and its events until it ends, failing if the
+// client leaves
+func (h *overlay) stream(ws *webSocket, session Session, events <-chan s4.Event) error {
+	b, _ := json.Marshal(OverlayMessage{Session: &session})
+	if err := ws.WriteText(b); err != nil {
+		return err
+	}
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if !overlayMetrics[event.Metric] {
+				continue
+			}
+			b, _ := json.Marshal(OverlayMessage{Event: &event})
+			if err := ws.WriteText(b); err != nil {
+				return err
+			}
+		case <-ws.closed:
+			return fmt.Errorf("client left")
+		}
+	}
+}
+
+// overlayPage is the overlay, with the fields shown as a JSON array
+const overlayPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>oarsman overlay</title>
+<style>
+html, body { background: transparent; margin: 0; overflow: hidden; }
+body { font-family: "Helvetica Neue", Arial, sans-serif; color: #fff; text-shadow: 0 0 4px #000, 0 0 2px #000; }
+.metric { display: inline-block; min-width: 120px; margin: 8px 16px; text-align: center; vertical-align: top; }
+.value { font-size: 48px; font-weight: bold; }
+.label { font-size: 14px; letter-spacing: 1px; text-transform: uppercase; }
+.bar { width: 240px; height: 14px; margin: 20px auto 12px; border: 2px solid #fff; box-shadow: 0 0 4px #000; }
+.bar div { width: 0; height: 100%%; background: #fff; }
+</style>
+</head>
+<body>
+<div id="overlay"></div>
+<script>
+var fields = %s;
+var labels = {pace: "/500m", spm: "spm", hr: "bpm", distance: "meters", time: "time", watts: "watts", progress: "progress"};
+var metrics = {};
+var session = {}, started = 0, last = 0, distance = 0, interval = 0, phase = "";
+
+fields.forEach(function (field) {
+  var metric = document.createElement("div");
+  metric.className = "metric";
+  metric.innerHTML = field === "progress" ?
+    '<div class="bar"><div></div></div><div class="label"></div>' :
+    '<div class="value">-</div><div class="label"></div>';
+  metric.lastChild.textContent = labels[field];
+  document.getElementById("overlay").appendChild(metric);
+  metrics[field] = metric;
+});
+
+function show(field, text) {
+  if (metrics[field] && field !== "progress") {
+    metrics[field].firstChild.textContent = text;
+  }
+}
+
+function clock(seconds) {
+  seconds = Math.max(0, Math.floor(seconds));
+  var s = seconds %% 60, m = Math.floor(seconds / 60) %% 60, h = Math.floor(seconds / 3600);
+  return (h > 0 ? h + ":" + (m < 10 ? "0" : "") : "") + m + ":" + (s < 10 ? "0" : "") + s;
+}
+
+function progress() {
+  var elapsed = started ? (last - started) / 1000 : 0;
+  show("time", clock(elapsed));
+  if (!metrics.progress) {
+    return;
+  }
+  var done = 0, label = "just row";
+  if (session.distance_meters) {
+    done = distance / session.distance_meters;
+    label = distance + " / " + session.distance_meters + " m";
+  } else if (session.duration_seconds) {
+    done = elapsed / session.duration_seconds;
+    label = clock(elapsed) + " / " + clock(session.duration_seconds);
+  }
+  if (interval) {
+    label = "interval " + interval + " " + phase + (label === "just row" ? "" : ", " + label);
+  }
+  metrics.progress.firstChild.firstChild.style.width = Math.min(100, 100 * done) + "%%";
+  metrics.progress.lastChild.textContent = label;
+}
+
+function receive(message) {
+  if (message.session) {
+    session = message.session;
+    started = 0; last = 0; distance = 0; interval = 0; phase = "";
+    fields.forEach(function (field) { show(field, "-"); });
+    progress();
+    return;
+  }
+  var e = message.event;
+  last = e.time_milliseconds;
+  if (!started && session.state === "started") {
+    // joined while rowing
+    started = e.time_milliseconds;
+  }
+  switch (e.metric) {
+  case "workout_state":
+    if (e.text === "started" && !started) {
+      started = e.time_milliseconds;
+    }
+    break;
+  case "speed_cm_s":
+    show("pace", e.value > 0 ? clock(50000 / e.value) : "-");
+    break;
+  case "stroke_rate":
+    show("spm", e.value);
+    break;
+  case "heart_rate":
+    show("hr", e.value > 0 ? e.value : "-");
+    break;
+  case "watts":
+    show("watts", e.value);
+    break;
+  case "interval":
+    interval = e.value;
+    phase = e.text;
+    break;
+  case "total_distance_meters":
+    distance = e.value;
+    show("distance", e.value);
+    break;
+  }
+  progress();
+}
+
+function connect() {
+  var scheme = location.protocol === "https:" ? "wss://" : "ws://";
+  var ws = new WebSocket(scheme + location.host + "/overlay/events");
+  ws.onmessage = function (m) { receive(JSON.parse(m.data)); };
+  ws.onclose = function () { setTimeout(connect, 2000); };
+}
+connect();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// the wire types of the protobuf encoding
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errInvalidProto = errors.New("invalid protobuf message")
+
+// protoField is a field of a protobuf message, with its value as a varint
+// (also the fixed width values) or as bytes
+type protoField struct {
+	number   int
+	wireType int
+	varint   uint64
+	bytes    []byte
+}
+
+// parseProto parses the fields of a protobuf message, in order. Groups are
+// not supported, as proto3 has none.
+func parseProto(b []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 || key>>3 == 0 || key>>3 > math.MaxInt32 {
+			return nil, errInvalidProto
+		}
+		b = b[n:]
+		field := protoField{number: int(key >> 3), wireType: int(key & 7)}
+		switch field.wireType {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return nil, errInvalidProto
+			}
+			field.varint = v
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return nil, errInvalidProto
+			}
+			field.varint = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return nil, errInvalidProto
+			}
+			field.varint = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		case wireBytes:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || length > uint64(len(b)-n) {
+				return nil, errInvalidProto
+			}
+			field.bytes = b[n : n+int(length)]
+			b = b[n+int(length):]
+		default:
+			return nil, errInvalidProto
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func appendKey(b []byte, number int, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(number)<<3|uint64(wireType))
+}
+
+// the fields with the default value are left out, as in proto3
+
+func appendUintField(b []byte, number int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	return binary.AppendUvarint(appendKey(b, number, wireVarint), v)
+}
+
+func appendIntField(b []byte, number int, v int64) []byte {
+	return appendUintField(b, number, uint64(v))
+}
+
+func appendBoolField(b []byte, number int, v bool) []byte {
+	if !v {
+		return b
+	}
+	return appendUintField(b, number, 1)
+}
+
+func appendDoubleField(b []byte, number int, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	return binary.LittleEndian.AppendUint64(appendKey(b, number, wireFixed64), math.Float64bits(v))
+}
+
+func appendStringField(b []byte, number int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = binary.AppendUvarint(appendKey(b, number, wireBytes), uint64(len(s)))
+	return append(b, s...)
+}
+
+// appendMessageField appends an embedded message, even if empty
+func appendMessageField(b []byte, number int, message []byte) []byte {
+	b = binary.AppendUvarint(appendKey(b, number, wireBytes), uint64(len(message)))
+	return append(b, message...)
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/olympum/oarsman/s4"
+	"net/http"
+	"strings"
+)
+
+// Server serves the oarsman API over HTTP, e.g. on the LAN. The requests
+// changing anything (other than GET, HEAD and OPTIONS) need the bearer
+// token, when set: "Authorization: Bearer <token>".
+type Server struct {
+	Token string
+
+	mux *http.ServeMux
+}
+
+// New returns a server with the token required by the mutating requests,
+// none if empty
+func New(token string) *Server {
+	return &Server{Token: token, mux: http.NewServeMux()}
+}
+
+// Handle registers the handler for the pattern, as http.ServeMux
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s4.Log().Debugf("%s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+	// the gRPC calls are all POST, the ones changing anything check the
+	// token themselves
+	if mutating(r.Method) && !grpcRequest(r) && !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="oarsman"`)
+		writeError(w, http.StatusUnauthorized, "a valid bearer token is required")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves on the address, e.g. ":8080", over TLS when given a
+// certificate and its key, with HTTP/2 for the gRPC clients
+func (s *Server) ListenAndServe(address string, certFile string, keyFile string) error {
+	if certFile != "" {
+		s4.Log().Infof("Serving on https://%s", address)
+		return http.ListenAndServeTLS(address, certFile, keyFile, s)
+	}
+	s4.Log().Infof("Serving on http://%s", address)
+	return http.ListenAndServe(address, s)
+}
+
+func mutating(method string) bool {
+	return method != "GET" && method != "HEAD" && method != "OPTIONS"
+}
+
+// authorized compares the bearer token in constant time, so it cannot be
+// guessed from the response times
+func (s *Server) authorized(r *http.Request) bool {
+	if s.Token == "" {
+		return true
+	}
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s4.Log().Errorf("%v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
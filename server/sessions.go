@@ -0,0 +1,167 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/olympum/oarsman/s4"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Session is a workout recorded by a daemon, in progress or ended
+type Session struct {
+	ID         string `json:"session_id"`
+	State      string `json:"state"`                 // an s4.WorkoutState, e.g. "started"
+	ActivityID int64  `json:"activity_id,omitempty"` // once saved, the start time in milliseconds
+	Error      string `json:"error,omitempty"`       // the failure of the S4 that ended the session
+
+	// the target of the workout, none for just row
+	DistanceMeters  uint64 `json:"distance_meters,omitempty"`
+	DurationSeconds uint64 `json:"duration_seconds,omitempty"`
+}
+
+// WorkoutRequest is a workout started remotely, a single distance or
+// duration, or just row if neither
+type WorkoutRequest struct {
+	DistanceMeters  uint64 `json:"distance_meters,omitempty"`
+	DurationSeconds uint64 `json:"duration_seconds,omitempty"`
+	TankNotes       string `json:"tank_notes,omitempty"`
+}
+
+// Build returns the workout of the request, validated against the limits
+// of the S4
+func (r WorkoutRequest) Build() (s4.S4Workout, error) {
+	builder := s4.NewWorkout()
+	if r.DistanceMeters > 0 {
+		builder.Distance(r.DistanceMeters)
+	}
+	if r.DurationSeconds > 0 {
+		builder.Duration(time.Duration(r.DurationSeconds) * time.Second)
+	}
+	if r.DistanceMeters == 0 && r.DurationSeconds == 0 {
+		builder.JustRow()
+	}
+	return builder.Build()
+}
+
+// Recorder records the sessions, e.g. the daemon
+type Recorder interface {
+	// Start records the workout as the next session, failing if a session
+	// is already being rowed
+	Start(request WorkoutRequest) (Session, error)
+	// Stop ends the session, saving it if rowed
+	Stop(id string) (Session, error)
+	// Session returns the session, or the current one for "current"
+	Session(id string) (Session, bool)
+	// Subscribe taps the live events of the session in progress, as
+	// s4.Subscribe
+	Subscribe(id string) (<-chan s4.Event, func(), bool)
+}
+
+// ErrSessionInProgress is returned when starting a workout while another
+// one is being rowed
+var ErrSessionInProgress = errors.New("a session is in progress")
+
+type sessions struct {
+	recorder Recorder
+}
+
+// Sessions returns the handler of the sessions of the recorder, to be
+// registered on "/sessions" and "/sessions/":
+//
+//	POST /sessions               starts a workout, e.g. {"distance_meters":5000}
+//	GET /sessions/{id}           the session, "current" for the one in progress
+//	DELETE /sessions/{id}        stops the session
+//	GET /sessions/{id}/events    the live events, as server-sent events
+func Sessions(recorder Recorder) http.Handler {
+	return &sessions{recorder: recorder}
+}
+
+func (h *sessions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/sessions"), "/")
+	tokens := strings.Split(path, "/")
+	switch {
+	case path == "" && r.Method == "POST":
+		h.start(w, r)
+	case path == "":
+		writeError(w, http.StatusMethodNotAllowed, r.Method+" not allowed")
+	case len(tokens) == 1 && r.Method == "GET":
+		session, ok := h.recorder.Session(tokens[0])
+		if !ok {
+			writeError(w, http.StatusNotFound, "unknown session "+tokens[0])
+			return
+		}
+		writeJSON(w, http.StatusOK, session)
+	case len(tokens) == 1 && r.Method == "DELETE":
+		session, err := h.recorder.Stop(tokens[0])
+		if err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, session)
+	case len(tokens) == 2 && tokens[1] == "events" && r.Method == "GET":
+		h.events(w, r, tokens[0])
+	default:
+		writeError(w, http.StatusNotFound, "unknown path "+r.URL.Path)
+	}
+}
+
+func (h *sessions) start(w http.ResponseWriter, r *http.Request) {
+	var request WorkoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid workout: "+err.Error())
+		return
+	}
+	if _, err := request.Build(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid workout: "+err.Error())
+		return
+	}
+	session, err := h.recorder.Start(request)
+	if err == ErrSessionInProgress {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, session)
+}
+
+// events streams the live events of the session as server-sent events,
+// one JSON event per message, until the session ends or the client leaves
+func (h *sessions) events(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	events, cancel, ok := h.recorder.Subscribe(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no session "+id+" in progress")
+		return
+	}
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			b, _ := json.Marshal(event)
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", b); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// the key of the WebSocket handshake, RFC 6455 section 1.3
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// the opcodes of the WebSocket frames
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xA
+)
+
+// the largest frame read from a client, which only sends control frames
+const maxClientFrame = 4096
+
+// webSocket is the server side of a WebSocket connection, sending text
+// messages: the messages of the client are discarded, other than the
+// control frames
+type webSocket struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mutex  sync.Mutex
+	closed chan bool // closed once the client leaves
+}
+
+// upgradeWebSocket answers the WebSocket handshake of the request and takes
+// over its connection
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*webSocket, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		return nil, errors.New("not a WebSocket handshake")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("WebSocket not supported")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	h := sha1.Sum([]byte(key + webSocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(h[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	ws := &webSocket{conn: conn, reader: rw.Reader, closed: make(chan bool)}
+	go ws.read()
+	return ws, nil
+}
+
+// WriteText sends a text message
+func (ws *webSocket) WriteText(payload []byte) error {
+	return ws.writeFrame(opText, payload)
+}
+
+func (ws *webSocket) writeFrame(opcode byte, payload []byte) error {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+	header := []byte{0x80 | opcode} // a final frame, unmasked from the server
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126, byte(n>>8), byte(n))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+	if _, err := ws.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// read reads the frames of the client until it closes the connection,
+// answering its pings
+func (ws *webSocket) read() {
+	defer close(ws.closed)
+	defer ws.conn.Close()
+	for {
+		opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case opClose:
+			ws.writeFrame(opClose, payload)
+			return
+		case opPing:
+			ws.writeFrame(opPong, payload)
+		}
+	}
+}
+
+func (ws *webSocket) readFrame() (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(ws.reader, header); err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0F
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		b := make([]byte, 2)
+		if _, err := io.ReadFull(ws.reader, b); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(b))
+	case 127:
+		b := make([]byte, 8)
+		if _, err := io.ReadFull(ws.reader, b); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(b)
+	}
+	if length > maxClientFrame {
+		return 0, nil, errors.New("WebSocket frame too large")
+	}
+	// the frames of the clients are always masked
+	mask := make([]byte, 4)
+	if header[1]&0x80 != 0 {
+		if _, err := io.ReadFull(ws.reader, mask); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
+
+// Close closes the connection, without waiting for the client
+func (ws *webSocket) Close() error {
+	ws.writeFrame(opClose, nil)
+	return ws.conn.Close()
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// clientFrame encodes a final frame of a client, masked if the mask is given,
+// with the length encoded on the extended length if any, 126 or 127
+func clientFrame(opcode byte, payload []byte, mask []byte, extended byte) []byte {
+	frame := []byte{0x80 | opcode, 0}
+	switch {
+	case extended == 126:
+		frame[1] = 126
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	case extended == 127:
+		frame[1] = 127
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	default:
+		frame[1] = byte(len(payload))
+	}
+	if mask == nil {
+		return append(frame, payload...)
+	}
+	frame[1] |= 0x80
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+func TestReadFrame(t *testing.T) {
+	mask := []byte{0x37, 0xFA, 0x21, 0x3D}
+	large := bytes.Repeat([]byte("oarsman"), 300)
+	for _, test := range []struct {
+		about   string
+		frame   []byte
+		opcode  byte
+		payload []byte
+	}{
+		{"masked", clientFrame(opText, []byte("Hello"), mask, 0), opText, []byte("Hello")},
+		{"unmasked", clientFrame(opText, []byte("Hello"), nil, 0), opText, []byte("Hello")},
+		{"empty", clientFrame(opPing, nil, mask, 0), opPing, []byte{}},
+		{"126", clientFrame(opText, large, mask, 126), opText, large},
+		{"127", clientFrame(opText, large, mask, 127), opText, large},
+		{"125 on 126", clientFrame(opText, large[:125], nil, 126), opText, large[:125]},
+		{"largest", clientFrame(opText, large[:maxClientFrame/2], mask, 127), opText, large[:maxClientFrame/2]},
+		{"close", clientFrame(opClose, []byte{0x03, 0xE8}, mask, 0), opClose, []byte{0x03, 0xE8}},
+	} {
+		// followed by another frame, read next
+		b := append(test.frame, clientFrame(opPing, []byte("next"), mask, 0)...)
+		ws := &webSocket{reader: bufio.NewReader(bytes.NewReader(b))}
+		opcode, payload, err := ws.readFrame()
+		if err != nil || opcode != test.opcode || !bytes.Equal(payload, test.payload) {
+			t.Errorf("%s: read %X %q (%v), want %X %q", test.about, opcode, payload, err, test.opcode, test.payload)
+			continue
+		}
+		if opcode, payload, err := ws.readFrame(); err != nil || opcode != opPing || string(payload) != "next" {
+			t.Errorf("%s: read next %X %q (%v)", test.about, opcode, payload, err)
+		}
+	}
+}
+
+func TestReadFrameInvalid(t *testing.T) {
+	mask := []byte{0x37, 0xFA, 0x21, 0x3D}
+	for _, test := range []struct {
+		about string
+		frame []byte
+	}{
+		{"empty", nil},
+		{"header cut", []byte{0x81}},
+		{"126 cut", []byte{0x81, 0xFE, 0x00}},
+		{"127 cut", []byte{0x81, 0xFF, 0, 0, 0, 0, 0, 0, 0x10}},
+		{"mask cut", []byte{0x81, 0x85, 0x37, 0xFA}},
+		{"payload cut", clientFrame(opText, []byte("Hello"), mask, 0)[:9]},
+		{"oversized 126", clientFrame(opText, make([]byte, maxClientFrame+1), mask, 126)},
+		{"oversized 127", clientFrame(opText, make([]byte, maxClientFrame+1), mask, 127)},
+		// not allocated, the length is checked first
+		{"127 huge", []byte{0x81, 0xFF, 0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+		{"127 negative", []byte{0x81, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
+	} {
+		ws := &webSocket{reader: bufio.NewReader(bytes.NewReader(test.frame))}
+		if opcode, payload, err := ws.readFrame(); err == nil {
+			t.Errorf("%s: read %X %q", test.about, opcode, payload)
+		}
+	}
+}
+
+func TestWebSocketRead(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	ws := &webSocket{conn: server, reader: bufio.NewReader(server), closed: make(chan bool)}
+	go ws.read()
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// a ping is answered, the messages are discarded
+	mask := []byte{0x37, 0xFA, 0x21, 0x3D}
+	go client.Write(append(clientFrame(opText, []byte("ignored"), mask, 0), clientFrame(opPing, []byte("ping"), mask, 0)...))
+	reply := make([]byte, 6)
+	if _, err := client.Read(reply); err != nil || string(reply) != "\x8A\x04ping" {
+		t.Fatalf("ping answered %q (%v)", reply, err)
+	}
+
+	// and a close echoed, closing the connection
+	go client.Write(clientFrame(opClose, []byte{0x03, 0xE8}, mask, 0))
+	if _, err := client.Read(reply); err != nil || string(reply[:4]) != "\x88\x02\x03\xE8" {
+		t.Fatalf("close answered %q (%v)", reply, err)
+	}
+	select {
+	case <-ws.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("WebSocket not closed by the client")
+	}
+}
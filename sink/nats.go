@@ -0,0 +1,142 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/olympum/oarsman/s4"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the time to wait before connecting again to an unreachable server, so
+// that publishing does not slow down the workout
+const natsRetryInterval = 5 * time.Second
+
+// ErrUnreachable is returned by Publish without trying to connect, while
+// waiting to connect again after the server was found unreachable: the
+// failure to connect was already returned
+var ErrUnreachable = errors.New("NATS server unreachable")
+
+// NATS publishes messages to a NATS server, e.g. "nats://localhost:4222" or
+// "nats://token@host:4222", connecting again as needed
+type NATS struct {
+	url *url.URL
+
+	mutex   sync.Mutex
+	conn    net.Conn
+	retryAt time.Time
+}
+
+// NewNATS returns the publisher to the server of the URL, connected on the
+// first message
+func NewNATS(server string) (*NATS, error) {
+	if !strings.Contains(server, "://") {
+		server = "nats://" + server
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "nats" {
+		return nil, fmt.Errorf("unsupported scheme %s, e.g. nats://localhost:4222", u.Scheme)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	return &NATS{url: u}, nil
+}
+
+// Publish sends the message on the subject, at most once: messages are
+// dropped while the server is unreachable, with ErrUnreachable
+func (n *NATS) Publish(subject string, payload []byte) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.conn == nil {
+		if time.Now().Before(n.retryAt) {
+			return ErrUnreachable
+		}
+		if err := n.connect(); err != nil {
+			n.retryAt = time.Now().Add(natsRetryInterval)
+			return err
+		}
+	}
+	n.conn.SetWriteDeadline(time.Now().Add(natsRetryInterval))
+	if _, err := fmt.Fprintf(n.conn, "PUB %s %d\r\n%s\r\n", subject, len(payload), payload); err != nil {
+		n.conn.Close()
+		n.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Close closes the connection to the server
+func (n *NATS) Close() error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.conn == nil {
+		return nil
+	}
+	err := n.conn.Close()
+	n.conn = nil
+	return err
+}
+
+// connect reads the INFO of the server and sends the CONNECT, with the
+// credentials of the URL if any
+func (n *NATS) connect() error {
+	conn, err := net.DialTimeout("tcp", n.url.Host, natsRetryInterval)
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(natsRetryInterval))
+	info, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(info, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("no NATS server at %s", n.url.Host)
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	options := map[string]interface{}{"verbose": false, "pedantic": false, "name": "oarsman", "lang": "go"}
+	if user := n.url.User; user != nil {
+		if password, ok := user.Password(); ok {
+			options["user"] = user.Username()
+			options["pass"] = password
+		} else {
+			options["auth_token"] = user.Username()
+		}
+	}
+	b, _ := json.Marshal(options)
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\n", b); err != nil {
+		conn.Close()
+		return err
+	}
+	n.conn = conn
+	go n.serve(conn, reader)
+	s4.Log().Infof("Connected to the NATS server %s", n.url.Host)
+	return nil
+}
+
+// serve answers the PINGs of the server, which otherwise closes the
+// connection, and logs its errors
+func (n *NATS) serve(conn net.Conn, reader *bufio.Reader) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch {
+		case strings.HasPrefix(line, "PING"):
+			n.mutex.Lock()
+			conn.Write([]byte("PONG\r\n"))
+			n.mutex.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			s4.Log().Errorf("NATS server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
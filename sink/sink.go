@@ -0,0 +1,55 @@
+package sink
+
+import (
+	"encoding/json"
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/s4"
+)
+
+// Publisher sends a message on a subject (or topic) of a message broker,
+// e.g. to feed a data lake or a gym processing several rowers centrally
+type Publisher interface {
+	Publish(subject string, payload []byte) error
+}
+
+// LiveMetrics are the metrics published live, leaving out the pulses and
+// strokes of the 25 ms resolution
+var LiveMetrics = []s4.Metric{
+	s4.MetricWorkoutState,
+	s4.MetricTotalDistance,
+	s4.MetricStrokeRate,
+	s4.MetricWatts,
+	s4.MetricCalories,
+	s4.MetricSpeed,
+	s4.MetricHeartRate,
+}
+
+// PublishEvents publishes the events on the subject prefix + ".live" as
+// JSON, until the events end, as subscribed with s4.Subscribe for the
+// LiveMetrics. The first failure is logged, the next ones until the
+// publisher recovers are not, nor are the events dropped with
+// ErrUnreachable.
+func PublishEvents(publisher Publisher, prefix string, events <-chan s4.Event) {
+	failing := false
+	for event := range events {
+		b, _ := json.Marshal(event)
+		err := publisher.Publish(prefix+".live", b)
+		if err == ErrUnreachable {
+			continue
+		}
+		if err != nil && !failing {
+			s4.Log().Errorf("Could not publish the live events: %v", err)
+		}
+		failing = err != nil
+	}
+}
+
+// PublishActivity publishes the activity completed, with its laps, on the
+// subject prefix + ".activities" as JSON
+func PublishActivity(publisher Publisher, prefix string, activity *collector.Activity) error {
+	b, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+	return publisher.Publish(prefix+".activities", b)
+}
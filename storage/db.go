@@ -0,0 +1,973 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/olympum/oarsman/collector"
+	"github.com/olympum/oarsman/s4"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var fields = `
+start_time_milliseconds,
+start_time_seconds,
+start_time_zulu,
+parent_start_time_milliseconds,
+total_time_seconds,
+distance_meters,
+maximum_speed_m_s,
+average_speed_m_s,
+kcalories,
+average_heart_rate_bpm,
+maximum_heart_rate_bpm,
+average_cadence_rpm,
+maximum_cadence_rpm,
+average_power_watts,
+maximum_power_watts,
+rest
+`
+
+// columns only meaningful for activities, laps keep the defaults
+var activityFields = `,
+recovered,
+timezone,
+tank_notes,
+pre_roll_milliseconds,
+monitor_model,
+firmware_version,
+serial_device,
+oarsman_version,
+memory_map_revision,
+decoupling_percent,
+auto_intervals,
+training_load,
+difficulty_score,
+odometer_meters,
+source,
+workout,
+notes,
+tags
+`
+
+var insertString = `
+
+INSERT INTO activity
+(` + fields + activityFields +
+	`)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+
+
+`
+
+var deleteString = `
+
+DELETE FROM activity
+WHERE start_time_milliseconds = ?
+
+`
+
+var deleteLapsString = `
+
+DELETE FROM activity
+WHERE parent_start_time_milliseconds = ?
+
+`
+
+var updateAutoIntervalsString = `
+
+UPDATE activity
+SET auto_intervals = ?
+WHERE parent_start_time_milliseconds = -1
+AND start_time_milliseconds = ?
+
+`
+
+var updateTrainingLoadString = `
+
+UPDATE activity
+SET training_load = ?
+WHERE parent_start_time_milliseconds = -1
+AND start_time_milliseconds = ?
+
+`
+
+var updateDifficultyString = `
+
+UPDATE activity
+SET difficulty_score = ?
+WHERE parent_start_time_milliseconds = -1
+AND start_time_milliseconds = ?
+
+`
+
+var updateNotesString = `
+
+UPDATE activity
+SET notes = ?, tags = ?
+WHERE parent_start_time_milliseconds = -1
+AND start_time_milliseconds = ?
+
+`
+
+var insertSearchString = `
+
+INSERT INTO activity_search
+(docid, workout, notes, tags, tank_notes)
+VALUES (?, ?, ?, ?, ?)
+
+`
+
+var updateSearchString = `
+
+UPDATE activity_search
+SET notes = ?, tags = ?
+WHERE docid = ?
+
+`
+
+var deleteSearchString = `
+
+DELETE FROM activity_search
+WHERE docid = ?
+
+`
+
+var deleteFitnessString = `
+
+DELETE FROM fitness
+
+`
+
+var insertFitnessString = `
+
+INSERT INTO fitness
+(date, load, fitness, fatigue, form)
+VALUES (?, ?, ?, ?, ?)
+
+`
+
+var selectFitnessString = `
+
+SELECT date, load, fitness, fatigue, form
+FROM fitness
+ORDER BY date
+
+`
+
+var deleteStrokesString = `
+
+DELETE FROM stroke
+WHERE activity_start_time_milliseconds = ?
+
+`
+
+var insertStrokeString = `
+
+INSERT INTO stroke
+(activity_start_time_milliseconds, start_time_milliseconds, drive_milliseconds, speeds_m_s)
+VALUES (?, ?, ?, ?)
+
+`
+
+var selectStrokesString = `
+
+SELECT start_time_milliseconds, drive_milliseconds, speeds_m_s
+FROM stroke
+WHERE activity_start_time_milliseconds = ?
+ORDER BY start_time_milliseconds
+
+`
+
+var deleteEffortsString = `
+
+DELETE FROM effort
+WHERE activity_start_time_milliseconds = ?
+
+`
+
+var insertEffortString = `
+
+INSERT INTO effort
+(activity_start_time_milliseconds, distance_meters, milliseconds)
+VALUES (?, ?, ?)
+
+`
+
+var selectBestEffortsString = `
+
+SELECT activity_start_time_milliseconds, distance_meters, MIN(milliseconds)
+FROM effort
+GROUP BY distance_meters
+ORDER BY distance_meters
+
+`
+
+var selectEffortActivitiesString = `
+
+SELECT DISTINCT activity_start_time_milliseconds
+FROM effort
+
+`
+
+var selectAllActivitiesString = `
+
+SELECT` + fields + activityFields + `
+FROM activity
+WHERE parent_start_time_milliseconds = -1
+ORDER BY start_time_milliseconds
+
+`
+
+var selectActivityString = `
+
+SELECT` + fields + activityFields + `
+FROM activity
+WHERE parent_start_time_milliseconds = -1
+AND start_time_milliseconds = ?
+
+`
+var selectSearchString = `
+
+SELECT` + fields + activityFields + `
+FROM activity
+WHERE parent_start_time_milliseconds = -1
+AND start_time_milliseconds IN (
+SELECT docid FROM activity_search WHERE activity_search MATCH ?
+)
+ORDER BY start_time_milliseconds DESC
+
+`
+
+var selectAllLapsString = `
+
+SELECT` + fields + `
+FROM activity
+WHERE parent_start_time_milliseconds = ?
+ORDER BY start_time_milliseconds
+
+`
+
+var createTableString = `
+
+CREATE TABLE activity (
+start_time_milliseconds INTEGER,
+start_time_seconds INTEGER,
+start_time_zulu VARCHAR,
+parent_start_time_milliseconds INTEGER,
+total_time_seconds INTEGER,
+distance_meters INTEGER,
+maximum_speed_m_s REAL,
+average_speed_m_s REAL,
+kcalories INTEGER,
+average_heart_rate_bpm INTEGER,
+maximum_heart_rate_bpm INTEGER,
+average_cadence_rpm INTEGER,
+maximum_cadence_rpm INTEGER,
+average_power_watts INTEGER,
+maximum_power_watts INTEGER
+);
+
+`
+
+// migrations are applied in order on top of the original table schema, the
+// database user_version records how many have been applied
+var migrations = []string{
+	`ALTER TABLE activity ADD COLUMN recovered INTEGER DEFAULT 0`,
+	`ALTER TABLE activity ADD COLUMN timezone VARCHAR DEFAULT ''`,
+	`ALTER TABLE activity ADD COLUMN pre_roll_milliseconds INTEGER DEFAULT 0`,
+	`ALTER TABLE activity ADD COLUMN monitor_model INTEGER DEFAULT 0`,
+	`ALTER TABLE activity ADD COLUMN firmware_version VARCHAR DEFAULT ''`,
+	`ALTER TABLE activity ADD COLUMN serial_device VARCHAR DEFAULT ''`,
+	`ALTER TABLE activity ADD COLUMN oarsman_version VARCHAR DEFAULT ''`,
+	`ALTER TABLE activity ADD COLUMN memory_map_revision INTEGER DEFAULT 0`,
+	// activities are the rows without a parent, so listing them, finding one
+	// by id and finding the laps of one are all lookups on this index instead
+	// of scans of every lap recorded
+	`CREATE INDEX IF NOT EXISTS activity_parent ON activity (parent_start_time_milliseconds, start_time_milliseconds)`,
+	`ALTER TABLE activity ADD COLUMN tank_notes VARCHAR DEFAULT ''`,
+	`ALTER TABLE activity ADD COLUMN rest INTEGER DEFAULT 0`,
+	// the speeds of a stroke every 25 ms, in m/s separated by commas
+	`CREATE TABLE IF NOT EXISTS stroke (
+activity_start_time_milliseconds INTEGER,
+start_time_milliseconds INTEGER,
+drive_milliseconds INTEGER,
+speeds_m_s VARCHAR
+)`,
+	`CREATE INDEX IF NOT EXISTS stroke_activity ON stroke (activity_start_time_milliseconds, start_time_milliseconds)`,
+	`ALTER TABLE activity ADD COLUMN decoupling_percent REAL DEFAULT 0`,
+	`ALTER TABLE activity ADD COLUMN auto_intervals INTEGER DEFAULT 0`,
+	`ALTER TABLE activity ADD COLUMN training_load REAL DEFAULT 0`,
+	// the daily fitness, fatigue and form, recomputed from the training load
+	// of the activities whenever one is saved
+	`CREATE TABLE IF NOT EXISTS fitness (
+date VARCHAR PRIMARY KEY,
+load REAL,
+fitness REAL,
+fatigue REAL,
+form REAL
+)`,
+	`ALTER TABLE activity ADD COLUMN difficulty_score REAL DEFAULT 0`,
+	`ALTER TABLE activity ADD COLUMN odometer_meters INTEGER DEFAULT 0`,
+	// the fastest time over each distance within an activity
+	`CREATE TABLE IF NOT EXISTS effort (
+activity_start_time_milliseconds INTEGER,
+distance_meters INTEGER,
+milliseconds INTEGER
+)`,
+	`CREATE INDEX IF NOT EXISTS effort_activity ON effort (activity_start_time_milliseconds)`,
+	`ALTER TABLE activity ADD COLUMN source VARCHAR DEFAULT ''`,
+	`ALTER TABLE activity ADD COLUMN workout VARCHAR DEFAULT ''`,
+	`ALTER TABLE activity ADD COLUMN notes VARCHAR DEFAULT ''`,
+	`ALTER TABLE activity ADD COLUMN tags VARCHAR DEFAULT ''`,
+	// the full-text index of the words of the activities, by id
+	`CREATE VIRTUAL TABLE IF NOT EXISTS activity_search USING fts4(workout, notes, tags, tank_notes)`,
+	`INSERT INTO activity_search (docid, workout, notes, tags, tank_notes)
+SELECT start_time_milliseconds, workout, notes, tags, tank_notes
+FROM activity
+WHERE parent_start_time_milliseconds = -1`,
+}
+
+type OarsmanDB struct {
+	odb *sql.DB
+}
+
+func (db *OarsmanDB) Close() error {
+	return db.odb.Close()
+}
+
+func (db *OarsmanDB) CreateTables() error {
+	_, err := db.odb.Exec(createTableString)
+	if err != nil {
+		s4.Log().Errorf("%q: %s\n", err, createTableString)
+		return err
+	}
+
+	s4.Log().Infof("Created table schema")
+
+	return nil
+}
+
+// InitializeDatabase creates and migrates the tables, failing when the
+// database cannot be read, as it is only opened on its first query
+func (db *OarsmanDB) InitializeDatabase() error {
+	q := `SELECT name FROM sqlite_master WHERE type='table' AND name='activity'`
+	var name string
+	err := db.odb.QueryRow(q).Scan(&name)
+	switch {
+	case err == sql.ErrNoRows:
+		s4.Log().Infof("Initializing database for the first time ...")
+		e := db.CreateTables()
+		if e != nil {
+			s4.Log().Errorf("%v", e)
+			return e
+		}
+	case err != nil:
+		s4.Log().Errorf("%v", err)
+		return err
+	default:
+		s4.Log().Debugf("Activity table alreay exists in database")
+	}
+
+	e := db.migrate()
+	if e != nil {
+		s4.Log().Errorf("%v", e)
+	}
+	return e
+}
+
+func (db *OarsmanDB) migrate() error {
+	var version int
+	err := db.odb.QueryRow(`PRAGMA user_version`).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	for ; version < len(migrations); version++ {
+		s4.Log().Infof("Migrating database to version %d\n", version+1)
+		_, err := db.odb.Exec(migrations[version])
+		if err != nil {
+			s4.Log().Errorf("%q: %s\n", err, migrations[version])
+			return err
+		}
+		_, err = db.odb.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsMigrated returns whether the tables are migrated to this version, so
+// that a database opened read-only can be queried
+func (db *OarsmanDB) IsMigrated() (bool, error) {
+	var version int
+	if err := db.odb.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return false, err
+	}
+	return version >= len(migrations), nil
+}
+
+func (db *OarsmanDB) ListActivities() []*collector.Activity {
+	s4.Log().Debugf("%v", selectAllActivitiesString)
+	rows, err := db.odb.Query(selectAllActivitiesString)
+	if err != nil {
+		s4.Log().Errorf("%v", err)
+		return nil
+	}
+	activities := parseActivities(rows)
+
+	if len(activities) == 0 {
+		s4.Log().Debugf("No activities found")
+		return nil
+	}
+	return activities
+}
+
+func (db *OarsmanDB) FindActivityById(id int64) *collector.Activity {
+	s4.Log().Debugf("Looking for activity %d", id)
+	rows, err := db.odb.Query(selectActivityString, id)
+	if err != nil {
+		s4.Log().Errorf("%v", err)
+		return nil
+	}
+	activities := parseActivities(rows)
+	if len(activities) > 0 {
+		s4.Log().Debugf("Activity %d found", id)
+		return activities[0]
+	} else {
+		s4.Log().Debugf("Activity %d not found", id)
+		return nil
+	}
+}
+
+func (db *OarsmanDB) FindLapsByParentId(id int64) []*collector.Lap {
+	s4.Log().Debugf("Looking for laps for activity %d", id)
+	rows, err := db.odb.Query(selectAllLapsString, id)
+	if err != nil {
+		s4.Log().Errorf("%v", err)
+		return nil
+	}
+	laps := parseLaps(rows)
+	if len(laps) > 0 {
+		s4.Log().Debugf("Laps for activity %d found", id)
+		return laps
+	} else {
+		s4.Log().Debugf("Laps for activity %d not found", id)
+		return nil
+	}
+}
+
+// RemoveActivityById removes the activity with its laps, strokes, efforts
+// and search index, all or nothing, returning it, nil if not found or not
+// removed
+func (db *OarsmanDB) RemoveActivityById(id int64) *collector.Activity {
+	s4.Log().Debugf("Removing activity %d", id)
+	activity := db.FindActivityById(id)
+	if activity == nil {
+		return nil
+	}
+	if err := db.removeActivity(id); err != nil {
+		s4.Log().Errorf("%v", err)
+		return nil
+	}
+	s4.Log().Infof("Activity %d deleted", activity.StartTimeMilliseconds)
+	return activity
+}
+
+func (db *OarsmanDB) removeActivity(id int64) error {
+	tx, err := db.odb.Begin()
+	if err != nil {
+		return err
+	}
+	for _, q := range []string{deleteString, deleteLapsString, deleteStrokesString, deleteEffortsString, deleteSearchString} {
+		if _, err := tx.Exec(q, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func parseLaps(rows *sql.Rows) []*collector.Lap {
+	laps := []*collector.Lap{}
+	for rows.Next() {
+
+		lap := collector.NewLap()
+		var id int64
+
+		rows.Scan(&lap.StartTimeMilliseconds,
+			&lap.StartTimeSeconds,
+			&lap.StartTimeZulu,
+			&id,
+			&lap.TotalTimeSeconds,
+			&lap.DistanceMeters,
+			&lap.MaximumSpeedMs,
+			&lap.AverageSpeedMs,
+			&lap.KCalories,
+			&lap.AverageHeartRateBpm,
+			&lap.MaximumHeartRateBpm,
+			&lap.AverageCadenceRpm,
+			&lap.MaximumCadenceRpm,
+			&lap.AveragePowerWatts,
+			&lap.MaximumPowerWatts,
+			&lap.Rest,
+		)
+
+		s4.Log().Debugf("Parsed lap with %v start time, parent id %v: %v", lap.StartTimeMilliseconds, id, lap)
+
+		laps = append(laps, &lap)
+	}
+	s4.Log().Debugf("Laps parsed %v", len(laps))
+	return laps
+}
+
+func parseActivities(rows *sql.Rows) []*collector.Activity {
+	activities := []*collector.Activity{}
+	for rows.Next() {
+
+		lap := collector.NewLap()
+		var id int64
+		var recovered bool
+		var timezone string
+		var tankNotes string
+		var preRoll int64
+		var device s4.Device
+		var decoupling float64
+		var autoIntervals bool
+		var load float64
+		var difficulty float64
+		var source string
+		var workout string
+		var notes string
+		var tags string
+
+		rows.Scan(&lap.StartTimeMilliseconds,
+			&lap.StartTimeSeconds,
+			&lap.StartTimeZulu,
+			&id,
+			&lap.TotalTimeSeconds,
+			&lap.DistanceMeters,
+			&lap.MaximumSpeedMs,
+			&lap.AverageSpeedMs,
+			&lap.KCalories,
+			&lap.AverageHeartRateBpm,
+			&lap.MaximumHeartRateBpm,
+			&lap.AverageCadenceRpm,
+			&lap.MaximumCadenceRpm,
+			&lap.AveragePowerWatts,
+			&lap.MaximumPowerWatts,
+			&lap.Rest,
+			&recovered,
+			&timezone,
+			&tankNotes,
+			&preRoll,
+			&device.Model,
+			&device.Firmware,
+			&device.SerialDevice,
+			&device.Version,
+			&device.MemoryMapRevision,
+			&decoupling,
+			&autoIntervals,
+			&load,
+			&difficulty,
+			&device.OdometerMeters,
+			&source,
+			&workout,
+			&notes,
+			&tags,
+		)
+
+		activity := collector.NewActivity(&lap, nil)
+		activity.Recovered = recovered
+		activity.Timezone = timezone
+		activity.TankNotes = tankNotes
+		activity.PreRollMilliseconds = preRoll
+		activity.Device = device
+		activity.DecouplingPercent = decoupling
+		activity.AutoIntervals = autoIntervals
+		activity.TrainingLoad = load
+		activity.DifficultyScore = difficulty
+		activity.Source = source
+		activity.Workout = workout
+		activity.Notes = notes
+		activity.Tags = collector.ParseTags(tags)
+		s4.Log().Debugf("Converted lap into activity %v", activity)
+
+		activities = append(activities, activity)
+	}
+	s4.Log().Debugf("Activities parsed %v", len(activities))
+	return activities
+}
+
+func (db *OarsmanDB) InsertActivity(activity *collector.Activity) *collector.Activity {
+
+	if db.FindActivityById(activity.StartTimeMilliseconds) != nil {
+		s4.Log().Errorf("Activity already exists in database, ignoring %d\n", activity.StartTimeMilliseconds)
+		return nil
+	}
+
+	// the activity and its laps are inserted all or nothing
+	tx, err := db.odb.Begin()
+	if err != nil {
+		s4.Log().Errorf("Could not insert activity with id %v into database: %v", activity.StartTimeMilliseconds, err)
+		return nil
+	}
+
+	result, err := tx.Exec(insertString,
+		activity.StartTimeMilliseconds,
+		activity.StartTimeSeconds,
+		activity.StartTimeZulu,
+		-1,
+		activity.TotalTimeSeconds,
+		activity.DistanceMeters,
+		activity.MaximumSpeedMs,
+		activity.AverageSpeedMs,
+		activity.KCalories,
+		activity.AverageHeartRateBpm,
+		activity.MaximumHeartRateBpm,
+		activity.AverageCadenceRpm,
+		activity.MaximumCadenceRpm,
+		activity.AveragePowerWatts,
+		activity.MaximumPowerWatts,
+		false,
+		activity.Recovered,
+		activity.Timezone,
+		activity.TankNotes,
+		activity.PreRollMilliseconds,
+		activity.Device.Model,
+		activity.Device.Firmware,
+		activity.Device.SerialDevice,
+		activity.Device.Version,
+		activity.Device.MemoryMapRevision,
+		activity.DecouplingPercent,
+		activity.AutoIntervals,
+		activity.TrainingLoad,
+		activity.DifficultyScore,
+		activity.Device.OdometerMeters,
+		activity.Source,
+		activity.Workout,
+		activity.Notes,
+		strings.Join(activity.Tags, ","),
+	)
+	if err == nil {
+		_, err = tx.Exec(insertSearchString,
+			activity.StartTimeMilliseconds,
+			activity.Workout,
+			activity.Notes,
+			strings.Join(activity.Tags, ","),
+			activity.TankNotes)
+	}
+	if err != nil {
+		s4.Log().Errorf("Could not insert activity with id %v into database: %v", activity.StartTimeMilliseconds, err)
+		tx.Rollback()
+		return nil
+	}
+	if err := insertLaps(tx, activity); err != nil {
+		s4.Log().Errorf("Could not insert lap in the database %v", err)
+		tx.Rollback()
+		return nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		s4.Log().Errorf("Could not insert activity with id %v into database: %v", activity.StartTimeMilliseconds, err)
+		return nil
+	}
+
+	s4.Log().Debugf("Inserted activity %v", activity, result)
+
+	return activity
+}
+
+// ReplaceLaps saves the laps of an activity in place of those saved before,
+// e.g. the intervals detected in a just row session
+func (db *OarsmanDB) ReplaceLaps(activity *collector.Activity) error {
+	tx, err := db.odb.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(deleteLapsString, activity.StartTimeMilliseconds); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := insertLaps(tx, activity); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(updateAutoIntervalsString, activity.AutoIntervals, activity.StartTimeMilliseconds); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s4.Log().Debugf("Replaced the laps of activity %d with %d laps", activity.StartTimeMilliseconds, len(activity.Laps()))
+	return nil
+}
+
+// insertLaps inserts the laps of an activity in the transaction
+func insertLaps(tx *sql.Tx, activity *collector.Activity) error {
+	for _, lap := range activity.Laps() {
+		result, err := tx.Exec(insertString,
+			lap.StartTimeMilliseconds,
+			lap.StartTimeSeconds,
+			lap.StartTimeZulu,
+			activity.StartTimeMilliseconds,
+			lap.TotalTimeSeconds,
+			lap.DistanceMeters,
+			lap.MaximumSpeedMs,
+			lap.AverageSpeedMs,
+			lap.KCalories,
+			lap.AverageHeartRateBpm,
+			lap.MaximumHeartRateBpm,
+			lap.AverageCadenceRpm,
+			lap.MaximumCadenceRpm,
+			lap.AveragePowerWatts,
+			lap.MaximumPowerWatts,
+			lap.Rest,
+			false,
+			"",
+			"",
+			0,
+			0,
+			"",
+			"",
+			"",
+			0,
+			0,
+			false,
+			0,
+			0,
+			0,
+			"",
+			"",
+			"",
+			"",
+		)
+		if err != nil {
+			return err
+		}
+		s4.Log().Debugf("Inserted lap %v", lap, result)
+	}
+	return nil
+}
+
+// UpdateTrainingLoad saves the training load of an activity, e.g. of an
+// activity saved before the training load was
+func (db *OarsmanDB) UpdateTrainingLoad(id int64, load float64) error {
+	_, err := db.odb.Exec(updateTrainingLoadString, load, id)
+	return err
+}
+
+// UpdateNotes saves the notes and tags of an activity in place of those
+// saved before, and indexes them for SearchActivities
+func (db *OarsmanDB) UpdateNotes(id int64, notes string, tags []string) error {
+	tx, err := db.odb.Begin()
+	if err != nil {
+		return err
+	}
+	joined := strings.Join(tags, ",")
+	if _, err := tx.Exec(updateNotesString, notes, joined, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(updateSearchString, notes, joined, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// SearchActivities returns the activities whose workout name, notes, tags
+// or tank notes have all the words of the query, or words starting with
+// them, e.g. "threshold 8x500", the latest first
+func (db *OarsmanDB) SearchActivities(query string) ([]*collector.Activity, error) {
+	terms := []string{}
+	for _, word := range strings.Fields(query) {
+		// each word as a prefix phrase, so that the syntax of the full-text
+		// queries is taken literally
+		if word = strings.Replace(word, `"`, "", -1); word != "" {
+			terms = append(terms, `"`+word+`*"`)
+		}
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("nothing to search for")
+	}
+	rows, err := db.odb.Query(selectSearchString, strings.Join(terms, " "))
+	if err != nil {
+		return nil, err
+	}
+	return parseActivities(rows), nil
+}
+
+// UpdateDifficulty saves the difficulty of an activity, e.g. once its
+// intervals are detected
+func (db *OarsmanDB) UpdateDifficulty(id int64, difficulty float64) error {
+	_, err := db.odb.Exec(updateDifficultyString, difficulty, id)
+	return err
+}
+
+// ReplaceFitness saves the daily fitness, fatigue and form in place of those
+// saved before
+func (db *OarsmanDB) ReplaceFitness(series []collector.Fitness) error {
+	tx, err := db.odb.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(deleteFitnessString); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, f := range series {
+		if _, err := tx.Exec(insertFitnessString, f.Date.Format("2006-01-02"), f.Load, f.Fitness, f.Fatigue, f.Form); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s4.Log().Debugf("Saved the fitness of %d days", len(series))
+	return nil
+}
+
+// FindFitness returns the daily fitness, fatigue and form saved, in date
+// order, the dates in location
+func (db *OarsmanDB) FindFitness(location *time.Location) []collector.Fitness {
+	rows, err := db.odb.Query(selectFitnessString)
+	if err != nil {
+		s4.Log().Errorf("%v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	series := []collector.Fitness{}
+	for rows.Next() {
+		var f collector.Fitness
+		var date string
+		if err := rows.Scan(&date, &f.Load, &f.Fitness, &f.Fatigue, &f.Form); err != nil {
+			s4.Log().Errorf("%v", err)
+			return nil
+		}
+		f.Date, _ = time.ParseInLocation("2006-01-02", date, location)
+		series = append(series, f)
+	}
+	return series
+}
+
+// InsertStrokes saves the stroke profiles of an activity, replacing those
+// saved before
+func (db *OarsmanDB) InsertStrokes(id int64, strokes []collector.StrokeProfile) error {
+	tx, err := db.odb.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(deleteStrokesString, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, stroke := range strokes {
+		speeds := make([]string, len(stroke.Speeds))
+		for i, v := range stroke.Speeds {
+			speeds[i] = strconv.FormatFloat(v, 'f', 3, 64)
+		}
+		if _, err := tx.Exec(insertStrokeString, id, stroke.StartTimeMilliseconds, stroke.DriveMilliseconds, strings.Join(speeds, ",")); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s4.Log().Debugf("Inserted %d strokes of activity %d", len(strokes), id)
+	return nil
+}
+
+// InsertEfforts saves the best efforts of an activity, replacing those saved
+// before
+func (db *OarsmanDB) InsertEfforts(id int64, efforts []collector.Effort) error {
+	tx, err := db.odb.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(deleteEffortsString, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, effort := range efforts {
+		if _, err := tx.Exec(insertEffortString, id, effort.DistanceMeters, effort.Milliseconds); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// FindBestEfforts returns the fastest effort over each distance across all
+// the activities, by distance
+func (db *OarsmanDB) FindBestEfforts() []collector.Effort {
+	rows, err := db.odb.Query(selectBestEffortsString)
+	if err != nil {
+		s4.Log().Errorf("%v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	efforts := []collector.Effort{}
+	for rows.Next() {
+		var effort collector.Effort
+		if err := rows.Scan(&effort.StartTimeMilliseconds, &effort.DistanceMeters, &effort.Milliseconds); err != nil {
+			s4.Log().Errorf("%v", err)
+			return nil
+		}
+		efforts = append(efforts, effort)
+	}
+	return efforts
+}
+
+// FindEffortActivityIds returns the ids of the activities whose best efforts
+// are saved
+func (db *OarsmanDB) FindEffortActivityIds() map[int64]bool {
+	ids := map[int64]bool{}
+	rows, err := db.odb.Query(selectEffortActivitiesString)
+	if err != nil {
+		s4.Log().Errorf("%v", err)
+		return ids
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if rows.Scan(&id) == nil {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// FindStrokesByActivityId returns the stroke profiles of an activity, nil if
+// none were saved
+func (db *OarsmanDB) FindStrokesByActivityId(id int64) []collector.StrokeProfile {
+	rows, err := db.odb.Query(selectStrokesString, id)
+	if err != nil {
+		s4.Log().Errorf("%v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var strokes []collector.StrokeProfile
+	for rows.Next() {
+		var stroke collector.StrokeProfile
+		var speeds string
+		if err := rows.Scan(&stroke.StartTimeMilliseconds, &stroke.DriveMilliseconds, &speeds); err != nil {
+			s4.Log().Errorf("%v", err)
+			return nil
+		}
+		for _, token := range strings.Split(speeds, ",") {
+			v, _ := strconv.ParseFloat(token, 64)
+			stroke.Speeds = append(stroke.Speeds, v)
+		}
+		strokes = append(strokes, stroke)
+	}
+	return strokes
+}
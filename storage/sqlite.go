@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/olympum/oarsman/s4"
+	"os"
+	"path/filepath"
+)
+
+var dbName = "oarsman.db"
+
+func OpenDatabase(workingFolder string) (*OarsmanDB, error) {
+	_, err := os.Stat(workingFolder)
+	if err != nil {
+		s4.Log().Errorf("Error accessing working folder %v", err)
+		return nil, err
+	}
+	// note that the sqlite driver ensures that the database file exists; the
+	// working directory is left alone so relative paths given by the user
+	// still resolve
+	db, e := sql.Open("sqlite3", workingFolder+string(os.PathSeparator)+dbName)
+	if e != nil {
+		s4.Log().Errorf("Could not open database file %v", e)
+		return nil, e
+	}
+
+	return &OarsmanDB{odb: db}, nil
+}
+
+// OpenDatabaseReadOnly opens the database of the working folder for reading
+// only, e.g. the database of another profile, failing rather than creating
+// it when it does not exist
+func OpenDatabaseReadOnly(workingFolder string) (*OarsmanDB, error) {
+	path := filepath.Join(workingFolder, dbName)
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, e := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if e != nil {
+		s4.Log().Errorf("Could not open database file %v", e)
+		return nil, e
+	}
+
+	return &OarsmanDB{odb: db}, nil
+}
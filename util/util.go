@@ -1,8 +1,9 @@
 package util
 
 import (
-	jww "github.com/spf13/jwalterweatherman"
+	"fmt"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -15,14 +16,7 @@ func EnsureFolderExists(path string) error {
 		}
 	}
 
-	jww.INFO.Printf("Creating folder: %s\n", err)
-
-	err = os.MkdirAll(path, 0700)
-	if err != nil {
-		jww.ERROR.Println("Error creating folder", err)
-		return err
-	}
-	return nil
+	return os.MkdirAll(path, 0700)
 }
 
 func MillisToZulu(millis int64) string {
@@ -32,3 +26,45 @@ func MillisToZulu(millis int64) string {
 func MillisToZuluNano(millis int64) string {
 	return time.Unix(millis/1000, millis%1000*1000).UTC().Format(time.RFC3339Nano)
 }
+
+func SecondsToPace(seconds float64) string {
+	if seconds <= 0 {
+		return "-"
+	}
+	minutes := int(seconds) / 60
+	return fmt.Sprintf("%d:%04.1f", minutes, seconds-float64(minutes*60))
+}
+
+// LocalTimezone returns the IANA name of the local timezone, taken from the
+// TZ environment variable or the /etc/localtime link, or UTC if unknown
+func LocalTimezone() string {
+	if tz := strings.TrimPrefix(os.Getenv("TZ"), ":"); tz != "" {
+		if _, err := time.LoadLocation(tz); err == nil {
+			return tz
+		}
+	}
+	if name := time.Local.String(); name != "Local" {
+		return name
+	}
+	if target, err := os.Readlink("/etc/localtime"); err == nil {
+		if i := strings.Index(target, "zoneinfo/"); i >= 0 {
+			return target[i+len("zoneinfo/"):]
+		}
+	}
+	return "UTC"
+}
+
+// Location returns the location of an IANA timezone, UTC if the timezone is
+// empty or unknown
+func Location(timezone string) *time.Location {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// MillisToLocal formats the time as RFC3339 in the given IANA timezone
+func MillisToLocal(millis int64, timezone string) string {
+	return time.Unix(millis/1000, millis%1000*1000000).In(Location(timezone)).Format(time.RFC3339)
+}